@@ -66,6 +66,11 @@ Supported URI schemes:
     Format: s3://[bucket]/[path]
             aws:[profile]:s3://[bucket]/[path]
             [profile]:s3://[bucket]/[path]
+  walrus:
+    Used to access files on the walrus filesystem configured with the
+    "walrusfs:*" settings. Walrus has no hosts, the whole URI is the path.
+
+    Format: walrus://[path]
   wavefile:
     Used to retrieve blockfiles from the internal Wave filesystem.
 
@@ -95,6 +100,7 @@ func init() {
 
 	fileCmd.AddCommand(fileListCmd)
 	fileCmd.AddCommand(fileCatCmd)
+	fileWriteCmd.Flags().BoolP("force", "f", false, "overwrite an existing walrus file")
 	fileCmd.AddCommand(fileWriteCmd)
 	fileRmCmd.Flags().BoolP("recursive", "r", false, "remove directories recursively")
 	fileCmd.AddCommand(fileRmCmd)
@@ -102,6 +108,8 @@ func init() {
 	fileCmd.AddCommand(fileAppendCmd)
 	fileCpCmd.Flags().BoolP("merge", "m", false, "merge directories")
 	fileCpCmd.Flags().BoolP("force", "f", false, "force overwrite of existing files")
+	fileCpCmd.Flags().Bool("no-preserve-times", false, "give copied files the time of the copy instead of their modification times")
+	fileCpCmd.Flags().String("conflict", "", "what walrus copies do with existing files: fail, skip, overwrite or rename")
 	fileCmd.AddCommand(fileCpCmd)
 	fileMvCmd.Flags().BoolP("recursive", "r", false, "move directories recursively")
 	fileMvCmd.Flags().BoolP("force", "f", false, "force overwrite of existing files")
@@ -266,9 +274,14 @@ func fileWriteRun(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
 	fileData := wshrpc.FileData{
 		Info: &wshrpc.FileInfo{
-			Path: path}}
+			Path: path,
+			Opts: &wshrpc.FileOpts{Overwrite: force}}}
 
 	capability, err := wshclient.FileShareCapabilityCommand(RpcClient, fileData.Info.Path, &wshrpc.RpcOpts{Timeout: fileTimeout})
 	if err != nil {
@@ -398,6 +411,14 @@ func fileCpRun(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	noPreserveTimes, err := cmd.Flags().GetBool("no-preserve-times")
+	if err != nil {
+		return err
+	}
+	conflict, err := cmd.Flags().GetString("conflict")
+	if err != nil {
+		return err
+	}
 
 	srcPath, err := fixRelativePaths(src)
 	if err != nil {
@@ -409,7 +430,7 @@ func fileCpRun(cmd *cobra.Command, args []string) error {
 	}
 	log.Printf("Copying %s to %s; merge: %v, force: %v", srcPath, destPath, merge, force)
 	rpcOpts := &wshrpc.RpcOpts{Timeout: TimeoutYear}
-	err = wshclient.FileCopyCommand(RpcClient, wshrpc.CommandFileCopyData{SrcUri: srcPath, DestUri: destPath, Opts: &wshrpc.FileCopyOpts{Merge: merge, Overwrite: force, Timeout: TimeoutYear}}, rpcOpts)
+	err = wshclient.FileCopyCommand(RpcClient, wshrpc.CommandFileCopyData{SrcUri: srcPath, DestUri: destPath, Opts: &wshrpc.FileCopyOpts{Merge: merge, Overwrite: force, NoPreserveTimes: noPreserveTimes, ConflictPolicy: conflict, Timeout: TimeoutYear}}, rpcOpts)
 	if err != nil {
 		return fmt.Errorf("copying file: %w", err)
 	}
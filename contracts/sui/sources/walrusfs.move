@@ -1,4 +1,9 @@
 /// Module: walrusfs
+///
+/// The fields of FileObject and DirListObject and the parameters of add_file, add_chunked_file and insert_file
+/// changed after the first release. A sui package upgrade can't change them, so a package published before has to
+/// be published again instead of upgraded, with a new root object created by it. The Go client reads and writes
+/// only this layout, its Ping reports a package or root object of an older one.
 module walrusfs::walrusfs;
 
 use sui::tx_context::sender;
@@ -27,7 +32,23 @@ public struct FileObject has copy, store, drop {
 	tags: vector<String>,
 	size: u64,
 	walrus_blob_id: String,
+	// all blobs of a file stored in chunks, in order; empty if the file is the single blob walrus_blob_id
+	walrus_blob_ids: vector<String>,
+	// hex sha256 of the file content, empty for files added without one
+	content_sha256: String,
 	walrus_epoch_till: u64,
+	// whether the blobs were stored as deletable, so deleting the file can free their storage on walrus
+	deletable: bool,
+	// whether the publisher reported the blobs certified when they were uploaded, a file that isn't may not be
+	// readable from aggregators yet
+	certified: bool,
+	// whether the blobs hold the content encrypted on the client, only readers with its key can decrypt it
+	encrypted: bool,
+	// the algorithm the client compressed the content with before storing it, empty when it wasn't; size is the
+	// size of the content before compression
+	compression: String,
+	// the content type the client detected at upload, empty when it detected none
+	mime_type: String,
 }
 
 public struct DirObject has copy, store, drop {
@@ -43,6 +64,7 @@ const EPathError: u64 = 1;
 const EArenaMismatchError: u64 = 2;
 const EFileAlreadyExists: u64 = 3;
 const EDirectoryAlreadyExists: u64 = 4;
+const ENoBlobs: u64 = 5;
 
 public struct FileAlreadyExistsEvent has copy, drop {
 	path: String,
@@ -81,7 +103,14 @@ public struct DirListObject has copy, store, drop {
 	tags: vector<String>,
 	size: u64,
 	walrus_blob_id: String,
+	walrus_blob_ids: vector<String>,
+	content_sha256: String,
 	walrus_epoch_till: u64,
+	deletable: bool,
+	certified: bool,
+	encrypted: bool,
+	compression: String,
+	mime_type: String,
 }
 
 public struct DeleteEvent has copy, drop {
@@ -134,8 +163,26 @@ public fun update_epoch(walrusfsRoot: &mut WalrusfsRoot, current_epoch: u64, _ct
 
 public fun add_file(walrusfsRoot: &mut WalrusfsRoot, clock: &Clock, path: String, 
 							tags: vector<String>, size: u64, 
-							walrus_blob_id: String, end_epoch: u64,
-							overwrite: bool, _ctx: &mut TxContext) {
+							walrus_blob_id: String, content_sha256: String, end_epoch: u64,
+							deletable: bool, certified: bool, encrypted: bool, compression: String, mime_type: String, create_ts: u64, overwrite: bool, _ctx: &mut TxContext) {
+	insert_file(walrusfsRoot, clock, path, tags, size, walrus_blob_id, vector::empty(), content_sha256, end_epoch, deletable, certified, encrypted, compression, mime_type, create_ts, overwrite);
+}
+
+// add a file stored as several blobs, which are read back in the order given
+public fun add_chunked_file(walrusfsRoot: &mut WalrusfsRoot, clock: &Clock, path: String, 
+							tags: vector<String>, size: u64, 
+							walrus_blob_ids: vector<String>, content_sha256: String, end_epoch: u64,
+							deletable: bool, certified: bool, encrypted: bool, compression: String, mime_type: String, create_ts: u64, overwrite: bool, _ctx: &mut TxContext) {
+	assert!(walrus_blob_ids.length() > 0, ENoBlobs);
+	let walrus_blob_id = walrus_blob_ids[0];
+	insert_file(walrusfsRoot, clock, path, tags, size, walrus_blob_id, walrus_blob_ids, content_sha256, end_epoch, deletable, certified, encrypted, compression, mime_type, create_ts, overwrite);
+}
+
+// create_ts is the creation time to record in ms, such as the modification time of an uploaded file, 0 records the current time
+fun insert_file(walrusfsRoot: &mut WalrusfsRoot, clock: &Clock, path: String, 
+							tags: vector<String>, size: u64, 
+							walrus_blob_id: String, walrus_blob_ids: vector<String>, content_sha256: String,
+							end_epoch: u64, deletable: bool, certified: bool, encrypted: bool, compression: String, mime_type: String, create_ts: u64, overwrite: bool) {
 	let mut p = path;
 	let mut children = &walrusfsRoot.children_directories;
 	let mut child_id = 0u256;
@@ -190,13 +237,20 @@ public fun add_file(walrusfsRoot: &mut WalrusfsRoot, clock: &Clock, path: String
 
 	// add file
 	walrusfsRoot.obj_id = walrusfsRoot.obj_id + 1;
-	let now = clock.timestamp_ms();
+	let now = if (create_ts > 0) { create_ts } else { clock.timestamp_ms() };
 	vec_map::insert(&mut walrusfsRoot.file_arena, walrusfsRoot.obj_id, FileObject {
 												create_ts: now,
 												tags,
 												size,
 												walrus_blob_id,
+												walrus_blob_ids,
+												content_sha256,
 												walrus_epoch_till: end_epoch,
+												deletable,
+												certified,
+												encrypted,
+												compression,
+												mime_type,
 											});
 	vec_map::insert(children_files, p, walrusfsRoot.obj_id);
 	event::emit(FileAddedEvent {
@@ -330,7 +384,14 @@ public fun list_dir(walrusfsRoot: &WalrusfsRoot, path: String, _ctx: &mut TxCont
 			tags: d.tags,
 			size: 0u64,
 			walrus_blob_id: b"".to_string(),
+			walrus_blob_ids: vector::empty(),
+			content_sha256: b"".to_string(),
 			walrus_epoch_till: 0u64,
+			deletable: false,
+			certified: false,
+			encrypted: false,
+			compression: b"".to_string(),
+			mime_type: b"".to_string(),
 		});
 
 		i = i + 1;
@@ -348,7 +409,14 @@ public fun list_dir(walrusfsRoot: &WalrusfsRoot, path: String, _ctx: &mut TxCont
 			tags: f.tags,
 			size: f.size,
 			walrus_blob_id: f.walrus_blob_id,
+			walrus_blob_ids: f.walrus_blob_ids,
+			content_sha256: f.content_sha256,
 			walrus_epoch_till: f.walrus_epoch_till,
+			deletable: f.deletable,
+			certified: f.certified,
+			encrypted: f.encrypted,
+			compression: f.compression,
+			mime_type: f.mime_type,
 		});
 
 		i = i + 1;
@@ -407,7 +475,14 @@ public fun stat(walrusfsRoot: &WalrusfsRoot, path: String, _ctx: &mut TxContext)
 			tags: f.tags,
 			size: f.size,
 			walrus_blob_id: f.walrus_blob_id,
+			walrus_blob_ids: f.walrus_blob_ids,
+			content_sha256: f.content_sha256,
 			walrus_epoch_till: f.walrus_epoch_till,
+			deletable: f.deletable,
+			certified: f.certified,
+			encrypted: f.encrypted,
+			compression: f.compression,
+			mime_type: f.mime_type,
 		}
 	} else if (children.contains(&p)) {
 		let id = *children.get(&p);
@@ -419,7 +494,14 @@ public fun stat(walrusfsRoot: &WalrusfsRoot, path: String, _ctx: &mut TxContext)
 			tags: d.tags,
 			size: 0u64,
 			walrus_blob_id: b"".to_string(),
+			walrus_blob_ids: vector::empty(),
+			content_sha256: b"".to_string(),
 			walrus_epoch_till: 0u64,
+			deletable: false,
+			certified: false,
+			encrypted: false,
+			compression: b"".to_string(),
+			mime_type: b"".to_string(),
 		}
 	} else {
 		abort EPathError
@@ -598,6 +680,54 @@ public fun delete_file(walrusfsRoot: &mut WalrusfsRoot, path: String, _ctx: &mut
 	children_files.remove(&p);
 }
 
+public fun update_file_epoch(walrusfsRoot: &mut WalrusfsRoot, path: String, walrus_epoch_till: u64, _ctx: &mut TxContext) {
+	let mut p = path;
+	assert!(p.length() > 0, EPathError);
+
+	let slash = b"/".to_string();
+	// remove ending "/"
+	if (p.substring(p.length() - 1, p.length()) == &slash) {
+		p = p.substring(0, p.length() - 1);
+	};
+
+	let mut children = &walrusfsRoot.children_directories;
+	let mut child_id = 0u256;
+	while (true) {
+		let idx = p.index_of(&slash);
+		let len = p.length();
+
+		if (idx == len) {
+			// can't be here
+			break
+		} else if (idx == 0) {
+			// ignore trailing "/"
+			p = p.substring(1, len);
+		} else {
+			let subp = p.substring(0, idx);
+			// find the matching path
+			assert!(children.contains(&subp), EPathError);
+
+			child_id = *children.get(&subp);
+			assert!(walrusfsRoot.dir_arena.contains(&child_id), EArenaMismatchError);
+			children = &walrusfsRoot.dir_arena.get(&child_id).children_directories;
+
+			p = p.substring(idx + 1, len);
+		}		
+	};	
+	assert!(p.length() > 0, EPathError);
+
+	let mut children_files = &walrusfsRoot.children_files;
+	if (child_id != 0) {
+		children_files = &walrusfsRoot.dir_arena.get(&child_id).children_files;
+	};
+
+	assert!(children_files.contains(&p), EPathError);
+
+	let id = *children_files.get(&p);
+	assert!(walrusfsRoot.file_arena.contains(&id), EArenaMismatchError);
+	walrusfsRoot.file_arena.get_mut(&id).walrus_epoch_till = walrus_epoch_till;
+}
+
 fun recursive_get_dir_objs(walrusfsRoot: &WalrusfsRoot, id: u256): (VecSet<u256>, VecSet<u256>) {
 	let mut f_set: VecSet<u256> = vec_set::empty();
 	let mut d_set: VecSet<u256> = vec_set::empty();
@@ -38,7 +38,7 @@ import "./directorypreview.scss";
 const PageJumpSize = 20;
 
 const recursiveError = "recursive flag must be set for directory operations";
-const overwriteError = "set overwrite flag to delete the existing file";
+export const overwriteError = "set overwrite flag to delete the existing file";
 const mergeError = "set overwrite flag to delete the existing contents or set merge flag to merge the contents";
 
 declare module "@tanstack/react-table" {
@@ -30,7 +30,7 @@ import { OverlayScrollbarsComponent } from "overlayscrollbars-react";
 import { createRef, memo, useCallback, useEffect, useMemo } from "react";
 import { TransformComponent, TransformWrapper, useControls } from "react-zoom-pan-pinch";
 import { CSVView } from "./csvview";
-import { DirectoryPreview } from "./directorypreview";
+import { DirectoryPreview, overwriteError } from "./directorypreview";
 import "./preview.scss";
 
 const MaxFileSize = 1024 * 1024 * 10; // 10MB
@@ -624,11 +624,14 @@ export class PreviewModel implements ViewModel {
         await services.ObjectService.UpdateObjectMeta(blockOref, { ...blockMeta, edit });
     }
 
-    async handleFileSave() {
-        const filePath = await globalStore.get(this.statFilePath);
+    async handleFileSave(overwrite = false) {
+        const fileInfo = await globalStore.get(this.statFile);
+        const filePath = fileInfo?.path;
         if (filePath == null) {
             return;
         }
+        // saving back to the file that was loaded replaces it, only a file that didn't exist yet asks first
+        overwrite ||= !fileInfo.notfound;
         const newFileContent = globalStore.get(this.newFileContent);
         if (newFileContent == null) {
             console.log("not saving file, newFileContent is null");
@@ -638,6 +641,7 @@ export class PreviewModel implements ViewModel {
             await RpcApi.FileWriteCommand(TabRpcClient, {
                 info: {
                     path: await this.formatRemoteUri(filePath, globalStore.get),
+                    opts: { overwrite },
                 },
                 data64: stringToBase64(newFileContent),
             });
@@ -645,10 +649,26 @@ export class PreviewModel implements ViewModel {
             globalStore.set(this.newFileContent, null);
             console.log("saved file", filePath);
         } catch (e) {
-            const errorStatus: ErrorMsg = {
-                status: "Save Failed",
-                text: `${e}`,
-            };
+            const saveError = `${e}`;
+            let errorStatus: ErrorMsg;
+            if (!overwrite && saveError.includes(overwriteError)) {
+                errorStatus = {
+                    status: "Confirm Overwrite File",
+                    text: "Saving will replace the existing file. Would you like to continue?",
+                    level: "warning",
+                    buttons: [
+                        {
+                            text: "Overwrite",
+                            onClick: () => fireAndForget(() => this.handleFileSave(true)),
+                        },
+                    ],
+                };
+            } else {
+                errorStatus = {
+                    status: "Save Failed",
+                    text: saveError,
+                };
+            }
             globalStore.set(this.errorMsgAtom, errorStatus);
         }
     }
@@ -217,6 +217,14 @@ export class WaveAiModel implements ViewModel {
                         noAction: true,
                     });
                     break;
+                case "ollama":
+                    viewTextChildren.push({
+                        elemtype: "iconbutton",
+                        icon: "location-dot",
+                        title: `Using Ollama @ ${aiOpts.baseurl ?? "http://localhost:11434/v1"} (${aiOpts.model})`,
+                        noAction: true,
+                    });
+                    break;
                 default:
                     if (isCloud) {
                         viewTextChildren.push({
@@ -363,6 +371,7 @@ export class WaveAiModel implements ViewModel {
             const history = await this.fetchAiData();
             const beMsg: WaveAIStreamRequest = {
                 clientid: clientId,
+                blockid: this.blockId,
                 opts: opts,
                 prompt: [...history, newPrompt],
             };
@@ -213,6 +213,8 @@ declare global {
     // wshrpc.CommandRemoteListEntriesRtnData
     type CommandRemoteListEntriesRtnData = {
         fileinfo?: FileInfo[];
+        truncated?: boolean;
+        cursor?: string;
     };
 
     // wshrpc.CommandRemoteStreamFileData
@@ -390,6 +392,8 @@ declare global {
         recursive?: boolean;
         merge?: boolean;
         timeout?: number;
+        nopreservetimes?: boolean;
+        conflictpolicy?: string;
     };
 
     // wshrpc.FileData
@@ -429,6 +433,16 @@ declare global {
         mimetype?: string;
         readonly?: boolean;
         walrus_blob_id?: string;
+        walrus_blob_ids?: string[];
+        content_sha256?: string;
+        walrus_epoch_till?: number;
+        walrus_epochs_left?: number;
+        walrus_expiring?: boolean;
+        walrus_deletable?: boolean;
+        walrus_certified?: boolean;
+        walrus_encrypted?: boolean;
+        walrus_compression?: string;
+        tags?: string[];
     };
 
     // wshrpc.FileListData
@@ -442,6 +456,11 @@ declare global {
         all?: boolean;
         offset?: number;
         limit?: number;
+        cursor?: string;
+        recursive?: boolean;
+        sortby?: string;
+        sortdesc?: boolean;
+        dirsfirst?: boolean;
     };
 
     // wshrpc.FileOpts
@@ -452,6 +471,7 @@ declare global {
         ijsonbudget?: number;
         truncate?: boolean;
         append?: boolean;
+        overwrite?: boolean;
     };
 
     // wshrpc.FileShareCapability
@@ -695,6 +715,8 @@ declare global {
         "ai:timeoutms"?: number;
         "ai:fontsize"?: number;
         "ai:fixedfontsize"?: number;
+        "ai:walrusprompt"?: boolean;
+        "ai:walrusprompttext"?: string;
         "term:*"?: boolean;
         "term:fontsize"?: number;
         "term:fontfamily"?: string;
@@ -758,6 +780,36 @@ declare global {
         "walrusfs:aggregator"?: string;
         "walrusfs:wallet"?: string;
         "walrusfs:mnemonic"?: string;
+        "walrusfs:rpcurl"?: string;
+        "walrusfs:storageepochs"?: number;
+        "walrusfs:expirywarnepochs"?: number;
+        "walrusfs:httptimeoutms"?: number;
+        "walrusfs:publishers"?: string[];
+        "walrusfs:txretrymaxattempts"?: number;
+        "walrusfs:txretrybasedelayms"?: number;
+        "walrusfs:txretryjitter"?: number;
+        "walrusfs:cachettlms"?: number;
+        "walrusfs:copyconcurrency"?: number;
+        "walrusfs:prefetchdepth"?: number;
+        "walrusfs:uploadbytespersec"?: number;
+        "walrusfs:downloadbytespersec"?: number;
+        "walrusfs:chunksizemb"?: number;
+        "walrusfs:gasbudget"?: number;
+        "walrusfs:mnemonicsource"?: string;
+        "walrusfs:loglevel"?: string;
+        "walrusfs:stakingobject"?: string;
+        "walrusfs:systemobject"?: string;
+        "walrusfs:deletable"?: boolean;
+        "walrusfs:verifyupload"?: boolean;
+        "walrusfs:verifyaggregators"?: string[];
+        "walrusfs:dedupuploads"?: boolean;
+        "walrusfs:readonly"?: boolean;
+        "walrusfs:encryptionkey"?: string;
+        "walrusfs:compression"?: string;
+        "walrusfs:gasprice"?: number;
+        "walrusfs:maxuploadsizemb"?: number;
+        "walrusfs:waitfinality"?: boolean;
+        "walrusfs:roots"?: {[key: string]: string};
     };
 
     // waveobj.StickerClickOptsType
@@ -837,6 +889,9 @@ declare global {
         "wsh:cmd"?: string;
         "wsh:haderror"?: boolean;
         "conn:conntype"?: string;
+        "walrus:direction"?: "local->walrus" | "walrus->local" | "walrus->walrus";
+        "walrus:files"?: number;
+        "walrus:bytes"?: number;
         "display:height"?: number;
         "display:width"?: number;
         "display:dpr"?: number;
@@ -1202,6 +1257,7 @@ declare global {
     // wshrpc.WaveAIStreamRequest
     type WaveAIStreamRequest = {
         clientid?: string;
+        blockid?: string;
         opts: WaveAIOptsType;
         prompt: WaveAIPromptMessageType[];
     };
@@ -45,6 +45,10 @@ func (c *Connection) GetType() string {
 }
 
 func (c *Connection) GetPathWithHost() string {
+	if c.Scheme == ConnectionTypeWalrus {
+		// the host of a walrus connection isn't part of its uri
+		return strings.TrimPrefix(c.Path, "/")
+	}
 	if c.Host == "" {
 		return ""
 	}
@@ -146,6 +150,11 @@ func ParseURI(uri string) (*Connection, error) {
 		}
 	} else if scheme == ConnectionTypeWsh {
 		parseWshPath()
+	} else if scheme == ConnectionTypeWalrus {
+		// walrus has no hosts, everything after the scheme is the path. It lives next to the local connection, like the
+		// walrus paths nested in wsh uris
+		host = wshrpc.LocalConnName
+		remotePath = "/" + strings.TrimPrefix(rest, "/")
 	} else {
 		parseGenericPath()
 	}
@@ -481,3 +481,35 @@ func TestParseURI_S3BucketOnly(t *testing.T) {
 	t.Log("Testing with trailing slash")
 	testUri("profile:s3://bucket/", "/", "bucket/")
 }
+
+func TestParseURI_Walrus(t *testing.T) {
+	t.Parallel()
+
+	testUri := func(cstr string, pathExpected string, fullUriExpected string) {
+		c, err := connparse.ParseURI(cstr)
+		if err != nil {
+			t.Fatalf("failed to parse URI: %v", err)
+		}
+		if c.Path != pathExpected {
+			t.Fatalf("expected path to be %q, got %q", pathExpected, c.Path)
+		}
+		if c.Host != "local" {
+			t.Fatalf("expected host to be \"local\", got %q", c.Host)
+		}
+		if c.GetType() != "walrus" {
+			t.Fatalf("expected conn type to be \"walrus\", got %q", c.GetType())
+		}
+		if fullUri := c.GetFullURI(); fullUri != fullUriExpected {
+			t.Fatalf("expected full URI to be %q, got %q", fullUriExpected, fullUri)
+		}
+	}
+
+	t.Log("Testing a directory")
+	testUri("walrus://dir", "/dir", "walrus://dir")
+	t.Log("Testing a nested path with trailing slash")
+	testUri("walrus://dir/sub/", "/dir/sub/", "walrus://dir/sub/")
+	t.Log("Testing the root")
+	testUri("walrus://", "/", "walrus://")
+	t.Log("Testing an absolute path")
+	testUri("walrus:///dir/file.txt", "/dir/file.txt", "walrus://dir/file.txt")
+}
@@ -2,204 +2,980 @@ package fileop
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
 	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fstype"
 	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/walrusfs"
-	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/telemetry"
+	"github.com/wavetermdev/waveterm/pkg/telemetry/telemetrydata"
+	"github.com/wavetermdev/waveterm/pkg/util/fileutil"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 )
 
-func copyDirToWalrus(walrus *walrusfs.WalrusClient, destpath string, finfo fs.FileInfo, srcFile string) error {
+// actions of a copy plan
+const (
+	PlanMkdir    = "mkdir"
+	PlanUpload   = "upload"
+	PlanDownload = "download"
+	// PlanCopy records an existing walrus file at another walrus path, nothing is uploaded
+	PlanCopy = "copy"
+	// PlanMove moves a walrus file to another walrus path
+	PlanMove   = "move"
+	PlanDelete = "delete"
+	// PlanConflict is a destination that already exists and may not be overwritten, the copy fails on it
+	PlanConflict = "conflict"
+	// PlanSkip is a destination that already exists and is left alone under walrusfs.ConflictSkip
+	PlanSkip = "skip"
+)
+
+// CopyPlanEntry is one action of a file operation on walrus
+type CopyPlanEntry struct {
+	Action string `json:"action"`
+	Src    string `json:"src,omitempty"`
+	Dst    string `json:"dst,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+}
+
+func (e CopyPlanEntry) String() string {
+	switch e.Action {
+	case PlanMkdir:
+		return fmt.Sprintf("mkdir %s", e.Dst)
+	case PlanDelete:
+		return fmt.Sprintf("delete %s", e.Src)
+	case PlanConflict:
+		return fmt.Sprintf("conflict %s already exists", e.Dst)
+	case PlanSkip:
+		return fmt.Sprintf("skip %s, it already exists", e.Dst)
+	default:
+		return fmt.Sprintf("%s %s -> %s (%d bytes)", e.Action, e.Src, e.Dst, e.Size)
+	}
+}
+
+func copyDirToWalrus(ctx context.Context, walrus *walrusfs.WalrusClient, destpath string, finfo fs.FileInfo, srcFile string, dryRun bool) ([]CopyPlanEntry, error) {
 	conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath}
-	nextinfo, err := walrus.Stat(context.Background(), conn)
+	exists, err := walrus.Exists(ctx, conn)
 	if err != nil {
-		return fmt.Errorf("cannot stat %q: %w", destpath, err)
+		return nil, fmt.Errorf("cannot stat %q: %w", destpath, err)
+	}
+	if exists {
+		return nil, nil
 	}
-	if nextinfo.NotFound {
-		// try creating the dir
-		err = walrus.Mkdir(context.Background(), conn)
+
+	if !dryRun {
+		// the parents of a deep destination may not exist yet either
+		err = walrus.MkdirAll(ctx, conn)
 		if err != nil {
-			return fmt.Errorf("cannot mkdir %q: %w", destpath, err)
+			return nil, fmt.Errorf("cannot mkdir %q: %w", destpath, err)
 		}
 	}
-
-	return nil
+	return []CopyPlanEntry{{Action: PlanMkdir, Src: srcFile, Dst: destpath}}, nil
 }
 
-func copyFileToWalrus(walrus *walrusfs.WalrusClient, destpath string, finfo fs.FileInfo, srcFile string, overwrite bool) error {
+// copyFileToWalrus uploads the local srcFile to destpath, or into it when it is a directory. A destination that
+// exists is handled by policy
+func copyFileToWalrus(ctx context.Context, walrus *walrusfs.WalrusClient, destpath string, finfo fs.FileInfo, srcFile string, policy walrusfs.ConflictPolicy, dryRun bool) ([]CopyPlanEntry, error) {
 	conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath}
-	nextinfo, err := walrus.Stat(context.Background(), conn)
+	destinfo, err := walrus.Stat(ctx, conn)
 	if err != nil {
-		return fmt.Errorf("cannot stat %q: %w", destpath, err)
+		return nil, fmt.Errorf("cannot stat %q: %w", destpath, err)
 	}
-	/*
-		else if nextinfo.NotFound && !finfo.IsDir() {
-			// file copy to existing dir - parent folder not existing
-			return 0, fmt.Errorf("path error")
+	exists := !destinfo.NotFound
+	if destinfo.IsDir {
+		// copy into the existing directory
+		destpath = filepath.Join(destpath, filepath.Base(finfo.Name()))
+		conn.Path = destpath
+		exists, err = walrus.Exists(ctx, conn)
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat file %q: %w", destpath, err)
 		}
-	*/
-
-	if nextinfo != nil {
-		if nextinfo.IsDir {
-			// file copy to existing dir
-			// try to create file in directory
-			destpath = filepath.Join(destpath, filepath.Base(finfo.Name()))
-			conn.Path = destpath
-			newdestinfo, err := walrus.Stat(context.Background(), conn)
-			if err != nil {
-				return fmt.Errorf("cannot stat file %q: %w", destpath, err)
-			}
-			if !newdestinfo.NotFound && !overwrite {
-				return fmt.Errorf(fstype.OverwriteRequiredError, destpath)
-			}
-		} else {
-			// file copy
-			if !nextinfo.NotFound {
-				if !overwrite {
-					return fmt.Errorf(fstype.OverwriteRequiredError, destpath)
-				}
-			}
+	}
+	if exists && policy == walrusfs.ConflictFail {
+		if dryRun {
+			// keep planning so every conflict is reported at once
+			return []CopyPlanEntry{{Action: PlanConflict, Src: srcFile, Dst: destpath}}, nil
 		}
+		return nil, fmt.Errorf(fstype.OverwriteRequiredError, destpath)
+	}
+	if exists {
+		target, skip, err := policy.ResolveConflict(destpath, func(candidate string) (bool, error) {
+			return walrus.Exists(ctx, &connparse.Connection{Scheme: "walrus", Host: "local", Path: candidate})
+		}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve the conflict at %q: %w", destpath, err)
+		}
+		if skip {
+			return []CopyPlanEntry{{Action: PlanSkip, Src: srcFile, Dst: destpath}}, nil
+		}
+		destpath = target
+		conn.Path = target
 	}
 
-	err = walrus.Mkfile(context.Background(), srcFile, conn.Path, overwrite)
-	if err != nil {
-		return fmt.Errorf("cannot create walrus file %q: %w", destpath, err)
+	if !dryRun {
+		err = walrus.Mkfile(ctx, srcFile, conn.Path, nil, policy == walrusfs.ConflictOverwrite, 0)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create walrus file %q: %w", destpath, err)
+		}
 	}
 
-	return nil
+	return []CopyPlanEntry{{Action: PlanUpload, Src: srcFile, Dst: destpath, Size: finfo.Size()}}, nil
 }
 
-func CopyLocalToWalrus(srcpath string, destpath string) error {
-	walrus := walrusfs.NewWalrusClient()
+// CopyLocalToWalrus copies a local file or directory to walrus, returning the actions taken. A dry run does the same
+// checks but doesn't create or upload anything, it returns the actions the copy would take. Like rsync, a source
+// directory is copied into destpath as a directory of the same name unless contents is set, which copies what is
+// inside it instead. A trailing slash on destpath means it is a directory; see localCopyDest for every case.
+// policy decides what happens to each file that already exists on walrus
+func CopyLocalToWalrus(ctx context.Context, srcpath string, destpath string, contents bool, policy walrusfs.ConflictPolicy, dryRun bool) ([]CopyPlanEntry, error) {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
 
-	srcPathCleaned := filepath.Clean(wavebase.ExpandHomeDirSafe(srcpath))
+	srcPathCleaned := localPath(srcpath)
 
 	srcFileStat, err := os.Stat(srcPathCleaned)
 	if err != nil {
-		return fmt.Errorf("cannot stat %q: %w", srcPathCleaned, err)
+		return nil, fmt.Errorf("cannot stat %q: %w", srcPathCleaned, err)
 	}
 
-	fi, err := walrus.Stat(context.Background(), &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath})
+	fi, err := walrus.Stat(ctx, &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath})
 	if err != nil {
-		return fmt.Errorf("cannot stat walrus %q: %w", destpath, err)
+		return nil, fmt.Errorf("cannot stat walrus %q: %w", destpath, err)
+	}
+	target, err := localCopyDest(srcPathCleaned, srcFileStat.IsDir(), destpath, fi, contents)
+	if err != nil {
+		return nil, fmt.Errorf("cannot copy %q to %q: %w", srcpath, destpath, err)
 	}
-	destIsDir := fi.IsDir
 
-	if srcFileStat.IsDir() {
-		var srcPathPrefix string
-		if destIsDir {
-			srcPathPrefix = filepath.Dir(srcPathCleaned)
-		} else {
-			srcPathPrefix = srcPathCleaned
+	var plan []CopyPlanEntry
+	if fi.NotFound && target != path.Clean(destpath) {
+		// the copy goes inside destpath, which has to be created first
+		plan, err = copyDirToWalrus(ctx, walrus, path.Clean(destpath), srcFileStat, srcPathCleaned, dryRun)
+		if err != nil {
+			return nil, err
 		}
-		err = filepath.Walk(srcPathCleaned, func(path string, info fs.FileInfo, err error) error {
+	}
+
+	if srcFileStat.IsDir() {
+		err = filepath.Walk(srcPathCleaned, func(srcFilePath string, info fs.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			srcFilePath := path
-			destFilePath := filepath.Join(destpath, strings.TrimPrefix(path, srcPathPrefix))
-			var file *os.File
-			if !info.IsDir() {
-				file, err = os.Open(srcFilePath)
-				if err != nil {
-					return fmt.Errorf("cannot open file %q: %w", srcFilePath, err)
-				}
-				defer utilfn.GracefulClose(file, "RemoteFileCopyCommand", srcFilePath)
+			rel, err := filepath.Rel(srcPathCleaned, srcFilePath)
+			if err != nil {
+				return err
 			}
+			destFilePath := path.Join(target, filepath.ToSlash(rel))
 
+			var entries []CopyPlanEntry
 			if info.IsDir() {
-				err = copyDirToWalrus(walrus, destFilePath, info, srcFilePath)
+				entries, err = copyDirToWalrus(ctx, walrus, destFilePath, info, srcFilePath, dryRun)
 			} else {
-				err = copyFileToWalrus(walrus, destFilePath, info, srcFilePath, false)
+				entries, err = copyFileToWalrus(ctx, walrus, destFilePath, info, srcFilePath, policy, dryRun)
 			}
+			plan = append(plan, entries...)
 			return err
 		})
 		if err != nil {
-			return fmt.Errorf("cannot copy %q to %q: %w", srcpath, destpath, err)
+			return nil, fmt.Errorf("cannot copy %q to %q: %w", srcpath, destpath, err)
 		}
 	} else {
 		// local file -> walrus
-		file, err := os.Open(srcPathCleaned)
+		entries, err := copyFileToWalrus(ctx, walrus, target, srcFileStat, srcPathCleaned, policy, dryRun)
 		if err != nil {
-			return fmt.Errorf("cannot open file %q: %w", srcPathCleaned, err)
-		}
-		defer utilfn.GracefulClose(file, "RemoteFileCopyCommand", srcPathCleaned)
-		/*
-			var destFilePath string
-			if destHasSlash {
-				destFilePath = filepath.Join(destPathCleaned, filepath.Base(srcPathCleaned))
-			} else {
-				destFilePath = destPathCleaned
-			}
-		*/
-		destFilePath := destpath
-		err = copyFileToWalrus(walrus, destFilePath, srcFileStat, srcPathCleaned, false)
-		if err != nil {
-			return fmt.Errorf("cannot copy %q to %q: %w", srcpath, destpath, err)
+			return nil, fmt.Errorf("cannot copy %q to %q: %w", srcpath, destpath, err)
 		}
+		plan = append(plan, entries...)
 	}
 
-	return nil
+	return plan, nil
+}
+
+// localCopyDest returns the walrus path CopyLocalToWalrus copies the local srcpath to, the path of the file or of
+// the directory whose contents are the contents of the source directory. dest is the stat of destpath:
+//
+//	source     destpath                   result
+//	file       missing                    destpath
+//	file       missing, trailing slash    destpath/name, destpath is created
+//	file       existing file              destpath, which has to be overwritable
+//	file       existing file, slash       error
+//	file       existing directory         destpath/name
+//	directory  missing                    destpath/name, destpath is created
+//	directory  missing, contents          destpath
+//	directory  existing directory         destpath/name
+//	directory  existing dir, contents     destpath, merged with what is there
+//	directory  existing file              error
+//
+// where name is the base name of srcpath. contents makes no difference to a source file
+func localCopyDest(srcpath string, srcIsDir bool, destpath string, dest *wshrpc.FileInfo, contents bool) (string, error) {
+	destHasSlash := strings.HasSuffix(destpath, "/")
+	destpath = path.Clean(destpath)
+	name := filepath.Base(srcpath)
+	switch {
+	case !dest.NotFound && !dest.IsDir:
+		if srcIsDir {
+			return "", fmt.Errorf("cannot copy a directory onto the walrus file %q", destpath)
+		}
+		if destHasSlash {
+			return "", fmt.Errorf("walrus %q is a file, not a directory", destpath)
+		}
+		return destpath, nil
+	case srcIsDir && contents:
+		return destpath, nil
+	case srcIsDir || dest.IsDir || destHasSlash:
+		return path.Join(destpath, name), nil
+	default:
+		return destpath, nil
+	}
 }
 
-func CopyWalrusToLocal(srcpath string, destpath string) error {
-	walrus := walrusfs.NewWalrusClient()
+// CopyWalrusToLocal copies a walrus file or directory into the local directory destpath and returns the downloads
+// made. A dry run only checks the source and destination and returns the downloads the copy would make. policy
+// decides what happens to each local file that already exists, the downloads returned don't tell those apart
+func CopyWalrusToLocal(ctx context.Context, srcpath string, destpath string, policy walrusfs.ConflictPolicy, dryRun bool) ([]CopyPlanEntry, error) {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
 
 	src := &connparse.Connection{Scheme: "walrus", Host: "local", Path: srcpath}
 	dst := &connparse.Connection{Scheme: "wsh", Host: "local", Path: destpath}
 
-	_, err := walrus.CopyInternal(context.Background(), src, dst, nil)
-	return err
+	fi, err := walrus.Stat(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat walrus %q: %w", srcpath, err)
+	}
+	if fi.NotFound {
+		return nil, fmt.Errorf("walrus path not found: %q", srcpath)
+	}
+	localDir, err := fileutil.FixPath(destpath)
+	if err != nil {
+		return nil, err
+	}
+	target := filepath.Join(localDir, path.Base(strings.TrimSuffix(srcpath, "/")))
+	if dryRun && policy == walrusfs.ConflictFail {
+		if _, err := os.Stat(target); err == nil {
+			return []CopyPlanEntry{{Action: PlanConflict, Src: srcpath, Dst: target}}, nil
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("cannot stat %q: %w", target, err)
+		}
+	}
+
+	plan, err := walrusPlan(ctx, walrus, srcpath, fi, target, PlanDownload, true)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	if _, err := walrus.CopyInternal(ctx, src, dst, &wshrpc.FileCopyOpts{ConflictPolicy: string(policy)}); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// walrusPlan lists the walrus file or directory fi at srcpath as the entries that put it at target, files get action
+// and directories PlanMkdir. A local target is joined with local path separators
+func walrusPlan(ctx context.Context, walrus *walrusfs.WalrusClient, srcpath string, fi *wshrpc.FileInfo, target string, action string, local bool) ([]CopyPlanEntry, error) {
+	if !fi.IsDir {
+		return []CopyPlanEntry{{Action: action, Src: srcpath, Dst: target, Size: fi.Size}}, nil
+	}
+
+	plan := []CopyPlanEntry{{Action: PlanMkdir, Src: srcpath, Dst: target}}
+	src := &connparse.Connection{Scheme: "walrus", Host: "local", Path: srcpath}
+	err := walrus.Walk(ctx, src, func(info *wshrpc.FileInfo) error {
+		rel := strings.TrimPrefix(strings.TrimPrefix(info.Path, strings.TrimSuffix(srcpath, "/")), "/")
+		dst := path.Join(target, rel)
+		if local {
+			dst = filepath.Join(target, filepath.FromSlash(rel))
+		}
+		entry := CopyPlanEntry{Action: action, Src: info.Path, Dst: dst, Size: info.Size}
+		if info.IsDir {
+			entry.Action = PlanMkdir
+			entry.Size = 0
+		}
+		plan = append(plan, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list walrus %q: %w", srcpath, err)
+	}
+	return plan, nil
+}
+
+// walrusPath strips the walrus:// prefix from p and makes the path absolute
+func walrusPath(p string) string {
+	p = strings.TrimPrefix(p, "walrus://")
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
+}
+
+// walrusURI is the inverse of walrusPath
+func walrusURI(p string) string {
+	return "walrus://" + strings.TrimPrefix(p, "/")
+}
+
+// localPath resolves a local path the way the copies do, expanding ~
+func localPath(p string) string {
+	return filepath.Clean(wavebase.ExpandHomeDirSafe(p))
+}
+
+// walrusTarget is where a walrus copy or move of srcpath to destpath ends up, inside destpath when it is an existing
+// directory
+func walrusTarget(ctx context.Context, walrus *walrusfs.WalrusClient, srcpath string, destpath string) (string, error) {
+	destpath = strings.TrimSuffix(destpath, "/")
+	fi, err := walrus.Stat(ctx, &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath})
+	if err != nil {
+		return "", fmt.Errorf("cannot stat walrus %q: %w", destpath, err)
+	}
+	if fi.IsDir {
+		return path.Join(destpath, path.Base(strings.TrimSuffix(srcpath, "/"))), nil
+	}
+	return destpath, nil
+}
+
+// statWalrusSource stats the source of a walrus operation, which has to exist
+func statWalrusSource(ctx context.Context, walrus *walrusfs.WalrusClient, srcpath string) (*wshrpc.FileInfo, error) {
+	fi, err := walrus.Stat(ctx, &connparse.Connection{Scheme: "walrus", Host: "local", Path: srcpath})
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat walrus %q: %w", srcpath, err)
+	}
+	if fi.NotFound {
+		return nil, fmt.Errorf("walrus path not found: %q", srcpath)
+	}
+	return fi, nil
+}
+
+// CopyWalrus copies a walrus file or directory to another walrus path and returns the entries recorded. The copy
+// records the existing blobs at the destination, nothing is uploaded again. policy decides what happens to each
+// destination file that already exists
+func CopyWalrus(ctx context.Context, srcpath string, destpath string, policy walrusfs.ConflictPolicy) ([]CopyPlanEntry, error) {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
+
+	fi, err := statWalrusSource(ctx, walrus, srcpath)
+	if err != nil {
+		return nil, err
+	}
+	target, err := walrusTarget(ctx, walrus, srcpath, destpath)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := walrusPlan(ctx, walrus, srcpath, fi, target, PlanCopy, false)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &connparse.Connection{Scheme: "walrus", Host: "local", Path: srcpath}
+	dst := &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath}
+
+	if _, err = walrus.CopyInternal(ctx, src, dst, &wshrpc.FileCopyOpts{ConflictPolicy: string(policy)}); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// MoveWalrus moves a walrus file or directory to another walrus path and returns the entries moved
+func MoveWalrus(ctx context.Context, srcpath string, destpath string) ([]CopyPlanEntry, error) {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
+
+	fi, err := statWalrusSource(ctx, walrus, srcpath)
+	if err != nil {
+		return nil, err
+	}
+	// like a copy, the move goes into an existing destination directory
+	target, err := walrusTarget(ctx, walrus, srcpath, destpath)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := walrusPlan(ctx, walrus, srcpath, fi, target, PlanMove, false)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &connparse.Connection{Scheme: "walrus", Host: "local", Path: srcpath}
+	dst := &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath}
+
+	if err := walrus.MoveInternal(ctx, src, dst, nil); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// MoveLocalToWalrus moves a local file to walrus and returns the actions taken. The local file is only deleted once
+// walrus serves the upload with its size and sha256, directories aren't moved
+func MoveLocalToWalrus(ctx context.Context, srcpath string, destpath string) ([]CopyPlanEntry, error) {
+	srcPathCleaned := localPath(srcpath)
+	if err := checkLocalMoveSource(srcPathCleaned); err != nil {
+		return nil, err
+	}
+	plan, err := CopyLocalToWalrus(ctx, srcpath, destpath, false, walrusfs.ConflictFail, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyLocalUpload(ctx, srcPathCleaned, plan); err != nil {
+		return nil, fmt.Errorf("copied %q to walrus but kept it, the copy can't be verified: %w", srcPathCleaned, err)
+	}
+	if err := os.Remove(srcPathCleaned); err != nil {
+		return nil, fmt.Errorf("cannot remove %q after copying: %w", srcPathCleaned, err)
+	}
+	return plan, nil
+}
+
+// checkLocalMoveSource refuses local paths a move may not delete, anything but a regular file and the home or root
+// directory
+func checkLocalMoveSource(p string) error {
+	if p == filepath.Dir(p) || p == filepath.Clean(wavebase.GetHomeDir()) {
+		return fmt.Errorf("cannot move %q, it is the home or root directory", p)
+	}
+	info, err := os.Lstat(p)
+	if err != nil {
+		return fmt.Errorf("cannot stat %q: %w", p, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cannot move %q, only files can be moved between walrus and the local filesystem, copy it instead", p)
+	}
+	return nil
 }
 
-func FileOperation(s string) (string, error) {
+// verifyLocalUpload checks walrus serves the upload of the local file p in plan with the size and sha256 p has now
+func verifyLocalUpload(ctx context.Context, p string, plan []CopyPlanEntry) error {
+	if len(plan) == 0 || plan[len(plan)-1].Action != PlanUpload {
+		return fmt.Errorf("%q was not uploaded", p)
+	}
+	size, sum, err := hashLocalFile(p)
+	if err != nil {
+		return err
+	}
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return err
+	}
+	defer walrus.Close()
+	dst := plan[len(plan)-1].Dst
+	manifest, err := walrus.UploadManifest(ctx, []string{dst})
+	if err != nil {
+		return err
+	}
+	if len(manifest.Files) != 1 || manifest.Files[0].Size != size || !strings.EqualFold(manifest.Files[0].ContentSha256, sum) {
+		return fmt.Errorf("walrus %q doesn't record the size and sha256 of %q", dst, p)
+	}
+	failed, err := walrus.Verify(ctx, manifest)
+	if err != nil {
+		return err
+	}
+	return failed[dst]
+}
+
+// hashLocalFile returns the size and hex sha256 of the local file p
+func hashLocalFile(p string) (int64, string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("cannot read %q: %w", p, err)
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MoveWalrusToLocal moves a walrus file into the local directory destpath and returns the download made. The walrus
+// file is only deleted once the local copy has its size and sha256, directories aren't moved
+func MoveWalrusToLocal(ctx context.Context, srcpath string, destpath string) ([]CopyPlanEntry, error) {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
+	fi, err := statWalrusSource(ctx, walrus, srcpath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir {
+		return nil, fmt.Errorf("cannot move walrus %q, only files can be moved between walrus and the local filesystem, copy it instead", srcpath)
+	}
+	if fi.ContentSha256 == "" {
+		return nil, fmt.Errorf("cannot move walrus %q, it has no sha256 to verify the download with, copy it instead", srcpath)
+	}
+
+	plan, err := CopyWalrusToLocal(ctx, srcpath, destpath, walrusfs.ConflictFail, false)
+	if err != nil {
+		return nil, err
+	}
+	target := plan[0].Dst
+	size, sum, err := hashLocalFile(target)
+	if err != nil {
+		return nil, fmt.Errorf("copied walrus %q but kept it, the copy can't be verified: %w", srcpath, err)
+	}
+	if size != fi.Size || !strings.EqualFold(sum, fi.ContentSha256) {
+		return nil, fmt.Errorf("copied walrus %q but kept it, %q doesn't have its size and sha256", srcpath, target)
+	}
+	err = walrus.Delete(ctx, &connparse.Connection{Scheme: "walrus", Host: "local", Path: srcpath}, false)
+	if err != nil {
+		return nil, fmt.Errorf("cannot remove walrus %q after copying: %w", srcpath, err)
+	}
+	return plan, nil
+}
+
+// DeleteWalrus deletes a walrus file or directory and returns the entries deleted
+func DeleteWalrus(ctx context.Context, path string) ([]CopyPlanEntry, error) {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
+
+	fi, err := statWalrusSource(ctx, walrus, path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := walrusPlan(ctx, walrus, path, fi, "", PlanDelete, false)
+	if err != nil {
+		return nil, err
+	}
+	// nothing is created by a delete, only the files deleted are reported
+	var plan []CopyPlanEntry
+	for _, entry := range entries {
+		if entry.Action == PlanDelete {
+			plan = append(plan, CopyPlanEntry{Action: PlanDelete, Src: entry.Src, Size: entry.Size})
+		}
+	}
+
+	conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: path}
+	if err := walrus.Delete(ctx, conn, fi.IsDir); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// writeUploadManifest writes the upload manifest of the files a copy uploaded to the local file manifestPath, as
+// json that VerifyUploadManifest checks
+func writeUploadManifest(ctx context.Context, manifestPath string, plan []CopyPlanEntry) error {
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return err
+	}
+	defer walrus.Close()
+
+	var paths []string
+	for _, entry := range plan {
+		if entry.Action == PlanUpload {
+			paths = append(paths, entry.Dst)
+		}
+	}
+	manifest, err := walrus.UploadManifest(ctx, paths)
+	if err != nil {
+		return fmt.Errorf("cannot make the upload manifest: %w", err)
+	}
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot make the upload manifest: %w", err)
+	}
+	if err := os.WriteFile(manifestPath, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write the upload manifest: %w", err)
+	}
+	return nil
+}
+
+// VerifyUploadManifest reads the upload manifest a copy wrote to the local file manifestPath and checks walrus still
+// serves every file in it as it was uploaded. The files that fail are returned with their error by walrus path
+func VerifyUploadManifest(ctx context.Context, manifestPath string) (map[string]error, error) {
+	b, err := os.ReadFile(localPath(manifestPath))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read upload manifest: %w", err)
+	}
+	var manifest walrusfs.UploadManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("cannot parse upload manifest %q: %w", manifestPath, err)
+	}
+	walrus, err := walrusfs.NewWalrusClient()
+	if err != nil {
+		return nil, err
+	}
+	defer walrus.Close()
+	return walrus.Verify(ctx, &manifest)
+}
+
+// FileOperationResult is what a file operation did, or for a dry run what it would do. It marshals to json for
+// callers that want more than the chat message String renders
+type FileOperationResult struct {
+	Operation string `json:"operation"`
+	// Src and Dst are the resolved paths, walrus ones as walrus:// uris and local ones absolute
+	Src    string `json:"src"`
+	Dst    string `json:"dst,omitempty"`
+	DryRun bool   `json:"dryrun,omitempty"`
+	// Files and Bytes count the files copied, moved or deleted
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Skipped counts the files left alone because they already existed
+	Skipped int `json:"skipped,omitempty"`
+	// Created are the destination paths of the files and directories written
+	Created []string `json:"created,omitempty"`
+	// TxDigests are the sui transactions the operation executed, in order
+	TxDigests []string `json:"txdigests,omitempty"`
+	// GasUsed is what the transactions cost in MIST, less the storage rebates they earned
+	GasUsed int64 `json:"gasused,omitempty"`
+	// Plan is only set for dry runs
+	Plan []CopyPlanEntry `json:"plan,omitempty"`
+	// Manifest is the local file the upload manifest of a copy was written to
+	Manifest string `json:"manifest,omitempty"`
+}
+
+func makeFileOperationResult(operation string, src string, dst string, dryRun bool, plan []CopyPlanEntry, txDigests []string) *FileOperationResult {
+	rtn := &FileOperationResult{Operation: operation, Src: src, Dst: dst, DryRun: dryRun, TxDigests: txDigests}
+	if dryRun {
+		rtn.Plan = plan
+	}
+	for _, entry := range plan {
+		if entry.Action == PlanConflict {
+			continue
+		}
+		if entry.Action == PlanSkip {
+			rtn.Skipped++
+			continue
+		}
+		if entry.Action != PlanMkdir {
+			rtn.Files++
+			rtn.Bytes += entry.Size
+		}
+		if entry.Dst != "" && !dryRun {
+			rtn.Created = append(rtn.Created, entry.Dst)
+		}
+	}
+	return rtn
+}
+
+// String renders the result as the message shown in the AI chat
+func (r *FileOperationResult) String() string {
+	if r.DryRun {
+		return formatCopyPlan(r.Src, r.Dst, r.Plan)
+	}
+	files := "files"
+	if r.Files == 1 {
+		files = "file"
+	}
+	if r.Operation == "delete" {
+		return fmt.Sprintf("successfully deleted %q (%d %s, %d bytes)", r.Src, r.Files, files, r.Bytes)
+	}
+	done := map[string]string{"copy": "copied", "move": "moved", "rename": "renamed"}[r.Operation]
+	var msg string
+	if r.Skipped > 0 {
+		msg = fmt.Sprintf("successfully %s from %q to %q (%d %s, %d bytes, %d skipped as they already existed)", done, r.Src, r.Dst, r.Files, files, r.Bytes, r.Skipped)
+	} else {
+		msg = fmt.Sprintf("successfully %s from %q to %q (%d %s, %d bytes)", done, r.Src, r.Dst, r.Files, files, r.Bytes)
+	}
+	if r.Manifest != "" {
+		msg += fmt.Sprintf(", upload manifest written to %q", r.Manifest)
+	}
+	return msg
+}
+
+// getOperationField returns the non-empty string field key of a file operation
+func getOperationField(jsonMap map[string]interface{}, key string) (string, error) {
+	v, ok := jsonMap[key]
+	if !ok || v == nil {
+		return "", fmt.Errorf("file operation is missing %q", key)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("file operation field %q must be a string, got %T", key, v)
+	}
+	if s == "" {
+		return "", fmt.Errorf("file operation field %q is empty", key)
+	}
+	return s, nil
+}
+
+// getOperationBool returns the optional boolean field key of a file operation, false when it is missing
+func getOperationBool(jsonMap map[string]interface{}, key string) (bool, error) {
+	v, ok := jsonMap[key]
+	if !ok || v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("file operation field %q must be a boolean, got %T", key, v)
+	}
+	return b, nil
+}
+
+// ConfirmFunc asks the user whether a file operation that deletes files may run, text describes what it deletes
+type ConfirmFunc func(ctx context.Context, title string, text string) (bool, error)
+
+type confirmCtxKey struct{}
+
+// WithConfirm sets how RunFileOperation asks the user before deleting files, without it those operations are refused
+func WithConfirm(ctx context.Context, confirm ConfirmFunc) context.Context {
+	return context.WithValue(ctx, confirmCtxKey{}, confirm)
+}
+
+// confirmOperation asks the user through the ConfirmFunc of ctx and fails unless they agree. The untrusted input
+// alone can't delete a file, so nothing in it can answer for the user
+func confirmOperation(ctx context.Context, title string, text string) error {
+	confirm, _ := ctx.Value(confirmCtxKey{}).(ConfirmFunc)
+	if confirm == nil {
+		return fmt.Errorf("%s needs the user's confirmation and there is no way to ask for it here", strings.ToLower(title))
+	}
+	ok, err := confirm(ctx, title, text)
+	if err != nil {
+		return fmt.Errorf("cannot confirm %s: %w", strings.ToLower(title), err)
+	}
+	if !ok {
+		return fmt.Errorf("the user declined: %s", text)
+	}
+	return nil
+}
+
+// FileOperation runs the file operation described by the markdown fenced json the AI responded with, it's the
+// fallback for backends without tool calling
+func FileOperation(ctx context.Context, s string) (string, error) {
+	s = strings.TrimSpace(s)
 	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimPrefix(s, "json")
 	s = strings.TrimSuffix(s, "```")
+	return FileOperationJSON(ctx, s)
+}
 
-	var jsonMap map[string]interface{}
-	err := json.Unmarshal([]byte(s), &jsonMap)
+// FileOperationJSON runs the file operation described by a json object, either the arguments of a
+// walrus_file_operation tool call or the body of a fenced AI response, and returns the chat message for it
+func FileOperationJSON(ctx context.Context, args string) (string, error) {
+	result, err := RunFileOperation(ctx, args)
 	if err != nil {
 		return "", err
 	}
+	return result.String(), nil
+}
 
-	src := jsonMap["src"].(string)
-	dst := jsonMap["dst"].(string)
+// RunFileOperation runs the file operation described by a json object and returns what it did. The input is
+// untrusted so every field is validated before anything is touched
+func RunFileOperation(ctx context.Context, args string) (*FileOperationResult, error) {
+	var jsonMap map[string]interface{}
+	err := json.Unmarshal([]byte(args), &jsonMap)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse file operation: %w", err)
+	}
 
-	switch jsonMap["operation"] {
-	case "copy":
-		if strings.HasPrefix(src, "walrus://") && !strings.HasPrefix(dst, "walrus://") {
-			// walrus -> local
-			srcCleaned := strings.TrimPrefix(src, "walrus://")
-			if !strings.HasPrefix(srcCleaned, "/") {
-				srcCleaned = "/" + srcCleaned
-			}
-			err = CopyWalrusToLocal(srcCleaned, dst)
-		} else if strings.HasPrefix(dst, "walrus://") && !strings.HasPrefix(src, "walrus://") {
-			// local -> walrus
-			dstCleaned := strings.TrimPrefix(dst, "walrus://")
-			if !strings.HasPrefix(dstCleaned, "/") {
-				dstCleaned = "/" + dstCleaned
-			}
-			err = CopyLocalToWalrus(src, dstCleaned)
+	operation, err := getOperationField(jsonMap, "operation")
+	if err != nil {
+		return nil, err
+	}
 
-		} else if !strings.HasPrefix(dst, "walrus://") && !strings.HasPrefix(src, "walrus://") {
+	dryRun, err := getOperationBool(jsonMap, "dryrun")
+	if err != nil {
+		return nil, err
+	}
+	if dryRun && operation != "copy" {
+		return nil, fmt.Errorf("dry run is only supported for copy, not %q", operation)
+	}
+	contents, err := getOperationBool(jsonMap, "contents")
+	if err != nil {
+		return nil, err
+	}
+	if contents && operation != "copy" {
+		return nil, fmt.Errorf("contents is only supported for copy, not %q", operation)
+	}
+	policy := walrusfs.ConflictFail
+	if v, ok := jsonMap["conflict"]; ok && v != nil {
+		if operation != "copy" {
+			return nil, fmt.Errorf("conflict is only supported for copy, not %q", operation)
+		}
+		name, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("file operation field %q must be a string, got %T", "conflict", v)
+		}
+		if policy, err = walrusfs.ParseConflictPolicy(name); err != nil {
+			return nil, err
+		}
+	}
 
+	manifest := ""
+	if v, ok := jsonMap["manifest"]; ok && v != nil {
+		if operation != "copy" {
+			return nil, fmt.Errorf("manifest is only supported for copy, not %q", operation)
+		}
+		if dryRun {
+			return nil, fmt.Errorf("manifest is not supported for dry runs, they don't upload anything")
+		}
+		if manifest, err = getOperationField(jsonMap, "manifest"); err != nil {
+			return nil, err
+		}
+	}
+
+	var src, dst string
+	switch operation {
+	case "copy", "move", "rename":
+		if src, err = getOperationField(jsonMap, "src"); err != nil {
+			return nil, err
+		}
+		if dst, err = getOperationField(jsonMap, "dst"); err != nil {
+			return nil, err
+		}
+	case "delete":
+		if _, ok := jsonMap["path"]; ok {
+			src, err = getOperationField(jsonMap, "path")
 		} else {
-			return "", fmt.Errorf("unsupported file operation from %q to %q", src, dst)
+			src, err = getOperationField(jsonMap, "src")
+		}
+		if err != nil {
+			return nil, err
 		}
+	default:
+		return nil, fmt.Errorf("unsupported file operation %q", operation)
 	}
 
+	srcIsWalrus := strings.HasPrefix(src, "walrus://")
+	dstIsWalrus := strings.HasPrefix(dst, "walrus://")
+	if operation != "delete" && !srcIsWalrus && !dstIsWalrus {
+		// file operations only go to and from walrus, local files are left to the shell
+		return nil, fmt.Errorf("unsupported file operation from %q to %q: %s between local paths isn't supported, src or dst has to be a walrus:// path", src, dst, operation)
+	}
+	if operation == "delete" && !srcIsWalrus {
+		return nil, fmt.Errorf("only walrus paths can be deleted, got %q", src)
+	}
+	if manifest != "" && (srcIsWalrus || !dstIsWalrus) {
+		return nil, fmt.Errorf("manifest is only supported for copies from local files to walrus")
+	}
+	if operation == "copy" && dryRun && srcIsWalrus && dstIsWalrus {
+		return nil, fmt.Errorf("dry run is not supported for copies within walrus, they don't upload or download anything")
+	}
+	if p := walrusPath(dst); p != "/" && (dstIsWalrus || operation == "rename" && srcIsWalrus && !strings.Contains(dst, "/")) {
+		// checked before dst is joined or cleaned, which would resolve a .. rather than reject it
+		if _, err := walrusfs.ValidatePath(p); err != nil {
+			return nil, err
+		}
+	}
+	if operation == "rename" && srcIsWalrus && !strings.Contains(dst, "/") {
+		// a bare new name renames in place
+		dst = walrusURI(path.Join(path.Dir(walrusPath(src)), dst))
+		dstIsWalrus = true
+	}
+	// like rsync, a trailing slash on a local source directory copies its contents
+	if !srcIsWalrus && (strings.HasSuffix(src, "/") || strings.HasSuffix(src, string(filepath.Separator))) {
+		contents = true
+	}
+
+	// resolve the paths the way the operations below see them
+	if srcIsWalrus {
+		src = walrusURI(walrusPath(src))
+	} else {
+		src = localPath(src)
+	}
+	if dstIsWalrus {
+		dst = walrusURI(walrusPath(dst))
+	} else if dst != "" {
+		dst = localPath(dst)
+	}
+
+	if (operation == "move" || operation == "rename") && srcIsWalrus != dstIsWalrus {
+		text := fmt.Sprintf("Move %s to %s? The source is deleted once it is copied.", src, dst)
+		if err := confirmOperation(ctx, "Move File", text); err != nil {
+			return nil, err
+		}
+	}
+	if operation == "delete" {
+		text := fmt.Sprintf("Delete %s? A directory is deleted with everything in it.", src)
+		if err := confirmOperation(ctx, "Delete File", text); err != nil {
+			return nil, err
+		}
+	}
+
+	rec := &walrusfs.TxRecorder{}
+	ctx = walrusfs.WithTxRecorder(ctx, rec)
+
+	var plan []CopyPlanEntry
+	switch operation {
+	case "copy":
+		if srcIsWalrus && dstIsWalrus {
+			plan, err = CopyWalrus(ctx, walrusPath(src), walrusPath(dst), policy)
+		} else if srcIsWalrus {
+			// walrus -> local
+			plan, err = CopyWalrusToLocal(ctx, walrusPath(src), dst, policy, dryRun)
+		} else {
+			// local -> walrus
+			plan, err = CopyLocalToWalrus(ctx, src, walrusPath(dst), contents, policy, dryRun)
+		}
+	case "move", "rename":
+		if srcIsWalrus && dstIsWalrus {
+			plan, err = MoveWalrus(ctx, walrusPath(src), walrusPath(dst))
+		} else if srcIsWalrus {
+			// walrus -> local
+			plan, err = MoveWalrusToLocal(ctx, walrusPath(src), dst)
+		} else {
+			// local -> walrus
+			plan, err = MoveLocalToWalrus(ctx, src, walrusPath(dst))
+		}
+	case "delete":
+		plan, err = DeleteWalrus(ctx, walrusPath(src))
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return fmt.Sprintf("successfully copied from %q to %q", src, dst), nil
+	result := makeFileOperationResult(operation, src, dst, dryRun, plan, rec.Digests())
+	result.GasUsed = rec.GasUsed()
+	if manifest != "" {
+		result.Manifest = localPath(manifest)
+		if err := writeUploadManifest(ctx, result.Manifest, plan); err != nil {
+			return nil, fmt.Errorf("copied %q to %q but %w", src, dst, err)
+		}
+	}
+	if !dryRun {
+		telemetry.GoRecordTEventWrap(operationTEvent(operation, srcIsWalrus, dstIsWalrus, result))
+	}
+	return result, nil
+}
+
+// operationTEvent returns the telemetry event of a file operation that ran, with its counts but none of its paths
+func operationTEvent(operation string, srcIsWalrus bool, dstIsWalrus bool, result *FileOperationResult) *telemetrydata.TEvent {
+	if operation == "delete" {
+		return walrusfs.MakeOpTEvent(walrusfs.TEventDelete, "", result.Files, result.Bytes)
+	}
+	direction := walrusfs.DirectionWalrusToWalrus
+	if !srcIsWalrus {
+		direction = walrusfs.DirectionLocalToWalrus
+	} else if !dstIsWalrus {
+		direction = walrusfs.DirectionWalrusToLocal
+	}
+	event := walrusfs.TEventCopy
+	if operation != "copy" {
+		event = walrusfs.TEventMove
+	}
+	return walrusfs.MakeOpTEvent(event, direction, result.Files, result.Bytes)
+}
+
+// formatCopyPlan describes the actions of a dry run copy, one per line
+func formatCopyPlan(src string, dst string, plan []CopyPlanEntry) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "dry run of copy from %q to %q", src, dst)
+	if len(plan) == 0 {
+		sb.WriteString(": nothing to copy")
+	}
+	for _, entry := range plan {
+		sb.WriteString("\n")
+		sb.WriteString(entry.String())
+	}
+	return sb.String()
 }
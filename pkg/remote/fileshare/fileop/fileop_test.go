@@ -0,0 +1,329 @@
+package fileop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestFileOperationMalformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"not json", "```copy everything```", "cannot parse"},
+		{"missing operation", "```{\"src\": \"a\", \"dst\": \"walrus://b\"}```", "\"operation\""},
+		{"numeric operation", "```{\"operation\": 1, \"src\": \"a\", \"dst\": \"walrus://b\"}```", "\"operation\""},
+		{"unknown operation", "```{\"operation\": \"chmod\", \"src\": \"a\"}```", "unsupported file operation \"chmod\""},
+		{"missing src", "```{\"operation\": \"copy\", \"dst\": \"walrus://b\"}```", "\"src\""},
+		{"missing dst", "```{\"operation\": \"move\", \"src\": \"walrus://a\"}```", "\"dst\""},
+		{"numeric dst", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": 5}```", "\"dst\""},
+		{"null src", "```{\"operation\": \"copy\", \"src\": null, \"dst\": \"walrus://b\"}```", "\"src\""},
+		{"empty src", "```{\"operation\": \"copy\", \"src\": \"\", \"dst\": \"walrus://b\"}```", "\"src\""},
+		{"delete without path", "```{\"operation\": \"delete\"}```", "\"src\""},
+		{"delete numeric path", "```{\"operation\": \"delete\", \"path\": []}```", "\"path\""},
+		{"delete local path", "```{\"operation\": \"delete\", \"path\": \"~/file\"}```", "only walrus paths"},
+		{"local to local copy", "```{\"operation\": \"copy\", \"src\": \"~/a\", \"dst\": \"~/b\"}```", "copy between local paths isn't supported"},
+		{"local to local move", "```{\"operation\": \"move\", \"src\": \"~/a\", \"dst\": \"/tmp/b\"}```", "src or dst has to be a walrus:// path"},
+		{"walrus to walrus dry run", "```json\n{\"operation\": \"copy\", \"src\": \"walrus://a\", \"dst\": \"walrus://b\", \"dryrun\": true}\n```", "not supported for copies within walrus"},
+		{"string dryrun", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://b\", \"dryrun\": \"yes\"}```", "\"dryrun\""},
+		{"dry run move", "```{\"operation\": \"move\", \"src\": \"a\", \"dst\": \"walrus://b\", \"dryrun\": true}```", "only supported for copy"},
+		{"string contents", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://b\", \"contents\": 1}```", "\"contents\""},
+		{"unknown conflict", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://b\", \"conflict\": \"merge\"}```", "unknown conflict policy"},
+		{"numeric conflict", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://b\", \"conflict\": 2}```", "\"conflict\""},
+		{"conflict delete", "```{\"operation\": \"delete\", \"path\": \"walrus://b\", \"conflict\": \"skip\"}```", "conflict is only supported for copy"},
+		{"walrus dst climbing up", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://photos/../../b\"}```", "can't be used as a name"},
+		{"rename to parent", "```{\"operation\": \"rename\", \"src\": \"walrus://a/b\", \"dst\": \"..\"}```", "can't be used as a name"},
+		{"control character in dst", "```{\"operation\": \"move\", \"src\": \"a\", \"dst\": \"walrus://b\\u0007\"}```", "control characters"},
+		{"contents move", "```{\"operation\": \"move\", \"src\": \"a\", \"dst\": \"walrus://b\", \"contents\": true}```", "contents is only supported for copy"},
+		{"manifest move", "```{\"operation\": \"move\", \"src\": \"a\", \"dst\": \"walrus://b\", \"manifest\": \"m.json\"}```", "manifest is only supported for copy"},
+		{"manifest dry run", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://b\", \"dryrun\": true, \"manifest\": \"m.json\"}```", "not supported for dry runs"},
+		{"manifest download", "```{\"operation\": \"copy\", \"src\": \"walrus://a\", \"dst\": \"b\", \"manifest\": \"m.json\"}```", "from local files to walrus"},
+		{"numeric manifest", "```{\"operation\": \"copy\", \"src\": \"a\", \"dst\": \"walrus://b\", \"manifest\": 1}```", "\"manifest\""},
+		{"unconfirmed upload move", "```{\"operation\": \"move\", \"src\": \"~/a\", \"dst\": \"walrus://b\"}```", "needs the user's confirmation"},
+		{"unconfirmed download move", "```{\"operation\": \"move\", \"src\": \"walrus://a\", \"dst\": \"~/b\"}```", "needs the user's confirmation"},
+		{"self confirmed move", "```{\"operation\": \"move\", \"src\": \"~/a\", \"dst\": \"walrus://b\", \"confirm\": true}```", "needs the user's confirmation"},
+	}
+
+	for _, test := range tests {
+		_, err := FileOperation(context.Background(), test.input)
+		if err == nil {
+			t.Errorf("%s: expected an error, got nil", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestFileOperationConfirm(t *testing.T) {
+	t.Parallel()
+
+	var asked []string
+	confirm := func(answer bool, err error) ConfirmFunc {
+		return func(ctx context.Context, title string, text string) (bool, error) {
+			asked = append(asked, title+": "+text)
+			return answer, err
+		}
+	}
+	home := wavebase.ExpandHomeDirSafe("~")
+
+	ctx := WithConfirm(context.Background(), confirm(false, nil))
+	_, err := FileOperationJSON(ctx, "{\"operation\": \"move\", \"src\": \"~/a\", \"dst\": \"walrus://b\"}")
+	if err == nil || !strings.Contains(err.Error(), "the user declined") {
+		t.Errorf("expected a declined move to fail, got %v", err)
+	}
+	want := "Move File: Move " + filepath.Join(home, "a") + " to walrus://b? The source is deleted once it is copied."
+	if len(asked) != 1 || asked[0] != want {
+		t.Errorf("expected the user to be asked %q, got %q", want, asked)
+	}
+
+	ctx = WithConfirm(context.Background(), confirm(false, errors.New("timed out waiting for user input")))
+	_, err = FileOperationJSON(ctx, "{\"operation\": \"rename\", \"src\": \"walrus://a\", \"dst\": \"~/b\"}")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a move the user didn't answer to fail, got %v", err)
+	}
+	if len(asked) != 2 {
+		t.Errorf("expected the user to be asked again, got %q", asked)
+	}
+
+	_, err = FileOperationJSON(context.Background(), "{\"operation\": \"delete\", \"path\": \"walrus://old\"}")
+	if err == nil || !strings.Contains(err.Error(), "needs the user's confirmation") {
+		t.Errorf("expected a delete without a way to confirm it to fail, got %v", err)
+	}
+	ctx = WithConfirm(context.Background(), confirm(false, nil))
+	_, err = FileOperationJSON(ctx, "{\"operation\": \"delete\", \"path\": \"walrus://old\", \"confirm\": true}")
+	if err == nil || !strings.Contains(err.Error(), "the user declined") {
+		t.Errorf("expected a declined delete to fail, got %v", err)
+	}
+	want = "Delete File: Delete walrus://old? A directory is deleted with everything in it."
+	if len(asked) != 3 || asked[2] != want {
+		t.Errorf("expected the user to be asked %q, got %q", want, asked)
+	}
+
+	// a confirmed operation goes on to walrus, only the gate itself is run here
+	ctx = WithConfirm(context.Background(), confirm(true, nil))
+	if err := confirmOperation(ctx, "Delete File", "Delete walrus://old?"); err != nil {
+		t.Errorf("expected a confirmed delete to go ahead, got %v", err)
+	}
+	if len(asked) != 4 {
+		t.Errorf("expected the user to be asked once per operation, got %q", asked)
+	}
+}
+
+func TestCheckLocalMoveSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("hello walrus"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(file, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLocalMoveSource(file); err != nil {
+		t.Errorf("got %v for a file", err)
+	}
+	for _, p := range []string{dir, link, filepath.Join(dir, "missing"), "/", wavebase.GetHomeDir()} {
+		if err := checkLocalMoveSource(p); err == nil {
+			t.Errorf("got no error moving %q", p)
+		}
+	}
+
+	want := sha256.Sum256([]byte("hello walrus"))
+	if size, sum, err := hashLocalFile(file); err != nil || size != 12 || sum != hex.EncodeToString(want[:]) {
+		t.Errorf("got %d, %q, %v, want the size and sha256 of the file", size, sum, err)
+	}
+}
+
+func TestLocalCopyDest(t *testing.T) {
+	t.Parallel()
+
+	missing := &wshrpc.FileInfo{NotFound: true}
+	file := &wshrpc.FileInfo{Name: "dst"}
+	dir := &wshrpc.FileInfo{Name: "dst", IsDir: true}
+	tests := []struct {
+		name     string
+		srcIsDir bool
+		destpath string
+		dest     *wshrpc.FileInfo
+		contents bool
+		want     string
+		wantErr  string
+	}{
+		{"file to missing", false, "/dst", missing, false, "/dst", ""},
+		{"file to missing with slash", false, "/dst/", missing, false, "/dst/src", ""},
+		{"file onto file", false, "/dst", file, false, "/dst", ""},
+		{"file onto file with slash", false, "/dst/", file, false, "", "not a directory"},
+		{"file into directory", false, "/dst", dir, false, "/dst/src", ""},
+		{"file into directory with slash", false, "/dst/", dir, false, "/dst/src", ""},
+		{"file contents", false, "/dst", missing, true, "/dst", ""},
+		{"directory to missing", true, "/dst", missing, false, "/dst/src", ""},
+		{"directory contents to missing", true, "/dst", missing, true, "/dst", ""},
+		{"directory into directory", true, "/dst", dir, false, "/dst/src", ""},
+		{"directory contents into directory", true, "/dst/", dir, true, "/dst", ""},
+		{"directory into root", true, "/", dir, false, "/src", ""},
+		{"directory onto file", true, "/dst", file, false, "", "onto the walrus file"},
+		{"directory contents onto file", true, "/dst", file, true, "", "onto the walrus file"},
+	}
+
+	for _, test := range tests {
+		got, err := localCopyDest("/home/user/src", test.srcIsDir, test.destpath, test.dest, test.contents)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got %q, %v, want an error containing %q", test.name, got, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestFileOperationJSON(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"fenced", "```{\"operation\": \"copy\", \"src\": \"~/a\", \"dst\": \"walrus://b\"}```", "cannot parse"},
+		{"not an object", "[\"copy\"]", "cannot parse"},
+		{"unknown operation", "{\"operation\": \"chmod\", \"src\": \"walrus://a\"}", "unsupported file operation \"chmod\""},
+		{"local to local copy", "{\"operation\": \"copy\", \"src\": \"~/a\", \"dst\": \"~/b\"}", "copy between local paths isn't supported"},
+		{"delete local path", "{\"operation\": \"delete\", \"path\": \"~/file\", \"dryrun\": null}", "only walrus paths"},
+	}
+
+	for _, test := range tests {
+		_, err := FileOperationJSON(context.Background(), test.input)
+		if err == nil {
+			t.Errorf("%s: expected an error, got nil", test.name)
+		} else if !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestFormatCopyPlan(t *testing.T) {
+	t.Parallel()
+
+	plan := []CopyPlanEntry{
+		{Action: PlanMkdir, Src: "/tmp/photos", Dst: "/photos"},
+		{Action: PlanUpload, Src: "/tmp/photos/a.png", Dst: "/photos/a.png", Size: 42},
+		{Action: PlanConflict, Src: "/tmp/photos/b.png", Dst: "/photos/b.png"},
+	}
+	want := `dry run of copy from "~/photos" to "walrus://photos"
+mkdir /photos
+upload /tmp/photos/a.png -> /photos/a.png (42 bytes)
+conflict /photos/b.png already exists`
+	if got := formatCopyPlan("~/photos", "walrus://photos", plan); got != want {
+		t.Errorf("unexpected plan:\n%s", got)
+	}
+	if got := formatCopyPlan("a", "walrus://b", nil); !strings.HasSuffix(got, "nothing to copy") {
+		t.Errorf("unexpected empty plan: %s", got)
+	}
+}
+
+func TestFileOperationResult(t *testing.T) {
+	t.Parallel()
+
+	plan := []CopyPlanEntry{
+		{Action: PlanMkdir, Src: "/tmp/photos", Dst: "/photos"},
+		{Action: PlanUpload, Src: "/tmp/photos/a.png", Dst: "/photos/a.png", Size: 42},
+		{Action: PlanUpload, Src: "/tmp/photos/b.png", Dst: "/photos/b.png", Size: 8},
+	}
+	result := makeFileOperationResult("copy", "/tmp/photos", "walrus://", false, plan, []string{"digest1", "digest2"})
+	if result.Files != 2 || result.Bytes != 50 || result.Plan != nil {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if len(result.Created) != 3 || result.Created[2] != "/photos/b.png" {
+		t.Errorf("unexpected created paths: %v", result.Created)
+	}
+	if got := result.String(); got != `successfully copied from "/tmp/photos" to "walrus://" (2 files, 50 bytes)` {
+		t.Errorf("unexpected message: %s", got)
+	}
+	buf, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("cannot marshal result: %v", err)
+	}
+	if !strings.Contains(string(buf), `"txdigests":["digest1","digest2"]`) || strings.Contains(string(buf), `"plan"`) {
+		t.Errorf("unexpected json: %s", buf)
+	}
+
+	// a dry run creates nothing and conflicts aren't counted
+	plan = append(plan, CopyPlanEntry{Action: PlanConflict, Src: "/tmp/photos/c.png", Dst: "/photos/c.png"})
+	result = makeFileOperationResult("copy", "/tmp/photos", "walrus://", true, plan, nil)
+	if result.Files != 2 || result.Created != nil || len(result.Plan) != 4 {
+		t.Errorf("unexpected dry run result: %+v", result)
+	}
+	if got := result.String(); !strings.HasPrefix(got, "dry run of copy") || !strings.HasSuffix(got, "conflict /photos/c.png already exists") {
+		t.Errorf("unexpected dry run message: %s", got)
+	}
+
+	// files left alone by the skip policy are counted apart
+	plan = []CopyPlanEntry{
+		{Action: PlanUpload, Src: "/tmp/photos/a.png", Dst: "/photos/a.png", Size: 42},
+		{Action: PlanSkip, Src: "/tmp/photos/b.png", Dst: "/photos/b.png"},
+	}
+	result = makeFileOperationResult("copy", "/tmp/photos", "walrus://", false, plan, nil)
+	if result.Files != 1 || result.Skipped != 1 || len(result.Created) != 1 {
+		t.Errorf("unexpected result with a skip: %+v", result)
+	}
+	if got := result.String(); got != `successfully copied from "/tmp/photos" to "walrus://" (1 file, 42 bytes, 1 skipped as they already existed)` {
+		t.Errorf("unexpected message with a skip: %s", got)
+	}
+
+	result.Manifest = "/tmp/photos.manifest.json"
+	if got := result.String(); !strings.HasSuffix(got, `, upload manifest written to "/tmp/photos.manifest.json"`) {
+		t.Errorf("unexpected message with a manifest: %s", got)
+	}
+
+	result = makeFileOperationResult("delete", "walrus://old", "", false, []CopyPlanEntry{{Action: PlanDelete, Src: "/old/x", Size: 3}}, nil)
+	if result.Created != nil || result.String() != `successfully deleted "walrus://old" (1 file, 3 bytes)` {
+		t.Errorf("unexpected delete result: %+v", result)
+	}
+}
+
+func TestOperationTEvent(t *testing.T) {
+	t.Parallel()
+
+	plan := []CopyPlanEntry{{Action: PlanUpload, Src: "/home/me/secret.txt", Dst: "/secret.txt", Size: 7}}
+	result := makeFileOperationResult("copy", "/home/me/secret.txt", "walrus://secret.txt", false, plan, nil)
+	tevent := operationTEvent("copy", false, true, result)
+	if tevent.Event != "action:walruscopy" || tevent.Props.WalrusDirection != "local->walrus" || tevent.Props.WalrusFiles != 1 || tevent.Props.WalrusBytes != 7 {
+		t.Errorf("unexpected copy event: %+v", tevent)
+	}
+	if err := tevent.Validate(true); err != nil {
+		t.Errorf("invalid copy event: %v", err)
+	}
+	// only counts are sent, never paths
+	buf, err := json.Marshal(tevent)
+	if err != nil {
+		t.Fatalf("cannot marshal event: %v", err)
+	}
+	if strings.Contains(string(buf), "secret") {
+		t.Errorf("event carries a path: %s", buf)
+	}
+
+	if tevent := operationTEvent("rename", true, false, result); tevent.Event != "action:walrusmove" || tevent.Props.WalrusDirection != "walrus->local" {
+		t.Errorf("unexpected move event: %+v", tevent)
+	}
+	if tevent := operationTEvent("delete", true, false, result); tevent.Event != "action:walrusdelete" || tevent.Props.WalrusDirection != "" {
+		t.Errorf("unexpected delete event: %+v", tevent)
+	}
+}
@@ -38,7 +38,13 @@ func CreateFileShareClient(ctx context.Context, connection string) (fstype.FileS
 		}
 		return s3fs.NewS3Client(config), conn
 	} else if conntype == connparse.ConnectionTypeWalrus {
-		return walrusfs.NewWalrusClient(), conn
+		// a path under a named root is relative to its object from here on
+		client, rootConn, err := walrusfs.NewWalrusClientForConn(conn)
+		if err != nil {
+			log.Printf("error getting walrus client: %v", err)
+			return nil, nil
+		}
+		return client, rootConn
 	} else if conntype == connparse.ConnectionTypeWave {
 		return wavefs.NewWaveClient(), conn
 	} else if conntype == connparse.ConnectionTypeWsh {
@@ -135,7 +141,10 @@ func Move(ctx context.Context, data wshrpc.CommandFileCopyData) error {
 	if destConn == nil || destClient == nil {
 		return fmt.Errorf("error creating fileshare client, could not parse destination connection %s", data.DestUri)
 	}
-	if srcConn.Host != destConn.Host {
+	if walrusfs.CrossRoot(srcClient, destClient) {
+		return fmt.Errorf("cannot move %q to %q, they are in different walrus roots", data.SrcUri, data.DestUri)
+	}
+	if !isInternalCopy(srcConn, destConn) {
 		isDir, err := destClient.CopyRemote(ctx, srcConn, destConn, srcClient, opts)
 		if err != nil {
 			return fmt.Errorf("cannot copy %q to %q: %w", data.SrcUri, data.DestUri, err)
@@ -146,6 +155,17 @@ func Move(ctx context.Context, data wshrpc.CommandFileCopyData) error {
 	}
 }
 
+// isInternalCopy reports whether the source client copies or moves to destConn itself instead of the destination's
+// CopyRemote. It needs the same host and, unless one side is wsh which copies between local and walrus paths, the same
+// connection type, so a walrus to s3 copy isn't sent to walrus when the bucket is named like the walrus host
+func isInternalCopy(srcConn, destConn *connparse.Connection) bool {
+	if srcConn.Host != destConn.Host {
+		return false
+	}
+	srcType, destType := srcConn.GetType(), destConn.GetType()
+	return srcType == destType || srcType == connparse.ConnectionTypeWsh || destType == connparse.ConnectionTypeWsh
+}
+
 func Copy(ctx context.Context, data wshrpc.CommandFileCopyData) error {
 	opts := data.Opts
 	if opts == nil {
@@ -161,7 +181,10 @@ func Copy(ctx context.Context, data wshrpc.CommandFileCopyData) error {
 	if destConn == nil || destClient == nil {
 		return fmt.Errorf("error creating fileshare client, could not parse destination connection %s", data.DestUri)
 	}
-	if srcConn.Host != destConn.Host {
+	if walrusfs.CrossRoot(srcClient, destClient) {
+		return fmt.Errorf("cannot copy %q to %q, they are in different walrus roots", data.SrcUri, data.DestUri)
+	}
+	if !isInternalCopy(srcConn, destConn) {
 		_, err := destClient.CopyRemote(ctx, srcConn, destConn, srcClient, opts)
 		return err
 	} else {
@@ -31,6 +31,21 @@ func GetParentPathString(hostAndPath string) string {
 		return ""
 	}
 
+	// a walrus uri carries an absolute path, the parent of a top level entry is the root walrus:/// and the root
+	// itself has none. Like the other parents it ends with a slash
+	walrusPrefix := connparse.ConnectionTypeWalrus + "://"
+	if walrusPath, ok := strings.CutPrefix(hostAndPath, walrusPrefix); ok {
+		walrusPath = fspath.Join(fspath.Separator, walrusPath)
+		if walrusPath == fspath.Separator {
+			return ""
+		}
+		parent := fspath.Dir(walrusPath)
+		if parent != fspath.Separator {
+			parent += fspath.Separator
+		}
+		return walrusPrefix + parent
+	}
+
 	// Remove trailing slash if present
 	if strings.HasSuffix(hostAndPath, fspath.Separator) {
 		hostAndPath = hostAndPath[:len(hostAndPath)-1]
@@ -41,12 +56,7 @@ func GetParentPathString(hostAndPath string) string {
 		return ""
 	}
 
-	t := hostAndPath[:lastSlash+1]
-	if strings.HasSuffix(t, "walrus:////") {
-		t = t[:len(t)-1]
-	}
-
-	return t
+	return hostAndPath[:lastSlash+1]
 }
 
 func PrefixCopyInternal(ctx context.Context, srcConn, destConn *connparse.Connection, c fstype.FileShareClient, opts *wshrpc.FileCopyOpts, listEntriesPrefix func(ctx context.Context, host string, path string) ([]string, error), copyFunc func(ctx context.Context, host string, path string) error) (bool, error) {
@@ -0,0 +1,32 @@
+package fsutil
+
+import "testing"
+
+func TestGetParentPathString(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"bucket", ""},
+		{"bucket/a.txt", "bucket/"},
+		{"bucket/dir/", "bucket/"},
+		{"walrus:///", ""},
+		{"walrus://", ""},
+		{"walrus:////", ""},
+		{"walrus:///foo.txt", "walrus:///"},
+		{"walrus://foo.txt", "walrus:///"},
+		{"walrus:///dir/", "walrus:///"},
+		{"walrus:///dir/bar.txt", "walrus:///dir/"},
+		{"walrus://dir/sub/", "walrus:///dir/"},
+		{"walrus:///dir/sub/baz.txt", "walrus:///dir/sub/"},
+	}
+	for _, tc := range tests {
+		if got := GetParentPathString(tc.path); got != tc.want {
+			t.Errorf("GetParentPathString(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
@@ -70,7 +70,7 @@ func (c S3Client) ReadStream(ctx context.Context, conn *connparse.Connection, da
 					Name:     "..",
 					IsDir:    true,
 					Size:     0,
-					ModTime:  time.Now().Unix(),
+					ModTime:  time.Now().UnixMilli(),
 					MimeType: "directory",
 				},
 			}}}
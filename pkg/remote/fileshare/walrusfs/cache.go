@@ -0,0 +1,106 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"maps"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listingCache holds recent stat and list_directory results so repeated lookups of the same path
+// don't each need a dev inspect round trip. It is shared by all clients, since a new client is
+// created for every file operation, and keyed by root object so different roots never mix.
+type listingCache struct {
+	lock  sync.Mutex
+	stats map[string]cachedStat
+	lists map[string]cachedList
+}
+
+type cachedStat struct {
+	item    *ListDirFileItem
+	expires time.Time
+}
+
+type cachedList struct {
+	items   []ListDirFileItem
+	expires time.Time
+}
+
+var listings = newListingCache()
+
+func newListingCache() *listingCache {
+	return &listingCache{
+		stats: make(map[string]cachedStat),
+		lists: make(map[string]cachedList),
+	}
+}
+
+func cacheKey(root string, p string) string {
+	return root + ":" + cleanCachePath(p)
+}
+
+func cleanCachePath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// getStat returns the cached stat result for a path. A cached nil item means the path was not found.
+func (c *listingCache) getStat(root string, p string, now time.Time) (*ListDirFileItem, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.stats[cacheKey(root, p)]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	if entry.item == nil {
+		return nil, true
+	}
+	item := *entry.item
+	return &item, true
+}
+
+func (c *listingCache) putStat(root string, p string, item *ListDirFileItem, expires time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var stored *ListDirFileItem
+	if item != nil {
+		copied := *item
+		stored = &copied
+	}
+	c.stats[cacheKey(root, p)] = cachedStat{item: stored, expires: expires}
+}
+
+func (c *listingCache) getList(root string, p string, now time.Time) ([]ListDirFileItem, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.lists[cacheKey(root, p)]
+	if !ok || now.After(entry.expires) {
+		return nil, false
+	}
+	return append([]ListDirFileItem(nil), entry.items...), true
+}
+
+func (c *listingCache) putList(root string, p string, items []ListDirFileItem, expires time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lists[cacheKey(root, p)] = cachedList{items: append([]ListDirFileItem(nil), items...), expires: expires}
+}
+
+// invalidate drops everything cached for a path, its parent directory and, in case the path is a
+// directory that was renamed or deleted, anything below it
+func (c *listingCache) invalidate(root string, p string) {
+	target := cacheKey(root, p)
+	parent := cacheKey(root, path.Dir(cleanCachePath(p)))
+	prefix := strings.TrimSuffix(target, "/") + "/"
+	stale := func(key string) bool {
+		return key == target || key == parent || strings.HasPrefix(key, prefix)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	maps.DeleteFunc(c.stats, func(key string, _ cachedStat) bool { return stale(key) })
+	maps.DeleteFunc(c.lists, func(key string, _ cachedList) bool { return stale(key) })
+}
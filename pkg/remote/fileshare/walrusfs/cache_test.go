@@ -0,0 +1,63 @@
+package walrusfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListingCacheExpiry(t *testing.T) {
+	t.Parallel()
+
+	c := newListingCache()
+	now := time.Now()
+	c.putStat("root", "/a/b.txt", &ListDirFileItem{Name: "b.txt", Size: 3}, now.Add(time.Second))
+	c.putStat("root", "/a/missing", nil, now.Add(time.Second))
+
+	item, ok := c.getStat("root", "a/b.txt", now)
+	if !ok || item == nil || item.Size != 3 {
+		t.Fatalf("getStat = %v, %v, want cached item", item, ok)
+	}
+	item.Size = 10
+	if item, _ := c.getStat("root", "/a/b.txt", now); item.Size != 3 {
+		t.Errorf("cached item was modified through a returned copy")
+	}
+	if item, ok := c.getStat("root", "/a/missing", now); !ok || item != nil {
+		t.Errorf("getStat(missing) = %v, %v, want cached not found", item, ok)
+	}
+	if _, ok := c.getStat("other", "/a/b.txt", now); ok {
+		t.Errorf("getStat returned an entry cached for another root")
+	}
+	if _, ok := c.getStat("root", "/a/b.txt", now.Add(2*time.Second)); ok {
+		t.Errorf("getStat returned an expired entry")
+	}
+}
+
+func TestListingCacheInvalidate(t *testing.T) {
+	t.Parallel()
+
+	c := newListingCache()
+	expires := time.Now().Add(time.Hour)
+	for _, p := range []string{"/", "/a", "/a/b", "/a/b/c.txt", "/ab", "/d"} {
+		c.putStat("root", p, &ListDirFileItem{Name: p}, expires)
+		c.putList("root", p, []ListDirFileItem{{Name: p}}, expires)
+	}
+
+	c.invalidate("root", "/a/b")
+
+	now := time.Now()
+	for p, want := range map[string]bool{
+		"/":          true,
+		"/a":         false,
+		"/a/b":       false,
+		"/a/b/c.txt": false,
+		"/ab":        true,
+		"/d":         true,
+	} {
+		if _, ok := c.getStat("root", p, now); ok != want {
+			t.Errorf("stat %q cached = %v, want %v", p, ok, want)
+		}
+		if _, ok := c.getList("root", p, now); ok != want {
+			t.Errorf("list %q cached = %v, want %v", p, ok, want)
+		}
+	}
+}
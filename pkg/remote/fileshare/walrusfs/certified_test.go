@@ -0,0 +1,63 @@
+package walrusfs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fsutil"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestReadPendingFile(t *testing.T) {
+	defer func(delay time.Duration) { publishRetryBaseDelay = delay }(publishRetryBaseDelay)
+	publishRetryBaseDelay = time.Millisecond
+
+	var gets atomic.Int32
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the blob reaches the aggregator after the first two reads
+		if gets.Add(1) <= 2 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello walrus"))
+	}))
+	defer aggregator.Close()
+
+	c, _ := newFakeChainClient("test-read-pending")
+	c.config.aggregatorUrl = aggregator.URL
+	c.config.httpTimeout = time.Second
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/pending.txt", &ListDirFileItem{Name: "pending.txt", Size: 12, WalrusBlobId: "blob1"}, expires)
+	listings.putStat(c.config.root, "/certified.txt", &ListDirFileItem{Name: "certified.txt", Size: 12, WalrusBlobId: "blob2", Certified: true}, expires)
+
+	finfo, err := c.Stat(context.Background(), walrusConn("/pending.txt"))
+	if err != nil || finfo.WalrusCertified {
+		t.Fatalf("got %+v, %v, want a pending file", finfo, err)
+	}
+	data, err := fsutil.ReadStreamToFileData(context.Background(), c.ReadStream(context.Background(), walrusConn("/pending.txt"), wshrpc.FileData{}))
+	if err != nil {
+		t.Fatalf("pending file wasn't read once the aggregator had it: %v", err)
+	}
+	if data.Data64 != "aGVsbG8gd2FscnVz" || gets.Load() != 3 {
+		t.Errorf("got %q after %d reads, want the content after 3", data.Data64, gets.Load())
+	}
+
+	// a certified file is read once
+	gets.Store(0)
+	_, err = fsutil.ReadStreamToFileData(context.Background(), c.ReadStream(context.Background(), walrusConn("/certified.txt"), wshrpc.FileData{}))
+	if err == nil || gets.Load() != 1 {
+		t.Errorf("got %v after %d reads, want the missing blob reported at once", err, gets.Load())
+	}
+
+	// a pending file that never shows up says so
+	gets.Store(-100)
+	_, err = fsutil.ReadStreamToFileData(context.Background(), c.ReadStream(context.Background(), walrusConn("/pending.txt"), wshrpc.FileData{}))
+	if err == nil || !strings.Contains(err.Error(), "pending certification") {
+		t.Errorf("got error %v, want the file reported pending", err)
+	}
+}
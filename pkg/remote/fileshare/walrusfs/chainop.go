@@ -6,33 +6,96 @@ package walrusfs
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"io/ioutil"
-	"log"
+	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/block-vision/sui-go-sdk/constant"
 	"github.com/block-vision/sui-go-sdk/models"
 	"github.com/block-vision/sui-go-sdk/mystenbcs"
-	"github.com/block-vision/sui-go-sdk/signer"
 	"github.com/block-vision/sui-go-sdk/sui"
 	"github.com/block-vision/sui-go-sdk/transaction"
+	"github.com/block-vision/sui-go-sdk/utils"
 	"github.com/fardream/go-bcs/bcs"
 	"github.com/holiman/uint256"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
+	"github.com/wavetermdev/waveterm/pkg/util/fileutil"
 )
 
+// publishRetryBaseDelay is the backoff before the second upload attempt, it doubles for every attempt after that
+var publishRetryBaseDelay = 500 * time.Millisecond
+
+const (
+	// DefaultStorageEpochs is used when neither the config nor the caller specify the storage epochs
+	DefaultStorageEpochs = 5
+	// MaxStorageEpochs is the maximum number of epochs ahead walrus will store a blob for
+	MaxStorageEpochs = 53
+	// PublishMaxAttempts bounds the upload attempts across all publishers
+	PublishMaxAttempts = 4
+	// MaxBufferedPublishSize is the largest upload from a non seekable reader that is kept in memory for retries
+	MaxBufferedPublishSize = 32 * 1024 * 1024
+	// MaxBatchCalls is the most move calls put in one batch transaction, well below the protocol's limit on
+	// commands so the transaction also stays under its size limit
+	MaxBatchCalls = 256
+	// DefaultChunkSize is the largest blob a file is stored in before it is split into several. It stays below the
+	// request body limit walrus publishers apply by default (10 MiB), which is what bounds uploads in practice
+	DefaultChunkSize = 8 * 1024 * 1024
+)
+
+type PublishBlobResult struct {
+	BlobId   string
+	EndEpoch int64
+	// RegisteredEpoch is the walrus epoch the blob was registered in, it is only known for newly created blobs
+	RegisteredEpoch int64
+	// Certified is set when the blob was already certified or the publisher waited for its certification
+	Certified bool
+}
+
+// TxResult describes the transaction of a write operation
+type TxResult struct {
+	Digest string
+	// GasUsed is what the transaction cost in MIST, see gas_used. Transactions that ran as a batch each report
+	// the cost of the whole batch
+	GasUsed int64
+	// BlobId is the walrus blob the file points at, it is only set for files
+	BlobId string
+	// BlobIds are the chunks of a file stored as several blobs, in order. BlobId is the first of them
+	BlobIds []string
+	// ObjectIds are the sui objects created by the transaction. Files and directories are entries in the
+	// walrusfs root object rather than objects of their own, so this is usually empty
+	ObjectIds []string
+}
+
 type ListDirFileItem struct {
 	Name            string   `json:"name,string"`
-	CreateTs        int64    `json:"create_ts,int64"`
+	CreateTs        int64    `json:"create_ts,int64"` // unix time in milliseconds from the chain clock, the unit of wshrpc.FileInfo.ModTime
 	IsDir           bool     `json:"is_dir,boolean"`
 	Tags            []string `json:"tags"`
 	Size            int64    `json:"size,int64"`
 	WalrusBlobId    string   `json:"walrus_blob_id,string"`
+	WalrusBlobIds   []string `json:"walrus_blob_ids"`
+	ContentSha256   string   `json:"content_sha256,string"`
 	WalrusEpochTill int64    `json:"walrus_epoch_till,int64"`
+	Deletable       bool     `json:"deletable,boolean"`
+	Certified       bool     `json:"certified,boolean"`
+	Encrypted       bool     `json:"encrypted,boolean"`
+	Compression     string   `json:"compression,string"`
+	MimeType        string   `json:"mime_type,string"`
 }
 
 type DirItem struct {
@@ -57,7 +120,14 @@ type FileObject struct {
 	Tags            []string
 	Size            uint64
 	WalrusBlobId    string
+	WalrusBlobIds   []string
+	ContentSha256   string
 	WalrusEpochTill uint64
+	Deletable       bool
+	Certified       bool
+	Encrypted       bool
+	Compression     string
+	MimeType        string
 }
 
 type DirObject struct {
@@ -88,39 +158,168 @@ type RecursiveDirList struct {
 	Dirs   []DirObjectEx
 }
 
-func parse_dir_file_item(m map[string]interface{}) (error, ListDirFileItem) {
-	var r ListDirFileItem
+func get_map_value(m map[string]interface{}, key string) (interface{}, error) {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return nil, fmt.Errorf("field %q is missing", key)
+	}
+	return v, nil
+}
 
-	i, err := strconv.ParseInt(m["create_ts"].(string), 10, 64)
+func get_map_string(m map[string]interface{}, key string) (string, error) {
+	v, err := get_map_value(m, key)
 	if err != nil {
-		log.Printf("conversion error: %v", err)
-		return err, ListDirFileItem{}
+		return "", err
 	}
-	r.CreateTs = i
-
-	r.IsDir = m["is_dir"].(bool)
-	r.Name = m["name"].(string)
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q has type %T, expected string", key, v)
+	}
+	return s, nil
+}
 
-	i, err = strconv.ParseInt(m["size"].(string), 10, 64)
+// get_map_int64 decodes a u64 field, which the chain returns as a decimal string
+func get_map_int64(m map[string]interface{}, key string) (int64, error) {
+	s, err := get_map_string(m, key)
 	if err != nil {
-		log.Printf("conversion error: %v", err)
-		return err, ListDirFileItem{}
+		return 0, err
 	}
-	r.Size = i
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("field %q is not a valid integer: %w", key, err)
+	}
+	return i, nil
+}
 
-	r.Tags = *new([]string)
-	for _, t := range m["tags"].([]interface{}) {
-		r.Tags = append(r.Tags, t.(string))
+func get_map_bool(m map[string]interface{}, key string) (bool, error) {
+	v, err := get_map_value(m, key)
+	if err != nil {
+		return false, err
 	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("field %q has type %T, expected bool", key, v)
+	}
+	return b, nil
+}
 
-	r.WalrusBlobId = m["walrus_blob_id"].(string)
+func get_map_strings(m map[string]interface{}, key string) ([]string, error) {
+	v, err := get_map_value(m, key)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q has type %T, expected array", key, v)
+	}
+	r := make([]string, 0, len(l))
+	for i, e := range l {
+		s, ok := e.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %q[%d] has type %T, expected string", key, i, e)
+		}
+		r = append(r, s)
+	}
+	return r, nil
+}
 
-	i, err = strconv.ParseInt(m["walrus_epoch_till"].(string), 10, 64)
+// get_map_vecmap decodes a move VecMap<String, u256>, which is serialized as {"contents": [{"key": .., "value": ..}]}
+func get_map_vecmap(m map[string]interface{}, key string) (map[string]string, error) {
+	v, err := get_map_value(m, key)
+	if err != nil {
+		return nil, err
+	}
+	vm, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q has type %T, expected object", key, v)
+	}
+	contents, err := get_map_value(vm, "contents")
 	if err != nil {
-		log.Printf("conversion error: %v", err)
+		return nil, fmt.Errorf("field %q: %w", key, err)
+	}
+	l, ok := contents.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q.contents has type %T, expected array", key, contents)
+	}
+	r := make(map[string]string, len(l))
+	for i, e := range l {
+		em, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %q.contents[%d] has type %T, expected object", key, i, e)
+		}
+		k, err := get_map_string(em, "key")
+		if err != nil {
+			return nil, fmt.Errorf("field %q.contents[%d]: %w", key, i, err)
+		}
+		val, err := get_map_string(em, "value")
+		if err != nil {
+			return nil, fmt.Errorf("field %q.contents[%d]: %w", key, i, err)
+		}
+		r[k] = val
+	}
+	return r, nil
+}
+
+func parse_dir_file_item(m map[string]interface{}) (error, ListDirFileItem) {
+	var r ListDirFileItem
+	var err error
+
+	if r.CreateTs, err = get_map_int64(m, "create_ts"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.IsDir, err = get_map_bool(m, "is_dir"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Name, err = get_map_string(m, "name"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Size, err = get_map_int64(m, "size"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Tags, err = get_map_strings(m, "tags"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.WalrusBlobId, err = get_map_string(m, "walrus_blob_id"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.WalrusBlobIds, err = get_map_strings(m, "walrus_blob_ids"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.ContentSha256, err = get_map_string(m, "content_sha256"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.WalrusEpochTill, err = get_map_int64(m, "walrus_epoch_till"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Deletable, err = get_map_bool(m, "deletable"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Certified, err = get_map_bool(m, "certified"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Encrypted, err = get_map_bool(m, "encrypted"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.Compression, err = get_map_string(m, "compression"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, ListDirFileItem{}
+	}
+	if r.MimeType, err = get_map_string(m, "mime_type"); err != nil {
+		logger.Debug("cannot convert move value", "err", err)
 		return err, ListDirFileItem{}
 	}
-	r.WalrusEpochTill = i
 
 	return nil, r
 }
@@ -133,7 +332,14 @@ func parse_file_info(f *FileObjectEx) (error, uint256.Int, ListDirFileItem) {
 	r.Size = int64(f.Obj.Size)
 	r.Tags = f.Obj.Tags
 	r.WalrusBlobId = f.Obj.WalrusBlobId
+	r.WalrusBlobIds = f.Obj.WalrusBlobIds
+	r.ContentSha256 = f.Obj.ContentSha256
 	r.WalrusEpochTill = int64(f.Obj.WalrusEpochTill)
+	r.Deletable = f.Obj.Deletable
+	r.Certified = f.Obj.Certified
+	r.Encrypted = f.Obj.Encrypted
+	r.Compression = f.Obj.Compression
+	r.MimeType = f.Obj.MimeType
 
 	return nil, f.Id, r
 }
@@ -146,28 +352,33 @@ func parse_dir_info(m map[string]interface{}) (error, DirItem) {
 		Tags:                make([]string, 0),
 	}
 
-	cd := m["children_directories"].(map[string]interface{})["contents"].([]interface{})
-	for _, cdi := range cd {
-		cdim := cdi.(map[string]interface{})
-		r.ChildrenDirectories[cdim["key"].(string)] = cdim["value"].(string)
+	cd, err := get_map_vecmap(m, "children_directories")
+	if err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, r
 	}
+	r.ChildrenDirectories = cd
 
-	cf := m["children_files"].(map[string]interface{})["contents"].([]interface{})
-	for _, cfi := range cf {
-		cfim := cfi.(map[string]interface{})
-		r.ChildrenFiles[cfim["key"].(string)] = cfim["value"].(string)
+	cf, err := get_map_vecmap(m, "children_files")
+	if err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, r
 	}
+	r.ChildrenFiles = cf
 
-	i, err := strconv.ParseInt(m["create_ts"].(string), 10, 64)
+	i, err := get_map_int64(m, "create_ts")
 	if err != nil {
-		log.Printf("conversion error: %v", err)
+		logger.Debug("cannot convert move value", "err", err)
 		return err, r
 	}
 	r.CreateTs = i
 
-	for _, t := range m["tags"].([]interface{}) {
-		r.Tags = append(r.Tags, t.(string))
+	tags, err := get_map_strings(m, "tags")
+	if err != nil {
+		logger.Debug("cannot convert move value", "err", err)
+		return err, r
 	}
+	r.Tags = append(r.Tags, tags...)
 
 	return nil, r
 }
@@ -213,146 +424,256 @@ func parse_dir_all(list *RecursiveDirList) (DirAllResult, error) {
 	return r, nil
 }
 
-func stat(config *WalrusFsConfig, path string) (*ListDirFileItem, error) {
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
-	ctx := context.Background()
-
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
-	if err != nil {
-		fmt.Println(err.Error())
-		return nil, err
+// newSuiClient returns a client for the configured Sui RPC endpoint, defaulting to testnet
+func newSuiClient(config *WalrusFsConfig) sui.ISuiAPI {
+	rpcUrl := config.rpcUrl
+	if rpcUrl == "" {
+		rpcUrl = constant.SuiTestnetEndpoint
 	}
+	return sui.NewSuiClient(rpcUrl)
+}
 
-	rsp, err := cli.SuiGetObject(ctx, models.SuiGetObjectRequest{
-		ObjectId: config.root,
-		Options: models.SuiObjectDataOptions{
-			ShowContent:             false,
-			ShowDisplay:             false,
-			ShowType:                false,
-			ShowBcs:                 false,
-			ShowOwner:               false,
-			ShowPreviousTransaction: false,
-			ShowStorageRebate:       false,
-		},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to SuiGetObject: %w", err)
+func (config *WalrusFsConfig) getSuiClient() sui.ISuiAPI {
+	config.lazyLock.Lock()
+	defer config.lazyLock.Unlock()
+	if config.suiClient == nil {
+		config.suiClient = newSuiClient(config)
 	}
+	return config.suiClient
+}
 
-	ver, err := strconv.ParseUint(rsp.Data.Version, 0, 64)
-	if err != nil {
-		return nil, fmt.Errorf("failed to ParseUint: %w", err)
+// getHttpClient returns the client used for the publisher and aggregator, requests time out after the configured http timeout.
+// It has a transport of its own so closing the client closes its connections only
+func (config *WalrusFsConfig) getHttpClient() *http.Client {
+	config.lazyLock.Lock()
+	defer config.lazyLock.Unlock()
+	if config.httpClient == nil {
+		config.httpClient = &http.Client{Timeout: config.httpTimeout, Transport: http.DefaultTransport.(*http.Transport).Clone()}
 	}
+	return config.httpClient
+}
 
-	objectIdBytes, err := transaction.ConvertSuiAddressStringToBytes(models.SuiAddress(config.root))
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert address: %w", err)
+// getSigner returns the custom signer of the config, or the signer derived from the configured mnemonic
+func (config *WalrusFsConfig) getSigner() (Signer, error) {
+	if config.txSigner != nil {
+		return config.txSigner, nil
+	}
+	config.lazyLock.Lock()
+	defer config.lazyLock.Unlock()
+	if !config.signerDone {
+		config.signerAccount, config.signerErr = get_mnemonic_signer(config.mnemonicSource, config.mnemonic)
+		config.signerDone = true
 	}
+	return config.signerAccount, config.signerErr
+}
 
-	digestBytes, err := transaction.ConvertObjectDigestStringToBytes((models.ObjectDigest)(rsp.Data.Digest))
+// inspect_sender returns the sender of dev inspect calls, the walrusfs:wallet setting or the signer's address when it
+// is unset. Only the latter needs a mnemonic
+func (config *WalrusFsConfig) inspect_sender() (string, error) {
+	if config.wallet != "" {
+		return config.wallet, nil
+	}
+	signerAccount, err := config.getSigner()
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert digest: %w", err)
+		return "", err
 	}
+	return signerAccount.Address(), nil
+}
 
-	tx := transaction.NewTransaction()
+// moveCall is a call of a function in the walrusfs module, one of the calls of a batch transaction
+type moveCall struct {
+	function  string
+	arguments []interface{}
+	// type arguments in their string form, such as 0x2::sui::SUI
+	typeArguments []interface{}
+	// the package and module of a function outside the walrusfs module, like the walrus system functions
+	pkg    string
+	module string
+}
 
-	bcsEncodedMsg := bytes.Buffer{}
-	bcsEncoder := mystenbcs.NewEncoder(&bcsEncodedMsg)
-	err = bcsEncoder.Encode(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to Encode param: %w", err)
+// target returns the package and module of the function called
+func (call moveCall) target(config *WalrusFsConfig) (string, string) {
+	if call.pkg == "" {
+		return config.pkg, "walrusfs"
 	}
-	val := bcsEncodedMsg.Bytes()
-	arg := tx.Data.V1.AddInput(transaction.CallArg{Pure: &transaction.Pure{
-		Bytes: val,
-	}})
+	return call.pkg, call.module
+}
 
-	arguments := []transaction.Argument{
-		tx.Object(
-			transaction.CallArg{
-				Object: &transaction.ObjectArg{
-					ImmOrOwnedObject: &transaction.SuiObjectRef{
-						ObjectId: *objectIdBytes,
-						Version:  ver,
-						Digest:   *digestBytes,
-					},
-				},
-			},
-		),
-		arg,
+// type_arguments returns the type arguments of the call, an empty list rather than nil since the rpc wants one
+func (call moveCall) type_arguments() []interface{} {
+	if call.typeArguments == nil {
+		return []interface{}{}
 	}
+	return call.typeArguments
+}
 
-	tx.SetSuiClient(cli.(*sui.Client))
-	tx.SetSender(models.SuiAddress(signerAccount.Address))
-	tx.SetGasBudget(100000000)
-	tx.MoveCall(
-		models.SuiAddress(config.pkg),
-		"walrusfs",
-		"stat",
-		[]transaction.TypeTag{},
-		arguments,
-	)
+// execute_move_call builds, signs and executes a call of function in the walrusfs module. Transient failures are
+// retried with the config retry policy, building the transaction again each time so gas objects are current
+func execute_move_call(ctx context.Context, config *WalrusFsConfig, function string, arguments []interface{}) (*models.SuiTransactionBlockResponse, error) {
+	return execute_call(ctx, config, moveCall{function: function, arguments: arguments})
+}
 
-	encodedMsg, err := tx.Data.V1.Kind.Marshal()
+// execute_call is execute_move_call for a call that may have type arguments
+func execute_call(ctx context.Context, config *WalrusFsConfig, call moveCall) (*models.SuiTransactionBlockResponse, error) {
+	return execute_transaction(ctx, config, call.function, func(cli sui.ISuiAPI, signerAccount Signer, budget uint64) (string, uint64, error) {
+		txn, budget, err := build_move_call(ctx, cli, config, signerAccount, call, budget)
+		return txn.TxBytes, budget, err
+	})
+}
+
+// execute_batch_call executes calls as a single transaction, so they all take effect or, if any of them aborts, none
+// of them do. It is retried like execute_move_call
+func execute_batch_call(ctx context.Context, config *WalrusFsConfig, op string, calls []moveCall) (*models.SuiTransactionBlockResponse, error) {
+	return execute_transaction(ctx, config, op, func(cli sui.ISuiAPI, signerAccount Signer, budget uint64) (string, uint64, error) {
+		return build_batch_call(ctx, cli, config, signerAccount, op, calls, budget)
+	})
+}
+
+// execute_transaction signs and executes the transaction returned by build, which gets the budget to build it with
+// and returns the transaction bytes and the budget it ended up using
+func execute_transaction(ctx context.Context, config *WalrusFsConfig, op string, build func(cli sui.ISuiAPI, signerAccount Signer, budget uint64) (string, uint64, error)) (*models.SuiTransactionBlockResponse, error) {
+	if config.readOnly {
+		return nil, ErrReadOnly
+	}
+	cli := config.getSuiClient()
+
+	signerAccount, err := config.getSigner()
 	if err != nil {
-		log.Printf("error tx.Data.V1.Kind.Marshal: %v", err)
+		logger.Debug("cannot get signer", "op", op, "err", err)
 		return nil, err
 	}
 
-	txBytes := mystenbcs.ToBase64(encodedMsg)
-
-	// 5. Call SuiDevInspectTransactionBlock
-	rsp2, err := cli.SuiDevInspectTransactionBlock(ctx, models.SuiDevInspectTransactionBlockRequest{
-		Sender:  config.wallet,
-		TxBytes: txBytes,
+	// the budget the last attempt was built with, reported when the transaction runs out of gas
+	var budget uint64
+	// nothing has been sent while building and signing, a failure there is retried by building the transaction again
+	// so its gas objects are current
+	txBytes, err := with_retry(ctx, config.retryPolicy, op, func() (string, error) {
+		txBytes, txBudget, err := build(cli, signerAccount, config.gas_budget(ctx))
+		if err == nil && config.gas_price(ctx) > 0 {
+			txBytes, txBudget, err = set_gas_price(txBytes, txBudget, config.gas_price(ctx), config.gas_budget(ctx) == 0)
+		}
+		budget = txBudget
+		if err != nil {
+			logger.Debug("cannot build move call", "op", op, "err", err)
+		}
+		return txBytes, err
 	})
-
 	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
 		return nil, err
 	}
-	if len(rsp2.Results) == 0 {
-		// nothing returned, not found
-		return nil, nil
+	signature, err := sign_transaction(signerAccount, txBytes)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := utils.GetTxDigest(txBytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the digest of the %s transaction: %w", op, err)
+	}
+
+	// a submission that fails on the way may still have been executed, so the transaction is looked up by its digest
+	// before it is sent again. It is sent again as it was signed, executing the same transaction twice has no effect
+	// while one built again would spend the gas and objects a second time
+	rsp, err := with_retry(ctx, config.retryPolicy, op, func() (*models.SuiTransactionBlockResponse, error) {
+		rsp, err := cli.SuiExecuteTransactionBlock(ctx, models.SuiExecuteTransactionBlockRequest{
+			TxBytes:   txBytes,
+			Signature: []string{signature},
+			// only fetch the effects field
+			Options: models.SuiTransactionBlockOptions{
+				ShowInput:    true,
+				ShowRawInput: true,
+				ShowEffects:  true,
+			},
+			RequestType: "WaitForLocalExecution",
+		})
+		if err == nil {
+			return &rsp, nil
+		}
+		logger.Debug("cannot execute transaction", "op", op, "digest", digest, "err", err)
+		if is_transient_error(err) {
+			if executed, lookupErr := get_transaction(ctx, cli, digest); lookupErr == nil {
+				logger.Debug("transaction executed despite the failed submission", "op", op, "digest", digest)
+				return executed, nil
+			}
+		}
+		return nil, err
+	})
+	if err != nil {
+		if is_transient_error(err) {
+			return nil, fmt.Errorf("%w, transaction %s may have been executed, check it on chain before retrying", err, digest)
+		}
+		return nil, err
 	}
 
-	type moveCallResult struct {
-		ReturnValues [2]interface{}
+	if err := check_tx_status(op, rsp, budget); err != nil {
+		return nil, err
 	}
+	gasUsed, err := gas_used(rsp.Effects.GasUsed)
+	if err != nil {
+		logger.Debug("cannot read the gas used by a transaction", "op", op, "digest", rsp.Digest, "err", err)
+	}
+	logger.Debug("transaction executed", "op", op, "digest", rsp.Digest, "gas_budget", budget, "gas_used", gasUsed)
+	record_tx(ctx, rsp.Digest, gasUsed)
+	if config.is_wait_finality(ctx) {
+		final, err := wait_finality(ctx, config, op, rsp.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := check_tx_status(op, final, budget); err != nil {
+			return nil, err
+		}
+	}
+	return rsp, nil
+}
 
-	var moveCallReturn []moveCallResult
-	err = json.Unmarshal(rsp2.Results, &moveCallReturn)
+// get_transaction returns the transaction with digest as the node recorded it, an error if the node doesn't know it
+func get_transaction(ctx context.Context, cli sui.ISuiAPI, digest string) (*models.SuiTransactionBlockResponse, error) {
+	rsp, err := cli.SuiGetTransactionBlock(ctx, models.SuiGetTransactionBlockRequest{
+		Digest: digest,
+		Options: models.SuiTransactionBlockOptions{
+			ShowInput:    true,
+			ShowRawInput: true,
+			ShowEffects:  true,
+		},
+	})
 	if err != nil {
-		fmt.Println("json", err.Error())
 		return nil, err
 	}
+	return &rsp, nil
+}
 
-	var dlo ListDirFileItem
-	t := moveCallReturn[0].ReturnValues
-	t1 := t[0].([]interface{})
-	t2 := t1[0].([]interface{})
-	output := make([]byte, 0, len(t2))
-	for i := range t2 {
-		bv := byte(int(t2[i].(float64)))
-		output = append(output, bv)
+// tx_result returns the digest, gas used and created objects of an executed transaction
+func tx_result(rsp *models.SuiTransactionBlockResponse) *TxResult {
+	gasUsed, _ := gas_used(rsp.Effects.GasUsed)
+	rtn := &TxResult{Digest: rsp.Digest, GasUsed: gasUsed, ObjectIds: make([]string, 0, len(rsp.Effects.Created))}
+	for _, created := range rsp.Effects.Created {
+		rtn.ObjectIds = append(rtn.ObjectIds, created.Reference.ObjectId)
 	}
+	return rtn
+}
 
-	if _, err := bcs.Unmarshal(output, &dlo); err != nil {
-		log.Printf("failed to decode: %v", err.Error())
-		return nil, err
+// dev_inspect runs a read only transaction, retrying transient failures with the config retry policy
+func dev_inspect(ctx context.Context, config *WalrusFsConfig, req models.SuiDevInspectTransactionBlockRequest) (models.SuiTransactionBlockResponse, error) {
+	cli := config.getSuiClient()
+	rsp, err := with_retry(ctx, config.retryPolicy, "dev inspect", func() (*models.SuiTransactionBlockResponse, error) {
+		rsp, err := cli.SuiDevInspectTransactionBlock(ctx, req)
+		return &rsp, err
+	})
+	if err != nil {
+		return models.SuiTransactionBlockResponse{}, err
 	}
-
-	return &dlo, nil
+	return *rsp, nil
 }
 
-func list_directory(config *WalrusFsConfig, path string) ([]ListDirFileItem, error) {
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
-	ctx := context.Background()
+// inspect_move_call dev inspects a call of function in the walrusfs module. The walrusfs root object is passed as the
+// first argument, followed by args which are bcs encoded as pure values
+func inspect_move_call(ctx context.Context, config *WalrusFsConfig, function string, args []interface{}, typeArgs []transaction.TypeTag) (models.SuiTransactionBlockResponse, error) {
+	var rtn models.SuiTransactionBlockResponse
+	cli := config.getSuiClient()
 
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
+	sender, err := config.inspect_sender()
 	if err != nil {
-		fmt.Println(err.Error())
-		return nil, err
+		logger.Debug("cannot get signer", "op", function, "err", err)
+		return rtn, err
 	}
 
 	rsp, err := cli.SuiGetObject(ctx, models.SuiGetObjectRequest{
@@ -368,37 +689,29 @@ func list_directory(config *WalrusFsConfig, path string) ([]ListDirFileItem, err
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to SuiGetObject: %w", err)
+		return rtn, fmt.Errorf("failed to SuiGetObject: %w", err)
+	}
+	if rsp.Data == nil {
+		return rtn, fmt.Errorf("walrusfs root object %s not found", config.root)
 	}
 
 	ver, err := strconv.ParseUint(rsp.Data.Version, 0, 64)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ParseUint: %w", err)
+		return rtn, fmt.Errorf("failed to ParseUint: %w", err)
 	}
 
 	objectIdBytes, err := transaction.ConvertSuiAddressStringToBytes(models.SuiAddress(config.root))
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert address: %w", err)
+		return rtn, fmt.Errorf("failed to convert address: %w", err)
 	}
 
 	digestBytes, err := transaction.ConvertObjectDigestStringToBytes((models.ObjectDigest)(rsp.Data.Digest))
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert digest: %w", err)
+		return rtn, fmt.Errorf("failed to convert digest: %w", err)
 	}
 
 	tx := transaction.NewTransaction()
 
-	bcsEncodedMsg := bytes.Buffer{}
-	bcsEncoder := mystenbcs.NewEncoder(&bcsEncodedMsg)
-	err = bcsEncoder.Encode(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to Encode param: %w", err)
-	}
-	val := bcsEncodedMsg.Bytes()
-	arg := tx.Data.V1.AddInput(transaction.CallArg{Pure: &transaction.Pure{
-		Bytes: val,
-	}})
-
 	arguments := []transaction.Argument{
 		tx.Object(
 			transaction.CallArg{
@@ -411,513 +724,1261 @@ func list_directory(config *WalrusFsConfig, path string) ([]ListDirFileItem, err
 				},
 			},
 		),
-		arg,
+	}
+	for i, arg := range args {
+		bcsEncodedMsg := bytes.Buffer{}
+		if err := mystenbcs.NewEncoder(&bcsEncodedMsg).Encode(arg); err != nil {
+			return rtn, fmt.Errorf("failed to Encode param %d: %w", i, err)
+		}
+		arguments = append(arguments, tx.Data.V1.AddInput(transaction.CallArg{Pure: &transaction.Pure{
+			Bytes: bcsEncodedMsg.Bytes(),
+		}}))
+	}
+	if typeArgs == nil {
+		typeArgs = []transaction.TypeTag{}
 	}
 
-	tx.SetSuiClient(cli.(*sui.Client))
-	tx.SetSender(models.SuiAddress(signerAccount.Address))
-	tx.SetGasBudget(100000000)
+	if client, ok := cli.(*sui.Client); ok {
+		tx.SetSuiClient(client)
+	}
+	tx.SetSender(models.SuiAddress(sender))
+	tx.SetGasBudget(DefaultGasBudget)
 	tx.MoveCall(
 		models.SuiAddress(config.pkg),
 		"walrusfs",
-		"list_dir",
-		[]transaction.TypeTag{},
+		function,
+		typeArgs,
 		arguments,
 	)
 
 	encodedMsg, err := tx.Data.V1.Kind.Marshal()
 	if err != nil {
-		log.Printf("error tx.Data.V1.Kind.Marshal: %v", err)
-		return nil, err
+		logger.Debug("cannot marshal transaction", "op", function, "err", err)
+		return rtn, err
 	}
 
-	txBytes := mystenbcs.ToBase64(encodedMsg)
-
-	rsp2, err := cli.SuiDevInspectTransactionBlock(ctx, models.SuiDevInspectTransactionBlockRequest{
-		Sender:  config.wallet,
-		TxBytes: txBytes,
+	return dev_inspect(ctx, config, models.SuiDevInspectTransactionBlockRequest{
+		Sender:  sender,
+		TxBytes: mystenbcs.ToBase64(encodedMsg),
 	})
+}
 
-	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
-		return nil, err
+// decode_return_value returns the bcs encoded first return value of the first move call in dev inspect results.
+// found is false when nothing was returned, which is how the contract's path lookups end for a path that doesn't exist
+func decode_return_value(results json.RawMessage) (output []byte, found bool, err error) {
+	results = bytes.TrimSpace(results)
+	if len(results) == 0 || bytes.Equal(results, []byte("null")) {
+		return nil, false, nil
 	}
 
-	type moveCallResult struct {
-		ReturnValues [2]interface{}
+	var moveCallReturn []struct {
+		ReturnValues []interface{}
 	}
-
-	var moveCallReturn []moveCallResult
-	err = json.Unmarshal(rsp2.Results, &moveCallReturn)
-	if err != nil {
-		fmt.Println("json", err.Error())
-		return nil, err
+	if err := json.Unmarshal(results, &moveCallReturn); err != nil {
+		return nil, false, fmt.Errorf("failed to decode dev inspect results: %w", err)
 	}
-
-	var dlo []ListDirFileItem
-	t := moveCallReturn[0].ReturnValues
-	t1 := t[0].([]interface{})
-	t2 := t1[0].([]interface{})
-	output := make([]byte, 0, len(t2))
-	for i := range t2 {
-		bv := byte(int(t2[i].(float64)))
-		output = append(output, bv)
+	if len(moveCallReturn) == 0 || len(moveCallReturn[0].ReturnValues) == 0 {
+		return nil, false, nil
 	}
 
-	if _, err := bcs.Unmarshal(output, &dlo); err != nil {
-		log.Printf("failed to decode: %v", err.Error())
-		return nil, err
+	// each return value is a pair of the bcs bytes and the move type
+	value, ok := moveCallReturn[0].ReturnValues[0].([]interface{})
+	if !ok || len(value) == 0 {
+		return nil, false, fmt.Errorf("unexpected dev inspect return value %v", moveCallReturn[0].ReturnValues[0])
 	}
-
-	return dlo, nil
+	raw, ok := value[0].([]interface{})
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected dev inspect return value bytes %v", value[0])
+	}
+	output = make([]byte, 0, len(raw))
+	for i, b := range raw {
+		n, ok := b.(float64)
+		if !ok || n < 0 || n > 255 {
+			return nil, false, fmt.Errorf("unexpected dev inspect return value byte %d: %v", i, b)
+		}
+		output = append(output, byte(n))
+	}
+	return output, true, nil
 }
 
-func create_directory(config *WalrusFsConfig, path string) error {
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
+// inspect_return_value returns the first return value of a dev inspect. found is false when the contract aborted
+// because the path looked up doesn't exist, any other failure is an error
+func inspect_return_value(rsp models.SuiTransactionBlockResponse) (output []byte, found bool, err error) {
+	if rsp.Effects.Status.Status == "failure" {
+		if errors.Is(move_abort_kind(rsp.Effects.Status.Error), ErrNotFound) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("dev inspect failed: %s", rsp.Effects.Status.Error)
+	}
+	return decode_return_value(rsp.Results)
+}
 
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
+// stat looks up the file or directory at path, nil if it doesn't exist. Results are served from the
+// listing cache while walrusfs:cachettlms hasn't elapsed
+func stat(ctx context.Context, config *WalrusFsConfig, path string) (*ListDirFileItem, error) {
+	if config.cacheTTL <= 0 {
+		return inspect_stat(ctx, config, path)
+	}
+	if item, ok := listings.getStat(config.root, path, time.Now()); ok {
+		return item, nil
+	}
+	item, err := inspect_stat(ctx, config, path)
 	if err != nil {
-		fmt.Println(err.Error())
-		return err
+		return nil, err
 	}
+	listings.putStat(config.root, path, item, time.Now().Add(config.cacheTTL))
+	return item, nil
+}
 
-	priKey := signerAccount.PriKey
-	var ctx = context.Background()
-
-	tags := make([]string, 0)
-	rsp, err := cli.MoveCall(ctx, models.MoveCallRequest{
-		Signer:          signerAccount.Address,
-		PackageObjectId: config.pkg,
-		Module:          "walrusfs",
-		Function:        "add_dir",
-		TypeArguments:   []interface{}{},
-		Arguments: []interface{}{
-			config.root,
-			"0x6",
-			path,
-			tags,
-		},
-		GasBudget: "100000000",
-	})
-
+func inspect_stat(ctx context.Context, config *WalrusFsConfig, path string) (*ListDirFileItem, error) {
+	rsp, err := inspect_move_call(ctx, config, "stat", []interface{}{path}, nil)
 	if err != nil {
-		log.Printf("error MoveCall: %v", err)
-		return err
+		logger.Debug("dev inspect failed", "op", "stat", "path", path, "err", err)
+		return nil, err
 	}
 
-	rsp2, err := cli.SignAndExecuteTransactionBlock(ctx, models.SignAndExecuteTransactionBlockRequest{
-		TxnMetaData: rsp,
-		PriKey:      priKey,
-		// only fetch the effects field
-		Options: models.SuiTransactionBlockOptions{
-			ShowInput:    true,
-			ShowRawInput: true,
-			ShowEffects:  true,
-		},
-		RequestType: "WaitForLocalExecution",
-	})
-
+	output, found, err := inspect_return_value(rsp)
 	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
-		return err
+		return nil, err
+	}
+	if !found {
+		// nothing returned, not found
+		return nil, nil
 	}
 
-	_, err = cli.SuiGetEvents(ctx, models.SuiGetEventsRequest{
-		Digest: rsp2.Digest,
-	})
+	var dlo ListDirFileItem
 
-	if err != nil {
-		log.Printf("error SuiGetEvents: %v", err)
-		return err
+	if _, err := bcs.Unmarshal(output, &dlo); err != nil {
+		logger.Debug("cannot decode dev inspect result", "op", "stat", "path", path, "err", err)
+		return nil, err
 	}
 
-	return nil
+	return &dlo, nil
 }
 
-func add_file_content(config *WalrusFsConfig, data io.Reader, len int64, dstpath string, overwrite bool) error {
-	req, err := http.NewRequest("PUT", config.publisherUrl+"/v1/blobs?epochs=5", data)
+// list_directory returns the entries of the directory at path, served from the listing cache like stat
+func list_directory(ctx context.Context, config *WalrusFsConfig, path string) ([]ListDirFileItem, error) {
+	if config.cacheTTL <= 0 {
+		return inspect_list_directory(ctx, config, path)
+	}
+	if items, ok := listings.getList(config.root, path, time.Now()); ok {
+		return items, nil
+	}
+	items, err := inspect_list_directory(ctx, config, path)
 	if err != nil {
-		log.Printf("error http.NewRequest: %v", err)
-		return err
+		return nil, err
 	}
+	listings.putList(config.root, path, items, time.Now().Add(config.cacheTTL))
+	return items, nil
+}
 
-	httpclient := &http.Client{}
-	res, err := httpclient.Do(req)
+func inspect_list_directory(ctx context.Context, config *WalrusFsConfig, path string) ([]ListDirFileItem, error) {
+	rsp, err := inspect_move_call(ctx, config, "list_dir", []interface{}{path}, nil)
 	if err != nil {
-		log.Printf("error httpclient.Do: %v", err)
-		return err
+		logger.Debug("dev inspect failed", "op", "list_directory", "path", path, "err", err)
+		return nil, err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	output, found, err := inspect_return_value(rsp)
 	if err != nil {
-		log.Printf("error io.ReadAll: %v", err)
-		return err
+		return nil, err
 	}
-	log.Println(string(body))
-
-	var objmap map[string]interface{}
-	if err := json.Unmarshal(body, &objmap); err != nil {
-		log.Printf("error json.Unmarshal: %v", err)
-		return err
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
 	}
 
-	blob_id := ""
-	if objmap["newlyCreated"] != nil {
-		nc := objmap["newlyCreated"].(map[string]interface{})
-		bo := nc["blobObject"].(map[string]interface{})
-		blob_id = bo["blobId"].(string)
-	} else if objmap["alreadyCertified"] != nil {
-		ac := objmap["alreadyCertified"].(map[string]interface{})
-		blob_id = ac["blobId"].(string)
-	} else {
-		log.Printf("json error with no blob_id: %v", objmap)
-		return err
+	var dlo []ListDirFileItem
+
+	if _, err := bcs.Unmarshal(output, &dlo); err != nil {
+		logger.Debug("cannot decode dev inspect result", "op", "list_directory", "path", path, "err", err)
+		return nil, err
 	}
 
-	// save info to sui
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
+	return dlo, nil
+}
 
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
+func create_directory(ctx context.Context, config *WalrusFsConfig, path string, tags []string) (*TxResult, error) {
+	path, err := ValidatePath(path)
 	if err != nil {
-		fmt.Println(err.Error())
-		return err
+		return nil, err
 	}
-
-	priKey := signerAccount.PriKey
-	var ctx = context.Background()
-
-	tags := make([]string, 0)
-	rsp, err := cli.MoveCall(ctx, models.MoveCallRequest{
-		Signer:          signerAccount.Address,
-		PackageObjectId: config.pkg,
-		Module:          "walrusfs",
-		Function:        "add_file",
-		TypeArguments:   []interface{}{},
-		Arguments: []interface{}{
-			config.root,
-			"0x6",
-			dstpath,
-			tags,
-			strconv.FormatInt(len, 10),
-			blob_id,
-			// calvin: TODO
-			strconv.FormatInt(0, 10),
-			overwrite,
-		},
-		GasBudget: "100000000",
+	defer listings.invalidate(config.root, path)
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	rsp, err := execute_move_call(ctx, config, "add_dir", []interface{}{
+		config.root,
+		"0x6",
+		path,
+		tags,
 	})
-
 	if err != nil {
-		log.Printf("error MoveCall: %v", err)
-		return err
+		return nil, err
 	}
+	return tx_result(rsp), nil
+}
 
-	rsp2, err := cli.SignAndExecuteTransactionBlock(ctx, models.SignAndExecuteTransactionBlockRequest{
-		TxnMetaData: rsp,
-		PriKey:      priKey,
-		// only fetch the effects field
-		Options: models.SuiTransactionBlockOptions{
-			ShowInput:    true,
-			ShowRawInput: true,
-			ShowEffects:  true,
-		},
-		RequestType: "WaitForLocalExecution",
-	})
+// getStorageEpochs resolves the number of epochs to store a blob for. Valid values are 1 to MaxStorageEpochs,
+// an override of 0 falls back to walrusfs:storageepochs and then to DefaultStorageEpochs
+func getStorageEpochs(config *WalrusFsConfig, override int) (int, error) {
+	epochs := override
+	if epochs == 0 {
+		epochs = config.storageEpochs
+	}
+	if epochs == 0 {
+		epochs = DefaultStorageEpochs
+	}
+	if epochs < 1 || epochs > MaxStorageEpochs {
+		return 0, fmt.Errorf("invalid storage epochs %d, must be between 1 and %d", epochs, MaxStorageEpochs)
+	}
+	return epochs, nil
+}
 
-	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
-		return err
+type deletableKey struct{}
+
+// WithDeletable returns a context whose walrus uploads store deletable blobs, which can be deleted to free their
+// storage before they expire, or permanent ones instead of following walrusfs:deletable
+func WithDeletable(ctx context.Context, deletable bool) context.Context {
+	return context.WithValue(ctx, deletableKey{}, deletable)
+}
+
+// is_deletable returns whether blobs uploaded with ctx are stored deletable
+func (config *WalrusFsConfig) is_deletable(ctx context.Context) bool {
+	if deletable, ok := ctx.Value(deletableKey{}).(bool); ok {
+		return deletable
 	}
+	return config.deletable
+}
 
-	_, err = cli.SuiGetEvents(ctx, models.SuiGetEventsRequest{
-		Digest: rsp2.Digest,
-	})
+type preserveTimesKey struct{}
+
+// WithPreserveTimes returns a context whose walrus copies keep the modification times of the files copied, the default,
+// or record the time of the copy instead
+func WithPreserveTimes(ctx context.Context, preserve bool) context.Context {
+	return context.WithValue(ctx, preserveTimesKey{}, preserve)
+}
+
+// preserve_times returns whether copies made with ctx keep modification times
+func preserve_times(ctx context.Context) bool {
+	if preserve, ok := ctx.Value(preserveTimesKey{}).(bool); ok {
+		return preserve
+	}
+	return true
+}
+
+// TxRecorder collects the digests of the transactions executed with a context from WithTxRecorder
+type TxRecorder struct {
+	lock    sync.Mutex
+	digests []string
+	gasUsed int64
+}
+
+// Digests returns the digests recorded so far, in the order the transactions executed
+func (r *TxRecorder) Digests() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.digests)
+}
+
+// GasUsed returns the MIST the transactions recorded so far cost together, less the storage they freed
+func (r *TxRecorder) GasUsed() int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.gasUsed
+}
+
+type txRecorderKey struct{}
 
+// WithTxRecorder returns a context whose walrusfs transactions are recorded in rec, for callers that report the
+// on-chain writes an operation made
+func WithTxRecorder(ctx context.Context, rec *TxRecorder) context.Context {
+	return context.WithValue(ctx, txRecorderKey{}, rec)
+}
+
+// record_tx adds an executed transaction to the recorder of ctx, if there is one
+func record_tx(ctx context.Context, digest string, gasUsed int64) {
+	rec, ok := ctx.Value(txRecorderKey{}).(*TxRecorder)
+	if !ok || rec == nil {
+		return
+	}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	rec.digests = append(rec.digests, digest)
+	rec.gasUsed += gasUsed
+}
+
+// publish_blob stores size bytes of data (-1 if unknown) on walrus through the publishers for the given number of epochs.
+// A publisher that returns a 5xx or can't be reached is retried with backoff, moving on to the next configured publisher each time
+func publish_blob(ctx context.Context, config *WalrusFsConfig, data io.Reader, size int64, epochs int) (*PublishBlobResult, error) {
+	if config.readOnly {
+		return nil, ErrReadOnly
+	}
+	epochs, err := getStorageEpochs(config, epochs)
 	if err != nil {
-		log.Printf("error SuiGetEvents: %v", err)
-		return err
+		return nil, err
+	}
+	if len(config.publisherUrls) == 0 {
+		return nil, fmt.Errorf("no walrus publisher configured")
 	}
 
-	return nil
+	body, rewind, err := rewindable_body(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < PublishMaxAttempts; attempt++ {
+		if attempt > 0 {
+			if rewind == nil {
+				// the body was too large to buffer and can't be read again
+				break
+			}
+			if err := rewind(); err != nil {
+				return nil, err
+			}
+			select {
+			case <-ctx.Done():
+				return nil, context.Cause(ctx)
+			case <-time.After(publishRetryBaseDelay << (attempt - 1)):
+			}
+		}
+
+		publisherUrl := config.publisherUrls[attempt%len(config.publisherUrls)]
+		blob, retry, err := put_blob(ctx, config, publisherUrl, body, size, epochs)
+		if err == nil {
+			return blob, nil
+		}
+		lastErr = err
+		if !retry || ctx.Err() != nil {
+			break
+		}
+		logger.Warn("cannot publish blob, retrying", "publisher", publisherUrl, "attempt", attempt+1, "err", err)
+	}
+	return nil, lastErr
 }
 
-func add_file(config *WalrusFsConfig, filepath string, dstpath string, overwrite bool) error {
-	// publish to walrus
-	data, err := os.Open(filepath)
+// rewindable_body returns a reader for data and a function that rewinds it for another upload attempt. Readers that
+// can't seek are buffered in memory up to MaxBufferedPublishSize, beyond that the rewind function is nil
+func rewindable_body(data io.Reader) (io.Reader, func() error, error) {
+	if rs, ok := data.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return rs, func() error {
+				_, err := rs.Seek(start, io.SeekStart)
+				return err
+			}, nil
+		}
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(data, MaxBufferedPublishSize+1))
 	if err != nil {
-		log.Printf("error Open file: %v", err)
+		return nil, nil, err
+	}
+	if len(buf) > MaxBufferedPublishSize {
+		return io.MultiReader(bytes.NewReader(buf), data), nil, nil
+	}
+	r := bytes.NewReader(buf)
+	return r, func() error {
+		_, err := r.Seek(0, io.SeekStart)
 		return err
+	}, nil
+}
+
+// put_blob uploads body to a single publisher, retry is set when the error is worth trying again
+func put_blob(ctx context.Context, config *WalrusFsConfig, publisherUrl string, body io.Reader, size int64, epochs int) (blob *PublishBlobResult, retry bool, err error) {
+	defer func(start time.Time) { config.record_op(OpPublish, start, max(size, 0), err) }(time.Now())
+	if _, ok := body.(io.Closer); ok {
+		// the transport closes the request body, keep it open so it can be rewound for the next attempt
+		body = io.NopCloser(body)
+	}
+	query := "epochs=" + strconv.Itoa(epochs)
+	if config.is_deletable(ctx) {
+		query += "&deletable=true"
+	}
+	if signerAccount, err := config.getSigner(); err == nil {
+		// the blob object goes to the signer, which can then extend its storage
+		query += "&send_object_to=" + signerAccount.Address()
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", publisherUrl+"/v1/blobs?"+query, body)
+	if err != nil {
+		logger.Debug("cannot create publish request", "publisher", publisherUrl, "err", err)
+		return nil, false, err
+	}
+	if config.uploadLimiter != nil && req.Body != nil {
+		// after the request is made, which takes the length of bytes and strings readers
+		req.Body = rate_limited_body(ctx, req.Body, config.uploadLimiter)
+	}
+	if size > 0 {
+		// readers other than the bytes and strings ones would otherwise be sent chunked
+		req.ContentLength = size
 	}
-	defer data.Close()
 
-	fi, err := data.Stat()
+	res, err := config.getHttpClient().Do(req)
 	if err != nil {
-		log.Printf("error file Stat: %v", err)
-		return err
+		logger.Debug("publish request failed", "publisher", publisherUrl, "err", err)
+		return nil, true, with_kind(ErrWalrusUnreachable, err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		logger.Debug("cannot read publisher response", "publisher", publisherUrl, "err", err)
+		return nil, true, err
+	}
+	logger.Debug("publisher response", "publisher", publisherUrl, "status", res.Status, "body", string(resBody))
+
+	if res.StatusCode >= 500 {
+		return nil, true, typed_error(ErrWalrusUnreachable, "publisher %s returned %s: %s", publisherUrl, res.Status, body_snippet(resBody))
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("publisher %s returned %s: %s", publisherUrl, res.Status, body_snippet(resBody))
+	}
+
+	blob, err = parse_publish_response(resBody)
+	if err != nil {
+		logger.Debug("cannot parse publisher response", "publisher", publisherUrl, "err", err)
+		return nil, false, fmt.Errorf("publisher %s: %w", publisherUrl, err)
+	}
+	return blob, false, nil
+}
+
+// parse_publish_response reads the blob id and storage epochs from a publisher response, which describes either a
+// newly created blob object or a blob that was already certified
+func parse_publish_response(body []byte) (*PublishBlobResult, error) {
+	var objmap map[string]interface{}
+	if err := json.Unmarshal(body, &objmap); err != nil {
+		return nil, fmt.Errorf("cannot decode response %s: %w", body_snippet(body), err)
 	}
 
-	return add_file_content(config, data, fi.Size(), dstpath, overwrite)
+	var blobId string
+	var endEpoch, registeredEpoch float64
+	var certified bool
+	if nc, ok := objmap["newlyCreated"].(map[string]interface{}); ok {
+		bo, ok := nc["blobObject"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("newly created blob has no blob object: %s", body_snippet(body))
+		}
+		blobId, _ = bo["blobId"].(string)
+		registeredEpoch, _ = bo["registeredEpoch"].(float64)
+		if storage, ok := bo["storage"].(map[string]interface{}); ok {
+			endEpoch, _ = storage["endEpoch"].(float64)
+		}
+		// null until the blob is certified
+		_, certified = bo["certifiedEpoch"].(float64)
+	} else if ac, ok := objmap["alreadyCertified"].(map[string]interface{}); ok {
+		blobId, _ = ac["blobId"].(string)
+		endEpoch, _ = ac["endEpoch"].(float64)
+		certified = true
+	} else {
+		return nil, fmt.Errorf("response is neither a newly created nor an already certified blob: %s", body_snippet(body))
+	}
+	if blobId == "" {
+		return nil, fmt.Errorf("response has no blob id: %s", body_snippet(body))
+	}
+
+	return &PublishBlobResult{
+		BlobId:          blobId,
+		EndEpoch:        int64(endEpoch),
+		RegisteredEpoch: int64(registeredEpoch),
+		Certified:       certified,
+	}, nil
 }
 
-func get_file(config *WalrusFsConfig, blobId string) ([]byte, error) {
-	resp, err := http.Get(config.aggregatorUrl + "/v1/blobs/" + blobId)
+// detect_content_type returns the content type of a file being uploaded to dstpath, using the extension when it is
+// known and sniffing the first 512 bytes otherwise. The returned reader must be used in place of data
+func detect_content_type(dstpath string, data io.Reader) (string, io.Reader, error) {
+	ext := filepath.Ext(dstpath)
+	if mimeType, ok := fileutil.StaticMimeTypeMap[ext]; ok {
+		return mimeType, data, nil
+	}
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		return mimeType, data, nil
+	}
+
+	var start int64 = -1
+	if rs, ok := data.(io.ReadSeeker); ok {
+		if pos, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			start = pos
+		}
+	}
+
+	buf := make([]byte, 512)
+	// ignore the error (EOF / UnexpectedEOF is fine, just process how much we got back)
+	n, err := io.ReadAtLeast(data, buf, 512)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	buf = buf[:n]
+	rest := io.MultiReader(bytes.NewReader(buf), data)
+	if start >= 0 {
+		// keep seekable readers seekable so uploads can be retried without buffering
+		if _, err := data.(io.ReadSeeker).Seek(start, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		rest = data
+	}
+	if n == 0 {
+		return "text/plain", rest, nil
+	}
+	return http.DetectContentType(buf), rest, nil
+}
+
+// validate_tags checks tags given by the user before they are stored
+func validate_tags(tags []string) error {
+	for _, tag := range tags {
+		if tag == "" {
+			return fmt.Errorf("tags can't be empty")
+		}
+	}
+	return nil
+}
+
+// ValidatePath checks a walrus path a file or directory is about to be written at and returns it cleaned, absolute
+// and without repeated or trailing separators. Every name in it must be valid utf-8 without control characters and
+// can't be . or .., which the contract would store as plain names, and the root itself is never written
+func ValidatePath(path string) (string, error) {
+	if !utf8.ValidString(path) {
+		return "", typed_error(ErrInvalidPath, "invalid path %q: not valid utf-8", path)
+	}
+	var names []string
+	for _, name := range strings.Split(path, fspath.Separator) {
+		switch {
+		case name == "":
+			continue
+		case name == "." || name == "..":
+			return "", typed_error(ErrInvalidPath, "invalid path %q: %q can't be used as a name", path, name)
+		case strings.ContainsFunc(name, unicode.IsControl):
+			return "", typed_error(ErrInvalidPath, "invalid path %q: names can't contain control characters", path)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "", typed_error(ErrInvalidPath, "invalid path %q: no file or directory name", path)
+	}
+	return fspath.Separator + strings.Join(names, fspath.Separator), nil
+}
+
+// add_file_content publishes data and records it at dstpath with tags and the content type detected from it.
+// Content larger than the chunk size is stored as several blobs. createTs is passed on to add_file_blob
+func add_file_content(ctx context.Context, config *WalrusFsConfig, data io.Reader, len int64, dstpath string, tags []string, createTs int64, overwrite bool, epochs int) (*TxResult, error) {
+	rec, err := publish_file(ctx, config, data, len, dstpath, tags, createTs, overwrite, epochs)
 	if err != nil {
-		log.Printf("error http.Get: %v", err)
 		return nil, err
 	}
+	return record_file(ctx, config, rec)
+}
 
-	defer resp.Body.Close()
+// check_upload_size fails for a file of size bytes over walrusfs:maxuploadsizemb, before any of it is published.
+// Files are already stored as blobs of at most walrusfs:chunksizemb, so the walrus limit on blobs never applies to
+// a whole file
+func (config *WalrusFsConfig) check_upload_size(dstpath string, size int64) error {
+	if config.maxUploadSize <= 0 || size <= config.maxUploadSize {
+		return nil
+	}
+	return typed_error(ErrTooLarge, "cannot upload %s, it is %d bytes and exceeds the maximum upload size of %d bytes, raise walrusfs:maxuploadsizemb to upload it", dstpath, size, config.maxUploadSize)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+// publish_file publishes data like add_file_content and returns the record to add for it, without a transaction.
+// With dedup uploads content that is already at dstpath is recorded again without publishing it
+func publish_file(ctx context.Context, config *WalrusFsConfig, data io.Reader, len int64, dstpath string, tags []string, createTs int64, overwrite bool, epochs int) (*fileRecord, error) {
+	dstpath, err := ValidatePath(dstpath)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.check_upload_size(dstpath, len); err != nil {
+		return nil, err
+	}
+	var dup *ListDirFileItem
+	if config.is_dedup_upload(ctx) {
+		if dup, err = find_duplicate(ctx, config, data, len, dstpath, epochs); err != nil {
+			return nil, err
+		}
+	}
+	mimeType, data, err := detect_content_type(dstpath, data)
 	if err != nil {
-		log.Printf("error ioutil.ReadAll: %v", err)
 		return nil, err
 	}
+	if dup != nil {
+		return &fileRecord{
+			path:          dstpath,
+			size:          len,
+			blobIds:       file_blob_ids(dup.WalrusBlobId, dup.WalrusBlobIds),
+			contentSha256: dup.ContentSha256,
+			endEpoch:      dup.WalrusEpochTill,
+			deletable:     dup.Deletable,
+			certified:     dup.Certified,
+			coding:        item_coding(dup),
+			mimeType:      mimeType,
+			tags:          tags,
+			createTs:      createTs,
+			overwrite:     overwrite,
+		}, nil
+	}
+
+	coding := blobCoding{encrypted: config.encrypts()}
+	if coding.compression, err = config.compression_for(ctx, mimeType); err != nil {
+		return nil, err
+	}
+	hashed := new_hashing_reader(data)
+	blobIds, endEpoch, certified, err := publish_chunks(ctx, config, hashed, len, epochs, coding)
+	if err != nil {
+		return nil, err
+	}
+	contentSha256, err := hashed.sum(len)
+	if err != nil {
+		return nil, err
+	}
+	if config.is_verify_upload(ctx) {
+		// before the file is recorded, so a blob that can't be read back leaves nothing on chain
+		if err := verify_upload(ctx, config, blobIds, contentSha256, coding); err != nil {
+			return nil, fmt.Errorf("upload of %s failed verification: %w", dstpath, err)
+		}
+	}
 
-	return body, nil
+	return &fileRecord{
+		path:          dstpath,
+		size:          len,
+		blobIds:       blobIds,
+		contentSha256: contentSha256,
+		endEpoch:      endEpoch,
+		deletable:     config.is_deletable(ctx),
+		certified:     certified,
+		coding:        coding,
+		mimeType:      mimeType,
+		tags:          tags,
+		createTs:      createTs,
+		overwrite:     overwrite,
+	}, nil
 }
 
-func rename(config *WalrusFsConfig, frompath string, topath string, isdir bool) error {
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
+// hashingReader computes the sha256 of the content read through it. Every byte is hashed once, in order,
+// even when publish retries rewind the reader and read parts of it again
+type hashingReader struct {
+	r      io.Reader
+	h      hash.Hash
+	start  int64
+	pos    int64
+	hashed int64
+}
 
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
+func new_hashing_reader(r io.Reader) *hashingReader {
+	hr := &hashingReader{r: r, h: sha256.New()}
+	if s, ok := r.(io.Seeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			hr.start, hr.pos, hr.hashed = start, start, start
+		}
+	}
+	return hr
+}
+
+func (hr *hashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	if end := hr.pos + int64(n); end > hr.hashed {
+		hr.h.Write(p[hr.hashed-hr.pos : n])
+		hr.hashed = end
+	}
+	hr.pos += int64(n)
+	return n, err
+}
+
+func (hr *hashingReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := hr.r.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("reader of type %T is not seekable", hr.r)
+	}
+	pos, err := s.Seek(offset, whence)
 	if err != nil {
-		fmt.Println(err.Error())
-		return err
+		return 0, err
 	}
+	if pos > hr.hashed {
+		return 0, fmt.Errorf("can't seek past the %d bytes hashed so far", hr.hashed-hr.start)
+	}
+	hr.pos = pos
+	return pos, nil
+}
 
-	priKey := signerAccount.PriKey
-	var ctx = context.Background()
+// sum returns the hex sha256 of the content, which must have been read up to size bytes
+func (hr *hashingReader) sum(size int64) (string, error) {
+	if hr.hashed-hr.start != size {
+		return "", fmt.Errorf("published %d bytes of content expected to be %d bytes long", hr.hashed-hr.start, size)
+	}
+	return hex.EncodeToString(hr.h.Sum(nil)), nil
+}
 
-	var funcname string
-	if isdir {
-		funcname = "rename_dir"
-	} else {
-		funcname = "rename_file"
+// publish_chunks publishes size bytes of data as blobs of at most the configured chunk size, returning the blob ids
+// in order, the epoch until which all of them are stored and whether all of them were certified. Each chunk is
+// compressed and encrypted as coding says before it is published, size stays the size of the content
+func publish_chunks(ctx context.Context, config *WalrusFsConfig, data io.Reader, size int64, epochs int, coding blobCoding) ([]string, int64, bool, error) {
+	chunkSize := config.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	chunked := size > chunkSize
+	var blobIds []string
+	var endEpoch int64
+	certified := true
+	for offset := int64(0); offset == 0 || offset < size; offset += chunkSize {
+		n := size
+		chunk := data
+		if chunked {
+			n = min(chunkSize, size-offset)
+			chunk = chunk_reader(data, n)
+		}
+		blobData, blobSize := chunk, n
+		if !coding.plain() {
+			encoded, err := encode_chunk(config, coding, chunk, n)
+			if err != nil {
+				return nil, 0, false, err
+			}
+			blobData, blobSize = bytes.NewReader(encoded), int64(len(encoded))
+		}
+		blob, err := publish_blob(ctx, config, blobData, blobSize, epochs)
+		if err != nil {
+			if len(blobIds) > 0 {
+				return nil, 0, false, fmt.Errorf("error publishing chunk %d of %d bytes: %w", len(blobIds)+1, n, err)
+			}
+			return nil, 0, false, err
+		}
+		if seeker, ok := chunk.(io.Seeker); ok && chunked {
+			// make sure the next chunk starts where this one ends, even if the publisher didn't read all of it
+			if _, err := seeker.Seek(n, io.SeekStart); err != nil {
+				return nil, 0, false, err
+			}
+		}
+		if blob.RegisteredEpoch > 0 {
+			config.observeEpoch(blob.RegisteredEpoch)
+		}
+		blobIds = append(blobIds, blob.BlobId)
+		if endEpoch == 0 || blob.EndEpoch < endEpoch {
+			endEpoch = blob.EndEpoch
+		}
+		certified = certified && blob.Certified
 	}
-	rsp, err := cli.MoveCall(ctx, models.MoveCallRequest{
-		Signer:          signerAccount.Address,
-		PackageObjectId: config.pkg,
-		Module:          "walrusfs",
-		Function:        funcname,
-		TypeArguments:   []interface{}{},
-		Arguments: []interface{}{
-			config.root,
-			frompath,
-			topath,
-		},
-		GasBudget: "100000000",
-	})
+	return blobIds, endEpoch, certified, nil
+}
 
-	if err != nil {
-		log.Printf("error MoveCall: %v", err)
-		return err
+// chunk_reader reads the next n bytes of data. When data can seek the chunk can be rewound as well, so publishing
+// a chunk larger than MaxBufferedPublishSize can still be retried
+func chunk_reader(data io.Reader, n int64) io.Reader {
+	if rs, ok := data.(io.ReadSeeker); ok {
+		if start, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			return &seekableChunk{rs: rs, start: start, size: n}
+		}
 	}
+	return io.LimitReader(data, n)
+}
 
-	_, err = cli.SignAndExecuteTransactionBlock(ctx, models.SignAndExecuteTransactionBlockRequest{
-		TxnMetaData: rsp,
-		PriKey:      priKey,
-		// only fetch the effects field
-		Options: models.SuiTransactionBlockOptions{
-			ShowInput:    true,
-			ShowRawInput: true,
-			ShowEffects:  true,
-		},
-		RequestType: "WaitForLocalExecution",
+// seekableChunk is a window of size bytes of rs from start, positions are relative to start
+type seekableChunk struct {
+	rs    io.ReadSeeker
+	start int64
+	size  int64
+	pos   int64
+}
+
+func (c *seekableChunk) Read(p []byte) (int, error) {
+	if c.pos >= c.size {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), c.size-c.pos)]
+	n, err := c.rs.Read(p)
+	c.pos += int64(n)
+	return n, err
+}
+
+func (c *seekableChunk) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += c.pos
+	case io.SeekEnd:
+		offset += c.size
+	}
+	if offset < 0 || offset > c.size {
+		return 0, fmt.Errorf("seek to %d outside of chunk of %d bytes", offset, c.size)
+	}
+	if _, err := c.rs.Seek(c.start+offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	c.pos = offset
+	return offset, nil
+}
+
+// fileRecord is a file entry pointing at published walrus blobs, the arguments of add_file or add_chunked_file
+type fileRecord struct {
+	path          string
+	size          int64
+	blobIds       []string
+	contentSha256 string
+	endEpoch      int64
+	deletable     bool
+	// whether all blobs were certified when they were published
+	certified bool
+	// how the chunks were compressed and encrypted before they were published
+	coding blobCoding
+	// the content type detected at upload, "" for none
+	mimeType string
+	tags     []string
+	// creation time to record in ms, 0 records the time of the transaction
+	createTs  int64
+	overwrite bool
+}
+
+// move_call returns the call adding the file, add_chunked_file when it is stored as several blobs
+func (rec *fileRecord) move_call(config *WalrusFsConfig) moveCall {
+	call := moveCall{function: "add_file"}
+	var blobArg interface{} = rec.blobIds[0]
+	if len(rec.blobIds) > 1 {
+		call.function = "add_chunked_file"
+		blobArg = rec.blobIds
+	}
+	tags := rec.tags
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	call.arguments = []interface{}{
+		config.root,
+		"0x6",
+		rec.path,
+		tags,
+		strconv.FormatInt(rec.size, 10),
+		blobArg,
+		rec.contentSha256,
+		strconv.FormatInt(rec.endEpoch, 10),
+		rec.deletable,
+		rec.certified,
+		rec.coding.encrypted,
+		rec.coding.compression,
+		rec.mimeType,
+		strconv.FormatInt(max(rec.createTs, 0), 10),
+		rec.overwrite,
+	}
+	return call
+}
+
+// tx_result returns the result of the transaction that added the file
+func (rec *fileRecord) tx_result(rsp *models.SuiTransactionBlockResponse) *TxResult {
+	rtn := tx_result(rsp)
+	rtn.BlobId = rec.blobIds[0]
+	if len(rec.blobIds) > 1 {
+		rtn.BlobIds = rec.blobIds
+	}
+	return rtn
+}
+
+// add_file_blob records an already published walrus blob at dstpath without uploading anything.
+// create_ts is the creation time to record in ms, 0 records the time of the transaction
+func add_file_blob(ctx context.Context, config *WalrusFsConfig, dstpath string, size int64, blob_ids []string, content_sha256 string, end_epoch int64, deletable bool, certified bool, coding blobCoding, mime_type string, tags []string, create_ts int64, overwrite bool) (*TxResult, error) {
+	dstpath, err := ValidatePath(dstpath)
+	if err != nil {
+		return nil, err
+	}
+	return record_file(ctx, config, &fileRecord{
+		path:          dstpath,
+		size:          size,
+		blobIds:       blob_ids,
+		contentSha256: content_sha256,
+		endEpoch:      end_epoch,
+		deletable:     deletable,
+		certified:     certified,
+		coding:        coding,
+		mimeType:      mime_type,
+		tags:          tags,
+		createTs:      create_ts,
+		overwrite:     overwrite,
 	})
+}
 
+// record_file adds the file entry of rec in a transaction of its own
+func record_file(ctx context.Context, config *WalrusFsConfig, rec *fileRecord) (*TxResult, error) {
+	defer listings.invalidate(config.root, rec.path)
+	if len(rec.blobIds) == 0 {
+		return nil, fmt.Errorf("no walrus blobs for %s", rec.path)
+	}
+	call := rec.move_call(config)
+	rsp, err := execute_call(ctx, config, call)
 	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
-		return err
+		return nil, err
 	}
+	return rec.tx_result(rsp), nil
+}
 
-	return nil
+// record_files adds the file entries of recs with execute_calls, the results and errors are in the order of recs
+func record_files(ctx context.Context, config *WalrusFsConfig, recs []*fileRecord) ([]*TxResult, []error) {
+	results := make([]*TxResult, len(recs))
+	errs := make([]error, len(recs))
+	// indexes of the records that have calls
+	var pending []int
+	var calls []moveCall
+	for i, rec := range recs {
+		if len(rec.blobIds) == 0 {
+			errs[i] = fmt.Errorf("no walrus blobs for %s", rec.path)
+			continue
+		}
+		pending = append(pending, i)
+		calls = append(calls, rec.move_call(config))
+	}
+	rsps, callErrs := execute_calls(ctx, config, "add_files", calls)
+	for n, i := range pending {
+		listings.invalidate(config.root, recs[i].path)
+		if callErrs[n] != nil {
+			errs[i] = callErrs[n]
+		} else {
+			results[i] = recs[i].tx_result(rsps[n])
+		}
+	}
+	return results, errs
 }
 
-func delete(config *WalrusFsConfig, path string, isdir bool) error {
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
+// execute_calls executes calls in batch transactions of up to MaxBatchCalls. A batch is all or nothing, so when one
+// fails its calls are executed one transaction each and only the calls that fail on their own report an error.
+// The responses and errors are in the order of calls
+func execute_calls(ctx context.Context, config *WalrusFsConfig, op string, calls []moveCall) ([]*models.SuiTransactionBlockResponse, []error) {
+	rsps := make([]*models.SuiTransactionBlockResponse, len(calls))
+	errs := make([]error, len(calls))
+	for start := 0; start < len(calls); start += MaxBatchCalls {
+		end := min(start+MaxBatchCalls, len(calls))
+		if end-start == 1 {
+			rsps[start], errs[start] = execute_call(ctx, config, calls[start])
+			continue
+		}
+		rsp, err := execute_batch_call(ctx, config, op, calls[start:end])
+		switch {
+		case err == nil:
+			for i := start; i < end; i++ {
+				rsps[i] = rsp
+			}
+		case ctx.Err() != nil:
+			for i := start; i < end; i++ {
+				errs[i] = err
+			}
+		default:
+			logger.Warn("batch transaction failed, executing its calls one at a time", "op", op, "calls", end-start, "err", err)
+			for i := start; i < end; i++ {
+				rsps[i], errs[i] = execute_call(ctx, config, calls[i])
+			}
+		}
+	}
+	return rsps, errs
+}
 
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
+func add_file(ctx context.Context, config *WalrusFsConfig, filepath string, dstpath string, tags []string, overwrite bool, epochs int) (*TxResult, error) {
+	// publish to walrus
+	data, err := os.Open(filepath)
 	if err != nil {
-		fmt.Println(err.Error())
-		return err
+		logger.Debug("cannot open file", "op", "add_file", "path", filepath, "err", err)
+		return nil, err
+	}
+	defer data.Close()
+
+	fi, err := data.Stat()
+	if err != nil {
+		logger.Debug("cannot stat file", "op", "add_file", "path", filepath, "err", err)
+		return nil, err
 	}
 
-	priKey := signerAccount.PriKey
-	var ctx = context.Background()
+	var createTs int64
+	if preserve_times(ctx) {
+		createTs = fi.ModTime().UnixMilli()
+	}
+	return add_file_content(ctx, config, data, fi.Size(), dstpath, tags, createTs, overwrite, epochs)
+}
 
-	var funcname string
-	if isdir {
-		funcname = "delete_dir"
-	} else {
-		funcname = "delete_file"
+// get_file downloads the content stored in blobIds, joining the chunks of a file stored as several blobs once the
+// coding of each is undone. The content is verified against contentSha256 unless it is empty, as for files uploaded
+// without a checksum
+func get_file(ctx context.Context, config *WalrusFsConfig, contentSha256 string, coding blobCoding, blobIds ...string) ([]byte, error) {
+	var content []byte
+	for _, blobId := range blobIds {
+		b, err := get_blob(ctx, config, blobId)
+		if err == nil {
+			b, err = decode_blob(config, coding, blobId, b)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(blobIds) == 1 {
+			content = b
+		} else {
+			content = append(content, b...)
+		}
 	}
-	rsp, err := cli.MoveCall(ctx, models.MoveCallRequest{
-		Signer:          signerAccount.Address,
-		PackageObjectId: config.pkg,
-		Module:          "walrusfs",
-		Function:        funcname,
-		TypeArguments:   []interface{}{},
-		Arguments: []interface{}{
-			config.root,
-			path,
-		},
-		GasBudget: "100000000",
-	})
+	if err := verify_content(content, contentSha256); err != nil {
+		return nil, fmt.Errorf("walrus blob %s: %w", strings.Join(blobIds, ","), err)
+	}
+	return content, nil
+}
 
-	if err != nil {
-		log.Printf("error MoveCall: %v", err)
-		return err
+// verify_content checks content against the hex sha256 it was uploaded with, if there is one
+func verify_content(content []byte, contentSha256 string) error {
+	if contentSha256 == "" {
+		return nil
 	}
+	sum := sha256.Sum256(content)
+	return verify_sum(sum[:], contentSha256)
+}
 
-	_, err = cli.SignAndExecuteTransactionBlock(ctx, models.SignAndExecuteTransactionBlockRequest{
-		TxnMetaData: rsp,
-		PriKey:      priKey,
-		// only fetch the effects field
-		Options: models.SuiTransactionBlockOptions{
-			ShowInput:    true,
-			ShowRawInput: true,
-			ShowEffects:  true,
-		},
-		RequestType: "WaitForLocalExecution",
-	})
+// verify_sum checks a sha256 computed over downloaded content against the hex sha256 it was uploaded with
+func verify_sum(sum []byte, contentSha256 string) error {
+	if actual := hex.EncodeToString(sum); !strings.EqualFold(actual, contentSha256) {
+		return fmt.Errorf("checksum mismatch, expected sha256 %s but downloaded content has %s", contentSha256, actual)
+	}
+	return nil
+}
 
+func get_blob(ctx context.Context, config *WalrusFsConfig, blobId string) ([]byte, error) {
+	body, err := open_blob(ctx, config, blobId)
 	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
-		return err
+		return nil, err
 	}
+	defer body.Close()
 
-	return nil
+	b, err := io.ReadAll(body)
+	if err != nil {
+		logger.Debug("cannot read aggregator response", "blob", blobId, "err", err)
+		return nil, blob_unavailable(err)
+	}
+	return b, nil
 }
 
-func get_dir_all(config *WalrusFsConfig, path string) (*DirAllResult, error) {
-	cli := sui.NewSuiClient(constant.SuiTestnetEndpoint)
-	ctx := context.Background()
+// blob_url is where the aggregator at aggregatorUrl serves a blob, anyone can read it without a sui client
+func blob_url(aggregatorUrl string, blobId string) string {
+	return aggregatorUrl + "/v1/blobs/" + blobId
+}
+
+// open_blob starts downloading a blob from the aggregator, the caller reads and closes the returned body
+func open_blob(ctx context.Context, config *WalrusFsConfig, blobId string) (io.ReadCloser, error) {
+	return open_blob_from(ctx, config, config.aggregatorUrl, blobId)
+}
 
-	signerAccount, err := signer.NewSignertWithMnemonic(config.mnemonic)
+// open_blob_from starts downloading a blob from the aggregator at aggregatorUrl
+func open_blob_from(ctx context.Context, config *WalrusFsConfig, aggregatorUrl string, blobId string) (io.ReadCloser, error) {
+	start := time.Now()
+	body, err := request_blob(ctx, config, aggregatorUrl, blobId)
 	if err != nil {
-		fmt.Println(err.Error())
+		config.record_op(OpAggregatorGet, start, 0, err)
 		return nil, err
 	}
+	if config.metrics != nil {
+		body = &meteredBody{ReadCloser: body, config: config, start: start}
+	}
+	return body, nil
+}
 
-	rsp, err := cli.SuiGetObject(ctx, models.SuiGetObjectRequest{
-		ObjectId: config.root,
-		Options: models.SuiObjectDataOptions{
-			ShowContent:             false,
-			ShowDisplay:             false,
-			ShowType:                false,
-			ShowBcs:                 false,
-			ShowOwner:               false,
-			ShowPreviousTransaction: false,
-			ShowStorageRebate:       false,
-		},
-	})
+// request_blob sends the request for a blob to the aggregator at aggregatorUrl and returns the body carrying it
+func request_blob(ctx context.Context, config *WalrusFsConfig, aggregatorUrl string, blobId string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", blob_url(aggregatorUrl, blobId), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to SuiGetObject: %w", err)
+		logger.Debug("cannot create aggregator request", "blob", blobId, "err", err)
+		return nil, err
 	}
 
-	ver, err := strconv.ParseUint(rsp.Data.Version, 0, 64)
+	resp, err := config.getHttpClient().Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ParseUint: %w", err)
+		logger.Debug("aggregator request failed", "blob", blobId, "err", err)
+		return nil, blob_unavailable(err)
 	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodySnippet+1))
+		return nil, blob_status_error(resp, blobId, body)
+	}
+	return rate_limited_body(ctx, resp.Body, config.downloadLimiter), nil
+}
 
-	objectIdBytes, err := transaction.ConvertSuiAddressStringToBytes(models.SuiAddress(config.root))
+// blob_available asks the aggregator whether it can serve a blob without downloading it. A blob the aggregator
+// doesn't know is reported as not available, failing to reach the aggregator as an error
+func blob_available(ctx context.Context, config *WalrusFsConfig, blobId string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", blob_url(config.aggregatorUrl, blobId), nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert address: %w", err)
+		return false, err
 	}
-
-	digestBytes, err := transaction.ConvertObjectDigestStringToBytes((models.ObjectDigest)(rsp.Data.Digest))
+	resp, err := config.getHttpClient().Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert digest: %w", err)
+		logger.Debug("aggregator request failed", "blob", blobId, "err", err)
+		return false, blob_unavailable(err)
+	}
+	resp.Body.Close()
+	err = blob_status_error(resp, blobId, nil)
+	if errors.Is(err, ErrBlobExpired) {
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	tx := transaction.NewTransaction()
+// blob_status_error returns the error for an aggregator response that doesn't carry the blob: ErrBlobExpired when
+// the aggregator doesn't have it, ErrBlobUnavailable when the aggregator failed. Only 200, or 206 for a range,
+// carries the blob, any other response body is an error page and never file content
+func blob_status_error(resp *http.Response, blobId string, body []byte) error {
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return typed_error(ErrBlobExpired, "blob %s is not available from the aggregator, it may have expired", blobId)
+	case resp.StatusCode >= 500:
+		return blob_unavailable(fmt.Errorf("aggregator returned %s for blob %s: %s", resp.Status, blobId, body_snippet(body)))
+	}
+	return fmt.Errorf("aggregator returned %s for blob %s: %s", resp.Status, blobId, body_snippet(body))
+}
 
-	bcsEncodedMsg := bytes.Buffer{}
-	bcsEncoder := mystenbcs.NewEncoder(&bcsEncodedMsg)
-	err = bcsEncoder.Encode(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to Encode param: %w", err)
+// maxBodySnippet is the most of a response body quoted in an error
+const maxBodySnippet = 256
+
+// body_snippet returns the start of a response body for an error message
+func body_snippet(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > maxBodySnippet {
+		s = strings.ToValidUTF8(s[:maxBodySnippet], "") + "..."
+	}
+	if s == "" {
+		return "empty response"
 	}
-	val := bcsEncodedMsg.Bytes()
-	arg := tx.Data.V1.AddInput(transaction.CallArg{Pure: &transaction.Pure{
-		Bytes: val,
-	}})
+	return s
+}
 
-	arguments := []transaction.Argument{
-		tx.Object(
-			transaction.CallArg{
-				Object: &transaction.ObjectArg{
-					ImmOrOwnedObject: &transaction.SuiObjectRef{
-						ObjectId: *objectIdBytes,
-						Version:  ver,
-						Digest:   *digestBytes,
-					},
-				},
-			},
-		),
-		arg,
+// blob_unavailable marks an error reaching the aggregator, it matches both ErrBlobUnavailable and ErrWalrusUnreachable
+func blob_unavailable(err error) error {
+	return with_kind(ErrBlobUnavailable, with_kind(ErrWalrusUnreachable, err))
+}
+
+// file_blob_ids returns the blobs holding the content of a file, in order
+func file_blob_ids(blobId string, blobIds []string) []string {
+	if len(blobIds) > 0 {
+		return blobIds
 	}
+	return []string{blobId}
+}
 
-	tx.SetSuiClient(cli.(*sui.Client))
-	tx.SetSender(models.SuiAddress(signerAccount.Address))
-	tx.SetGasBudget(100000000)
-	tx.MoveCall(
-		models.SuiAddress(config.pkg),
-		"walrusfs",
-		"get_dir_all",
-		[]transaction.TypeTag{},
-		arguments,
-	)
+// rename moves the file or directory at frompath to topath. Only topath is validated, so an entry written before
+// paths were checked can still be renamed to a valid one
+func rename(ctx context.Context, config *WalrusFsConfig, frompath string, topath string, isdir bool) (*TxResult, error) {
+	topath, err := ValidatePath(topath)
+	if err != nil {
+		return nil, err
+	}
+	defer listings.invalidate(config.root, frompath)
+	defer listings.invalidate(config.root, topath)
+	var funcname string
+	if isdir {
+		funcname = "rename_dir"
+	} else {
+		funcname = "rename_file"
+	}
+	rsp, err := execute_move_call(ctx, config, funcname, []interface{}{
+		config.root,
+		frompath,
+		topath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx_result(rsp), nil
+}
 
-	encodedMsg, err := tx.Data.V1.Kind.Marshal()
+func delete(ctx context.Context, config *WalrusFsConfig, path string, isdir bool) (*TxResult, error) {
+	defer listings.invalidate(config.root, path)
+	var funcname string
+	if isdir {
+		funcname = "delete_dir"
+	} else {
+		funcname = "delete_file"
+	}
+	rsp, err := execute_move_call(ctx, config, funcname, []interface{}{
+		config.root,
+		path,
+	})
 	if err != nil {
-		log.Printf("error tx.Data.V1.Kind.Marshal: %v", err)
 		return nil, err
 	}
+	return tx_result(rsp), nil
+}
+
+// delete_many deletes the files and directories of paths with execute_calls, isdir says which each path is.
+// The errors are in the order of paths
+func delete_many(ctx context.Context, config *WalrusFsConfig, paths []string, isdir []bool) []error {
+	calls := make([]moveCall, len(paths))
+	for i, path := range paths {
+		calls[i] = moveCall{function: "delete_file", arguments: []interface{}{config.root, path}}
+		if isdir[i] {
+			calls[i].function = "delete_dir"
+		}
+	}
+	_, errs := execute_calls(ctx, config, "delete_many", calls)
+	for _, path := range paths {
+		listings.invalidate(config.root, path)
+	}
+	return errs
+}
 
-	txBytes := mystenbcs.ToBase64(encodedMsg)
+// get_current_epoch returns the walrus epoch recorded in the walrusfs root object, 0 if it was never set. Nothing
+// records it anymore, roots written by older versions still have it
+func get_current_epoch(ctx context.Context, config *WalrusFsConfig) (int64, error) {
+	cli := config.getSuiClient()
 
-	rsp2, err := cli.SuiDevInspectTransactionBlock(ctx, models.SuiDevInspectTransactionBlockRequest{
-		Sender:  config.wallet,
-		TxBytes: txBytes,
+	rsp, err := cli.SuiGetObject(ctx, models.SuiGetObjectRequest{
+		ObjectId: config.root,
+		Options: models.SuiObjectDataOptions{
+			ShowContent: true,
+		},
 	})
-
 	if err != nil {
-		log.Printf("error SignAndExecuteTransactionBlock: %v", err)
-		return nil, err
+		return 0, fmt.Errorf("failed to SuiGetObject: %w", err)
 	}
+	if rsp.Data == nil || rsp.Data.Content == nil {
+		return 0, fmt.Errorf("walrusfs root object %s has no content", config.root)
+	}
+
+	return get_map_int64(rsp.Data.Content.Fields, "current_epoch")
+}
+
+// observeEpoch remembers epoch if it is later than any epoch this config has seen, publishers report the epoch they
+// register blobs in
+func (config *WalrusFsConfig) observeEpoch(epoch int64) {
+	config.epochLock.Lock()
+	defer config.epochLock.Unlock()
+	config.knownEpoch = max(config.knownEpoch, epoch)
+}
 
-	type moveCallResult struct {
-		ReturnValues [2]interface{}
+// known_epoch returns the latest epoch this config has seen, 0 before anything was published
+func (config *WalrusFsConfig) known_epoch() int64 {
+	config.epochLock.Lock()
+	defer config.epochLock.Unlock()
+	return config.knownEpoch
+}
+
+// file_epoch_call is the call recording the epoch until which the blobs of the file at path are stored
+func file_epoch_call(config *WalrusFsConfig, path string, endEpoch int64) moveCall {
+	return moveCall{function: "update_file_epoch", arguments: []interface{}{
+		config.root,
+		path,
+		strconv.FormatInt(endEpoch, 10),
+	}}
+}
+
+func get_dir_all(ctx context.Context, config *WalrusFsConfig, path string) (*DirAllResult, error) {
+	rsp, err := inspect_move_call(ctx, config, "get_dir_all", []interface{}{path}, nil)
+	if err != nil {
+		logger.Debug("dev inspect failed", "op", "get_dir_all", "path", path, "err", err)
+		return nil, err
 	}
 
-	var moveCallReturn []moveCallResult
-	err = json.Unmarshal(rsp2.Results, &moveCallReturn)
+	output, found, err := inspect_return_value(rsp)
 	if err != nil {
-		fmt.Println("json", err.Error())
 		return nil, err
 	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
 
 	var dlo RecursiveDirList
-	t := moveCallReturn[0].ReturnValues
-	t1 := t[0].([]interface{})
-	t2 := t1[0].([]interface{})
-	output := make([]byte, 0, len(t2))
-	for i := range t2 {
-		bv := byte(int(t2[i].(float64)))
-		output = append(output, bv)
-	}
 
 	if _, err := bcs.Unmarshal(output, &dlo); err != nil {
-		log.Printf("failed to decode: %v", err.Error())
+		logger.Debug("cannot decode dev inspect result", "op", "get_dir_all", "path", path, "err", err)
 		return nil, err
 	}
 
 	res, err := parse_dir_all(&dlo)
 	if err != nil {
-		fmt.Println("parse_dir_all", err.Error())
+		logger.Debug("cannot parse directory tree", "op", "get_dir_all", "path", path, "err", err)
 		return nil, err
 	}
 
@@ -0,0 +1,787 @@
+package walrusfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/block-vision/sui-go-sdk/models"
+)
+
+func validFileItemMap() map[string]interface{} {
+	return map[string]interface{}{
+		"name":              "file.txt",
+		"create_ts":         "1736900000000",
+		"is_dir":            false,
+		"tags":              []interface{}{"a", "b"},
+		"size":              "42",
+		"walrus_blob_id":    "blobid",
+		"walrus_blob_ids":   []interface{}{"blobid", "blobid2"},
+		"content_sha256":    "abc123",
+		"walrus_epoch_till": "10",
+		"deletable":         true,
+		"certified":         true,
+		"encrypted":         true,
+		"compression":       "gzip",
+		"mime_type":         "text/plain",
+	}
+}
+
+func validDirInfoMap() map[string]interface{} {
+	return map[string]interface{}{
+		"create_ts": "1736900000000",
+		"tags":      []interface{}{"t"},
+		"children_directories": map[string]interface{}{
+			"contents": []interface{}{
+				map[string]interface{}{"key": "sub", "value": "2"},
+			},
+		},
+		"children_files": map[string]interface{}{
+			"contents": []interface{}{
+				map[string]interface{}{"key": "file.txt", "value": "3"},
+			},
+		},
+	}
+}
+
+func TestParseDirFileItem(t *testing.T) {
+	t.Parallel()
+
+	err, item := parse_dir_file_item(validFileItemMap())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Name != "file.txt" || item.Size != 42 || item.CreateTs != 1736900000000 || item.IsDir {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if len(item.Tags) != 2 || item.WalrusBlobId != "blobid" || item.WalrusEpochTill != 10 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if !slices.Equal(item.WalrusBlobIds, []string{"blobid", "blobid2"}) || item.ContentSha256 != "abc123" || !item.Deletable || !item.Certified || !item.Encrypted || item.Compression != "gzip" || item.MimeType != "text/plain" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+}
+
+func TestParseDirFileItemMalformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		key    string
+		value  interface{}
+		delete bool
+	}{
+		{"missing create_ts", "create_ts", nil, true},
+		{"null name", "name", nil, false},
+		{"numeric size", "size", float64(42), false},
+		{"invalid size", "size", "abc", false},
+		{"string is_dir", "is_dir", "false", false},
+		{"tags not an array", "tags", "a,b", false},
+		{"non-string tag", "tags", []interface{}{"a", 1.0}, false},
+		{"missing walrus_blob_id", "walrus_blob_id", nil, true},
+		{"walrus_blob_ids not an array", "walrus_blob_ids", "blobid", false},
+		{"missing content_sha256", "content_sha256", nil, true},
+		{"numeric walrus_epoch_till", "walrus_epoch_till", float64(10), false},
+		{"string deletable", "deletable", "true", false},
+		{"missing certified", "certified", nil, true},
+		{"string encrypted", "encrypted", "false", false},
+		{"missing compression", "compression", nil, true},
+		{"missing mime_type", "mime_type", nil, true},
+	}
+
+	for _, test := range tests {
+		m := validFileItemMap()
+		if test.delete {
+			// the package defines its own delete, so rebuild the map without the key
+			pruned := make(map[string]interface{})
+			for k, v := range m {
+				if k != test.key {
+					pruned[k] = v
+				}
+			}
+			m = pruned
+		} else {
+			m[test.key] = test.value
+		}
+		err, _ := parse_dir_file_item(m)
+		if err == nil {
+			t.Errorf("%s: expected an error, got nil", test.name)
+		} else if !strings.Contains(err.Error(), test.key) {
+			t.Errorf("%s: expected error to name field %q, got %v", test.name, test.key, err)
+		}
+	}
+}
+
+func TestParseDirInfo(t *testing.T) {
+	t.Parallel()
+
+	err, item := parse_dir_info(validDirInfoMap())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.ChildrenDirectories["sub"] != "2" || item.ChildrenFiles["file.txt"] != "3" {
+		t.Errorf("unexpected children: %+v", item)
+	}
+	if item.CreateTs != 1736900000000 || len(item.Tags) != 1 {
+		t.Errorf("unexpected item: %+v", item)
+	}
+}
+
+func TestParseDirInfoMalformed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		key   string
+		value interface{}
+	}{
+		{"children_directories not an object", "children_directories", []interface{}{}},
+		{"children_files missing contents", "children_files", map[string]interface{}{}},
+		{"children_files entry without value", "children_files", map[string]interface{}{
+			"contents": []interface{}{map[string]interface{}{"key": "file.txt"}},
+		}},
+		{"null create_ts", "create_ts", nil},
+		{"tags not an array", "tags", map[string]interface{}{}},
+	}
+
+	for _, test := range tests {
+		m := validDirInfoMap()
+		m[test.key] = test.value
+		err, _ := parse_dir_info(m)
+		if err == nil {
+			t.Errorf("%s: expected an error, got nil", test.name)
+		} else if !strings.Contains(err.Error(), test.key) {
+			t.Errorf("%s: expected error to name field %q, got %v", test.name, test.key, err)
+		}
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		dstpath string
+		data    string
+		want    string
+	}{
+		{"known extension", "/docs/readme.md", "# title", "text/markdown"},
+		{"extensionless text", "/docs/README", "hello world", "text/plain; charset=utf-8"},
+		{"extensionless png", "/img/logo", "\x89PNG\r\n\x1a\n0000", "image/png"},
+		{"empty file", "/empty", "", "text/plain"},
+		{"long file", "/big", strings.Repeat("a", 2048), "text/plain; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		mimeType, rest, err := detect_content_type(test.dstpath, strings.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if mimeType != test.want {
+			t.Errorf("%s: got mime type %q, want %q", test.name, mimeType, test.want)
+		}
+		// the sniffed bytes must still be uploaded
+		data, err := io.ReadAll(rest)
+		if err != nil {
+			t.Fatalf("%s: unexpected error reading data: %v", test.name, err)
+		}
+		if string(data) != test.data {
+			t.Errorf("%s: data was not preserved, got %d bytes, want %d", test.name, len(data), len(test.data))
+		}
+	}
+}
+
+func TestFileMimeType(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var lastBody atomic.Value
+	c, chain := newFakeChainClient("test-file-mime-type")
+	c.config.publisherUrls = []string{newTestPublisher(t, http.StatusOK, &requests, &lastBody).URL}
+	c.config.httpTimeout = time.Second
+	ctx := context.Background()
+
+	if _, err := add_file_content(ctx, c.config, strings.NewReader("hello"), 5, "/noext", []string{"mime:image/png"}, 0, false, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the detected type has an argument of its own, the tags are stored as the user gave them
+	call := chain.calls[0]
+	if !slices.Equal(call.Arguments[3].([]string), []string{"mime:image/png"}) || call.Arguments[12] != "text/plain; charset=utf-8" {
+		t.Errorf("got tags %v and mime type %v", call.Arguments[3], call.Arguments[12])
+	}
+
+	listings.putStat(c.config.root, "/noext", &ListDirFileItem{Name: "noext", Tags: []string{"keep"}, MimeType: "image/png"}, time.Now().Add(time.Hour))
+	finfo, err := c.Stat(ctx, walrusConn("/noext"))
+	if err != nil || finfo.MimeType != "image/png" || !slices.Equal(finfo.Tags, []string{"keep"}) {
+		t.Errorf("got %+v, %v, want the stored mime type and tags", finfo, err)
+	}
+}
+
+// newTestPublisher returns a publisher that answers with status, or with a newly created blob when status is 200.
+// The number of requests and the last body received are recorded
+func newTestPublisher(t *testing.T, status int, requests *atomic.Int32, lastBody *atomic.Value) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		lastBody.Store(string(body))
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"newlyCreated": {"blobObject": {"blobId": "blob1", "registeredEpoch": 3, "storage": {"endEpoch": 8}}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPublishBlobFailover(t *testing.T) {
+	defer func(delay time.Duration) { publishRetryBaseDelay = delay }(publishRetryBaseDelay)
+	publishRetryBaseDelay = time.Millisecond
+
+	readers := map[string]func(string) io.Reader{
+		"seekable":     func(s string) io.Reader { return strings.NewReader(s) },
+		"not seekable": func(s string) io.Reader { return io.MultiReader(strings.NewReader(s)) },
+	}
+	for name, newReader := range readers {
+		var badRequests, goodRequests atomic.Int32
+		var badBody, goodBody atomic.Value
+		bad := newTestPublisher(t, http.StatusBadGateway, &badRequests, &badBody)
+		good := newTestPublisher(t, http.StatusOK, &goodRequests, &goodBody)
+		config := &WalrusFsConfig{publisherUrls: []string{bad.URL, good.URL}, httpTimeout: time.Second}
+
+		blob, err := publish_blob(context.Background(), config, newReader("hello walrus"), -1, 0)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if blob.BlobId != "blob1" || blob.EndEpoch != 8 || blob.RegisteredEpoch != 3 {
+			t.Errorf("%s: unexpected blob: %+v", name, blob)
+		}
+		if badRequests.Load() != 1 || goodRequests.Load() != 1 {
+			t.Errorf("%s: expected one request per publisher, got %d and %d", name, badRequests.Load(), goodRequests.Load())
+		}
+		// the body has to be sent again in full after the failed attempt
+		if goodBody.Load() != "hello walrus" {
+			t.Errorf("%s: publisher got body %q", name, goodBody.Load())
+		}
+	}
+}
+
+func TestPublishBlobRetryLimits(t *testing.T) {
+	defer func(delay time.Duration) { publishRetryBaseDelay = delay }(publishRetryBaseDelay)
+	publishRetryBaseDelay = time.Millisecond
+
+	var requests atomic.Int32
+	var body atomic.Value
+	failing := newTestPublisher(t, http.StatusServiceUnavailable, &requests, &body)
+	config := &WalrusFsConfig{publisherUrls: []string{failing.URL}, httpTimeout: time.Second}
+	if _, err := publish_blob(context.Background(), config, strings.NewReader("data"), 4, 0); err == nil {
+		t.Errorf("expected an error when every attempt fails")
+	}
+	if requests.Load() != PublishMaxAttempts {
+		t.Errorf("expected %d attempts, got %d", PublishMaxAttempts, requests.Load())
+	}
+
+	requests.Store(0)
+	rejecting := newTestPublisher(t, http.StatusBadRequest, &requests, &body)
+	config = &WalrusFsConfig{publisherUrls: []string{rejecting.URL, failing.URL}, httpTimeout: time.Second}
+	if _, err := publish_blob(context.Background(), config, strings.NewReader("data"), 4, 0); err == nil {
+		t.Errorf("expected an error for a rejected upload")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected a rejected upload not to be retried, got %d attempts", requests.Load())
+	}
+}
+
+func TestTxResult(t *testing.T) {
+	t.Parallel()
+
+	rsp := &models.SuiTransactionBlockResponse{Digest: "digest1"}
+	rsp.Effects.Created = []models.OwnedObjectRef{{Reference: models.SuiObjectRef{ObjectId: "0x1"}}}
+	rtn := tx_result(rsp)
+	if rtn.Digest != "digest1" || len(rtn.ObjectIds) != 1 || rtn.ObjectIds[0] != "0x1" || rtn.BlobId != "" {
+		t.Errorf("unexpected result: %+v", rtn)
+	}
+}
+
+func TestExecuteTransactionRetry(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	timeout := errors.New("Post \"http://fullnode\": dial tcp: i/o timeout")
+	ctx := context.Background()
+
+	// the node executed the transaction but the response was lost, it is found by its digest and not sent again
+	c, chain := newFakeChainClient("test-execute-lost-response")
+	c.config.retryPolicy = policy
+	chain.lostResponses = 1
+	rsp, err := execute_move_call(ctx, c.config, "add_dir", []interface{}{"/a"})
+	if err != nil || rsp.Digest != "tx-1" || chain.submissions != 1 || len(chain.executed) != 1 {
+		t.Errorf("got %v, %v after %d submissions and transactions %v, want the executed transaction", rsp, err, chain.submissions, chain.executed)
+	}
+
+	// a submission that never arrived is sent again as it was signed, without building it again
+	c, chain = newFakeChainClient("test-execute-resubmit")
+	c.config.retryPolicy = policy
+	chain.submitErrors = []error{timeout}
+	if _, err := execute_move_call(ctx, c.config, "add_dir", []interface{}{"/a"}); err != nil || chain.submissions != 2 || len(chain.calls) != 1 || len(chain.executed) != 1 {
+		t.Errorf("got %v after %d submissions, %d builds and transactions %v, want one transaction built once", err, chain.submissions, len(chain.calls), chain.executed)
+	}
+
+	// when every submission times out the error says the transaction may still have been executed
+	c, chain = newFakeChainClient("test-execute-unknown")
+	c.config.retryPolicy = policy
+	chain.submitErrors = []error{timeout, timeout, timeout}
+	if _, err := execute_move_call(ctx, c.config, "add_dir", []interface{}{"/a"}); err == nil || !strings.Contains(err.Error(), "may have been executed") || chain.submissions != 3 {
+		t.Errorf("got %v after %d submissions", err, chain.submissions)
+	}
+
+	// objects locked by another transaction are never submitted again
+	c, chain = newFakeChainClient("test-execute-equivocated")
+	c.config.retryPolicy = policy
+	chain.submitErrors = []error{errors.New("Failed to sign transaction by a quorum of validators because of locked objects")}
+	if _, err := execute_move_call(ctx, c.config, "add_dir", []interface{}{"/a"}); err == nil || chain.submissions != 1 || len(chain.executed) != 0 {
+		t.Errorf("got %v after %d submissions, want no retry of an equivocated transaction", err, chain.submissions)
+	}
+}
+
+func TestTxRecorder(t *testing.T) {
+	t.Parallel()
+
+	// without a recorder nothing is recorded and nothing breaks
+	record_tx(context.Background(), "digest0", 100)
+
+	rec := &TxRecorder{}
+	ctx := WithTxRecorder(context.Background(), rec)
+	record_tx(ctx, "digest1", 3000)
+	record_tx(ctx, "digest2", -1000)
+	digests := rec.Digests()
+	if !slices.Equal(digests, []string{"digest1", "digest2"}) {
+		t.Errorf("unexpected digests: %v", digests)
+	}
+	if got := rec.GasUsed(); got != 2000 {
+		t.Errorf("got gas used %d, want 2000", got)
+	}
+	digests[0] = "changed"
+	if rec.Digests()[0] != "digest1" {
+		t.Errorf("expected Digests to return a copy")
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	t.Parallel()
+
+	if err := validate_tags([]string{"project:foo", "env:prod", "mime:image/png"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validate_tags([]string{""}); err == nil {
+		t.Errorf("expected an empty tag to be rejected")
+	}
+}
+
+func TestValidatePath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/a/b.txt", "/a/b.txt"},
+		{"a//b/", "/a/b"},
+		{"//a", "/a"},
+		{"/a/.hidden/..b", "/a/.hidden/..b"},
+		{"/dir/日本語 file", "/dir/日本語 file"},
+		{"/", ""},
+		{"", ""},
+		{"/a/../b", ""},
+		{"/a/./b", ""},
+		{"/a/b\nc", ""},
+		{"/a/\x7f", ""},
+		{"/a/\xff", ""},
+	}
+	for _, tc := range tests {
+		got, err := ValidatePath(tc.path)
+		if tc.want == "" {
+			if !errors.Is(err, ErrInvalidPath) || !errors.Is(err, fs.ErrInvalid) {
+				t.Errorf("%q: got %q, %v, want ErrInvalidPath", tc.path, got, err)
+			}
+		} else if err != nil || got != tc.want {
+			t.Errorf("%q: got %q, %v, want %q", tc.path, got, err, tc.want)
+		}
+	}
+
+	// nothing is written at an invalid path
+	c, chain := newFakeChainClient("test-validate-path")
+	if _, err := c.MkdirWithResult(context.Background(), walrusConn("/a/../b"), nil); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Mkdir: got %v, want ErrInvalidPath", err)
+	}
+	if _, err := rename(context.Background(), c.config, "/a", "/b/..", false); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("rename: got %v, want ErrInvalidPath", err)
+	}
+	if len(chain.functions()) != 0 {
+		t.Errorf("got calls %v for invalid paths", chain.functions())
+	}
+}
+
+func TestMaxUploadSize(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var body atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+	config := &WalrusFsConfig{publisherUrls: []string{publisher.URL}, httpTimeout: time.Second, maxUploadSize: 10}
+	ctx := context.Background()
+
+	_, err := publish_file(ctx, config, strings.NewReader("0123456789a"), 11, "/big.txt", nil, 0, true, 1)
+	if !errors.Is(err, ErrTooLarge) || !strings.Contains(err.Error(), "walrusfs:maxuploadsizemb") {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("a file over the limit was sent to the publisher")
+	}
+	if _, err := publish_file(ctx, config, strings.NewReader("0123456789"), 10, "/fits.txt", nil, 0, true, 1); err != nil {
+		t.Errorf("a file at the limit: %v", err)
+	}
+	config.maxUploadSize = 0
+	if _, err := publish_file(ctx, config, strings.NewReader("0123456789a"), 11, "/big.txt", nil, 0, true, 1); err != nil {
+		t.Errorf("without a limit: %v", err)
+	}
+}
+
+func TestPublishChunks(t *testing.T) {
+	readers := map[string]func(string) io.Reader{
+		"seekable":     func(s string) io.Reader { return strings.NewReader(s) },
+		"not seekable": func(s string) io.Reader { return io.MultiReader(strings.NewReader(s)) },
+	}
+	for name, newReader := range readers {
+		var requests atomic.Int32
+		var bodies sync.Map
+		publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := requests.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			if r.ContentLength != int64(len(body)) {
+				t.Errorf("%s: content length %d for a body of %d bytes", name, r.ContentLength, len(body))
+			}
+			bodies.Store(fmt.Sprintf("blob%d", n), string(body))
+			fmt.Fprintf(w, `{"alreadyCertified": {"blobId": "blob%d", "endEpoch": %d}}`, n, 10-n)
+		}))
+		aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := bodies.Load(strings.TrimPrefix(r.URL.Path, "/v1/blobs/"))
+			io.WriteString(w, body.(string))
+		}))
+		config := &WalrusFsConfig{publisherUrls: []string{publisher.URL}, aggregatorUrl: aggregator.URL, httpTimeout: time.Second, chunkSize: 10}
+
+		content := "0123456789abcdefghijklmno"
+		blobIds, endEpoch, certified, err := publish_chunks(context.Background(), config, newReader(content), int64(len(content)), 1, blobCoding{})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !slices.Equal(blobIds, []string{"blob1", "blob2", "blob3"}) || endEpoch != 7 || !certified {
+			t.Errorf("%s: unexpected blobs %v ending at epoch %d", name, blobIds, endEpoch)
+		}
+		if b, _ := bodies.Load("blob3"); b != "klmno" {
+			t.Errorf("%s: last chunk is %q", name, b)
+		}
+		sum := sha256.Sum256([]byte(content))
+		data, err := get_file(context.Background(), config, hex.EncodeToString(sum[:]), blobCoding{}, blobIds...)
+		if err != nil || string(data) != content {
+			t.Errorf("%s: get_file = %q, %v", name, data, err)
+		}
+		wrong := sha256.Sum256([]byte("something else"))
+		if _, err := get_file(context.Background(), config, hex.EncodeToString(wrong[:]), blobCoding{}, blobIds...); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("%s: expected a checksum mismatch, got %v", name, err)
+		}
+
+		// files that fit in a chunk stay a single blob
+		blobIds, _, _, err = publish_chunks(context.Background(), config, newReader("small"), 5, 1, blobCoding{})
+		if err != nil || !slices.Equal(blobIds, []string{"blob4"}) {
+			t.Errorf("%s: small file published as %v, %v", name, blobIds, err)
+		}
+
+		publisher.Close()
+		aggregator.Close()
+	}
+}
+
+func TestFileBlobIds(t *testing.T) {
+	t.Parallel()
+
+	if ids := file_blob_ids("blob", nil); !slices.Equal(ids, []string{"blob"}) {
+		t.Errorf("unexpected blob ids for a single blob file: %v", ids)
+	}
+	if ids := file_blob_ids("a", []string{"a", "b"}); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Errorf("unexpected blob ids for a chunked file: %v", ids)
+	}
+}
+
+func TestHashingReader(t *testing.T) {
+	t.Parallel()
+
+	content := "hash every byte exactly once"
+	sum := sha256.Sum256([]byte(content))
+	want := hex.EncodeToString(sum[:])
+
+	// a failed publish attempt rewinds and reads the content again
+	hr := new_hashing_reader(strings.NewReader(content))
+	if _, err := io.CopyN(io.Discard, hr, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hr.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, hr); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := hr.sum(int64(len(content))); err != nil || got != want {
+		t.Errorf("sum = %q, %v, want %q", got, err, want)
+	}
+	if _, err := hr.sum(int64(len(content)) + 1); err == nil {
+		t.Errorf("expected an error when the content was only partly read")
+	}
+
+	hr = new_hashing_reader(strings.NewReader(content))
+	if _, err := hr.Seek(5, io.SeekStart); err == nil {
+		t.Errorf("expected an error seeking past the hashed content")
+	}
+	hr = new_hashing_reader(io.MultiReader(strings.NewReader(content)))
+	if _, err := hr.Seek(0, io.SeekCurrent); err == nil {
+		t.Errorf("expected an error seeking a reader that isn't seekable")
+	}
+}
+
+func TestDecodeReturnValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		results   string
+		want      []byte
+		wantFound bool
+		wantErr   bool
+	}{
+		{"missing", "", nil, false, false},
+		{"null", "null", nil, false, false},
+		{"no calls", "[]", nil, false, false},
+		{"no return values", `[{"returnValues": []}]`, nil, false, false},
+		{"value", `[{"returnValues": [[[1, 2, 255], "vector<u8>"]]}]`, []byte{1, 2, 255}, true, false},
+		{"not an array", `{}`, nil, false, true},
+		{"bytes not an array", `[{"returnValues": [["abc", "vector<u8>"]]}]`, nil, false, true},
+		{"byte out of range", `[{"returnValues": [[[256], "vector<u8>"]]}]`, nil, false, true},
+	}
+
+	for _, test := range tests {
+		output, found, err := decode_return_value(json.RawMessage(test.results))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if found != test.wantFound || !bytes.Equal(output, test.want) {
+			t.Errorf("%s: got %v, %v, want %v, %v", test.name, output, found, test.want, test.wantFound)
+		}
+	}
+}
+
+func TestInspectReturnValue(t *testing.T) {
+	t.Parallel()
+
+	aborted := func(code int) models.SuiTransactionBlockResponse {
+		var rsp models.SuiTransactionBlockResponse
+		rsp.Effects.Status.Status = "failure"
+		rsp.Effects.Status.Error = fmt.Sprintf(`MoveAbort(MoveLocation { module: ModuleId { address: 0x1, name: Identifier("walrusfs") }, function: 7, instruction: 12, function_name: Some("stat") }, %d) in command 0`, code)
+		return rsp
+	}
+
+	if _, found, err := inspect_return_value(aborted(abortPathError)); found || err != nil {
+		t.Errorf("a path error abort should be not found, got %v, %v", found, err)
+	}
+	if _, found, err := inspect_return_value(aborted(2)); found || err == nil {
+		t.Errorf("other aborts should be errors, got %v, %v", found, err)
+	}
+	var rsp models.SuiTransactionBlockResponse
+	rsp.Effects.Status.Status = "success"
+	rsp.Results = json.RawMessage(`[{"returnValues": [[[7], "u8"]]}]`)
+	if output, found, err := inspect_return_value(rsp); !found || err != nil || !bytes.Equal(output, []byte{7}) {
+		t.Errorf("got %v, %v, %v, want the return value", output, found, err)
+	}
+}
+
+func TestInspectSender(t *testing.T) {
+	t.Parallel()
+
+	custom := fakeSigner{address: "0x1"}
+	if got, err := (&WalrusFsConfig{txSigner: custom}).inspect_sender(); got != "0x1" || err != nil {
+		t.Errorf("got sender %q, %v, want the signer address when no wallet is set", got, err)
+	}
+	if got, err := (&WalrusFsConfig{txSigner: custom, wallet: "0x2"}).inspect_sender(); got != "0x2" || err != nil {
+		t.Errorf("got sender %q, %v, want the configured wallet", got, err)
+	}
+	// the wallet is enough without a signer
+	if got, err := (&WalrusFsConfig{wallet: "0x2", mnemonicSource: "env:WALRUSFS_TEST_UNSET"}).inspect_sender(); got != "0x2" || err != nil {
+		t.Errorf("got sender %q, %v, want the configured wallet", got, err)
+	}
+	if _, err := (&WalrusFsConfig{mnemonicSource: "env:WALRUSFS_TEST_UNSET"}).inspect_sender(); err == nil {
+		t.Errorf("expected an error with neither a wallet nor a signer")
+	}
+}
+
+func TestBlobResponseStatus(t *testing.T) {
+	t.Parallel()
+
+	status, body := http.StatusOK, "content"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	config := &WalrusFsConfig{aggregatorUrl: server.URL, publisherUrls: []string{server.URL}, httpTimeout: 5 * time.Second}
+
+	if b, err := get_blob(context.Background(), config, "blob1"); err != nil || string(b) != "content" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{http.StatusNoContent, "", "204 No Content for blob blob1: empty response"},
+		{http.StatusForbidden, "<html>denied</html>", "403 Forbidden for blob blob1: <html>denied</html>"},
+		{http.StatusBadGateway, strings.Repeat("x", 1000), "502 Bad Gateway for blob blob1: " + strings.Repeat("x", maxBodySnippet) + "..."},
+	}
+	for _, tc := range tests {
+		status, body = tc.status, tc.body
+		b, err := get_blob(context.Background(), config, "blob1")
+		if err == nil || !strings.HasSuffix(err.Error(), tc.want) || b != nil {
+			t.Errorf("status %d: got %q, %v, want error ending in %q", tc.status, b, err, tc.want)
+		}
+	}
+
+	status, body = http.StatusAccepted, `{"newlyCreated":{"blobObject":{"blobId":"blob1"}}}`
+	if _, retry, err := put_blob(context.Background(), config, server.URL, strings.NewReader("data"), 4, 1); err == nil || retry {
+		t.Errorf("publisher status 202: got retry %v, %v, want a permanent error", retry, err)
+	}
+}
+
+func TestParsePublishResponse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		want    PublishBlobResult
+		wantErr string
+	}{
+		{
+			name: "newly created",
+			body: `{"newlyCreated":{"blobObject":{"id":"0x1","registeredEpoch":3,"blobId":"blob1","size":12,"certifiedEpoch":3,"storage":{"id":"0x2","startEpoch":3,"endEpoch":8,"storageSize":66034000},"deletable":false},"resourceOperation":{"registerFromScratch":{"encodedLength":66034000,"epochsAhead":5}},"cost":132300}}`,
+			want: PublishBlobResult{BlobId: "blob1", EndEpoch: 8, RegisteredEpoch: 3, Certified: true},
+		},
+		{
+			name: "newly created uncertified",
+			body: `{"newlyCreated":{"blobObject":{"registeredEpoch":3,"blobId":"blob1","certifiedEpoch":null,"storage":{"endEpoch":8}}}}`,
+			want: PublishBlobResult{BlobId: "blob1", EndEpoch: 8, RegisteredEpoch: 3},
+		},
+		{
+			name: "already certified",
+			body: `{"alreadyCertified":{"blobId":"blob2","event":{"txDigest":"d","eventSeq":"0"},"endEpoch":9}}`,
+			want: PublishBlobResult{BlobId: "blob2", EndEpoch: 9, Certified: true},
+		},
+		{
+			name:    "error payload",
+			body:    `{"error":{"code":400,"message":"the blob is too large"}}`,
+			wantErr: "neither a newly created nor an already certified blob: {\"error\"",
+		},
+		{
+			name:    "missing blob object",
+			body:    `{"newlyCreated":{"cost":1}}`,
+			wantErr: "no blob object",
+		},
+		{
+			name:    "missing blob id",
+			body:    `{"alreadyCertified":{"blobId":7,"endEpoch":9}}`,
+			wantErr: "no blob id",
+		},
+		{
+			name:    "not json",
+			body:    `<html>bad gateway</html>`,
+			wantErr: "cannot decode response <html>bad gateway</html>",
+		},
+	}
+	for _, tc := range tests {
+		blob, err := parse_publish_response([]byte(tc.body))
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: got error %v, want it to contain %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		} else if *blob != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *blob, tc.want)
+		}
+	}
+}
+
+func TestPutBlobDeletable(t *testing.T) {
+	t.Parallel()
+
+	var query atomic.Value
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query.Store(r.URL.RawQuery)
+		w.Write([]byte(`{"newlyCreated": {"blobObject": {"blobId": "blob1", "registeredEpoch": 3, "storage": {"endEpoch": 8}}}}`))
+	}))
+	defer publisher.Close()
+
+	tests := []struct {
+		name       string
+		configured bool
+		ctx        context.Context
+		signer     Signer
+		want       string
+	}{
+		{"default", false, context.Background(), nil, "epochs=2"},
+		{"configured", true, context.Background(), nil, "epochs=2&deletable=true"},
+		{"per upload", false, WithDeletable(context.Background(), true), nil, "epochs=2&deletable=true"},
+		{"per upload permanent", true, WithDeletable(context.Background(), false), nil, "epochs=2"},
+		{"to the signer", false, context.Background(), fakeSigner{address: "0x1"}, "epochs=2&send_object_to=0x1"},
+	}
+	for _, tc := range tests {
+		config := &WalrusFsConfig{deletable: tc.configured, httpTimeout: 5 * time.Second, txSigner: tc.signer}
+		if _, _, err := put_blob(tc.ctx, config, publisher.URL, strings.NewReader("data"), 4, 2); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got := query.Load(); got != tc.want {
+			t.Errorf("%s: publisher got query %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestInspectCancelled(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{root: testRootId, rpcUrl: newTestRpc(t, true).URL, wallet: testRootId}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := stat(ctx, config, "/a.txt"); !errors.Is(err, context.Canceled) {
+		t.Errorf("stat: got %v, want context.Canceled", err)
+	}
+	if _, err := list_directory(ctx, config, "/"); !errors.Is(err, context.Canceled) {
+		t.Errorf("list_directory: got %v, want context.Canceled", err)
+	}
+	if _, err := get_dir_all(ctx, config, "/"); !errors.Is(err, context.Canceled) {
+		t.Errorf("get_dir_all: got %v, want context.Canceled", err)
+	}
+}
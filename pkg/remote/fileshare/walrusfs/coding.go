@@ -0,0 +1,129 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// blobCoding is how each chunk of a file was transformed before it was published as a blob, compressed first and
+// then encrypted, and is undone in reverse when the blob is read
+type blobCoding struct {
+	// compression is the algorithm the chunks were compressed with, CompressionNone when they weren't
+	compression string
+	// encrypted chunks were sealed with walrusfs:encryptionkey
+	encrypted bool
+}
+
+// plain returns whether blobs hold the content as it is
+func (coding blobCoding) plain() bool {
+	return coding.compression == CompressionNone && !coding.encrypted
+}
+
+// item_coding returns the coding of the blobs of a file entry
+func item_coding(item *ListDirFileItem) blobCoding {
+	return blobCoding{compression: item.Compression, encrypted: item.Encrypted}
+}
+
+// info_coding returns the coding of the blobs of a file as reported by Stat
+func info_coding(finfo *wshrpc.FileInfo) blobCoding {
+	return blobCoding{compression: finfo.WalrusCompression, encrypted: finfo.WalrusEncrypted}
+}
+
+// encode_chunk reads the n bytes of chunk, or all of it when n is negative, and returns the blob to publish for
+// them. The whole chunk is held in memory, so it is at most walrusfs:chunksizemb
+func encode_chunk(config *WalrusFsConfig, coding blobCoding, chunk io.Reader, n int64) ([]byte, error) {
+	var b []byte
+	var err error
+	if n < 0 {
+		b, err = io.ReadAll(chunk)
+	} else {
+		b = make([]byte, n)
+		_, err = io.ReadFull(chunk, b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read content to encode: %w", err)
+	}
+	if coding.compression != CompressionNone {
+		if b, err = compress(coding.compression, b); err != nil {
+			return nil, err
+		}
+	}
+	if coding.encrypted {
+		if b, err = seal(config, b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// decode_blob returns the chunk of content held by the blob b
+func decode_blob(config *WalrusFsConfig, coding blobCoding, blobId string, b []byte) ([]byte, error) {
+	if coding.plain() {
+		return b, nil
+	}
+	r, err := open_coded(config, coding, blobId, io.NopCloser(bytes.NewReader(b)))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("walrus blob %s: %w", blobId, err)
+	}
+	return plain, nil
+}
+
+// open_file_blob starts reading the chunk of content held by a blob of a file. An encrypted blob is read whole
+// before any of it is returned, since it can't be authenticated before its end
+func open_file_blob(ctx context.Context, config *WalrusFsConfig, blobId string, coding blobCoding) (io.ReadCloser, error) {
+	body, err := open_blob(ctx, config, blobId)
+	if err != nil || coding.plain() {
+		return body, err
+	}
+	return open_coded(config, coding, blobId, body)
+}
+
+// open_coded undoes coding on the blob read from body, closing body when the returned reader is closed or on error
+func open_coded(config *WalrusFsConfig, coding blobCoding, blobId string, body io.ReadCloser) (io.ReadCloser, error) {
+	if coding.encrypted {
+		sealed, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return nil, blob_unavailable(err)
+		}
+		plain, err := open_sealed(config, blobId, sealed)
+		if err != nil {
+			return nil, err
+		}
+		body = io.NopCloser(bytes.NewReader(plain))
+	}
+	if coding.compression == CompressionNone {
+		return body, nil
+	}
+	zr, err := decompress_reader(coding.compression, body)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("walrus blob %s: %w", blobId, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, closerFunc(func() error {
+		zr.Close()
+		return body.Close()
+	})}, nil
+}
+
+// closerFunc closes by calling itself
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
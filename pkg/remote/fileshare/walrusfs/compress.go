@@ -0,0 +1,133 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// the compression algorithms of walrusfs:compression, CompressionNone stores content as it is
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressedMimeTypes are content types whose data is compressed already, compressing it again wastes cpu
+var compressedMimeTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/x-compress":       true,
+	"application/java-archive":     true,
+	"application/epub+zip":         true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+// is_compressed_type returns whether content of mimeType is compressed already. Images, audio and video count as
+// compressed, except for the few formats that store them uncompressed
+func is_compressed_type(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if compressedMimeTypes[mimeType] || strings.HasPrefix(mimeType, "application/vnd.openxmlformats-officedocument.") {
+		return true
+	}
+	switch mimeType {
+	case "image/svg+xml", "image/bmp", "image/x-ms-bmp", "image/tiff", "audio/wav", "audio/x-wav", "audio/wave":
+		return false
+	}
+	kind, _, _ := strings.Cut(mimeType, "/")
+	return kind == "image" || kind == "audio" || kind == "video"
+}
+
+// validate_compression checks algorithm is one uploads can be compressed with
+func validate_compression(algorithm string) error {
+	switch algorithm {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q, expected gzip or zstd", algorithm)
+}
+
+type compressionKey struct{}
+
+// WithCompression returns a context whose walrus uploads are compressed with algorithm, CompressionNone to store
+// them as they are, instead of following walrusfs:compression
+func WithCompression(ctx context.Context, algorithm string) context.Context {
+	return context.WithValue(ctx, compressionKey{}, algorithm)
+}
+
+// compression_for returns the algorithm to compress an upload of mimeType with, CompressionNone when content of
+// that type is compressed already
+func (config *WalrusFsConfig) compression_for(ctx context.Context, mimeType string) (string, error) {
+	algorithm, ok := ctx.Value(compressionKey{}).(string)
+	if !ok {
+		algorithm = config.compression
+	}
+	if err := validate_compression(algorithm); err != nil {
+		return "", err
+	}
+	if algorithm == CompressionNone || is_compressed_type(mimeType) {
+		return CompressionNone, nil
+	}
+	return algorithm, nil
+}
+
+// compress returns plain compressed with algorithm
+func compress(algorithm string, plain []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch algorithm {
+	case CompressionGzip:
+		zw = gzip.NewWriter(&buf)
+	case CompressionZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		zw = w
+	default:
+		return nil, validate_compression(algorithm)
+	}
+	if _, err := zw.Write(plain); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress_reader returns the content of r, compressed with algorithm, as it was before it was compressed
+func decompress_reader(algorithm string, r io.Reader) (io.ReadCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress %s content: %w", algorithm, err)
+		}
+		return zr, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress %s content: %w", algorithm, err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("the content is compressed with unknown algorithm %q", algorithm)
+}
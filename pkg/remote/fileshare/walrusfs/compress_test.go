@@ -0,0 +1,115 @@
+package walrusfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompressionFor(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{compression: CompressionGzip}
+	tests := []struct {
+		ctx      context.Context
+		mimeType string
+		want     string
+	}{
+		{context.Background(), "text/plain", CompressionGzip},
+		{context.Background(), "image/svg+xml", CompressionGzip},
+		{context.Background(), "image/png", CompressionNone},
+		{context.Background(), "application/zip", CompressionNone},
+		{context.Background(), "video/mp4; codecs=avc1", CompressionNone},
+		{WithCompression(context.Background(), CompressionNone), "text/plain", CompressionNone},
+		{WithCompression(context.Background(), CompressionZstd), "text/plain", CompressionZstd},
+		{WithCompression(context.Background(), CompressionZstd), "image/png", CompressionNone},
+	}
+	for _, tc := range tests {
+		if got, err := config.compression_for(tc.ctx, tc.mimeType); err != nil || got != tc.want {
+			t.Errorf("%s: got %q, %v, want %q", tc.mimeType, got, err, tc.want)
+		}
+	}
+	if _, err := config.compression_for(WithCompression(context.Background(), "lz4"), "text/plain"); err == nil {
+		t.Errorf("an unknown compression was accepted")
+	}
+}
+
+func TestCompressedUpload(t *testing.T) {
+	t.Parallel()
+
+	// the publisher names each blob after its position, the aggregator serves them back
+	var lock sync.Mutex
+	var blobs []string
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		blobs = append(blobs, string(body))
+		id := len(blobs) - 1
+		lock.Unlock()
+		w.Write([]byte(`{"alreadyCertified": {"blobId": "b` + string(rune('0'+id)) + `", "endEpoch": 8}}`))
+	}))
+	defer publisher.Close()
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write([]byte(blobs[r.URL.Path[len(r.URL.Path)-1]-'0']))
+	}))
+	defer aggregator.Close()
+
+	content := strings.Repeat("walrus compresses well ", 100)
+	tests := []struct {
+		compression string
+		key         string
+	}{
+		{CompressionGzip, ""},
+		{CompressionGzip, testEncryptionKey},
+		{CompressionZstd, ""},
+		{CompressionZstd, testEncryptionKey},
+	}
+	for _, tc := range tests {
+		config := &WalrusFsConfig{
+			publisherUrls: []string{publisher.URL},
+			aggregatorUrl: aggregator.URL,
+			httpTimeout:   time.Second,
+			compression:   tc.compression,
+			encryptionKey: secretString(tc.key),
+			chunkSize:     1000,
+			verifyUpload:  true,
+		}
+		lock.Lock()
+		blobs = nil
+		lock.Unlock()
+		ctx := context.Background()
+		rec, err := publish_file(ctx, config, strings.NewReader(content), int64(len(content)), "/a.txt", nil, 0, true, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := 0
+		for _, b := range blobs {
+			stored += len(b)
+		}
+		if rec.coding.compression != tc.compression || rec.size != int64(len(content)) || len(rec.blobIds) != 3 || stored >= len(content)/2 {
+			t.Errorf("%s, key %q: got record %+v storing %d bytes, want 3 compressed chunks", tc.compression, tc.key, rec, stored)
+		}
+		if b, err := get_file(ctx, config, rec.contentSha256, rec.coding, rec.blobIds...); err != nil || string(b) != content {
+			t.Errorf("%s, key %q: get_file got %d bytes, %v", tc.compression, tc.key, len(b), err)
+		}
+		if b, err := io.ReadAll(new_blob_reader(ctx, config, rec.contentSha256, rec.coding, rec.blobIds)); err != nil || string(b) != content {
+			t.Errorf("%s, key %q: blob reader got %d bytes, %v", tc.compression, tc.key, len(b), err)
+		}
+
+		// already compressed types are stored as they are
+		rec, err = publish_file(ctx, config, strings.NewReader(content), int64(len(content)), "/a.zip", nil, 0, true, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.coding.compression != CompressionNone {
+			t.Errorf("%s, key %q: got compression %q for a zip file", tc.compression, tc.key, rec.coding.compression)
+		}
+	}
+}
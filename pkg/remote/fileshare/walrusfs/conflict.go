@@ -0,0 +1,138 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// ConflictPolicy says what a copy does with a destination file that already exists. Apart from ConflictFail it
+// applies to each file on its own, so a copy into a directory that exists merges with what is there
+type ConflictPolicy string
+
+const (
+	// ConflictFail fails the copy on the first destination that exists, the default
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip leaves existing files alone, which resumes a copy that stopped half way
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces existing files
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictRename copies to the first free name with a numeric suffix, report-1.pdf for report.pdf
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// maxConflictRenames is how many suffixes ConflictRename tries before giving up
+const maxConflictRenames = 1000
+
+// ParseConflictPolicy returns the policy named s, empty is ConflictFail
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(strings.TrimSpace(s))); p {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverwrite, ConflictRename:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q, expected fail, skip, overwrite or rename", s)
+}
+
+// CopyConflictPolicy returns the policy of a copy with opts. Overwrite is ConflictOverwrite, and can't be combined
+// with another policy
+func CopyConflictPolicy(opts *wshrpc.FileCopyOpts) (ConflictPolicy, error) {
+	if opts == nil {
+		return ConflictFail, nil
+	}
+	policy, err := ParseConflictPolicy(opts.ConflictPolicy)
+	if err != nil {
+		return "", err
+	}
+	if opts.Overwrite {
+		if policy != ConflictFail && policy != ConflictOverwrite {
+			return "", fmt.Errorf("overwrite cannot be combined with the %s conflict policy", policy)
+		}
+		return ConflictOverwrite, nil
+	}
+	return policy, nil
+}
+
+// ResolveConflict returns where a copy to destPath, which exists, goes under the policy: destPath itself to overwrite
+// it, a free name found with exists to rename it, or skip set to leave it alone. ConflictFail returns conflictErr
+func (p ConflictPolicy) ResolveConflict(destPath string, exists func(string) (bool, error), conflictErr error) (target string, skip bool, err error) {
+	switch p {
+	case ConflictSkip:
+		return "", true, nil
+	case ConflictOverwrite:
+		return destPath, false, nil
+	case ConflictRename:
+		for i := 1; i <= maxConflictRenames; i++ {
+			candidate := conflict_name(destPath, i)
+			taken, err := exists(candidate)
+			if err != nil {
+				return "", false, err
+			}
+			if !taken {
+				return candidate, false, nil
+			}
+		}
+		return "", false, fmt.Errorf("no free name for %q after %d tries", destPath, maxConflictRenames)
+	}
+	return "", false, conflictErr
+}
+
+// conflict_name returns destPath with the suffix -i before its extension. It works on local and walrus paths alike,
+// only the last path element changes
+func conflict_name(destPath string, i int) string {
+	sep := strings.LastIndexAny(destPath, "/"+string(os.PathSeparator))
+	dir, name := destPath[:sep+1], destPath[sep+1:]
+	ext := path.Ext(name)
+	if ext == name {
+		// a dot file such as .bashrc has no extension
+		ext = ""
+	}
+	return fmt.Sprintf("%s%s-%d%s", dir, strings.TrimSuffix(name, ext), i, ext)
+}
+
+// local_exists reports whether the local path exists, an error other than it not existing is returned
+func local_exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// local_conflict returns where a download to the local destname goes under policy, skip set when it shouldn't be
+// written. isDir is whether a directory is copied there; a directory merges with an existing one, while a file
+// and a directory never replace each other
+func local_conflict(policy ConflictPolicy, destname string, isDir bool) (target string, skip bool, err error) {
+	fi, err := os.Stat(destname)
+	switch {
+	case os.IsNotExist(err):
+		// a missing parent is created along with destname
+		return destname, false, nil
+	case err != nil:
+		// such as a permission error or a parent that is a file, destname may or may not exist
+		return "", false, fmt.Errorf("cannot stat destination %q: %w", destname, err)
+	}
+	if policy == ConflictFail {
+		return "", false, typed_error(ErrAlreadyExists, "destination path already exists: %s", destname)
+	}
+	if fi.IsDir() != isDir && policy == ConflictOverwrite {
+		if isDir {
+			return "", false, fmt.Errorf("cannot overwrite file %q with a directory", destname)
+		}
+		return "", false, fmt.Errorf("cannot overwrite directory %q with a file", destname)
+	}
+	if isDir && fi.IsDir() {
+		return destname, false, nil
+	}
+	return policy.ResolveConflict(destname, local_exists, nil)
+}
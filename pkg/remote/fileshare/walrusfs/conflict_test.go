@@ -0,0 +1,310 @@
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestCopyConflictPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		opts    *wshrpc.FileCopyOpts
+		want    ConflictPolicy
+		wantErr bool
+	}{
+		{"no opts", nil, ConflictFail, false},
+		{"empty", &wshrpc.FileCopyOpts{}, ConflictFail, false},
+		{"skip", &wshrpc.FileCopyOpts{ConflictPolicy: "skip"}, ConflictSkip, false},
+		{"upper case rename", &wshrpc.FileCopyOpts{ConflictPolicy: "Rename"}, ConflictRename, false},
+		{"overwrite flag", &wshrpc.FileCopyOpts{Overwrite: true}, ConflictOverwrite, false},
+		{"overwrite flag and policy", &wshrpc.FileCopyOpts{Overwrite: true, ConflictPolicy: "overwrite"}, ConflictOverwrite, false},
+		{"overwrite flag and skip", &wshrpc.FileCopyOpts{Overwrite: true, ConflictPolicy: "skip"}, "", true},
+		{"unknown", &wshrpc.FileCopyOpts{ConflictPolicy: "merge"}, "", true},
+	}
+
+	for _, test := range tests {
+		got, err := CopyConflictPolicy(test.opts)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		i    int
+		want string
+	}{
+		{"/dir/report.pdf", 1, "/dir/report-1.pdf"},
+		{"/dir/archive.tar.gz", 2, "/dir/archive.tar-2.gz"},
+		{"/dir/notes", 3, "/dir/notes-3"},
+		{"/dir/.bashrc", 1, "/dir/.bashrc-1"},
+		{"report.pdf", 1, "report-1.pdf"},
+	}
+
+	for _, test := range tests {
+		if got := conflict_name(test.path, test.i); got != test.want {
+			t.Errorf("conflict_name(%q, %d) = %q, want %q", test.path, test.i, got, test.want)
+		}
+	}
+}
+
+func TestLocalConflict(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	sub := filepath.Join(dir, "sub")
+	for _, name := range []string{file, filepath.Join(dir, "a-1.txt")} {
+		if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		dest     string
+		isDir    bool
+		want     string
+		wantSkip bool
+		wantErr  bool
+	}{
+		{"missing", ConflictFail, filepath.Join(dir, "b.txt"), false, filepath.Join(dir, "b.txt"), false, false},
+		{"fail", ConflictFail, file, false, "", false, true},
+		{"skip", ConflictSkip, file, false, "", true, false},
+		{"overwrite", ConflictOverwrite, file, false, file, false, false},
+		{"rename past a taken name", ConflictRename, file, false, filepath.Join(dir, "a-2.txt"), false, false},
+		{"merge directory", ConflictSkip, sub, true, sub, false, false},
+		{"fail on directory", ConflictFail, sub, true, "", false, true},
+		{"overwrite directory with file", ConflictOverwrite, sub, false, "", false, true},
+		{"overwrite file with directory", ConflictOverwrite, file, true, "", false, true},
+		{"rename directory in the way", ConflictRename, sub, false, filepath.Join(dir, "sub-1"), false, false},
+	}
+
+	for _, test := range tests {
+		got, skip, err := local_conflict(test.policy, test.dest, test.isDir)
+		if (err != nil) != test.wantErr || skip != test.wantSkip || got != test.want {
+			t.Errorf("%s: got %q, %v, %v, want %q, %v", test.name, got, skip, err, test.want, test.wantSkip)
+		}
+	}
+	if _, _, err := local_conflict(ConflictFail, file, false); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("got error %v, want ErrAlreadyExists", err)
+	}
+}
+
+func TestCopyRecursiveConflicts(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	}))
+	defer aggregator.Close()
+
+	res := &DirAllResult{
+		Dirobj: "d0",
+		Files: map[string]ListDirFileItem{
+			"f0": {Name: "a.txt", Size: 3, WalrusBlobId: "blob0"},
+			"f1": {Name: "b.txt", Size: 3, WalrusBlobId: "blob1"},
+		},
+		Dirs: map[string]DirItem{
+			"d0": {ChildrenFiles: map[string]string{"a.txt": "f0", "b.txt": "f1"}, ChildrenDirectories: map[string]string{}},
+		},
+	}
+	c := WalrusClient{config: &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: time.Second, copyConcurrency: 2}}
+
+	// a copy that stopped after a.txt
+	setup := func() string {
+		dest := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dest, "top"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dest, "top", "a.txt"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return dest
+	}
+	read := func(dest string, name string) string {
+		b, err := os.ReadFile(filepath.Join(dest, "top", name))
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+
+	dest := setup()
+	if _, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictFail, nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("fail: got error %v, want ErrAlreadyExists", err)
+	}
+	if read(dest, "b.txt") != "" {
+		t.Errorf("fail: b.txt was written")
+	}
+
+	dest = setup()
+	if _, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictSkip, nil); err != nil {
+		t.Fatalf("skip: %v", err)
+	}
+	if read(dest, "a.txt") != "old" || read(dest, "b.txt") != "new" {
+		t.Errorf("skip: got a.txt %q and b.txt %q, want old and new", read(dest, "a.txt"), read(dest, "b.txt"))
+	}
+
+	dest = setup()
+	if _, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictOverwrite, nil); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if read(dest, "a.txt") != "new" || read(dest, "b.txt") != "new" {
+		t.Errorf("overwrite: got a.txt %q and b.txt %q, want both new", read(dest, "a.txt"), read(dest, "b.txt"))
+	}
+
+	dest = setup()
+	if _, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictRename, nil); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if read(dest, "a.txt") != "old" || read(dest, "a-1.txt") != "new" || read(dest, "b.txt") != "new" {
+		t.Errorf("rename: got a.txt %q, a-1.txt %q and b.txt %q", read(dest, "a.txt"), read(dest, "a-1.txt"), read(dest, "b.txt"))
+	}
+}
+
+func TestCopyWalrusConflicts(t *testing.T) {
+	t.Parallel()
+
+	setup := func(name string) (WalrusClient, *fakeChain) {
+		c, chain := newFakeChainClient("test-copy-conflicts-" + name)
+		expires := time.Now().Add(time.Hour)
+		listings.putStat(c.config.root, "/src/a.txt", &ListDirFileItem{Name: "a.txt", Size: 3, WalrusBlobId: "blobA"}, expires)
+		listings.putStat(c.config.root, "/dst/a.txt", &ListDirFileItem{Name: "a.txt", Size: 5, WalrusBlobId: "blobOld"}, expires)
+		listings.putStat(c.config.root, "/dst/a-1.txt", nil, expires)
+		return c, chain
+	}
+	ctx := context.Background()
+	src, dst := walrusConn("/src/a.txt"), walrusConn("/dst/a.txt")
+
+	c, chain := setup("fail")
+	if _, err := c.CopyInternal(ctx, src, dst, nil); !errors.Is(err, ErrOverwriteRequired) {
+		t.Errorf("fail: got error %v, want ErrOverwriteRequired", err)
+	}
+	if len(chain.calls) != 0 {
+		t.Errorf("fail: made calls %v", chain.functions())
+	}
+
+	c, chain = setup("skip")
+	if _, err := c.CopyInternal(ctx, src, dst, &wshrpc.FileCopyOpts{ConflictPolicy: "skip"}); err != nil || len(chain.calls) != 0 {
+		t.Errorf("skip: got error %v and calls %v, want neither", err, chain.functions())
+	}
+
+	c, chain = setup("overwrite")
+	if _, err := c.CopyInternal(ctx, src, dst, &wshrpc.FileCopyOpts{ConflictPolicy: "overwrite"}); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if !slices.Equal(chain.functions(), []string{"add_file"}) || chain.calls[0].Arguments[2] != "/dst/a.txt" || chain.calls[0].Arguments[14] != true {
+		t.Errorf("overwrite: got calls %+v, want an overwriting add_file of /dst/a.txt", chain.calls)
+	}
+
+	c, chain = setup("rename")
+	if _, err := c.CopyInternal(ctx, src, dst, &wshrpc.FileCopyOpts{ConflictPolicy: "rename"}); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if !slices.Equal(chain.functions(), []string{"add_file"}) || chain.calls[0].Arguments[2] != "/dst/a-1.txt" {
+		t.Errorf("rename: got calls %+v, want an add_file of /dst/a-1.txt", chain.calls)
+	}
+
+	// a directory onto a file fails without reporting a directory copy
+	c, chain = setup("directory")
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/src", &ListDirFileItem{Name: "src", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/dst", &ListDirFileItem{Name: "dst", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/dst/src", &ListDirFileItem{Name: "src", WalrusBlobId: "blobOld"}, expires)
+	if isDir, err := c.CopyInternal(ctx, walrusConn("/src"), walrusConn("/dst"), &wshrpc.FileCopyOpts{ConflictPolicy: "overwrite"}); err == nil || isDir || len(chain.calls) != 0 {
+		t.Errorf("directory: got %v, %v and calls %v, want an error only", isDir, err, chain.functions())
+	}
+}
+
+func TestCopyExpiredBlobToLocal(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.NotFoundHandler())
+	defer aggregator.Close()
+	config := &WalrusFsConfig{root: "test-copy-expired", cacheTTL: time.Hour, aggregatorUrl: aggregator.URL, httpTimeout: time.Second}
+	listings.putStat(config.root, "/a.txt", &ListDirFileItem{Name: "a.txt", Size: 3, WalrusBlobId: "blobA"}, time.Now().Add(time.Hour))
+	c := WalrusClient{config: config}
+
+	dest := &connparse.Connection{Scheme: "wsh", Host: "local", Path: t.TempDir()}
+	_, err := c.CopyInternal(context.Background(), walrusConn("/a.txt"), dest, nil)
+	if !errors.Is(err, ErrBlobExpired) || !strings.Contains(err.Error(), "blobA") {
+		t.Errorf("got %v, want the expired blob error with its id", err)
+	}
+}
+
+func TestCopyRecursiveDestination(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("new"))
+	}))
+	defer aggregator.Close()
+
+	res := &DirAllResult{
+		Dirobj: "d0",
+		Files:  map[string]ListDirFileItem{"f0": {Name: "a.txt", Size: 3, WalrusBlobId: "blob0"}},
+		Dirs: map[string]DirItem{
+			"d0": {ChildrenFiles: map[string]string{"a.txt": "f0"}, ChildrenDirectories: map[string]string{}},
+		},
+	}
+	c := WalrusClient{config: &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: time.Second, copyConcurrency: 1}}
+	dir := t.TempDir()
+
+	// missing parents are created
+	base := filepath.Join(dir, "missing", "parent")
+	if _, err := c.CopyRecursive(context.Background(), base, "top", res.Dirobj, res, ConflictFail, nil); err != nil {
+		t.Fatalf("missing parent: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(base, "top", "a.txt")); err != nil || string(b) != "new" {
+		t.Errorf("missing parent: got %q, %v", b, err)
+	}
+
+	// a parent that is a file is reported as it is, not as an existing destination
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.CopyRecursive(context.Background(), file, "top", res.Dirobj, res, ConflictFail, nil)
+	if err == nil || errors.Is(err, ErrAlreadyExists) || !strings.Contains(err.Error(), "cannot stat destination") {
+		t.Errorf("file parent: got error %v, want the stat error", err)
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permissions don't stop this user")
+	}
+	denied := filepath.Join(dir, "denied")
+	if err := os.Mkdir(denied, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(denied, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(denied, 0755)
+	_, err = c.CopyRecursive(context.Background(), filepath.Join(denied, "sub"), "top", res.Dirobj, res, ConflictFail, nil)
+	if !errors.Is(err, os.ErrPermission) || errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("permission denied: got error %v, want a permission error", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// CopyManifestName is the file a directory download keeps in its destination while it runs. Each downloaded and
+// verified file is appended to it, so a copy that fails half way skips those files when it is run again. It is
+// removed once the whole directory is downloaded
+const CopyManifestName = ".walrusfs-copy-manifest"
+
+// copyManifestEntry is a line of the manifest, a file at Path relative to the destination directory whose content
+// is the blobs Blobs
+type copyManifestEntry struct {
+	Path  string `json:"path"`
+	Blobs string `json:"blobs"`
+}
+
+// copyManifest records the files a directory download has written
+type copyManifest struct {
+	dir  string
+	lock sync.Mutex
+	done map[string]string
+	file *os.File
+}
+
+// manifest_blob_key is what the manifest records of a file's blobs, a file whose blobs changed is downloaded again
+func manifest_blob_key(blobIds []string) string {
+	return strings.Join(blobIds, ",")
+}
+
+// load_copy_manifest opens the manifest of an earlier download into dir, nil if there is none
+func load_copy_manifest(dir string) (*copyManifest, error) {
+	f, err := os.OpenFile(filepath.Join(dir, CopyManifestName), os.O_RDWR|os.O_APPEND, 0644)
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+		// a parent that is a file holds no manifest either, the copy reports it when it stats the destination
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open copy manifest: %w", err)
+	}
+	m := &copyManifest{dir: dir, done: make(map[string]string), file: f}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry copyManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last line is cut short when the copy stopped while writing it
+			continue
+		}
+		m.done[entry.Path] = entry.Blobs
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot read copy manifest: %w", err)
+	}
+	return m, nil
+}
+
+// create_copy_manifest starts an empty manifest for a download into dir
+func create_copy_manifest(dir string) (*copyManifest, error) {
+	f, err := os.OpenFile(filepath.Join(dir, CopyManifestName), os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create copy manifest: %w", err)
+	}
+	return &copyManifest{dir: dir, done: make(map[string]string), file: f}, nil
+}
+
+// rel returns the manifest path of the local filename
+func (m *copyManifest) rel(filename string) string {
+	rel, err := filepath.Rel(m.dir, filename)
+	if err != nil {
+		return filename
+	}
+	return filepath.ToSlash(rel)
+}
+
+// downloaded reports whether filename was downloaded from blobIds by an earlier run and still has its size
+func (m *copyManifest) downloaded(filename string, blobIds []string, size int64) bool {
+	if m == nil {
+		return false
+	}
+	m.lock.Lock()
+	blobs, ok := m.done[m.rel(filename)]
+	m.lock.Unlock()
+	if !ok || blobs != manifest_blob_key(blobIds) {
+		return false
+	}
+	fi, err := os.Stat(filename)
+	return err == nil && fi.Mode().IsRegular() && fi.Size() == size
+}
+
+// record appends filename downloaded from blobIds to the manifest
+func (m *copyManifest) record(filename string, blobIds []string) error {
+	entry := copyManifestEntry{Path: m.rel(filename), Blobs: manifest_blob_key(blobIds)}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.done[entry.Path] = entry.Blobs
+	_, err = m.file.Write(append(b, '\n'))
+	return err
+}
+
+// close closes the manifest, removing it when the download finished
+func (m *copyManifest) close(finished bool) error {
+	if err := m.file.Close(); err != nil {
+		return err
+	}
+	if !finished {
+		return nil
+	}
+	return os.Remove(m.file.Name())
+}
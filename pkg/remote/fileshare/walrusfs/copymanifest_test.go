@@ -0,0 +1,144 @@
+package walrusfs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCopyManifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sub", "a.txt")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err := load_copy_manifest(dir); m != nil || err != nil {
+		t.Fatalf("got manifest %v, %v before one was created", m, err)
+	}
+	m, err := create_copy_manifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.record(file, []string{"blob1", "blob2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.close(false); err != nil {
+		t.Fatal(err)
+	}
+	// a line cut short by the copy stopping is ignored
+	f, err := os.OpenFile(filepath.Join(dir, CopyManifestName), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"path":"b.t`)
+	f.Close()
+
+	m, err = load_copy_manifest(dir)
+	if err != nil || m == nil {
+		t.Fatalf("got manifest %v, %v", m, err)
+	}
+	if !m.downloaded(file, []string{"blob1", "blob2"}, 3) {
+		t.Errorf("recorded file is not downloaded")
+	}
+	if m.downloaded(file, []string{"blob1", "blob3"}, 3) {
+		t.Errorf("file with changed blobs is downloaded")
+	}
+	if m.downloaded(file, []string{"blob1", "blob2"}, 4) {
+		t.Errorf("file with another size is downloaded")
+	}
+	if m.downloaded(filepath.Join(dir, "b.txt"), []string{"blob1"}, 0) {
+		t.Errorf("file that was not recorded is downloaded")
+	}
+	var nilManifest *copyManifest
+	if nilManifest.downloaded(file, []string{"blob1", "blob2"}, 3) {
+		t.Errorf("no manifest has a download")
+	}
+
+	if err := m.close(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, CopyManifestName)); !os.IsNotExist(err) {
+		t.Errorf("manifest was not removed after the copy finished: %v", err)
+	}
+}
+
+func TestCopyRecursiveResume(t *testing.T) {
+	t.Parallel()
+
+	var lock sync.Mutex
+	requests := map[string]int{}
+	failing := true
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blobId := filepath.Base(r.URL.Path)
+		lock.Lock()
+		requests[blobId]++
+		fail := failing && blobId == "blob1"
+		lock.Unlock()
+		if fail {
+			http.Error(w, "bad blob", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("content of " + blobId))
+	}))
+	defer aggregator.Close()
+
+	res := &DirAllResult{
+		Dirobj: "d0",
+		Files: map[string]ListDirFileItem{
+			"f0": {Name: "a.txt", Size: int64(len("content of blob0")), WalrusBlobId: "blob0"},
+			"f1": {Name: "b.txt", Size: int64(len("content of blob1")), WalrusBlobId: "blob1"},
+		},
+		Dirs: map[string]DirItem{
+			"d0": {ChildrenFiles: map[string]string{"a.txt": "f0"}, ChildrenDirectories: map[string]string{"sub": "d1"}},
+			"d1": {ChildrenFiles: map[string]string{"b.txt": "f1"}, ChildrenDirectories: map[string]string{}},
+		},
+	}
+	c := WalrusClient{config: &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: time.Second, copyConcurrency: 1}}
+	dest := t.TempDir()
+	manifestPath := filepath.Join(dest, "top", CopyManifestName)
+
+	_, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictFail, nil)
+	if err == nil || !strings.Contains(err.Error(), "resume") {
+		t.Fatalf("got error %v, want one saying the copy can be resumed", err)
+	}
+	if _, err := os.Stat(manifestPath); err != nil {
+		t.Fatalf("manifest was not left behind: %v", err)
+	}
+
+	lock.Lock()
+	failing = false
+	lock.Unlock()
+	if _, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictFail, nil); err != nil {
+		t.Fatalf("resumed copy: %v", err)
+	}
+	lock.Lock()
+	if requests["blob0"] != 1 || requests["blob1"] < 2 {
+		t.Errorf("got requests %v, want blob0 fetched once and blob1 again", requests)
+	}
+	lock.Unlock()
+	for name, want := range map[string]string{"a.txt": "content of blob0", filepath.Join("sub", "b.txt"): "content of blob1"} {
+		if b, err := os.ReadFile(filepath.Join(dest, "top", name)); err != nil || string(b) != want {
+			t.Errorf("%s: got %q, %v, want %q", name, b, err, want)
+		}
+	}
+	if _, err := os.Stat(manifestPath); !os.IsNotExist(err) {
+		t.Errorf("manifest was not removed after the copy finished: %v", err)
+	}
+
+	// a finished copy isn't resumed, the destination exists
+	if _, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictFail, nil); err == nil {
+		t.Errorf("copying onto a finished copy succeeded")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+type dedupUploadKey struct{}
+
+// WithDedupUpload returns a context that overrides walrusfs:dedupuploads for uploads with this context. With dedup
+// set, an upload first compares its content with the file already at the destination. When the content is the same
+// and its blobs are still served and stored for as long as the upload asks, they are recorded again and nothing is
+// sent to a publisher. Only content that can be rewound, such as a local file, is compared
+func WithDedupUpload(ctx context.Context, dedup bool) context.Context {
+	return context.WithValue(ctx, dedupUploadKey{}, dedup)
+}
+
+// is_dedup_upload returns whether uploads with ctx look for a duplicate first
+func (config *WalrusFsConfig) is_dedup_upload(ctx context.Context) bool {
+	if dedup, ok := ctx.Value(dedupUploadKey{}).(bool); ok {
+		return dedup
+	}
+	return config.dedupUploads
+}
+
+// find_duplicate returns the file at dstpath when its blobs hold the size bytes of data and can be reused for an
+// upload storing them for epochs, nil when the content has to be uploaded. data is read to hash it and rewound
+func find_duplicate(ctx context.Context, config *WalrusFsConfig, data io.Reader, size int64, dstpath string, epochs int) (*ListDirFileItem, error) {
+	rs, ok := data.(io.ReadSeeker)
+	if !ok || size < 0 {
+		return nil, nil
+	}
+	item, err := stat(ctx, config, dstpath)
+	// the sha256 of encrypted content doesn't tell which key its blobs were encrypted with, so they aren't reused
+	if err != nil || item == nil || item.IsDir || item.Size != size || item.ContentSha256 == "" || item.Encrypted || config.encrypts() {
+		return nil, nil
+	}
+
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(rs, size+1))
+	if _, serr := rs.Seek(start, io.SeekStart); serr != nil {
+		// the content can't be uploaded from where it started either
+		return nil, serr
+	}
+	if err != nil || n != size || !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), item.ContentSha256) {
+		return nil, nil
+	}
+
+	// the publisher would extend storage that ends before the upload asks for
+	epochs, err = getStorageEpochs(config, epochs)
+	if err != nil {
+		return nil, err
+	}
+	current, err := current_epoch(ctx, config)
+	if err != nil {
+		logger.Debug("cannot read walrus epoch, uploading", "path", dstpath, "err", err)
+		return nil, nil
+	}
+	if item.WalrusEpochTill < current+int64(epochs) {
+		return nil, nil
+	}
+	for _, blobId := range file_blob_ids(item.WalrusBlobId, item.WalrusBlobIds) {
+		if available, err := blob_available(ctx, config, blobId); !available {
+			logger.Debug("duplicate blob is not available, uploading", "path", dstpath, "blob", blobId, "err", err)
+			return nil, nil
+		}
+	}
+	logger.Debug("content is already on walrus, skipping upload", "path", dstpath, "blob", item.WalrusBlobId)
+	return item, nil
+}
@@ -0,0 +1,82 @@
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupUpload(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var body atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/blobA") {
+			http.NotFound(w, r)
+		}
+	}))
+	defer aggregator.Close()
+
+	c, chain := newFakeChainClient("test-dedup")
+	chain.currentEpoch = 5
+	c.config.publisherUrls = []string{publisher.URL}
+	c.config.aggregatorUrl = aggregator.URL
+	c.config.httpTimeout = time.Second
+	sum := sha256.Sum256([]byte("hello walrus"))
+	listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt", Size: 12, WalrusBlobId: "blobA", ContentSha256: hex.EncodeToString(sum[:]), WalrusEpochTill: 20, Certified: true}, time.Now().Add(time.Hour))
+	listings.putStat(c.config.root, "/gone.txt", &ListDirFileItem{Name: "gone.txt", Size: 12, WalrusBlobId: "blobB", ContentSha256: hex.EncodeToString(sum[:]), WalrusEpochTill: 20}, time.Now().Add(time.Hour))
+
+	dedup := WithDedupUpload(context.Background(), true)
+	publish := func(ctx context.Context, data io.Reader, dstpath string, epochs int) *fileRecord {
+		t.Helper()
+		rec, err := publish_file(ctx, c.config, data, 12, dstpath, []string{"tag"}, 0, true, epochs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	rec := publish(dedup, strings.NewReader("hello walrus"), "/a.txt", 3)
+	if !slices.Equal(rec.blobIds, []string{"blobA"}) || rec.endEpoch != 20 || !rec.certified || requests.Load() != 0 {
+		t.Errorf("got record %+v after %d uploads, want blobA reused without uploading", rec, requests.Load())
+	}
+	if !slices.Contains(rec.tags, "tag") {
+		t.Errorf("got tags %v, want the tags of the upload", rec.tags)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		data    io.Reader
+		dstpath string
+		epochs  int
+	}{
+		{"off by default", context.Background(), strings.NewReader("hello walrus"), "/a.txt", 3},
+		{"different content", dedup, strings.NewReader("hello w4lrus"), "/a.txt", 3},
+		{"storage too short", dedup, strings.NewReader("hello walrus"), "/a.txt", 20},
+		{"not seekable", dedup, io.MultiReader(strings.NewReader("hello walrus")), "/a.txt", 3},
+		{"blob not served", dedup, strings.NewReader("hello walrus"), "/gone.txt", 3},
+		{"new file", dedup, strings.NewReader("hello walrus"), "/b.txt", 3},
+	}
+	for _, tc := range tests {
+		before := requests.Load()
+		rec := publish(tc.ctx, tc.data, tc.dstpath, tc.epochs)
+		if !slices.Equal(rec.blobIds, []string{"blob1"}) || requests.Load() != before+1 {
+			t.Errorf("%s: got record %+v after %d uploads, want the content uploaded", tc.name, rec, requests.Load()-before)
+		}
+		// the whole content is uploaded after it was hashed
+		if got := body.Load(); !strings.HasPrefix(got.(string), "hello w") || len(got.(string)) != 12 {
+			t.Errorf("%s: publisher got %q", tc.name, got)
+		}
+	}
+}
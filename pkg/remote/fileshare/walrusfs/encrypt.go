@@ -0,0 +1,81 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// EncryptionKeySize is the size of walrusfs:encryptionkey, which is set as twice as many hex digits. It is the AES-256
+// key itself and has to be random, e.g. from openssl rand -hex 32, a passphrase is refused
+const EncryptionKeySize = 32
+
+// EncryptionOverhead is the number of bytes an encrypted blob has on top of the chunk it holds, the random nonce it
+// starts with and the AES-GCM tag it ends with
+const EncryptionOverhead = 12 + 16
+
+// encrypts returns whether uploads are encrypted, which they are whenever walrusfs:encryptionkey is set
+func (config *WalrusFsConfig) encrypts() bool {
+	return config.encryptionKey != ""
+}
+
+// encryption_key decodes walrusfs:encryptionkey, which has to be EncryptionKeySize random bytes in hex
+func encryption_key(config *WalrusFsConfig) ([]byte, error) {
+	key, err := hex.DecodeString(string(config.encryptionKey))
+	if err != nil || len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("walrusfs:encryptionkey must be %d hex digits of a random key, e.g. from openssl rand -hex %d", 2*EncryptionKeySize, EncryptionKeySize)
+	}
+	return key, nil
+}
+
+// blob_cipher returns the AES-256-GCM cipher keyed with walrusfs:encryptionkey
+func blob_cipher(config *WalrusFsConfig) (cipher.AEAD, error) {
+	if config.encryptionKey == "" {
+		return nil, typed_error(ErrEncrypted, "walrusfs:encryptionkey is not set")
+	}
+	key, err := encryption_key(config)
+	if err != nil {
+		return nil, typed_error(ErrEncrypted, "%v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns plain encrypted as a random nonce followed by the sealed bytes
+func seal(config *WalrusFsConfig, plain []byte) ([]byte, error) {
+	aead, err := blob_cipher(config)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(sealed); err != nil {
+		return nil, err
+	}
+	return aead.Seal(sealed, sealed, plain, nil), nil
+}
+
+// open_sealed decrypts a blob written by seal. A blob that doesn't open was encrypted with another key or
+// altered
+func open_sealed(config *WalrusFsConfig, blobId string, sealed []byte) ([]byte, error) {
+	aead, err := blob_cipher(config)
+	if err != nil {
+		return nil, fmt.Errorf("walrus blob %s is encrypted: %w", blobId, err)
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, typed_error(ErrEncrypted, "walrus blob %s is too short to be encrypted", blobId)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, typed_error(ErrEncrypted, "cannot decrypt walrus blob %s, walrusfs:encryptionkey may not be the key it was uploaded with", blobId)
+	}
+	return plain, nil
+}
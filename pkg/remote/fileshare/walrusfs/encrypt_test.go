@@ -0,0 +1,77 @@
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testEncryptionKey is a walrusfs:encryptionkey, random keys are hex
+var testEncryptionKey = strings.Repeat("5e", EncryptionKeySize)
+
+func TestEncryptedUpload(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var body atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+	// serves what was last published as blob1
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer aggregator.Close()
+
+	newConfig := func(key string) *WalrusFsConfig {
+		return &WalrusFsConfig{
+			publisherUrls: []string{publisher.URL},
+			aggregatorUrl: aggregator.URL,
+			httpTimeout:   time.Second,
+			encryptionKey: secretString(key),
+			verifyUpload:  true,
+		}
+	}
+	config := newConfig(testEncryptionKey)
+	ctx := context.Background()
+	content := "hello walrus"
+	rec, err := publish_file(ctx, config, strings.NewReader(content), int64(len(content)), "/a.txt", nil, 0, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := body.Load().(string)
+	if !rec.coding.encrypted || strings.Contains(stored, content) || len(stored) != len(content)+EncryptionOverhead {
+		t.Errorf("got record %+v and stored %q, want the content encrypted", rec, stored)
+	}
+
+	b, err := get_file(ctx, config, rec.contentSha256, rec.coding, rec.blobIds...)
+	if err != nil || string(b) != content {
+		t.Errorf("get_file: got %q, %v", b, err)
+	}
+	b, err = io.ReadAll(new_blob_reader(ctx, config, rec.contentSha256, rec.coding, rec.blobIds))
+	if err != nil || string(b) != content {
+		t.Errorf("blob reader: got %q, %v", b, err)
+	}
+	for _, key := range []string{"", strings.Repeat("0f", EncryptionKeySize), "secret"} {
+		if _, err := get_file(ctx, newConfig(key), rec.contentSha256, rec.coding, rec.blobIds...); !errors.Is(err, ErrEncrypted) {
+			t.Errorf("key %q: got %v, want ErrEncrypted", key, err)
+		}
+	}
+
+	// files uploaded without a key still read as they are stored
+	plain := newConfig("")
+	rec, err = publish_file(ctx, plain, strings.NewReader(content), int64(len(content)), "/b.txt", nil, 0, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.coding.encrypted || body.Load().(string) != content {
+		t.Errorf("got record %+v and stored %q, want the content as it is", rec, body.Load())
+	}
+	if b, err := get_file(ctx, config, rec.contentSha256, rec.coding, rec.blobIds...); err != nil || string(b) != content {
+		t.Errorf("plaintext file with a key set: got %q, %v", b, err)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/block-vision/sui-go-sdk/models"
+)
+
+// EpochInfo describes the walrus network's epochs, read from the walrus staking object
+type EpochInfo struct {
+	Epoch    uint64
+	Duration time.Duration
+	// zero while the network is changing epochs
+	NextEpochStart time.Time
+}
+
+// CurrentEpoch returns the current walrus epoch and the time the next one starts, which is zero while an epoch
+// change is in progress. It reads the staking object set in walrusfs:stakingobject, which has to be set
+func (c WalrusClient) CurrentEpoch(ctx context.Context) (uint64, time.Time, error) {
+	if err := c.config.require_staking_object("read the current walrus epoch"); err != nil {
+		return 0, time.Time{}, err
+	}
+	info, err := get_epoch_info(ctx, c.config)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return info.Epoch, info.NextEpochStart, nil
+}
+
+// GetEpochInfo returns the current walrus epoch, the epoch duration and the time the next epoch starts
+func (c WalrusClient) GetEpochInfo(ctx context.Context) (*EpochInfo, error) {
+	return get_epoch_info(ctx, c.config)
+}
+
+// current_epoch returns the epoch file expiry is measured against, the network's epoch when the staking object is
+// configured and readable. Otherwise it is the latest epoch publishers reported to this config, or the epoch older
+// versions recorded in the walrusfs root object when that is later
+func current_epoch(ctx context.Context, config *WalrusFsConfig) (int64, error) {
+	if config.stakingObject != "" {
+		info, err := get_epoch_info(ctx, config)
+		if err == nil {
+			return int64(info.Epoch), nil
+		}
+		logger.Warn("cannot read walrus epoch from the staking object, using the last epoch seen", "err", err)
+	}
+	known := config.known_epoch()
+	recorded, err := get_current_epoch(ctx, config)
+	if err != nil {
+		if known > 0 {
+			return known, nil
+		}
+		return 0, err
+	}
+	return max(known, recorded), nil
+}
+
+// get_epoch_info reads the epochs from the inner object of the walrus staking object
+func get_epoch_info(ctx context.Context, config *WalrusFsConfig) (*EpochInfo, error) {
+	if err := config.require_staking_object("read walrus epochs"); err != nil {
+		return nil, err
+	}
+	fields, _, err := get_versioned_inner(ctx, config, config.stakingObject, "staking")
+	if err != nil {
+		return nil, err
+	}
+	return parse_epoch_info(fields)
+}
+
+// require_staking_object fails when walrusfs:stakingobject isn't set, what names the feature that needs it
+func (config *WalrusFsConfig) require_staking_object(what string) error {
+	if config.stakingObject == "" {
+		return fmt.Errorf("walrusfs:stakingobject is not set, it is needed to %s", what)
+	}
+	return nil
+}
+
+// get_versioned_inner reads the fields of the inner object of a versioned walrus object such as the staking or the
+// system object, it is a dynamic field keyed by the object's version. The fields of the object itself are returned too
+func get_versioned_inner(ctx context.Context, config *WalrusFsConfig, objectId string, kind string) (inner map[string]interface{}, outer map[string]interface{}, err error) {
+	cli := config.getSuiClient()
+	obj, err := with_retry(ctx, config.retryPolicy, "get "+kind+" object", func() (models.SuiObjectResponse, error) {
+		return cli.SuiGetObject(ctx, models.SuiGetObjectRequest{
+			ObjectId: objectId,
+			Options:  models.SuiObjectDataOptions{ShowContent: true},
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if obj.Data == nil || obj.Data.Content == nil {
+		return nil, nil, fmt.Errorf("walrus %s object %s has no content", kind, objectId)
+	}
+	version, err := get_map_string(obj.Data.Content.Fields, "version")
+	if err != nil {
+		return nil, nil, fmt.Errorf("walrus %s object %s: %w", kind, objectId, err)
+	}
+
+	state, err := with_retry(ctx, config.retryPolicy, "get "+kind+" state", func() (models.SuiObjectResponse, error) {
+		return cli.SuiXGetDynamicFieldObject(ctx, models.SuiXGetDynamicFieldObjectRequest{
+			ObjectId:         objectId,
+			DynamicFieldName: models.DynamicFieldObjectName{Type: "u64", Value: version},
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if state.Data == nil || state.Data.Content == nil {
+		return nil, nil, fmt.Errorf("walrus %s object %s has no state for version %s", kind, objectId, version)
+	}
+	value, ok := state.Data.Content.Fields["value"].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("walrus %s state has no value", kind)
+	}
+	fields, ok := value["fields"].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("walrus %s state has no fields", kind)
+	}
+	return fields, obj.Data.Content.Fields, nil
+}
+
+// parse_epoch_info reads the epoch fields of the walrus StakingInnerV1 struct. The first epoch starts at
+// first_epoch_start, later ones one epoch duration after the last epoch change, which epoch_state records
+// unless a change is in progress
+func parse_epoch_info(fields map[string]interface{}) (*EpochInfo, error) {
+	epoch, err := get_map_uint64(fields, "current_epoch")
+	if err != nil {
+		return nil, err
+	}
+	durationMs, err := get_map_uint64(fields, "epoch_duration")
+	if err != nil {
+		return nil, err
+	}
+	info := &EpochInfo{Epoch: epoch, Duration: time.Duration(durationMs) * time.Millisecond}
+	if epoch == 0 {
+		firstStart, err := get_map_uint64(fields, "first_epoch_start")
+		if err != nil {
+			return nil, err
+		}
+		info.NextEpochStart = time.UnixMilli(int64(firstStart))
+		return info, nil
+	}
+
+	state, ok := fields["epoch_state"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q is missing", "epoch_state")
+	}
+	variant, _ := state["variant"].(string)
+	switch variant {
+	case "EpochChangeSync":
+		return info, nil
+	case "EpochChangeDone", "NextParamsSelected":
+		stateFields, ok := state["fields"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("epoch state %s has no fields", variant)
+		}
+		lastChange, err := get_map_uint64(stateFields, "pos0")
+		if err != nil {
+			return nil, fmt.Errorf("epoch state %s: %w", variant, err)
+		}
+		info.NextEpochStart = time.UnixMilli(int64(lastChange)).Add(info.Duration)
+		return info, nil
+	}
+	return nil, fmt.Errorf("unknown walrus epoch state %q", variant)
+}
+
+// get_map_uint64 decodes an unsigned integer field, u64 and larger come as decimal strings and smaller ones as numbers
+func get_map_uint64(m map[string]interface{}, key string) (uint64, error) {
+	v, err := get_map_value(m, key)
+	if err != nil {
+		return 0, err
+	}
+	switch n := v.(type) {
+	case float64:
+		if n < 0 || n != float64(uint64(n)) {
+			return 0, fmt.Errorf("field %q is not a valid integer: %v", key, n)
+		}
+		return uint64(n), nil
+	case string:
+		u, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("field %q is not a valid integer: %w", key, err)
+		}
+		return u, nil
+	}
+	return 0, fmt.Errorf("field %q has type %T, expected integer", key, v)
+}
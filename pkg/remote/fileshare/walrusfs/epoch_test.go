@@ -0,0 +1,157 @@
+package walrusfs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseEpochInfo(t *testing.T) {
+	t.Parallel()
+
+	const hour = int64(time.Hour / time.Millisecond)
+	tests := []struct {
+		name      string
+		fields    map[string]interface{}
+		wantEpoch uint64
+		wantNext  time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "first epoch",
+			fields:    map[string]interface{}{"current_epoch": float64(0), "epoch_duration": "3600000", "first_epoch_start": "1700000000000"},
+			wantEpoch: 0,
+			wantNext:  time.UnixMilli(1700000000000),
+		},
+		{
+			name: "epoch change done",
+			fields: map[string]interface{}{"current_epoch": float64(7), "epoch_duration": "3600000",
+				"epoch_state": map[string]interface{}{"variant": "EpochChangeDone", "fields": map[string]interface{}{"pos0": "1700000000000"}}},
+			wantEpoch: 7,
+			wantNext:  time.UnixMilli(1700000000000 + hour),
+		},
+		{
+			name: "next params selected",
+			fields: map[string]interface{}{"current_epoch": float64(8), "epoch_duration": "3600000",
+				"epoch_state": map[string]interface{}{"variant": "NextParamsSelected", "fields": map[string]interface{}{"pos0": "1700000000000"}}},
+			wantEpoch: 8,
+			wantNext:  time.UnixMilli(1700000000000 + hour),
+		},
+		{
+			name: "epoch change in progress",
+			fields: map[string]interface{}{"current_epoch": float64(9), "epoch_duration": "3600000",
+				"epoch_state": map[string]interface{}{"variant": "EpochChangeSync", "fields": map[string]interface{}{"pos0": float64(100)}}},
+			wantEpoch: 9,
+		},
+		{
+			name:    "missing duration",
+			fields:  map[string]interface{}{"current_epoch": float64(1)},
+			wantErr: true,
+		},
+		{
+			name: "unknown state",
+			fields: map[string]interface{}{"current_epoch": float64(1), "epoch_duration": "3600000",
+				"epoch_state": map[string]interface{}{"variant": "Halted"}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		info, err := parse_epoch_info(tc.fields)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if info.Epoch != tc.wantEpoch || !info.NextEpochStart.Equal(tc.wantNext) || info.Duration != time.Hour {
+			t.Errorf("%s: got %+v, want epoch %d starting the next at %v", tc.name, info, tc.wantEpoch, tc.wantNext)
+		}
+	}
+}
+
+func TestCurrentEpoch(t *testing.T) {
+	t.Parallel()
+
+	const stakingId = "0x00000000000000000000000000000000000000000000000000000000000000bb"
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id     int               `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var result any
+		switch req.Method {
+		case "sui_getObject":
+			result = map[string]any{"data": map[string]any{"objectId": stakingId, "version": "1", "digest": "d",
+				"content": map[string]any{"dataType": "moveObject", "fields": map[string]any{"version": "2"}}}}
+		case "suix_getDynamicFieldObject":
+			result = map[string]any{"data": map[string]any{"objectId": "0x1", "version": "1", "digest": "d",
+				"content": map[string]any{"dataType": "moveObject", "fields": map[string]any{
+					"name": "2",
+					"value": map[string]any{"fields": map[string]any{
+						"current_epoch":  12,
+						"epoch_duration": "86400000",
+						"epoch_state":    map[string]any{"variant": "EpochChangeDone", "fields": map[string]any{"pos0": "1700000000000"}},
+					}},
+				}}}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.Id, "result": result})
+	}))
+	defer rpc.Close()
+
+	c := WalrusClient{config: &WalrusFsConfig{rpcUrl: rpc.URL, stakingObject: stakingId}}
+	epoch, next, err := c.CurrentEpoch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if epoch != 12 || !next.Equal(time.UnixMilli(1700000000000).Add(24*time.Hour)) {
+		t.Errorf("got epoch %d with the next starting at %v", epoch, next)
+	}
+
+	// without the staking object the epoch recorded in the root isn't used instead
+	c = WalrusClient{config: &WalrusFsConfig{rpcUrl: rpc.URL}}
+	if epoch, _, err := c.CurrentEpoch(context.Background()); err == nil || !strings.Contains(err.Error(), "walrusfs:stakingobject") {
+		t.Errorf("got epoch %d, %v without a staking object, want an error naming the setting", epoch, err)
+	}
+}
+
+func TestObservedEpoch(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var body atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+	c, chain := newFakeChainClient("test-observed-epoch")
+	chain.currentEpoch = 2
+	c.config.publisherUrls = []string{publisher.URL}
+	c.config.httpTimeout = time.Second
+	ctx := context.Background()
+
+	if epoch, err := current_epoch(ctx, c.config); err != nil || epoch != 2 {
+		t.Errorf("got %d, %v before publishing, want the epoch recorded in the root", epoch, err)
+	}
+	// the publisher registers the blob in epoch 3, which is remembered without a transaction
+	if _, err := publish_file(ctx, c.config, strings.NewReader("hello walrus"), 12, "/a.txt", nil, 0, true, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.executed) != 0 {
+		t.Errorf("got transactions %v publishing a file", chain.executed)
+	}
+	if epoch, err := current_epoch(ctx, c.config); err != nil || epoch != 3 {
+		t.Errorf("got %d, %v after publishing, want the registered epoch", epoch, err)
+	}
+	chain.currentEpoch = 5
+	if epoch, err := current_epoch(ctx, c.config); err != nil || epoch != 5 {
+		t.Errorf("got %d, %v, want the later recorded epoch", epoch, err)
+	}
+}
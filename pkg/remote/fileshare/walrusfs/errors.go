@@ -0,0 +1,100 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+)
+
+// Errors returned by walrusfs operations, wrapped so they can be told apart with errors.Is. ErrNotFound also
+// matches fs.ErrNotExist, ErrAlreadyExists matches fs.ErrExist and ErrInvalidPath matches fs.ErrInvalid
+var (
+	ErrNotFound            error = kindError{"not found", fs.ErrNotExist}
+	ErrAlreadyExists       error = kindError{"already exists", fs.ErrExist}
+	ErrInvalidPath         error = kindError{"invalid path", fs.ErrInvalid}
+	ErrOverwriteRequired         = errors.New("overwrite required")
+	ErrInsufficientGas           = errors.New("insufficient gas")
+	ErrBlobExpired               = errors.New("walrus blob expired")
+	ErrBlobUnavailable           = errors.New("walrus blob unavailable")
+	ErrWalrusUnreachable         = errors.New("walrus or sui unreachable")
+	ErrReadOnly                  = errors.New("walrusfs client is read only")
+	ErrEncrypted                 = errors.New("walrus file is encrypted")
+	ErrTooLarge                  = errors.New("file too large")
+	ErrIncompatiblePackage       = errors.New("walrusfs package incompatible with this client")
+)
+
+// abort codes of the walrusfs move module
+const (
+	abortPathError              = 1
+	abortFileAlreadyExists      = 3
+	abortDirectoryAlreadyExists = 4
+)
+
+// kindError is a sentinel that also matches a standard library error
+type kindError struct {
+	msg  string
+	also error
+}
+
+func (e kindError) Error() string {
+	return e.msg
+}
+
+func (e kindError) Is(target error) bool {
+	return target == e.also
+}
+
+// typedError keeps the message of err while matching kind with errors.Is
+type typedError struct {
+	kind error
+	err  error
+}
+
+func (e *typedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *typedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// typed_error formats an error that matches kind, without adding the kind to the message
+func typed_error(kind error, format string, args ...any) error {
+	return &typedError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// with_kind marks err as kind, nil stays nil
+func with_kind(kind error, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &typedError{kind: kind, err: err}
+}
+
+var moveAbortRe = regexp.MustCompile(`MoveAbort\(.*, (\d+)\) in command`)
+
+// move_abort_kind returns the error kind of a walrusfs move abort in a transaction status error, or nil
+func move_abort_kind(statusError string) error {
+	m := moveAbortRe.FindStringSubmatch(statusError)
+	if m == nil {
+		return nil
+	}
+	code, err := strconv.Atoi(m[1])
+	if err != nil {
+		return nil
+	}
+	switch code {
+	case abortPathError:
+		return ErrNotFound
+	case abortFileAlreadyExists:
+		return ErrOverwriteRequired
+	case abortDirectoryAlreadyExists:
+		return ErrAlreadyExists
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fstype"
+)
+
+func TestTypedErrors(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("stat: %w", typed_error(ErrNotFound, "file not found: %s", "wavefile://walrus/a"))
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("not found error %v doesn't match ErrNotFound and fs.ErrNotExist", err)
+	}
+	if errors.Is(err, ErrOverwriteRequired) {
+		t.Errorf("not found error %v matches ErrOverwriteRequired", err)
+	}
+
+	err = typed_error(ErrOverwriteRequired, fstype.OverwriteRequiredError, "/a")
+	if err.Error() != fmt.Sprintf(fstype.OverwriteRequiredError, "/a") {
+		t.Errorf("typed error changed the message to %q", err.Error())
+	}
+	if !errors.Is(err, ErrOverwriteRequired) {
+		t.Errorf("overwrite error %v doesn't match ErrOverwriteRequired", err)
+	}
+
+	if !errors.Is(tx_status_error("add_file", "digest1", "InsufficientGas", 1), ErrInsufficientGas) {
+		t.Errorf("out of gas error doesn't match ErrInsufficientGas")
+	}
+}
+
+func TestMoveAbortKind(t *testing.T) {
+	t.Parallel()
+
+	abort := func(code int) string {
+		return fmt.Sprintf(`MoveAbort(MoveLocation { module: ModuleId { address: 0x1, name: Identifier("walrusfs") }, function: 4, instruction: 21, function_name: Some("add_file") }, %d) in command 0`, code)
+	}
+	tests := []struct {
+		status string
+		want   error
+	}{
+		{abort(1), ErrNotFound},
+		{abort(3), ErrOverwriteRequired},
+		{abort(4), ErrAlreadyExists},
+		{abort(5), nil},
+		{"InsufficientGas", nil},
+	}
+	for _, tc := range tests {
+		if got := move_abort_kind(tc.status); got != tc.want {
+			t.Errorf("got kind %v for %q, want %v", got, tc.status, tc.want)
+		}
+		err := tx_status_error("add_file", "digest1", tc.status, 1)
+		if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("transaction error %v doesn't match %v", err, tc.want)
+		}
+	}
+}
+
+func TestUnreachableErrors(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+	_, err := with_retry(context.Background(), policy, "stat", func() (int, error) {
+		return 0, errors.New("503 service unavailable")
+	})
+	if !errors.Is(err, ErrWalrusUnreachable) {
+		t.Errorf("exhausted transient error %v doesn't match ErrWalrusUnreachable", err)
+	}
+	_, err = with_retry(context.Background(), policy, "stat", func() (int, error) {
+		return 0, errors.New("invalid params")
+	})
+	if errors.Is(err, ErrWalrusUnreachable) {
+		t.Errorf("permanent error %v matches ErrWalrusUnreachable", err)
+	}
+
+	status := http.StatusNotFound
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer aggregator.Close()
+	config := &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: 5 * time.Second}
+	if _, err := get_blob(context.Background(), config, "blob1"); !errors.Is(err, ErrBlobExpired) {
+		t.Errorf("missing blob error %v doesn't match ErrBlobExpired", err)
+	}
+	status = http.StatusServiceUnavailable
+	if _, err := get_blob(context.Background(), config, "blob1"); !errors.Is(err, ErrWalrusUnreachable) || !errors.Is(err, ErrBlobUnavailable) {
+		t.Errorf("aggregator error %v doesn't match ErrWalrusUnreachable and ErrBlobUnavailable", err)
+	}
+	aggregator.Close()
+	if _, err := get_blob(context.Background(), config, "blob1"); !errors.Is(err, ErrWalrusUnreachable) || !errors.Is(err, ErrBlobUnavailable) {
+		t.Errorf("connection error %v doesn't match ErrWalrusUnreachable and ErrBlobUnavailable", err)
+	}
+}
+
+func TestBlobAvailable(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusOK
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/v1/blobs/blob1" {
+			t.Errorf("unexpected aggregator request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer aggregator.Close()
+	c := WalrusClient{config: &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: 5 * time.Second}}
+
+	tests := []struct {
+		status  int
+		want    bool
+		wantErr error
+	}{
+		{http.StatusOK, true, nil},
+		{http.StatusNotFound, false, nil},
+		{http.StatusServiceUnavailable, false, ErrBlobUnavailable},
+	}
+	for _, tc := range tests {
+		status = tc.status
+		ok, err := c.BlobAvailable(context.Background(), "blob1")
+		if ok != tc.want || (tc.wantErr == nil && err != nil) || (tc.wantErr != nil && !errors.Is(err, tc.wantErr)) {
+			t.Errorf("status %d: got %v, %v, want %v, %v", tc.status, ok, err, tc.want, tc.wantErr)
+		}
+	}
+	aggregator.Close()
+	if ok, err := c.BlobAvailable(context.Background(), "blob1"); ok || !errors.Is(err, ErrBlobUnavailable) {
+		t.Errorf("unreachable aggregator: got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/block-vision/sui-go-sdk/models"
+)
+
+const (
+	// FinalityTimeout is how long an executed transaction is waited for to be included in a checkpoint
+	FinalityTimeout = time.Minute
+	finalityMaxPoll = 4 * time.Second
+)
+
+// finalityBasePoll is the delay before polling a transaction again, it doubles up to finalityMaxPoll
+var finalityBasePoll = 250 * time.Millisecond
+
+type waitFinalityKey struct{}
+
+// WithWaitFinality returns a context whose walrus transactions are waited for until they are checkpointed, or not,
+// instead of following walrusfs:waitfinality
+func WithWaitFinality(ctx context.Context, wait bool) context.Context {
+	return context.WithValue(ctx, waitFinalityKey{}, wait)
+}
+
+// is_wait_finality returns whether transactions made with ctx wait for finality
+func (config *WalrusFsConfig) is_wait_finality(ctx context.Context) bool {
+	if wait, ok := ctx.Value(waitFinalityKey{}).(bool); ok {
+		return wait
+	}
+	return config.waitFinality
+}
+
+// wait_finality polls the transaction digest until it is included in a checkpoint, which makes it final, and
+// returns it as the chain recorded it. Lookups that fail are polled again, the node may not have indexed the
+// transaction yet
+func wait_finality(ctx context.Context, config *WalrusFsConfig, op string, digest string) (*models.SuiTransactionBlockResponse, error) {
+	cli := config.getSuiClient()
+	deadline := time.Now().Add(FinalityTimeout)
+	delay := finalityBasePoll
+	for {
+		rsp, err := cli.SuiGetTransactionBlock(ctx, models.SuiGetTransactionBlockRequest{
+			Digest:  digest,
+			Options: models.SuiTransactionBlockOptions{ShowEffects: true},
+		})
+		if err == nil && rsp.Checkpoint != "" {
+			logger.Debug("transaction final", "op", op, "digest", digest, "checkpoint", rsp.Checkpoint)
+			return &rsp, nil
+		}
+		if err != nil {
+			logger.Debug("cannot get transaction", "op", op, "digest", digest, "err", err)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return nil, fmt.Errorf("%s transaction %s was executed but not checkpointed within %s, check it on chain before retrying", op, digest, FinalityTimeout)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, context.Cause(ctx)
+		case <-timer.C:
+		}
+		delay = min(delay*2, finalityMaxPoll)
+	}
+}
+
+// check_tx_status returns the error of a transaction whose effects aren't a success, with the move abort of a
+// failed one. A status that is neither success nor failure leaves the outcome unknown, which is an error as well
+func check_tx_status(op string, rsp *models.SuiTransactionBlockResponse, budget uint64) error {
+	switch rsp.Effects.Status.Status {
+	case "success":
+		return nil
+	case "failure":
+		return tx_status_error(op, rsp.Digest, rsp.Effects.Status.Error, budget)
+	}
+	return fmt.Errorf("%s transaction %s has unknown status %q, check it on chain before retrying", op, rsp.Digest, rsp.Effects.Status.Status)
+}
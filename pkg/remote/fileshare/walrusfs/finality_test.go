@@ -0,0 +1,68 @@
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/block-vision/sui-go-sdk/models"
+)
+
+func TestWaitFinality(t *testing.T) {
+	defer func(delay time.Duration) { finalityBasePoll = delay }(finalityBasePoll)
+	finalityBasePoll = time.Millisecond
+
+	success := models.ExecutionStatus{Status: "success"}
+	c, chain := newFakeChainClient("test-wait-finality")
+	chain.checkpointAfter = 2
+	chain.finalStatus = success
+	ctx := WithWaitFinality(context.Background(), true)
+	if _, err := c.MkdirWithResult(ctx, walrusConn("/a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if chain.txLookups != 3 {
+		t.Errorf("got %d lookups, want 3 until the transaction was checkpointed", chain.txLookups)
+	}
+
+	// without waiting the transaction isn't looked up
+	c, chain = newFakeChainClient("test-wait-finality-off")
+	if _, err := c.MkdirWithResult(context.Background(), walrusConn("/a"), nil); err != nil || chain.txLookups != 0 {
+		t.Errorf("got %d lookups, %v without waiting for finality", chain.txLookups, err)
+	}
+
+	// a transaction recorded as failed is an error, with its move abort
+	c, chain = newFakeChainClient("test-wait-finality-failed")
+	chain.finalStatus = models.ExecutionStatus{Status: "failure", Error: "MoveAbort(MoveLocation { module: walrusfs }, 4) in command 0"}
+	if _, err := c.MkdirWithResult(ctx, walrusConn("/a"), nil); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("got %v, want the move abort of the final transaction", err)
+	}
+
+	// a transaction that never gets checkpointed stops waiting with the context
+	c, chain = newFakeChainClient("test-wait-finality-timeout")
+	chain.checkpointAfter = 1 << 30
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.MkdirWithResult(timeout, walrusConn("/a"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context deadline", err)
+	}
+}
+
+func TestCheckTxStatus(t *testing.T) {
+	t.Parallel()
+
+	rsp := &models.SuiTransactionBlockResponse{Digest: "digest1"}
+	rsp.Effects.Status.Status = "success"
+	if err := check_tx_status("add_dir", rsp, 0); err != nil {
+		t.Errorf("success: %v", err)
+	}
+	rsp.Effects.Status = models.ExecutionStatus{Status: "failure", Error: "MoveAbort(MoveLocation { module: walrusfs }, 1) in command 0"}
+	if err := check_tx_status("add_dir", rsp, 0); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "MoveAbort") {
+		t.Errorf("failure: got %v, want the move abort", err)
+	}
+	rsp.Effects.Status = models.ExecutionStatus{}
+	if err := check_tx_status("add_dir", rsp, 0); err == nil || !strings.Contains(err.Error(), "unknown status") {
+		t.Errorf("missing status: got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/mystenbcs"
+	"github.com/block-vision/sui-go-sdk/sui"
+)
+
+const (
+	// used for dev inspect, to build transactions that are dry run, and when a dry run fails
+	DefaultGasBudget uint64 = 100_000_000
+	// estimated budgets never go below this, a dry run under-reports storage for some first writes
+	MinGasBudget uint64 = 2_000_000
+	// percentage added on top of the dry run gas cost
+	GasEstimateMarginPercent = 20
+)
+
+type gasBudgetKey struct{}
+
+// WithGasBudget returns a context whose walrus move calls use budget, in MIST, instead of the configured
+// gas budget. A zero budget estimates it with a dry run
+func WithGasBudget(ctx context.Context, budget uint64) context.Context {
+	return context.WithValue(ctx, gasBudgetKey{}, budget)
+}
+
+// gas_budget returns the budget for a move call made with ctx, zero means it should be estimated
+func (config *WalrusFsConfig) gas_budget(ctx context.Context) uint64 {
+	if budget, ok := ctx.Value(gasBudgetKey{}).(uint64); ok {
+		return budget
+	}
+	return config.gasBudget
+}
+
+type gasPriceKey struct{}
+
+// WithGasPrice returns a context whose walrus transactions pay price, in MIST per unit of gas, instead of the
+// configured gas price. A zero price pays the reference gas price the node builds transactions with
+func WithGasPrice(ctx context.Context, price uint64) context.Context {
+	return context.WithValue(ctx, gasPriceKey{}, price)
+}
+
+// gas_price returns the gas price for a transaction made with ctx, zero means the reference gas price
+func (config *WalrusFsConfig) gas_price(ctx context.Context) uint64 {
+	if price, ok := ctx.Value(gasPriceKey{}).(uint64); ok {
+		return price
+	}
+	return config.gasPrice
+}
+
+// set_gas_price returns the base64 bcs transaction data txBytes, built with budget, paying price per unit of gas.
+// The node builds transactions at the reference gas price and a lower price would be rejected, so the price is
+// only ever raised. An estimated budget is raised with it since the cost of the gas used grows with its price.
+// The gas data ends the transaction data, followed only by the expiration, which is how the price is found
+func set_gas_price(txBytes string, budget uint64, price uint64, estimated bool) (string, uint64, error) {
+	b, err := mystenbcs.FromBase64(txBytes)
+	if err != nil {
+		return txBytes, budget, fmt.Errorf("cannot decode transaction to set its gas price: %w", err)
+	}
+	// the expiration is a single byte for none, or followed by a u64 epoch
+	var end int
+	for _, expirationSize := range []int{1, 9} {
+		if n := len(b) - expirationSize; n >= 16 && binary.LittleEndian.Uint64(b[n-8:n]) == budget {
+			end = n
+			break
+		}
+	}
+	if end == 0 {
+		return txBytes, budget, fmt.Errorf("cannot find the gas data of the transaction to set its gas price")
+	}
+	current := binary.LittleEndian.Uint64(b[end-16 : end-8])
+	if price <= current {
+		return txBytes, budget, nil
+	}
+	if estimated && current > 0 {
+		budget = (budget*price + current - 1) / current
+	}
+	binary.LittleEndian.PutUint64(b[end-16:end-8], price)
+	binary.LittleEndian.PutUint64(b[end-8:end], budget)
+	return mystenbcs.ToBase64(b), budget, nil
+}
+
+// gas_used returns the MIST a transaction cost, its computation and storage costs less the storage rebate. It is
+// negative when the transaction freed more storage than it used, deleting files for instance
+func gas_used(cost models.GasCostSummary) (int64, error) {
+	var total int64
+	for _, c := range []struct {
+		name  string
+		value string
+		sign  int64
+	}{{"computation cost", cost.ComputationCost, 1}, {"storage cost", cost.StorageCost, 1}, {"storage rebate", cost.StorageRebate, -1}} {
+		v, err := strconv.ParseInt(c.value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q: %w", c.name, c.value, err)
+		}
+		total += c.sign * v
+	}
+	return total, nil
+}
+
+// build_move_call builds call with the given budget, estimating it first when it is zero
+func build_move_call(ctx context.Context, cli sui.ISuiAPI, config *WalrusFsConfig, signerAccount Signer, call moveCall, budget uint64) (models.TxnMetaData, uint64, error) {
+	var txn models.TxnMetaData
+	pkg, module := call.target(config)
+	_, budget, err := build_with_budget(ctx, cli, call.function, budget, func(budget uint64) (string, error) {
+		var err error
+		txn, err = cli.MoveCall(ctx, models.MoveCallRequest{
+			Signer:          signerAccount.Address(),
+			PackageObjectId: pkg,
+			Module:          module,
+			Function:        call.function,
+			TypeArguments:   call.type_arguments(),
+			Arguments:       call.arguments,
+			GasBudget:       strconv.FormatUint(budget, 10),
+		})
+		return txn.TxBytes, err
+	})
+	return txn, budget, err
+}
+
+// build_batch_call builds a single transaction making all of calls in order, with the budget estimated like
+// build_move_call when it is zero
+func build_batch_call(ctx context.Context, cli sui.ISuiAPI, config *WalrusFsConfig, signerAccount Signer, op string, calls []moveCall, budget uint64) (string, uint64, error) {
+	params := make([]models.RPCTransactionRequestParams, 0, len(calls))
+	for _, call := range calls {
+		pkg, module := call.target(config)
+		params = append(params, models.RPCTransactionRequestParams{MoveCallRequestParams: &models.MoveCallRequest{
+			PackageObjectId: pkg,
+			Module:          module,
+			Function:        call.function,
+			TypeArguments:   call.type_arguments(),
+			Arguments:       call.arguments,
+		}})
+	}
+	return build_with_budget(ctx, cli, op, budget, func(budget uint64) (string, error) {
+		txn, err := cli.BatchTransaction(ctx, models.BatchTransactionRequest{
+			Signer:                         signerAccount.Address(),
+			RPCTransactionRequestParams:    params,
+			GasBudget:                      strconv.FormatUint(budget, 10),
+			SuiTransactionBlockBuilderMode: "Commit",
+		})
+		return txn.TxBytes, err
+	})
+}
+
+// build_with_budget calls build for the transaction bytes with the given budget. A zero budget is estimated by
+// building with DefaultGasBudget and dry running that, then building again with the estimate
+func build_with_budget(ctx context.Context, cli sui.ISuiAPI, op string, budget uint64, build func(budget uint64) (string, error)) (string, uint64, error) {
+	if budget > 0 {
+		txBytes, err := build(budget)
+		return txBytes, budget, err
+	}
+
+	txBytes, err := build(DefaultGasBudget)
+	if err != nil {
+		return txBytes, DefaultGasBudget, err
+	}
+	dryRun, err := cli.SuiDryRunTransactionBlock(ctx, models.SuiDryRunTransactionBlockRequest{TxBytes: txBytes})
+	if err != nil {
+		logger.Warn("cannot estimate gas, using the default budget", "op", op, "err", err)
+		return txBytes, DefaultGasBudget, nil
+	}
+	if dryRun.Effects.Status.Status == "failure" {
+		// the transaction would fail anyway, don't spend gas finding out
+		return txBytes, 0, tx_status_error(op, "dry run", dryRun.Effects.Status.Error, DefaultGasBudget)
+	}
+	budget, err = gas_budget_from_cost(dryRun.Effects.GasUsed)
+	if err != nil {
+		logger.Warn("cannot estimate gas, using the default budget", "op", op, "err", err)
+		return txBytes, DefaultGasBudget, nil
+	}
+	txBytes, err = build(budget)
+	return txBytes, budget, err
+}
+
+// gas_budget_from_cost sizes a budget from the gas used by a dry run, the storage rebate is not subtracted
+// since the budget has to cover the cost before the rebate is paid back
+func gas_budget_from_cost(cost models.GasCostSummary) (uint64, error) {
+	computation, err := strconv.ParseUint(cost.ComputationCost, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid computation cost %q: %w", cost.ComputationCost, err)
+	}
+	storage, err := strconv.ParseUint(cost.StorageCost, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid storage cost %q: %w", cost.StorageCost, err)
+	}
+	budget := (computation + storage) * (100 + GasEstimateMarginPercent) / 100
+	return max(budget, MinGasBudget), nil
+}
+
+// is_insufficient_gas reports whether a transaction status error means it ran out of gas
+func is_insufficient_gas(statusError string) bool {
+	return strings.Contains(statusError, "InsufficientGas")
+}
+
+// tx_status_error describes a failed transaction, pointing at the gas budget settings when it ran out of gas
+func tx_status_error(function string, digest string, statusError string, budget uint64) error {
+	if is_insufficient_gas(statusError) {
+		return typed_error(ErrInsufficientGas, "%s transaction %s ran out of gas with a budget of %d MIST, raise walrusfs:gasbudget or leave it unset to estimate the budget: %s", function, digest, budget, statusError)
+	}
+	if kind := move_abort_kind(statusError); kind != nil {
+		return typed_error(kind, "%s transaction %s failed: %s", function, digest, statusError)
+	}
+	return fmt.Errorf("%s transaction %s failed: %s", function, digest, statusError)
+}
@@ -0,0 +1,127 @@
+package walrusfs
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/mystenbcs"
+	"github.com/block-vision/sui-go-sdk/transaction"
+)
+
+func TestGasBudgetFromCost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cost    models.GasCostSummary
+		want    uint64
+		wantErr bool
+	}{
+		{"margin added", models.GasCostSummary{ComputationCost: "5000000", StorageCost: "5000000", StorageRebate: "9000000"}, 12_000_000, false},
+		{"minimum", models.GasCostSummary{ComputationCost: "1000", StorageCost: "2000"}, MinGasBudget, false},
+		{"invalid computation", models.GasCostSummary{ComputationCost: "", StorageCost: "2000"}, 0, true},
+		{"invalid storage", models.GasCostSummary{ComputationCost: "1000", StorageCost: "-1"}, 0, true},
+	}
+	for _, tc := range tests {
+		got, err := gas_budget_from_cost(tc.cost)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: got budget %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGasBudgetOverride(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{gasBudget: 50_000_000}
+	ctx := context.Background()
+	if got := config.gas_budget(ctx); got != 50_000_000 {
+		t.Errorf("got budget %d, want the configured budget", got)
+	}
+	if got := config.gas_budget(WithGasBudget(ctx, 7_000_000)); got != 7_000_000 {
+		t.Errorf("got budget %d, want the per operation budget", got)
+	}
+	if got := config.gas_budget(WithGasBudget(ctx, 0)); got != 0 {
+		t.Errorf("got budget %d, want zero to estimate it", got)
+	}
+}
+
+func TestSetGasPrice(t *testing.T) {
+	t.Parallel()
+
+	build := func(price uint64, budget uint64, epoch *uint64) string {
+		tx := transaction.NewTransaction()
+		tx.SetSender("0x1")
+		tx.SetGasOwner("0x1")
+		tx.SetGasPayment([]transaction.SuiObjectRef{})
+		tx.SetGasPrice(price)
+		tx.SetGasBudget(budget)
+		b, err := tx.Data.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if epoch != nil {
+			// an epoch expiration replaces the trailing none
+			b = binary.LittleEndian.AppendUint64(append(b[:len(b)-1], 1), *epoch)
+		}
+		return mystenbcs.ToBase64(b)
+	}
+	epoch := uint64(512)
+	for _, exp := range []*uint64{nil, &epoch} {
+		got, budget, err := set_gas_price(build(750, 4_000_000, exp), 4_000_000, 1000, false)
+		if err != nil || got != build(1000, 4_000_000, exp) || budget != 4_000_000 {
+			t.Errorf("expiration %v: got budget %d, %v", exp, budget, err)
+		}
+		// an estimated budget grows with the price
+		got, budget, err = set_gas_price(build(750, 3_000_000, exp), 3_000_000, 1000, true)
+		if err != nil || got != build(1000, 4_000_000, exp) || budget != 4_000_000 {
+			t.Errorf("expiration %v: got estimated budget %d, %v", exp, budget, err)
+		}
+		// a price under the reference price is left alone
+		txBytes := build(750, 4_000_000, exp)
+		if got, budget, err := set_gas_price(txBytes, 4_000_000, 500, true); err != nil || got != txBytes || budget != 4_000_000 {
+			t.Errorf("expiration %v: a lower price changed the transaction, %v", exp, err)
+		}
+	}
+	if _, _, err := set_gas_price(build(750, 4_000_000, nil), 5_000_000, 1000, false); err == nil {
+		t.Errorf("expected an error when the budget isn't in the gas data")
+	}
+
+	config := &WalrusFsConfig{gasPrice: 900}
+	if got := config.gas_price(WithGasPrice(context.Background(), 2000)); got != 2000 || config.gas_price(context.Background()) != 900 {
+		t.Errorf("got price %d, want the per operation price", got)
+	}
+}
+
+func TestGasUsed(t *testing.T) {
+	t.Parallel()
+
+	if got, err := gas_used(models.GasCostSummary{ComputationCost: "1000", StorageCost: "5000", StorageRebate: "2000"}); err != nil || got != 4000 {
+		t.Errorf("got %d, %v, want 4000", got, err)
+	}
+	if got, err := gas_used(models.GasCostSummary{ComputationCost: "1000", StorageCost: "0", StorageRebate: "9000"}); err != nil || got != -8000 {
+		t.Errorf("got %d, %v for a rebate, want -8000", got, err)
+	}
+	if _, err := gas_used(models.GasCostSummary{ComputationCost: "1000"}); err == nil {
+		t.Errorf("expected an error for a missing storage cost")
+	}
+}
+
+func TestGasError(t *testing.T) {
+	t.Parallel()
+
+	err := tx_status_error("add_file", "digest1", "InsufficientGas", 2_000_000)
+	if !strings.Contains(err.Error(), "ran out of gas with a budget of 2000000 MIST") || !strings.Contains(err.Error(), "walrusfs:gasbudget") {
+		t.Errorf("unexpected insufficient gas error: %v", err)
+	}
+	err = tx_status_error("add_file", "digest1", "MoveAbort in 1st command, abort code: 3", 2_000_000)
+	if err.Error() != "add_file transaction digest1 failed: MoveAbort in 1st command, abort code: 3" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
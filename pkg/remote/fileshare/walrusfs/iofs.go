@@ -0,0 +1,300 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
+)
+
+// WalrusFS serves a walrus tree through io/fs, so fs.WalkDir, fs.Glob, template.ParseFS and the like can read it.
+// Names are unrooted slash separated walrus paths, "." is the walrus root. Files are streamed from the aggregator
+// as they are read and verified against their content sha256 at the end
+type WalrusFS struct {
+	ctx    context.Context
+	client *WalrusClient
+}
+
+var (
+	_ fs.FS          = (*WalrusFS)(nil)
+	_ fs.ReadDirFS   = (*WalrusFS)(nil)
+	_ fs.StatFS      = (*WalrusFS)(nil)
+	_ fs.ReadDirFile = (*walrusDir)(nil)
+)
+
+// NewWalrusFS returns an fs.FS for the walrus tree of client, chain and aggregator requests are made with ctx
+func NewWalrusFS(ctx context.Context, client *WalrusClient) *WalrusFS {
+	return &WalrusFS{ctx: ctx, client: client}
+}
+
+func (fsys *WalrusFS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &walrusDir{fsys: fsys, name: name, info: info}, nil
+	}
+	return &walrusFile{fsys: fsys, name: name, info: info}, nil
+}
+
+func (fsys *WalrusFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := fsys.stat("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name
+func (fsys *WalrusFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries := make(map[string]fs.DirEntry)
+	err := fsys.client.listFilesPrefix(fsys.ctx, walrus_path(name), func(item *ListDirFileItem) (bool, error) {
+		entryName := strings.Trim(item.Name, fspath.Separator)
+		if entryName == "" {
+			return true, nil
+		}
+		// a directory can be listed more than once, a file takes the place of a directory of the same name
+		if prev, ok := entries[entryName]; ok && !prev.IsDir() {
+			return true, nil
+		}
+		entries[entryName] = fs.FileInfoToDirEntry(&walrusFileInfo{name: entryName, item: *item})
+		return true, nil
+	})
+	if err != nil {
+		// listing a path that isn't a directory aborts, tell the usual cases apart
+		if _, statErr := fsys.stat("readdir", name); statErr != nil {
+			return nil, statErr
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	rtn := make([]fs.DirEntry, 0, len(entries))
+	for _, entryName := range slices.Sorted(maps.Keys(entries)) {
+		rtn = append(rtn, entries[entryName])
+	}
+	return rtn, nil
+}
+
+// stat returns the info of a file or directory, errors are fs.PathErrors for op
+func (fsys *WalrusFS) stat(op string, name string) (*walrusFileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &walrusFileInfo{name: ".", item: ListDirFileItem{IsDir: true}}, nil
+	}
+	item, err := stat(fsys.ctx, fsys.client.config, walrus_path(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if item == nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return &walrusFileInfo{name: fspath.Base(name), item: *item}, nil
+}
+
+// walrus_path returns the walrus path of an io/fs name
+func walrus_path(name string) string {
+	if name == "." {
+		return fspath.Separator
+	}
+	return fspath.Separator + name
+}
+
+// walrusFileInfo is the fs.FileInfo of a walrus file or directory, Sys returns its *ListDirFileItem
+type walrusFileInfo struct {
+	name string
+	item ListDirFileItem
+}
+
+func (fi *walrusFileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *walrusFileInfo) Size() int64 {
+	return fi.item.Size
+}
+
+func (fi *walrusFileInfo) Mode() fs.FileMode {
+	if fi.item.IsDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi *walrusFileInfo) ModTime() time.Time {
+	return time.UnixMilli(fi.item.CreateTs)
+}
+
+func (fi *walrusFileInfo) IsDir() bool {
+	return fi.item.IsDir
+}
+
+func (fi *walrusFileInfo) Sys() any {
+	item := fi.item
+	return &item
+}
+
+// walrusFile streams the content of a walrus file, the download starts with the first Read
+type walrusFile struct {
+	fsys   *WalrusFS
+	name   string
+	info   *walrusFileInfo
+	reader *blobReader
+	closed bool
+}
+
+func (f *walrusFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *walrusFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.reader == nil {
+		item := f.info.item
+		f.reader = new_blob_reader(f.fsys.ctx, f.fsys.client.config, item.ContentSha256, item_coding(&item), file_blob_ids(item.WalrusBlobId, item.WalrusBlobIds))
+	}
+	n, err := f.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &fs.PathError{Op: "read", Path: f.name, Err: err}
+	}
+	return n, err
+}
+
+func (f *walrusFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.reader != nil {
+		return f.reader.Close()
+	}
+	return nil
+}
+
+// walrusDir is an open walrus directory, its entries are listed with the first ReadDir
+type walrusDir struct {
+	fsys    *WalrusFS
+	name    string
+	info    *walrusFileInfo
+	entries []fs.DirEntry
+	listed  bool
+	offset  int
+}
+
+func (d *walrusDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *walrusDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *walrusDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries, or all remaining ones when n <= 0, as fs.ReadDirFile describes
+func (d *walrusDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.listed = entries, true
+	}
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	rest = rest[:min(n, len(rest))]
+	d.offset += len(rest)
+	return rest, nil
+}
+
+// blobReader reads the blobs of a file one after the other as a single stream, checking the content sha256 at the end
+type blobReader struct {
+	ctx           context.Context
+	config        *WalrusFsConfig
+	blobIds       []string
+	blobId        string
+	contentSha256 string
+	coding        blobCoding
+	current       io.ReadCloser
+	hash          hash.Hash
+	err           error
+}
+
+func new_blob_reader(ctx context.Context, config *WalrusFsConfig, contentSha256 string, coding blobCoding, blobIds []string) *blobReader {
+	return &blobReader{ctx: ctx, config: config, blobIds: blobIds, blobId: strings.Join(blobIds, ","), contentSha256: contentSha256, coding: coding, hash: sha256.New()}
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if r.current == nil {
+			if len(r.blobIds) == 0 {
+				r.err = r.verify()
+				break
+			}
+			r.current, r.err = open_file_blob(r.ctx, r.config, r.blobIds[0], r.coding)
+			if r.err != nil {
+				break
+			}
+			r.blobIds = r.blobIds[1:]
+		}
+		n, err := r.current.Read(p)
+		r.hash.Write(p[:n])
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			err = nil
+		} else if err != nil {
+			r.err = blob_unavailable(err)
+		}
+		if n > 0 || len(p) == 0 {
+			return n, err
+		}
+	}
+	return 0, r.err
+}
+
+// verify returns io.EOF when the content matches its sha256, or when there is none to check
+func (r *blobReader) verify() error {
+	if r.contentSha256 == "" {
+		return io.EOF
+	}
+	if err := verify_sum(r.hash.Sum(nil), r.contentSha256); err != nil {
+		return fmt.Errorf("walrus blob %s: %w", r.blobId, err)
+	}
+	return io.EOF
+}
+
+func (r *blobReader) Close() error {
+	if r.current != nil {
+		err := r.current.Close()
+		r.current = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWalrusFS(t *testing.T) {
+	t.Parallel()
+
+	blobs := map[string]string{"blob-a": "hello walrus", "blob-b1": "first half ", "blob-b2": "second half", "blob-bad": "tampered"}
+	var blobsLock sync.Mutex
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blobsLock.Lock()
+		content, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v1/blobs/")]
+		blobsLock.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, content)
+	}))
+	defer aggregator.Close()
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+
+	// serve the tree from the listing cache so no chain access is needed
+	config := &WalrusFsConfig{root: "test-walrus-fs", cacheTTL: time.Hour, aggregatorUrl: aggregator.URL, httpTimeout: 5 * time.Second}
+	expires := time.Now().Add(time.Hour)
+	a := ListDirFileItem{Name: "a.txt", CreateTs: 1700000000000, Size: 12, WalrusBlobId: "blob-a", ContentSha256: sum("hello walrus")}
+	b := ListDirFileItem{Name: "b.txt", CreateTs: 1700000001000, Size: 22, WalrusBlobId: "blob-b1", WalrusBlobIds: []string{"blob-b1", "blob-b2"}, ContentSha256: sum("first half second half")}
+	bad := ListDirFileItem{Name: "bad.txt", CreateTs: 1700000002000, Size: 8, WalrusBlobId: "blob-bad", ContentSha256: sum("original")}
+	dir := ListDirFileItem{Name: "dir", CreateTs: 1700000003000, IsDir: true}
+	listings.putList(config.root, "/", []ListDirFileItem{a, dir}, expires)
+	listings.putList(config.root, "/dir", []ListDirFileItem{b, bad}, expires)
+	listings.putStat(config.root, "/a.txt", &a, expires)
+	listings.putStat(config.root, "/dir", &dir, expires)
+	listings.putStat(config.root, "/dir/b.txt", &b, expires)
+	listings.putStat(config.root, "/dir/bad.txt", &bad, expires)
+	listings.putStat(config.root, "/missing.txt", nil, expires)
+
+	fsys := NewWalrusFS(context.Background(), &WalrusClient{config: config})
+	content, err := fs.ReadFile(fsys, "dir/b.txt")
+	if err != nil || string(content) != "first half second half" {
+		t.Fatalf("got %q, %v for the chunked file", content, err)
+	}
+	if _, err := fs.ReadFile(fsys, "dir/bad.txt"); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("got error %v for content that doesn't match its sha256", err)
+	}
+	if _, err := fs.Stat(fsys, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v for a missing file", err)
+	}
+	if _, err := fsys.Open("/a.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("got error %v for a rooted name", err)
+	}
+	matches, err := fs.Glob(fsys, "dir/*.txt")
+	if err != nil || strings.Join(matches, ",") != "dir/b.txt,dir/bad.txt" {
+		t.Errorf("glob got %v, %v", matches, err)
+	}
+
+	// the tampered file fails to read, so check the consistent part of the tree
+	blobsLock.Lock()
+	blobs["blob-bad"] = "original"
+	blobsLock.Unlock()
+	if err := fstest.TestFS(fsys, "a.txt", "dir", "dir/b.txt", "dir/bad.txt"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// listOrder is the order ListEntriesStream sends entries in, from the sort options of wshrpc.FileListOpts
+type listOrder struct {
+	sortBy    string
+	desc      bool
+	dirsFirst bool
+}
+
+// list_order returns the order opts asks for, by name when opts is nil
+func list_order(opts *wshrpc.FileListOpts) (listOrder, error) {
+	order := listOrder{sortBy: wshrpc.FileSortName}
+	if opts == nil {
+		return order, nil
+	}
+	switch opts.SortBy {
+	case "", wshrpc.FileSortName:
+	case wshrpc.FileSortSize, wshrpc.FileSortModTime:
+		order.sortBy = opts.SortBy
+	default:
+		return order, fmt.Errorf("unknown sort order %q, expected %s, %s or %s", opts.SortBy, wshrpc.FileSortName, wshrpc.FileSortSize, wshrpc.FileSortModTime)
+	}
+	order.desc = opts.SortDesc
+	order.dirsFirst = opts.DirsFirst
+	return order, nil
+}
+
+// is_default returns whether entries are ordered by path alone, the order whose cursor is a plain path
+func (o listOrder) is_default() bool {
+	return o.sortBy == wshrpc.FileSortName && !o.desc && !o.dirsFirst
+}
+
+// compare orders the entry a at relPath aPath against b at bPath
+func (o listOrder) compare(aPath string, a *ListDirFileItem, bPath string, b *ListDirFileItem) int {
+	if o.dirsFirst && a.IsDir != b.IsDir {
+		if a.IsDir {
+			return -1
+		}
+		return 1
+	}
+	var c int
+	switch o.sortBy {
+	case wshrpc.FileSortSize:
+		c = cmp.Compare(a.Size, b.Size)
+	case wshrpc.FileSortModTime:
+		c = cmp.Compare(a.CreateTs, b.CreateTs)
+	}
+	if c == 0 {
+		c = strings.Compare(aPath, bPath)
+	}
+	if o.desc {
+		return -c
+	}
+	return c
+}
+
+// cursor returns the cursor of a page ending with the entry at relPath. It is relPath itself in the default order,
+// otherwise it carries what the entry is sorted by so the next page starts after it even once it is gone
+func (o listOrder) cursor(relPath string, item *ListDirFileItem) string {
+	if o.is_default() {
+		return relPath
+	}
+	kind := "f"
+	if item.IsDir {
+		kind = "d"
+	}
+	return fmt.Sprintf("%s:%d:%d:%s", kind, item.Size, item.CreateTs, relPath)
+}
+
+// parse_cursor returns the path and the sort keys of the entry a cursor points after
+func (o listOrder) parse_cursor(cursor string) (string, *ListDirFileItem, error) {
+	if o.is_default() {
+		return cursor, &ListDirFileItem{}, nil
+	}
+	parts := strings.SplitN(cursor, ":", 4)
+	if len(parts) != 4 || (parts[0] != "d" && parts[0] != "f") {
+		return "", nil, fmt.Errorf("invalid listing cursor %q for this sort order", cursor)
+	}
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid listing cursor %q for this sort order", cursor)
+	}
+	createTs, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid listing cursor %q for this sort order", cursor)
+	}
+	return parts[3], &ListDirFileItem{IsDir: parts[0] == "d", Size: size, CreateTs: createTs}, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"log"
+	"log/slog"
+)
+
+const DefaultLogLevel = slog.LevelInfo
+
+// logLevel is set from walrusfs:loglevel whenever the config is read
+var logLevel = func() *slog.LevelVar {
+	var level slog.LevelVar
+	level.Set(DefaultLogLevel)
+	return &level
+}()
+
+// logger writes leveled key=value records through the standard logger, so they land in the wave log with its
+// timestamps. Returned errors are logged at debug, errors walrusfs recovers from at warn
+var logger = slog.New(slog.NewTextHandler(stdLogWriter{}, &slog.HandlerOptions{
+	Level: logLevel,
+	ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) == 0 && a.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		return a
+	},
+})).With("component", "walrusfs")
+
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	log.Print(string(p))
+	return len(p), nil
+}
+
+// set_log_level sets the walrusfs log level from a name: debug, info, warn or error. Empty selects the default
+func set_log_level(name string) {
+	if name == "" {
+		logLevel.Set(DefaultLogLevel)
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		logger.Warn("unknown walrusfs:loglevel, expected debug, info, warn or error", "level", name)
+		logLevel.Set(DefaultLogLevel)
+		return
+	}
+	logLevel.Set(level)
+}
@@ -0,0 +1,37 @@
+package walrusfs
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestSetLogLevel(t *testing.T) {
+	defer set_log_level("")
+
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		wantDebug bool
+		wantInfo  bool
+		wantWarn  bool
+	}{
+		{"", false, true, true},
+		{"debug", true, true, true},
+		{"WARN", false, false, true},
+		{"error", false, false, false},
+		{"verbose", false, true, true},
+	}
+	for _, tc := range tests {
+		set_log_level(tc.name)
+		if got := logger.Enabled(ctx, slog.LevelDebug); got != tc.wantDebug {
+			t.Errorf("level %q: debug enabled %v, want %v", tc.name, got, tc.wantDebug)
+		}
+		if got := logger.Enabled(ctx, slog.LevelInfo); got != tc.wantInfo {
+			t.Errorf("level %q: info enabled %v, want %v", tc.name, got, tc.wantInfo)
+		}
+		if got := logger.Enabled(ctx, slog.LevelWarn); got != tc.wantWarn {
+			t.Errorf("level %q: warn enabled %v, want %v", tc.name, got, tc.wantWarn)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the operations reported to Metrics
+const (
+	OpStat        = "stat"
+	OpListEntries = "list_entries"
+	OpRead        = "read"
+	OpPutFile     = "put_file"
+	OpDelete      = "delete"
+	// a blob upload to a publisher, each attempt is reported
+	OpPublish = "publish"
+	// a blob download from an aggregator, reported once the body is closed
+	OpAggregatorGet = "aggregator_get"
+)
+
+// Metrics receives a record of every walrusfs operation as it finishes, for dashboards. It is called from many
+// goroutines at once and should return quickly
+type Metrics interface {
+	// RecordOp reports an operation that took duration and moved bytes of file content, err is what it failed with
+	RecordOp(op string, duration time.Duration, bytes int64, err error)
+}
+
+var customMetricsLock sync.Mutex
+var customMetrics Metrics
+
+// SetMetrics makes configs created afterwards report their operations to m, nil stops reporting
+func SetMetrics(m Metrics) {
+	customMetricsLock.Lock()
+	defer customMetricsLock.Unlock()
+	customMetrics = m
+}
+
+func getCustomMetrics() Metrics {
+	customMetricsLock.Lock()
+	defer customMetricsLock.Unlock()
+	return customMetrics
+}
+
+// record_op reports op, started at start, to the metrics of config if it has any
+func (config *WalrusFsConfig) record_op(op string, start time.Time, bytes int64, err error) {
+	if config.metrics == nil {
+		return
+	}
+	config.metrics.RecordOp(op, time.Since(start), bytes, err)
+}
+
+// record_stream passes the responses of ch through and reports op when it closes, with the first error sent and
+// the bytes that size counts in the responses. ch is returned as it is when there are no metrics
+func record_stream[T any](config *WalrusFsConfig, op string, ch <-chan wshrpc.RespOrErrorUnion[T], size func(T) int64) <-chan wshrpc.RespOrErrorUnion[T] {
+	if config.metrics == nil {
+		return ch
+	}
+	start := time.Now()
+	rtn := make(chan wshrpc.RespOrErrorUnion[T], cap(ch))
+	go func() {
+		defer close(rtn)
+		var bytes int64
+		var err error
+		for resp := range ch {
+			if resp.Error != nil && err == nil {
+				err = resp.Error
+			}
+			if size != nil {
+				bytes += size(resp.Response)
+			}
+			rtn <- resp
+		}
+		config.record_op(op, start, bytes, err)
+	}()
+	return rtn
+}
+
+// base64_size returns the number of bytes data64 decodes to
+func base64_size(data64 string) int64 {
+	return int64(len(data64)/4*3 - (len(data64) - len(strings.TrimRight(data64, "="))))
+}
+
+// meteredBody reports a blob download from the aggregator when it is closed
+type meteredBody struct {
+	io.ReadCloser
+	config *WalrusFsConfig
+	start  time.Time
+	bytes  int64
+	err    error
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *meteredBody) Close() error {
+	b.config.record_op(OpAggregatorGet, b.start, b.bytes, b.err)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,98 @@
+package walrusfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type metricsRecord struct {
+	op    string
+	bytes int64
+	err   error
+}
+
+type fakeMetrics struct {
+	lock    sync.Mutex
+	records []metricsRecord
+}
+
+func (m *fakeMetrics) RecordOp(op string, duration time.Duration, bytes int64, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.records = append(m.records, metricsRecord{op: op, bytes: bytes, err: err})
+}
+
+func (m *fakeMetrics) take() []metricsRecord {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rtn := m.records
+	m.records = nil
+	return rtn
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newFakeChainClient("test-metrics", "delete_file")
+	metrics := &fakeMetrics{}
+	c.config.metrics = metrics
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt", Size: 5, WalrusBlobId: "blobA"}, expires)
+
+	check := func(what string, op string, bytes int64, failed bool) {
+		t.Helper()
+		records := metrics.take()
+		if len(records) != 1 || records[0].op != op || records[0].bytes != bytes || (records[0].err != nil) != failed {
+			t.Errorf("%s: got records %v, want one %s of %d bytes, failed %v", what, records, op, bytes, failed)
+		}
+	}
+
+	if _, err := c.Stat(context.Background(), walrusConn("/a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	check("stat", OpStat, 0, false)
+	if err := c.Delete(context.Background(), walrusConn("/a.txt"), false); err == nil {
+		t.Fatal("delete succeeded, want the chain failure")
+	}
+	check("delete", OpDelete, 0, true)
+
+	var requests atomic.Int32
+	var body atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+	if _, _, err := put_blob(context.Background(), c.config, publisher.URL, strings.NewReader("data"), 4, 1); err != nil {
+		t.Fatal(err)
+	}
+	check("publish", OpPublish, 4, false)
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello walrus"))
+	}))
+	t.Cleanup(aggregator.Close)
+	rc, err := open_blob_from(context.Background(), c.config, aggregator.URL, "blob1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, rc)
+	if records := metrics.take(); len(records) != 0 {
+		t.Errorf("got records %v before the download was closed", records)
+	}
+	rc.Close()
+	check("aggregator get", OpAggregatorGet, 12, false)
+}
+
+func TestBase64Size(t *testing.T) {
+	t.Parallel()
+
+	for data64, want := range map[string]int64{"": 0, "YQ==": 1, "YWI=": 2, "YWJj": 3, "YWJjZA==": 4} {
+		if got := base64_size(data64); got != want {
+			t.Errorf("base64_size(%q) = %d, want %d", data64, got, want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+// walrusfs:mnemonicsource selects where the wallet mnemonic is read from:
+//
+//	config                      the walrusfs:mnemonic setting (the default)
+//	env[:NAME]                  an environment variable, WALRUSFS_MNEMONIC when no name is given
+//	file:PATH                   a file that only its owner can read
+//	keychain[:SERVICE/ACCOUNT]  the os keychain, service walrusfs and account mnemonic by default
+const (
+	MnemonicSourceConfig   = "config"
+	MnemonicSourceEnv      = "env"
+	MnemonicSourceFile     = "file"
+	MnemonicSourceKeychain = "keychain"
+
+	DefaultMnemonicEnvVar   = "WALRUSFS_MNEMONIC"
+	DefaultKeychainService  = "walrusfs"
+	DefaultKeychainAccount  = "mnemonic"
+	keychainLookupTimeout   = 30 * time.Second
+	redactedMnemonicDisplay = "[redacted]"
+)
+
+// secretString holds the mnemonic, it prints redacted so dumping a config never reveals it
+type secretString string
+
+func (s secretString) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedMnemonicDisplay
+}
+
+func (s secretString) GoString() string {
+	return s.String()
+}
+
+func (s secretString) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// String describes the config without the mnemonic, fmt doesn't use secretString's String for unexported fields
+func (config *WalrusFsConfig) String() string {
+	return fmt.Sprintf("WalrusFsConfig{pkg:%s root:%s publishers:%v aggregator:%s wallet:%s rpc:%s mnemonic:%s mnemonicsource:%s}",
+		config.pkg, config.root, config.publisherUrls, config.aggregatorUrl, config.wallet, config.rpcUrl, config.mnemonic, config.mnemonicSource)
+}
+
+func (config *WalrusFsConfig) GoString() string {
+	return config.String()
+}
+
+// load_mnemonic reads the mnemonic from the configured source. Errors never include the mnemonic itself
+func load_mnemonic(source string, configured secretString) (secretString, error) {
+	kind, arg, _ := strings.Cut(source, ":")
+	var mnemonic string
+	switch kind {
+	case "", MnemonicSourceConfig:
+		if configured == "" {
+			return "", fmt.Errorf("walrusfs:mnemonic is not set, it is needed to sign transactions")
+		}
+		mnemonic = string(configured)
+	case MnemonicSourceEnv:
+		name := arg
+		if name == "" {
+			name = DefaultMnemonicEnvVar
+		}
+		var ok bool
+		if mnemonic, ok = os.LookupEnv(name); !ok {
+			return "", fmt.Errorf("walrusfs mnemonic environment variable %s is not set", name)
+		}
+	case MnemonicSourceFile:
+		var err error
+		if mnemonic, err = read_mnemonic_file(arg); err != nil {
+			return "", err
+		}
+	case MnemonicSourceKeychain:
+		var err error
+		if mnemonic, err = read_keychain_mnemonic(arg); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown walrusfs:mnemonicsource %q, expected config, env, file or keychain", kind)
+	}
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if mnemonic == "" {
+		return "", fmt.Errorf("walrusfs mnemonic from source %q is empty", kind)
+	}
+	return secretString(mnemonic), nil
+}
+
+// read_mnemonic_file reads a mnemonic file, refusing files that other users can read or write
+func read_mnemonic_file(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("walrusfs:mnemonicsource file needs a path, e.g. file:~/.walrusfs/mnemonic")
+	}
+	path, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return "", err
+	}
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot stat walrusfs mnemonic file: %w", err)
+	}
+	if !finfo.Mode().IsRegular() {
+		return "", fmt.Errorf("walrusfs mnemonic file %s is not a regular file", path)
+	}
+	// windows has no unix permission bits, access is controlled by acls instead
+	if runtime.GOOS != "windows" && finfo.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("walrusfs mnemonic file %s has permissions %v, restrict it to its owner with chmod 600", path, finfo.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read walrusfs mnemonic file: %w", err)
+	}
+	return string(data), nil
+}
+
+// read_keychain_mnemonic looks the mnemonic up in the os keychain with the platform's command line tool
+func read_keychain_mnemonic(entry string) (string, error) {
+	service, account := DefaultKeychainService, DefaultKeychainAccount
+	if entry != "" {
+		var ok bool
+		service, account, ok = strings.Cut(entry, "/")
+		if !ok || service == "" || account == "" {
+			return "", fmt.Errorf("invalid walrusfs keychain entry %q, expected keychain:SERVICE/ACCOUNT", entry)
+		}
+	}
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		args = []string{"security", "find-generic-password", "-s", service, "-a", account, "-w"}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		args = []string{"secret-tool", "lookup", "service", service, "account", account}
+	default:
+		return "", fmt.Errorf("reading the walrusfs mnemonic from the keychain is not supported on %s", runtime.GOOS)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), keychainLookupTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// stdout may hold part of the secret, only stderr is reported
+		return "", fmt.Errorf("cannot read walrusfs mnemonic for %s/%s from the keychain with %s: %w: %s", service, account, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,74 @@
+package walrusfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestLoadMnemonic(t *testing.T) {
+	t.Setenv("WALRUSFS_TEST_MNEMONIC", testMnemonic+"\n")
+	t.Setenv(DefaultMnemonicEnvVar, testMnemonic)
+
+	dir := t.TempDir()
+	privateFile := filepath.Join(dir, "mnemonic")
+	if err := os.WriteFile(privateFile, []byte("  "+testMnemonic+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sharedFile := filepath.Join(dir, "shared")
+	if err := os.WriteFile(sharedFile, []byte(testMnemonic), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		source     string
+		configured secretString
+		wantErr    bool
+	}{
+		{"default to config", "", testMnemonic, false},
+		{"config", "config", testMnemonic, false},
+		{"empty config", "config", "", true},
+		{"default env var", "env", "", false},
+		{"named env var", "env:WALRUSFS_TEST_MNEMONIC", "", false},
+		{"missing env var", "env:WALRUSFS_TEST_MISSING", testMnemonic, true},
+		{"private file", "file:" + privateFile, "", false},
+		{"shared file", "file:" + sharedFile, "", runtime.GOOS != "windows"},
+		{"file without path", "file", "", true},
+		{"missing file", "file:" + filepath.Join(dir, "missing"), "", true},
+		{"bad keychain entry", "keychain:walrusfs", "", true},
+		{"unknown source", "vault:secret", testMnemonic, true},
+	}
+	for _, tc := range tests {
+		got, err := load_mnemonic(tc.source, tc.configured)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			} else if strings.Contains(err.Error(), "abandon") {
+				t.Errorf("%s: error reveals the mnemonic: %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		} else if string(got) != testMnemonic {
+			t.Errorf("%s: got mnemonic %q", tc.name, string(got))
+		}
+	}
+}
+
+func TestMnemonicRedacted(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{mnemonic: testMnemonic, mnemonicSource: MnemonicSourceConfig}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		if dump := fmt.Sprintf(format, config); strings.Contains(dump, "abandon") {
+			t.Errorf("%s dump of the config reveals the mnemonic: %s", format, dump)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/transaction"
+)
+
+// CallMove signs and executes a call of function in the walrusfs move package, for contract functions that have
+// no wrapper of their own. The walrusfs root object is passed as the first argument, followed by args in the json
+// form the sui rpc takes for move calls: object ids and addresses as hex strings, integers as decimal strings.
+// The transaction is retried and its gas budget set like every other walrusfs transaction, a transaction that
+// fails is returned as an error
+func (c WalrusClient) CallMove(ctx context.Context, function string, args []interface{}, typeArgs []transaction.TypeTag) (*models.SuiTransactionBlockResponse, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
+	}
+	call := moveCall{function: function, arguments: append([]interface{}{c.config.root}, args...)}
+	for i, tag := range typeArgs {
+		s, err := type_tag_string(tag)
+		if err != nil {
+			return nil, fmt.Errorf("type argument %d: %w", i, err)
+		}
+		call.typeArguments = append(call.typeArguments, s)
+	}
+	return execute_call(ctx, c.config, call)
+}
+
+// InspectMove dev inspects a call of function in the walrusfs move package without signing or paying for it. The
+// walrusfs root object is passed as the first argument, followed by args which are bcs encoded, so each has to
+// be the go type of the move parameter: string for String, uint64 for u64, models.SuiAddressBytes for address and
+// so on. The return values are in the Results of the response, a call that aborts is returned as an error
+func (c WalrusClient) InspectMove(ctx context.Context, function string, args []interface{}, typeArgs []transaction.TypeTag) (*models.SuiTransactionBlockResponse, error) {
+	rsp, err := inspect_move_call(ctx, c.config, function, args, typeArgs)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Effects.Status.Status == "failure" {
+		return &rsp, tx_status_error(function, "dev inspect", rsp.Effects.Status.Error, 0)
+	}
+	return &rsp, nil
+}
+
+// type_tag_string returns the move syntax of tag, which is how the sui rpc takes type arguments
+func type_tag_string(tag transaction.TypeTag) (string, error) {
+	switch {
+	case tag.Bool != nil:
+		return "bool", nil
+	case tag.U8 != nil:
+		return "u8", nil
+	case tag.U16 != nil:
+		return "u16", nil
+	case tag.U32 != nil:
+		return "u32", nil
+	case tag.U64 != nil:
+		return "u64", nil
+	case tag.U128 != nil:
+		return "u128", nil
+	case tag.U256 != nil:
+		return "u256", nil
+	case tag.Address != nil:
+		return "address", nil
+	case tag.Signer != nil:
+		return "signer", nil
+	case tag.Vector != nil:
+		elem, err := type_tag_string(*tag.Vector)
+		if err != nil {
+			return "", err
+		}
+		return "vector<" + elem + ">", nil
+	case tag.Struct != nil:
+		s := fmt.Sprintf("0x%s::%s::%s", hex.EncodeToString(tag.Struct.Address[:]), tag.Struct.Module, tag.Struct.Name)
+		if len(tag.Struct.TypeParams) == 0 {
+			return s, nil
+		}
+		params := make([]string, 0, len(tag.Struct.TypeParams))
+		for _, param := range tag.Struct.TypeParams {
+			if param == nil {
+				return "", fmt.Errorf("empty type parameter of %s", s)
+			}
+			p, err := type_tag_string(*param)
+			if err != nil {
+				return "", err
+			}
+			params = append(params, p)
+		}
+		return s + "<" + strings.Join(params, ", ") + ">", nil
+	}
+	return "", fmt.Errorf("empty type tag")
+}
@@ -0,0 +1,67 @@
+package walrusfs
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/transaction"
+)
+
+func TestTypeTagString(t *testing.T) {
+	t.Parallel()
+
+	set := true
+	var sui models.SuiAddressBytes
+	sui[31] = 2
+	coin := transaction.TypeTag{Struct: &transaction.StructTag{Address: sui, Module: "sui", Name: "SUI"}}
+	tests := []struct {
+		tag  transaction.TypeTag
+		want string
+	}{
+		{transaction.TypeTag{U64: &set}, "u64"},
+		{transaction.TypeTag{Address: &set}, "address"},
+		{transaction.TypeTag{Vector: &transaction.TypeTag{U8: &set}}, "vector<u8>"},
+		{coin, "0x0000000000000000000000000000000000000000000000000000000000000002::sui::SUI"},
+		{
+			transaction.TypeTag{Struct: &transaction.StructTag{Address: sui, Module: "coin", Name: "Coin", TypeParams: []*transaction.TypeTag{&coin, {Bool: &set}}}},
+			"0x0000000000000000000000000000000000000000000000000000000000000002::coin::Coin<0x0000000000000000000000000000000000000000000000000000000000000002::sui::SUI, bool>",
+		},
+	}
+	for _, tc := range tests {
+		got, err := type_tag_string(tc.tag)
+		if err != nil || got != tc.want {
+			t.Errorf("got %q, %v, want %q", got, err, tc.want)
+		}
+	}
+	if _, err := type_tag_string(transaction.TypeTag{Vector: &transaction.TypeTag{}}); err == nil {
+		t.Errorf("expected an error for an empty type tag")
+	}
+}
+
+func TestCallMove(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-call-move")
+	set := true
+	rsp, err := c.CallMove(context.Background(), "new_function", []interface{}{"/path", "42"}, []transaction.TypeTag{{U64: &set}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Digest == "" {
+		t.Errorf("got no digest")
+	}
+	call := chain.calls[0]
+	if call.Function != "new_function" || !slices.Equal(call.Arguments, []interface{}{c.config.root, "/path", "42"}) {
+		t.Errorf("got call %s%v, want new_function with the root first", call.Function, call.Arguments)
+	}
+	if !slices.Equal(call.TypeArguments, []interface{}{"u64"}) {
+		t.Errorf("got type arguments %v", call.TypeArguments)
+	}
+
+	c, _ = newFakeChainClient("test-call-move-fails", "new_function")
+	if _, err := c.CallMove(context.Background(), "new_function", nil, nil); err == nil {
+		t.Errorf("expected an error for a failed transaction")
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/block-vision/sui-go-sdk/models"
+)
+
+// components checked by Ping
+const (
+	PingComponentRpc        = "sui rpc"
+	PingComponentPackage    = "package"
+	PingComponentPublisher  = "publisher"
+	PingComponentAggregator = "aggregator"
+	PingComponentSigner     = "signer"
+)
+
+// PingError reports which part of the walrusfs configuration is unusable
+type PingError struct {
+	Component string
+	Err       error
+}
+
+func (e *PingError) Error() string {
+	return fmt.Sprintf("walrusfs %s: %v", e.Component, e.Err)
+}
+
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
+
+// packageFileFields are the fields of the contract's FileObject this client reads and writes, in order. Sui package
+// upgrades can't change a struct, so a package published before the last of them was added has to be published
+// again, along with a new root object
+var packageFileFields = []string{
+	"create_ts", "tags", "size", "walrus_blob_id", "walrus_blob_ids", "content_sha256", "walrus_epoch_till",
+	"deletable", "certified", "encrypted", "compression", "mime_type",
+}
+
+// Ping checks that the sui rpc serves the root object, that walrusfs:package and the root have the contract layout
+// this client uses, that a publisher and the aggregator respond and that the signer has a valid address. Every
+// failing component is reported as a *PingError, joined when several fail
+func (c WalrusClient) Ping(ctx context.Context) error {
+	var errs []error
+	if rootType, err := c.pingRpc(ctx); err != nil {
+		errs = append(errs, &PingError{Component: PingComponentRpc, Err: err})
+	} else if err := c.pingPackage(ctx, rootType); err != nil {
+		errs = append(errs, &PingError{Component: PingComponentPackage, Err: err})
+	}
+	// a read only client never uploads
+	if !c.config.readOnly {
+		if err := c.pingPublishers(ctx); err != nil {
+			errs = append(errs, &PingError{Component: PingComponentPublisher, Err: err})
+		}
+	}
+	if err := ping_http(ctx, c.config.getHttpClient(), c.config.aggregatorUrl); err != nil {
+		errs = append(errs, &PingError{Component: PingComponentAggregator, Err: err})
+	}
+	if err := c.pingSigner(); err != nil {
+		errs = append(errs, &PingError{Component: PingComponentSigner, Err: err})
+	}
+	return errors.Join(errs...)
+}
+
+// pingRpc returns the move type of the root object
+func (c WalrusClient) pingRpc(ctx context.Context) (string, error) {
+	if c.config.root == "" {
+		return "", fmt.Errorf("walrusfs:root is not set")
+	}
+	rsp, err := c.config.getSuiClient().SuiGetObject(ctx, models.SuiGetObjectRequest{
+		ObjectId: c.config.root,
+		Options:  models.SuiObjectDataOptions{ShowType: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	if rsp.Error != nil {
+		return "", fmt.Errorf("root object %s: %s %s", c.config.root, rsp.Error.Code, rsp.Error.Error)
+	}
+	if rsp.Data == nil {
+		return "", fmt.Errorf("root object %s not found", c.config.root)
+	}
+	return rsp.Data.Type, nil
+}
+
+// pingPackage checks the root object was created by walrusfs:package and that the package stores files with the
+// fields of packageFileFields. Either fails with ErrIncompatiblePackage for a package published before them
+func (c WalrusClient) pingPackage(ctx context.Context, rootType string) error {
+	wantType := normalize_address(c.config.pkg) + "::walrusfs::WalrusfsRoot"
+	if rootType != wantType {
+		return typed_error(ErrIncompatiblePackage, "root object %s is a %s, not a root of walrusfs:package %s; create a new root with that package", c.config.root, rootType, c.config.pkg)
+	}
+	rsp, err := c.config.getSuiClient().SuiGetNormalizedMoveStruct(ctx, models.GetNormalizedMoveStructRequest{
+		Package:    c.config.pkg,
+		ModuleName: "walrusfs",
+		StructName: "FileObject",
+	})
+	if err != nil {
+		return err
+	}
+	var fields []string
+	for _, field := range rsp.Fields {
+		if f, ok := field.(map[string]interface{}); ok {
+			name, _ := f["name"].(string)
+			fields = append(fields, name)
+		}
+	}
+	if !slices.Equal(fields, packageFileFields) {
+		return typed_error(ErrIncompatiblePackage, "walrusfs:package %s stores files with the fields %v, this client needs %v; publish contracts/sui again and create a new root with it", c.config.pkg, fields, packageFileFields)
+	}
+	return nil
+}
+
+// pingPublishers succeeds when any publisher responds, since uploads fail over between them
+func (c WalrusClient) pingPublishers(ctx context.Context) error {
+	if len(c.config.publisherUrls) == 0 {
+		return fmt.Errorf("no walrus publisher configured")
+	}
+	var errs []error
+	for _, url := range c.config.publisherUrls {
+		err := ping_http(ctx, c.config.getHttpClient(), url)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// pingSigner checks the signer address, or for a read only client the address dev inspect calls run as
+func (c WalrusClient) pingSigner() error {
+	var address string
+	if c.config.readOnly {
+		sender, err := c.config.inspect_sender()
+		if err != nil {
+			return err
+		}
+		address = normalize_address(sender)
+	} else {
+		signerAccount, err := c.config.getSigner()
+		if err != nil {
+			return err
+		}
+		address = signerAccount.Address()
+	}
+	if !is_object_id(address) {
+		return fmt.Errorf("invalid signer address %q", address)
+	}
+	return nil
+}
+
+// ping_http checks a walrus http endpoint responds, any status below 500 means the service is up
+func ping_http(ctx context.Context, client *http.Client, baseUrl string) error {
+	if baseUrl == "" {
+		return fmt.Errorf("url is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", baseUrl+"/v1/api", nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(rsp.Body, 64*1024))
+	if rsp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s responded %s", baseUrl, rsp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package walrusfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testRootId = "0x00000000000000000000000000000000000000000000000000000000000000aa"
+
+func newTestRpc(t *testing.T, rootExists bool) *httptest.Server {
+	return newTestPackageRpc(t, rootExists, testRootId, packageFileFields)
+}
+
+// newTestPackageRpc serves a root object created by the package rootPkg, whose FileObject has fileFields
+func newTestPackageRpc(t *testing.T, rootExists bool, rootPkg string, fileFields []string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		result := map[string]any{"data": map[string]any{"objectId": testRootId, "version": "1", "digest": "d", "type": rootPkg + "::walrusfs::WalrusfsRoot"}}
+		if !rootExists {
+			result = map[string]any{"error": map[string]any{"code": "notExists", "object_id": testRootId}}
+		}
+		if req.Method == "sui_getNormalizedMoveStruct" {
+			var fields []map[string]any
+			for _, name := range fileFields {
+				fields = append(fields, map[string]any{"name": name, "type": "U64"})
+			}
+			result = map[string]any{"abilities": map[string]any{"abilities": []string{}}, "typeParameters": []any{}, "fields": fields}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.Id, "result": result})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestWalrusService(t *testing.T, status int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func pingComponents(err error) []string {
+	var components []string
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return components
+	}
+	for _, e := range joined.Unwrap() {
+		var pingErr *PingError
+		if errors.As(e, &pingErr) {
+			components = append(components, pingErr.Component)
+		}
+	}
+	return components
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	down := newTestWalrusService(t, http.StatusOK)
+	down.Close()
+
+	ok := WalrusClient{config: &WalrusFsConfig{
+		pkg:           testRootId,
+		root:          testRootId,
+		rpcUrl:        newTestRpc(t, true).URL,
+		publisherUrls: []string{down.URL, newTestWalrusService(t, http.StatusNotFound).URL},
+		aggregatorUrl: newTestWalrusService(t, http.StatusOK).URL,
+		mnemonic:      testMnemonic,
+		httpTimeout:   5 * time.Second,
+	}}
+	if err := ok.Ping(context.Background()); err != nil {
+		t.Errorf("unexpected ping error: %v", err)
+	}
+
+	broken := WalrusClient{config: &WalrusFsConfig{
+		pkg:            testRootId,
+		root:           testRootId,
+		rpcUrl:         newTestRpc(t, false).URL,
+		publisherUrls:  []string{down.URL},
+		aggregatorUrl:  newTestWalrusService(t, http.StatusBadGateway).URL,
+		mnemonicSource: "env:WALRUSFS_TEST_UNSET",
+		httpTimeout:    5 * time.Second,
+	}}
+	err := broken.Ping(context.Background())
+	want := []string{PingComponentRpc, PingComponentPublisher, PingComponentAggregator, PingComponentSigner}
+	if got := pingComponents(err); !slices.Equal(got, want) {
+		t.Errorf("got failing components %v, want %v: %v", got, want, err)
+	}
+}
+
+func TestPingPackage(t *testing.T) {
+	t.Parallel()
+
+	otherPkg := "0x00000000000000000000000000000000000000000000000000000000000000bb"
+	tests := []struct {
+		name   string
+		rpcUrl string
+	}{
+		{"old package", newTestPackageRpc(t, true, testRootId, packageFileFields[:len(packageFileFields)-1]).URL},
+		{"root of another package", newTestPackageRpc(t, true, otherPkg, packageFileFields).URL},
+	}
+	for _, tc := range tests {
+		c := WalrusClient{config: &WalrusFsConfig{
+			pkg:           testRootId,
+			root:          testRootId,
+			rpcUrl:        tc.rpcUrl,
+			publisherUrls: []string{newTestWalrusService(t, http.StatusOK).URL},
+			aggregatorUrl: newTestWalrusService(t, http.StatusOK).URL,
+			mnemonic:      testMnemonic,
+			httpTimeout:   5 * time.Second,
+		}}
+		err := c.Ping(context.Background())
+		if got := pingComponents(err); !slices.Equal(got, []string{PingComponentPackage}) || !errors.Is(err, ErrIncompatiblePackage) {
+			t.Errorf("%s: got failing components %v, want the package: %v", tc.name, got, err)
+		}
+	}
+}
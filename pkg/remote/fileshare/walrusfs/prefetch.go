@@ -0,0 +1,55 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+)
+
+// prefetchMaxFileSize is the largest file whose blobs are prefetched, larger ones are streamed when their turn comes
+// so a tar holds at most prefetchdepth+1 files of this size in memory
+var prefetchMaxFileSize int64 = 32 * 1024 * 1024
+
+// tarFetch is an entry of a walrus directory read as a tar. For a prefetched file, data or err is set once done is
+// closed, a file over prefetchMaxFileSize is left to stream
+type tarFetch struct {
+	path   string
+	item   *ListDirFileItem
+	done   chan struct{}
+	stream bool
+	data   []byte
+	err    error
+}
+
+// prefetchTree walks the walrus directory dirPath like walkTree, sending its entries on the returned channel in walk
+// order. The blobs of the files are fetched concurrently, at most walrusfs:prefetchdepth entries ahead of the one
+// the receiver took last, so the tar keeps the walk order whatever order the fetches finish in. The channel is
+// closed after the last entry, walkErr then returns what stopped the walk. A receiver that stops early cancels ctx
+func (c WalrusClient) prefetchTree(ctx context.Context, dirPath string) (<-chan *tarFetch, func() error) {
+	fetches := make(chan *tarFetch, max(c.config.prefetchDepth, 1))
+	var err error
+	go func() {
+		defer close(fetches)
+		err = c.walkTree(ctx, dirPath, func(path string, item *ListDirFileItem) error {
+			f := &tarFetch{path: path, item: item, done: make(chan struct{})}
+			// blocks while the receiver is prefetchdepth entries behind
+			select {
+			case fetches <- f:
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			}
+			if item.IsDir || item.Size > prefetchMaxFileSize {
+				f.stream = !item.IsDir
+				close(f.done)
+				return nil
+			}
+			go func() {
+				defer close(f.done)
+				f.data, f.err = get_file(ctx, c.config, item.ContentSha256, item_coding(item), file_blob_ids(item.WalrusBlobId, item.WalrusBlobIds)...)
+			}()
+			return nil
+		})
+	}()
+	return fetches, func() error { return err }
+}
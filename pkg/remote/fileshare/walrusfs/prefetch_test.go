@@ -0,0 +1,151 @@
+package walrusfs
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
+	"github.com/wavetermdev/waveterm/pkg/util/tarcopy"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestReadTarStreamPrefetch(t *testing.T) {
+	t.Parallel()
+
+	const depth = 2
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blobId := fspath.Base(r.URL.Path)
+		lock.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		lock.Unlock()
+		// the first blobs are the slowest, so the fetches finish out of walk order
+		n, _ := strconv.Atoi(blobId[len("blob"):])
+		time.Sleep(time.Duration(10-n) * 5 * time.Millisecond)
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+		w.Write([]byte("content of " + blobId))
+	}))
+	defer aggregator.Close()
+
+	config := &WalrusFsConfig{root: "test-read-tar-prefetch", cacheTTL: time.Hour, aggregatorUrl: aggregator.URL, httpTimeout: time.Second, prefetchDepth: depth}
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	var items []ListDirFileItem
+	var want []string
+	for i := 0; i < 8; i++ {
+		name := "f" + strconv.Itoa(i)
+		items = append(items, ListDirFileItem{Name: name, Size: int64(len("content of blob0")), WalrusBlobId: "blob" + strconv.Itoa(i)})
+		want = append(want, "dir/"+name)
+		if i == 3 {
+			items = append(items, ListDirFileItem{Name: "sub", IsDir: true})
+			want = append(want, "dir/sub", "dir/sub/g")
+		}
+	}
+	listings.putList(config.root, "/dir", items, expires)
+	listings.putList(config.root, "/dir/sub", []ListDirFileItem{{Name: "g", Size: int64(len("content of blob9")), WalrusBlobId: "blob9"}}, expires)
+	c := WalrusClient{config: config}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: "/dir"}
+	var got []string
+	err := tarcopy.TarCopyDest(ctx, cancel, c.ReadTarStream(ctx, conn, &wshrpc.FileCopyOpts{Recursive: true}), func(next *tar.Header, reader *tar.Reader, singleFile bool) error {
+		got = append(got, next.Name)
+		if next.Typeflag == tar.TypeDir {
+			return nil
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if blob := "content of blob" + next.Name[len(next.Name)-1:]; next.Name != "dir/sub/g" && string(data) != blob {
+			t.Errorf("%s: got %q, want %q", next.Name, data, blob)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, append([]string{"dir"}, want...)) {
+		t.Errorf("got tar entries %v, want the walk order %v", got, want)
+	}
+	// the entries queued plus the one being waited on
+	if maxInFlight > depth+1 {
+		t.Errorf("got %d blobs fetched at once, want at most %d", maxInFlight, depth+1)
+	}
+}
+
+func TestReadTarStreamLargeFiles(t *testing.T) {
+	defer func(size int64) { prefetchMaxFileSize = size }(prefetchMaxFileSize)
+	prefetchMaxFileSize = 4
+
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+		w.Write([]byte("content of " + fspath.Base(r.URL.Path)))
+	}))
+	defer aggregator.Close()
+
+	config := &WalrusFsConfig{root: "test-read-tar-large", cacheTTL: time.Hour, aggregatorUrl: aggregator.URL, httpTimeout: time.Second, prefetchDepth: 4}
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	var items []ListDirFileItem
+	for i := 0; i < 4; i++ {
+		items = append(items, ListDirFileItem{Name: "f" + strconv.Itoa(i), Size: int64(len("content of blob0")), WalrusBlobId: "blob" + strconv.Itoa(i)})
+	}
+	listings.putList(config.root, "/dir", items, expires)
+	listings.putStat(config.root, "/dir/f0", &items[0], expires)
+	c := WalrusClient{config: config}
+
+	for _, path := range []string{"/dir", "/dir/f0"} {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: path}
+		files := 0
+		err := tarcopy.TarCopyDest(ctx, cancel, c.ReadTarStream(ctx, conn, &wshrpc.FileCopyOpts{Recursive: true}), func(next *tar.Header, reader *tar.Reader, singleFile bool) error {
+			if next.Typeflag == tar.TypeDir {
+				return nil
+			}
+			files++
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			if blob := "content of blob" + next.Name[len(next.Name)-1:]; string(data) != blob {
+				t.Errorf("%s: got %q, want %q", next.Name, data, blob)
+			}
+			return nil
+		})
+		cancel(nil)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if want := map[string]int{"/dir": 4, "/dir/f0": 1}[path]; files != want {
+			t.Errorf("%s: got %d files, want %d", path, files, want)
+		}
+	}
+	// files over the prefetch size are streamed one at a time
+	if maxInFlight != 1 {
+		t.Errorf("got %d blobs fetched at once, want 1", maxInFlight)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// maxRateBurst is the most bytes a rate limited transfer moves at once
+const maxRateBurst = 64 * 1024
+
+// the limiters of walrusfs:uploadbytespersec and walrusfs:downloadbytespersec. Like the listing cache they are
+// shared by all clients, since a new client is created for every file operation, so concurrent copies share the limit
+var (
+	sharedUploadLimiter   = rate.NewLimiter(rate.Inf, maxRateBurst)
+	sharedDownloadLimiter = rate.NewLimiter(rate.Inf, maxRateBurst)
+)
+
+// set_shared_limit sets the shared limiter to bytesPerSec and returns it, or nil when bytesPerSec is zero or less
+// which means no limit
+func set_shared_limit(limiter *rate.Limiter, bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	limiter.SetLimit(rate.Limit(bytesPerSec))
+	limiter.SetBurst(rate_burst(bytesPerSec))
+	return limiter
+}
+
+// rate_burst keeps the bursts of a slow limit to a second of transfer
+func rate_burst(bytesPerSec int64) int {
+	return int(min(bytesPerSec, maxRateBurst))
+}
+
+// rateLimitedReader reads from r no faster than limiter allows, waiting for the bytes after each read
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// rate_limited_reader wraps r in limiter, r itself when limiter is nil
+func rate_limited_reader(ctx context.Context, r io.Reader, limiter *rate.Limiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	if burst := l.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if werr := l.limiter.WaitN(l.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// rateLimitedReadCloser is a rate limited reader that closes the body it reads from
+type rateLimitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// rate_limited_body wraps body in limiter, body itself when limiter is nil
+func rate_limited_body(ctx context.Context, body io.ReadCloser, limiter *rate.Limiter) io.ReadCloser {
+	if limiter == nil {
+		return body
+	}
+	return rateLimitedReadCloser{Reader: rate_limited_reader(ctx, body, limiter), Closer: body}
+}
@@ -0,0 +1,43 @@
+package walrusfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedReader(t *testing.T) {
+	t.Parallel()
+
+	r := bytes.NewReader(nil)
+	if rate_limited_reader(context.Background(), r, nil) != r {
+		t.Errorf("no limiter wrapped the reader")
+	}
+
+	const bytesPerSec = 40000
+	limiter := set_shared_limit(rate.NewLimiter(rate.Inf, maxRateBurst), bytesPerSec)
+	if limiter.Burst() != bytesPerSec {
+		t.Errorf("got burst %d, want a second of transfer", limiter.Burst())
+	}
+	content := bytes.Repeat([]byte("x"), bytesPerSec*3/2)
+	start := time.Now()
+	b, err := io.ReadAll(rate_limited_reader(context.Background(), bytes.NewReader(content), limiter))
+	if err != nil || !bytes.Equal(b, content) {
+		t.Fatalf("got %d bytes, %v", len(b), err)
+	}
+	// the first second of transfer is the burst, the rest is limited
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("read %d bytes in %v, limited to %d bytes per second", len(content), elapsed, bytesPerSec)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := io.ReadAll(rate_limited_reader(ctx, bytes.NewReader(content), limiter)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v reading with a canceled context", err)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/holiman/uint256"
+)
+
+// ownedBlob is a walrus blob object owned by the signer, which can extend its storage
+type ownedBlob struct {
+	objectId string
+	endEpoch int64
+}
+
+// blobRenewal is what renewing files reads from the chain, once for a RenewFile or RenewDir
+type blobRenewal struct {
+	currentEpoch int64
+	// the walrus package whose system module extends blobs
+	walrusPkg string
+	// the WAL coin the extensions are paid with
+	payment string
+	// the blob objects of the signer by blob id
+	blobs map[string]*ownedBlob
+}
+
+// new_blob_renewal reads the current epoch, the walrus package, and the WAL coin and blob objects of the signer
+func new_blob_renewal(ctx context.Context, config *WalrusFsConfig) (*blobRenewal, error) {
+	if config.systemObject == "" {
+		return nil, fmt.Errorf("walrusfs:systemobject is not set, it is needed to renew files")
+	}
+	system, err := get_system_info(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	info, err := get_epoch_info(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	signerAccount, err := config.getSigner()
+	if err != nil {
+		return nil, err
+	}
+	payment, err := wal_coin(ctx, config, signerAccount.Address())
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := owned_blobs(ctx, config, signerAccount.Address())
+	if err != nil {
+		return nil, err
+	}
+	return &blobRenewal{currentEpoch: int64(info.Epoch), walrusPkg: system.PackageId, payment: payment, blobs: blobs}, nil
+}
+
+// renew extends the blobs of the file at path by additionalEpochs past epochTill, the end epoch the file records,
+// and records the new end in the same transaction. Walrus stores blobs at most MaxStorageEpochs ahead, a renewal
+// past that is an error rather than a shorter one
+func (r *blobRenewal) renew(ctx context.Context, config *WalrusFsConfig, path string, blobIds []string, epochTill int64, additionalEpochs int) error {
+	if epochTill <= r.currentEpoch {
+		return typed_error(ErrBlobExpired, "cannot renew %s, its storage ended in epoch %d", config.walrus_uri(path), epochTill)
+	}
+	endEpoch := epochTill + int64(additionalEpochs)
+	if maxEnd := r.currentEpoch + MaxStorageEpochs; endEpoch > maxEnd {
+		return fmt.Errorf("cannot renew %s by %d epochs, walrus stores blobs at most %d epochs ahead so it can be renewed by %d epochs at most", config.walrus_uri(path), additionalEpochs, MaxStorageEpochs, maxEnd-epochTill)
+	}
+
+	var calls []moveCall
+	var extended []*ownedBlob
+	for _, blobId := range blobIds {
+		blob := r.blobs[blobId]
+		if blob == nil {
+			return fmt.Errorf("cannot renew %s, its blob %s isn't owned by the signer, only blobs uploaded with it can be extended", config.walrus_uri(path), blobId)
+		}
+		if blob.endEpoch >= endEpoch || slices.Contains(extended, blob) {
+			// another file with the same content was renewed already
+			continue
+		}
+		calls = append(calls, moveCall{
+			pkg:       r.walrusPkg,
+			module:    "system",
+			function:  "extend_blob",
+			arguments: []interface{}{config.systemObject, blob.objectId, strconv.FormatInt(endEpoch-blob.endEpoch, 10), r.payment},
+		})
+		extended = append(extended, blob)
+	}
+	calls = append(calls, file_epoch_call(config, path, endEpoch))
+	defer listings.invalidate(config.root, path)
+	if _, err := execute_batch_call(ctx, config, "renew", calls); err != nil {
+		return err
+	}
+	for _, blob := range extended {
+		blob.endEpoch = endEpoch
+	}
+	return nil
+}
+
+// owned_blobs returns the walrus blob objects owner has by blob id. Uploads send their blob objects to the signer,
+// a blob the publisher already stored belongs to whoever stored it first
+func owned_blobs(ctx context.Context, config *WalrusFsConfig, owner string) (map[string]*ownedBlob, error) {
+	cli := config.getSuiClient()
+	rtn := make(map[string]*ownedBlob)
+	var cursor interface{}
+	for {
+		page, err := with_retry(ctx, config.retryPolicy, "get owned objects", func() (models.PaginatedObjectsResponse, error) {
+			return cli.SuiXGetOwnedObjects(ctx, models.SuiXGetOwnedObjectsRequest{
+				Address: owner,
+				Query:   models.SuiObjectResponseQuery{Options: models.SuiObjectDataOptions{ShowType: true, ShowContent: true}},
+				Cursor:  cursor,
+				Limit:   50,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Data {
+			if obj.Data == nil || obj.Data.Content == nil || !strings.HasSuffix(obj.Data.Type, "::blob::Blob") {
+				continue
+			}
+			blobId, blob, err := parse_owned_blob(obj.Data)
+			if err != nil {
+				logger.Debug("cannot read walrus blob object", "object", obj.Data.ObjectId, "err", err)
+				continue
+			}
+			rtn[blobId] = blob
+		}
+		if !page.HasNextPage || page.NextCursor == "" {
+			return rtn, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// parse_owned_blob reads the blob id and storage end epoch of a walrus Blob object
+func parse_owned_blob(data *models.SuiObjectData) (string, *ownedBlob, error) {
+	raw, err := get_map_string(data.Content.Fields, "blob_id")
+	if err != nil {
+		return "", nil, err
+	}
+	blobId, err := blob_id_from_u256(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	storage, ok := data.Content.Fields["storage"].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("field %q is missing", "storage")
+	}
+	storageFields, ok := storage["fields"].(map[string]interface{})
+	if !ok {
+		return "", nil, fmt.Errorf("storage has no fields")
+	}
+	endEpoch, err := get_map_uint64(storageFields, "end_epoch")
+	if err != nil {
+		return "", nil, err
+	}
+	return blobId, &ownedBlob{objectId: data.ObjectId, endEpoch: int64(endEpoch)}, nil
+}
+
+// blob_id_from_u256 returns the blob id a walrus Blob object stores as a decimal u256, blob ids are the url safe
+// base64 of its little endian bytes
+func blob_id_from_u256(s string) (string, error) {
+	n, err := uint256.FromDecimal(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid blob id %q: %w", s, err)
+	}
+	b := n.Bytes32()
+	slices.Reverse(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// wal_coin returns the WAL coin of owner with the largest balance, walrus storage is paid in WAL
+func wal_coin(ctx context.Context, config *WalrusFsConfig, owner string) (string, error) {
+	cli := config.getSuiClient()
+	var coinId string
+	var balance uint64
+	var cursor interface{}
+	for {
+		page, err := with_retry(ctx, config.retryPolicy, "get coins", func() (models.PaginatedCoinsResponse, error) {
+			return cli.SuiXGetAllCoins(ctx, models.SuiXGetAllCoinsRequest{Owner: owner, Cursor: cursor, Limit: 50})
+		})
+		if err != nil {
+			return "", err
+		}
+		for _, coin := range page.Data {
+			if !strings.HasSuffix(coin.CoinType, "::wal::WAL") {
+				continue
+			}
+			if b, err := strconv.ParseUint(coin.Balance, 10, 64); err == nil && (coinId == "" || b > balance) {
+				coinId, balance = coin.CoinObjectId, b
+			}
+		}
+		if !page.HasNextPage || page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if coinId == "" {
+		return "", fmt.Errorf("%s has no WAL to pay for the storage with", owner)
+	}
+	return coinId, nil
+}
@@ -0,0 +1,142 @@
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/block-vision/sui-go-sdk/models"
+)
+
+func TestBlobIdFromU256(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		u256 string
+		want string
+	}{
+		{"1", "AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"},
+		{"14074904626401341155369551180448584754667373453244490859944217516317499064576", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8"},
+	}
+	for _, tc := range tests {
+		if got, err := blob_id_from_u256(tc.u256); err != nil || got != tc.want {
+			t.Errorf("blob_id_from_u256(%s) = %q, %v, want %q", tc.u256, got, err, tc.want)
+		}
+	}
+	if _, err := blob_id_from_u256("blob"); err == nil {
+		t.Errorf("got no error for a blob id that isn't a number")
+	}
+}
+
+const (
+	renewStakingId = "0x00000000000000000000000000000000000000000000000000000000000000bb"
+	renewSystemId  = "0x00000000000000000000000000000000000000000000000000000000000000cc"
+	renewPackageId = "0x00000000000000000000000000000000000000000000000000000000000000dd"
+	// the blob id of the u256 1
+	renewBlobId = "AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+)
+
+// renewChain is a fakeChain with the walrus staking and system objects, in epoch 12, and a signer owning the blob
+// renewBlobId stored until epoch 20 and two WAL coins
+type renewChain struct {
+	*fakeChain
+}
+
+func (f renewChain) SuiGetObject(ctx context.Context, req models.SuiGetObjectRequest) (models.SuiObjectResponse, error) {
+	fields := map[string]interface{}{"version": "1"}
+	if req.ObjectId == renewSystemId {
+		fields["package_id"] = renewPackageId
+	}
+	content := &models.SuiParsedData{DataType: "moveObject"}
+	content.Fields = fields
+	return models.SuiObjectResponse{Data: &models.SuiObjectData{ObjectId: req.ObjectId, Content: content}}, nil
+}
+
+func (f renewChain) SuiXGetDynamicFieldObject(ctx context.Context, req models.SuiXGetDynamicFieldObjectRequest) (models.SuiObjectResponse, error) {
+	inner := map[string]interface{}{
+		"current_epoch":  "12",
+		"epoch_duration": "86400000",
+		"epoch_state":    map[string]interface{}{"variant": "EpochChangeDone", "fields": map[string]interface{}{"pos0": "1700000000000"}},
+	}
+	if req.ObjectId == renewSystemId {
+		inner = map[string]interface{}{
+			"total_capacity_size":         "1000000",
+			"used_capacity_size":          "2500",
+			"storage_price_per_unit_size": "11000",
+			"write_price_per_unit_size":   "20000",
+		}
+	}
+	content := &models.SuiParsedData{DataType: "moveObject"}
+	content.Fields = map[string]interface{}{"value": map[string]interface{}{"fields": inner}}
+	return models.SuiObjectResponse{Data: &models.SuiObjectData{ObjectId: "0x1", Content: content}}, nil
+}
+
+func (f renewChain) SuiXGetOwnedObjects(ctx context.Context, req models.SuiXGetOwnedObjectsRequest) (models.PaginatedObjectsResponse, error) {
+	blob := &models.SuiParsedData{DataType: "moveObject"}
+	blob.Fields = map[string]interface{}{
+		"blob_id": "1",
+		"storage": map[string]interface{}{"fields": map[string]interface{}{"end_epoch": float64(20)}},
+	}
+	other := &models.SuiParsedData{DataType: "moveObject"}
+	other.Fields = map[string]interface{}{"blob_id": "2"}
+	return models.PaginatedObjectsResponse{Data: []models.SuiObjectResponse{
+		{Data: &models.SuiObjectData{ObjectId: "0xb1", Type: renewPackageId + "::blob::Blob", Content: blob}},
+		{Data: &models.SuiObjectData{ObjectId: "0xb2", Type: "0x2::kiosk::Kiosk", Content: other}},
+	}}, nil
+}
+
+func (f renewChain) SuiXGetAllCoins(ctx context.Context, req models.SuiXGetAllCoinsRequest) (models.PaginatedCoinsResponse, error) {
+	return models.PaginatedCoinsResponse{Data: []models.CoinData{
+		{CoinType: "0x2::sui::SUI", CoinObjectId: "0xc0", Balance: "900000000000"},
+		{CoinType: "0xee::wal::WAL", CoinObjectId: "0xc1", Balance: "100"},
+		{CoinType: "0xee::wal::WAL", CoinObjectId: "0xc2", Balance: "5000"},
+	}}, nil
+}
+
+func TestRenewFile(t *testing.T) {
+	t.Parallel()
+
+	setup := func(name string, item *ListDirFileItem) (WalrusClient, *fakeChain) {
+		c, chain := newFakeChainClient("test-renew-" + name)
+		c.config.stakingObject = renewStakingId
+		c.config.systemObject = renewSystemId
+		c.config.suiClient = renewChain{chain}
+		listings.putStat(c.config.root, "/a.txt", item, time.Now().Add(time.Hour))
+		return c, chain
+	}
+	ctx := context.Background()
+
+	c, chain := setup("extend", &ListDirFileItem{Name: "a.txt", WalrusBlobId: renewBlobId, WalrusEpochTill: 20})
+	if err := c.RenewFile(ctx, walrusConn("/a.txt"), 5); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.executed) != 1 || !slices.Equal(chain.executed[0], []string{"extend_blob", "update_file_epoch"}) {
+		t.Fatalf("got transactions %v, want the blob extended and the file epoch recorded together", chain.executed)
+	}
+	extend, record := chain.calls[0], chain.calls[1]
+	if extend.PackageObjectId != renewPackageId || extend.Module != "system" || !slices.Equal(extend.Arguments, []interface{}{renewSystemId, "0xb1", "5", "0xc2"}) {
+		t.Errorf("got extend call %+v, want blob 0xb1 extended by 5 epochs paid with the largest WAL coin", extend)
+	}
+	if record.Module != "walrusfs" || record.Arguments[2] != "25" {
+		t.Errorf("got record call %+v, want epoch 25 recorded", record)
+	}
+
+	// walrus stores blobs until epoch 12+53 at most
+	c, chain = setup("too-far", &ListDirFileItem{Name: "a.txt", WalrusBlobId: renewBlobId, WalrusEpochTill: 20})
+	if err := c.RenewFile(ctx, walrusConn("/a.txt"), 50); err == nil || !strings.Contains(err.Error(), "renewed by 45 epochs at most") || len(chain.executed) != 0 {
+		t.Errorf("got %v and transactions %v, want an error naming the most epochs it can be renewed by", err, chain.executed)
+	}
+
+	c, chain = setup("not-owned", &ListDirFileItem{Name: "a.txt", WalrusBlobId: "blobA", WalrusEpochTill: 20})
+	if err := c.RenewFile(ctx, walrusConn("/a.txt"), 5); err == nil || !strings.Contains(err.Error(), "isn't owned by the signer") || len(chain.executed) != 0 {
+		t.Errorf("got %v and transactions %v for a blob the signer doesn't own", err, chain.executed)
+	}
+
+	c, chain = setup("expired", &ListDirFileItem{Name: "a.txt", WalrusBlobId: renewBlobId, WalrusEpochTill: 10})
+	if err := c.RenewFile(ctx, walrusConn("/a.txt"), 5); !errors.Is(err, ErrBlobExpired) || len(chain.executed) != 0 {
+		t.Errorf("got %v and transactions %v for an expired file, want ErrBlobExpired", err, chain.executed)
+	}
+}
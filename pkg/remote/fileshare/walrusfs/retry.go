@@ -0,0 +1,115 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 500 * time.Millisecond
+	DefaultRetryJitter      = 0.2
+)
+
+// RetryPolicy controls how transient sui rpc failures are retried. The delay before attempt n+1 is
+// BaseDelay * 2^(n-1), randomly adjusted by up to Jitter of itself
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Jitter      float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		Jitter:      DefaultRetryJitter,
+	}
+}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (rand.Float64()*2 - 1))
+	}
+	return d
+}
+
+// messages of errors returned by the rpc node that are worth retrying, the sdk returns json rpc errors as plain strings
+var transientErrorMarkers = []string{
+	"timeout",
+	"timed out",
+	"too many requests",
+	"rate limit",
+	"service unavailable",
+	"bad gateway",
+	"gateway timeout",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	// a proxy error page instead of a json rpc response leaves the result empty
+	"unexpected end of json input",
+}
+
+// is_transient_error reports whether err looks like a network or node availability problem rather than
+// a rejected transaction, only those are retried. Objects locked by another transaction are not transient, sending
+// a conflicting transaction again only equivocates them further
+func is_transient_error(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range transientErrorMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// with_retry runs fn until it succeeds, fails with an error that isn't transient, or policy.MaxAttempts is reached.
+// The returned error records how many attempts were made
+func with_retry[T any](ctx context.Context, policy RetryPolicy, op string, fn func() (T, error)) (T, error) {
+	maxAttempts := max(policy.MaxAttempts, 1)
+	var rtn T
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		rtn, err = fn()
+		if err == nil {
+			return rtn, nil
+		}
+		if attempt >= maxAttempts || !is_transient_error(err) {
+			break
+		}
+		delay := policy.delay(attempt)
+		logger.Warn("transient failure, retrying", "op", op, "attempt", attempt, "max_attempts", maxAttempts, "delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return rtn, fmt.Errorf("%s failed after %d attempt(s): %w", op, attempt, errors.Join(err, context.Cause(ctx)))
+		case <-time.After(delay):
+		}
+	}
+	err = fmt.Errorf("%s failed after %d attempt(s): %w", op, attempt, err)
+	if is_transient_error(err) {
+		err = with_kind(ErrWalrusUnreachable, err)
+	}
+	return rtn, err
+}
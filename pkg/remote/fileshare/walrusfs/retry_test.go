@@ -0,0 +1,86 @@
+package walrusfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTransientError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"net error", &net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+		{"eof", fmt.Errorf("reading response: %w", io.EOF), true},
+		{"rate limited", errors.New(`{"code":-32000,"message":"Too Many Requests"}`), true},
+		{"equivocation", errors.New("Failed to sign transaction by a quorum of validators because of locked objects"), false},
+		{"locked object", errors.New("Object 0x1 is already locked by a different transaction"), false},
+		{"proxy error page", errors.New("unexpected end of JSON input"), true},
+		{"canceled", context.Canceled, false},
+		{"invalid params", errors.New(`{"code":-32602,"message":"Invalid params"}`), false},
+		{"move abort", errors.New("MoveAbort in 1st command, abort code: 3"), false},
+	}
+
+	for _, test := range tests {
+		if got := is_transient_error(test.err); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: 0.5}
+
+	calls := 0
+	rtn, err := with_retry(context.Background(), policy, "op", func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, io.EOF
+		}
+		return 42, nil
+	})
+	if err != nil || rtn != 42 || calls != 3 {
+		t.Errorf("expected success on the third attempt, got %d, %v after %d calls", rtn, err, calls)
+	}
+
+	calls = 0
+	_, err = with_retry(context.Background(), policy, "op", func() (int, error) {
+		calls++
+		return 0, io.EOF
+	})
+	if calls != 3 || err == nil || !strings.Contains(err.Error(), "after 3 attempt(s)") || !errors.Is(err, io.EOF) {
+		t.Errorf("expected the wrapped error after 3 attempts, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	_, err = with_retry(context.Background(), policy, "op", func() (int, error) {
+		calls++
+		return 0, errors.New("MoveAbort")
+	})
+	if calls != 1 || err == nil || !strings.Contains(err.Error(), "after 1 attempt(s)") {
+		t.Errorf("expected no retry for a validation error, got %v after %d calls", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	_, err = with_retry(ctx, RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}, "op", func() (int, error) {
+		calls++
+		return 0, io.EOF
+	})
+	if calls != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a canceled context to stop retrying, got %v after %d calls", err, calls)
+	}
+}
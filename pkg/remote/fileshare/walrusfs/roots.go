@@ -0,0 +1,58 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fstype"
+)
+
+// NewWalrusClientForConn returns the client of the root a walrus connection is in, along with the connection with
+// its path relative to that root. A path under a name of walrus:roots goes to that root object, like
+// walrus:///<name>/a.txt, and any other path to walrus:root
+func NewWalrusClientForConn(conn *connparse.Connection) (*WalrusClient, *connparse.Connection, error) {
+	config := GetConfig()
+	if name, relPath, ok := config.route(conn.Path); ok {
+		config.root = config.roots[name]
+		config.rootName = name
+		conn = &connparse.Connection{Scheme: conn.Scheme, Host: conn.Host, Path: relPath}
+	}
+	client, err := newWalrusClient(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+// CrossRoot reports whether src and dest are walrus clients of different root objects. Nothing can be copied or
+// moved between them on chain, the objects don't share any directory
+func CrossRoot(src, dest fstype.FileShareClient) bool {
+	srcClient, srcOk := src.(*WalrusClient)
+	destClient, destOk := dest.(*WalrusClient)
+	return srcOk && destOk && srcClient.config.root != destClient.config.root
+}
+
+// route returns the named root path is under and the path relative to it, ok is false for a path of walrus:root
+func (config *WalrusFsConfig) route(path string) (name string, relPath string, ok bool) {
+	name, rest, _ := strings.Cut(strings.TrimPrefix(path, fspath.Separator), fspath.Separator)
+	if _, ok := config.roots[name]; !ok || name == "" {
+		return "", path, false
+	}
+	return name, fspath.Separator + rest, true
+}
+
+// validate_root_name checks the name of a named root is a single path element
+func validate_root_name(name string) error {
+	if strings.Contains(name, fspath.Separator) {
+		return fmt.Errorf("root name %q can't contain %s", name, fspath.Separator)
+	}
+	if _, err := ValidatePath(name); err != nil {
+		return fmt.Errorf("root name %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package walrusfs
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRoute(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{roots: map[string]string{"work": testRootId}}
+	tests := []struct {
+		path     string
+		wantName string
+		wantPath string
+	}{
+		{"/", "", "/"},
+		{"", "", ""},
+		{"/work", "work", "/"},
+		{"/work/", "work", "/"},
+		{"work/a/b.txt", "work", "/a/b.txt"},
+		{"/work/a/", "work", "/a/"},
+		{"/workspace/a.txt", "", "/workspace/a.txt"},
+		{"/other/work", "", "/other/work"},
+	}
+	for _, tc := range tests {
+		name, relPath, ok := config.route(tc.path)
+		if name != tc.wantName || relPath != tc.wantPath || ok != (tc.wantName != "") {
+			t.Errorf("route(%q) = %q, %q, %v, want %q, %q", tc.path, name, relPath, ok, tc.wantName, tc.wantPath)
+		}
+	}
+}
+
+func TestNamedRoots(t *testing.T) {
+	t.Parallel()
+
+	rpcUrl := newTestRpc(t, true).URL
+	roots := map[string]string{"work": "test-roots-work", "notes": "test-roots-notes"}
+	top := WalrusClient{config: &WalrusFsConfig{root: "test-roots-default", roots: roots, cacheTTL: time.Hour, rpcUrl: rpcUrl}}
+	work := WalrusClient{config: &WalrusFsConfig{root: roots["work"], roots: roots, rootName: "work", cacheTTL: time.Hour, rpcUrl: rpcUrl}}
+	expires := time.Now().Add(time.Hour)
+	// the file named like a root is hidden by it
+	listings.putList(top.config.root, "/", []ListDirFileItem{{Name: "a.txt"}, {Name: "work"}}, expires)
+	listings.putList(work.config.root, "/", []ListDirFileItem{{Name: "b.txt"}}, expires)
+	listings.putStat(work.config.root, "/b.txt", &ListDirFileItem{Name: "b.txt"}, expires)
+	ctx := context.Background()
+
+	list := func(c WalrusClient) []string {
+		infos, err := c.ListEntries(ctx, walrusConn("/"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, info := range infos {
+			got = append(got, info.Path)
+			if info.IsDir != (info.Name != "a.txt" && info.Name != "b.txt") {
+				t.Errorf("%s: got dir %v", info.Path, info.IsDir)
+			}
+		}
+		return got
+	}
+	if got, want := list(top), []string{"walrus:///a.txt", "walrus:///notes", "walrus:///work"}; !slices.Equal(got, want) {
+		t.Errorf("top level: got %v, want %v", got, want)
+	}
+	if got, want := list(work), []string{"walrus:///work/b.txt"}; !slices.Equal(got, want) {
+		t.Errorf("named root: got %v, want %v", got, want)
+	}
+
+	finfo, err := work.Stat(ctx, walrusConn("/"))
+	if err != nil || finfo.Name != "work" || finfo.Path != "walrus:///work" || finfo.Dir != "walrus:///" || !finfo.IsDir {
+		t.Errorf("named root: got %+v, %v", finfo, err)
+	}
+	finfo, err = work.Stat(ctx, walrusConn("/b.txt"))
+	if err != nil || finfo.Path != "walrus:///work/b.txt" || finfo.Dir != "walrus:///work/" {
+		t.Errorf("file in a named root: got %+v, %v", finfo, err)
+	}
+}
+
+func TestCrossRoot(t *testing.T) {
+	t.Parallel()
+
+	a := &WalrusClient{config: &WalrusFsConfig{root: "a"}}
+	b := &WalrusClient{config: &WalrusFsConfig{root: "b"}}
+	// CreateFileShareClient hands out pointers, a client value is never a walrus root
+	if same, cross, value := CrossRoot(a, a), CrossRoot(a, b), CrossRoot(a, *b); same || !cross || value {
+		t.Errorf("got %v, %v and %v, want false, true and false", same, cross, value)
+	}
+}
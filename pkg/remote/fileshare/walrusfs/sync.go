@@ -0,0 +1,295 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/sync/errgroup"
+)
+
+// SyncOpts are the options of Sync
+type SyncOpts struct {
+	// Delete removes the walrus files and directories below the destination that aren't in the local tree
+	Delete bool
+	// DryRun works out what would change without changing anything
+	DryRun bool
+	// Progress is called as the files are uploaded, when set
+	Progress func(wshrpc.FileCopyProgress)
+}
+
+// SyncResult is what Sync changed, or for a dry run what it would change. The paths are walrus paths, parents
+// before their children
+type SyncResult struct {
+	Mkdirs   []string
+	Uploaded []string
+	// Deleted only has the top of each deleted subtree
+	Deleted []string
+	// Unchanged counts the files that were already on walrus with the same size and content
+	Unchanged     int
+	BytesUploaded int64
+}
+
+// syncUpload is a local file Sync uploads
+type syncUpload struct {
+	localPath string
+	path      string
+	size      int64
+	modTime   int64
+}
+
+// Sync makes the walrus directory dstWalrus mirror the local directory srcLocal. Only files that are new, or whose
+// size or sha256 differs from the file on walrus, are uploaded, with opts.Delete the walrus entries missing locally
+// are deleted. A walrus file where there is a local directory, or the other way round, is replaced when deleting
+// and an error otherwise. Directories, deletes and uploaded files are recorded in batch transactions. Only regular
+// files are synced, symlinks and other special files are skipped
+func (c WalrusClient) Sync(ctx context.Context, srcLocal string, dstWalrus string, opts SyncOpts) (*SyncResult, error) {
+	if !opts.DryRun {
+		if err := c.check_writable(); err != nil {
+			return nil, err
+		}
+	}
+	srcLocal = filepath.Clean(srcLocal)
+	srcInfo, err := os.Stat(srcLocal)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat sync source: %w", err)
+	}
+	if !srcInfo.IsDir() {
+		return nil, fmt.Errorf("sync source %q is not a directory", srcLocal)
+	}
+
+	dst := fspath.Join(fspath.Separator, dstWalrus)
+	remote := make(map[string]ListDirFileItem)
+	result := &SyncResult{}
+	var dstItem *ListDirFileItem
+	if dst != fspath.Separator {
+		if dstItem, err = stat(ctx, c.config, dst); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case dstItem == nil && dst != fspath.Separator:
+		result.Mkdirs = append(result.Mkdirs, dst)
+	case dstItem != nil && !dstItem.IsDir:
+		return nil, fmt.Errorf("sync destination %s is a file, not a directory", c.config.walrus_uri(dst))
+	default:
+		err = c.collectEntries(ctx, dst, func(path string, item *ListDirFileItem) bool {
+			remote[path] = *item
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot list %s: %w", c.config.walrus_uri(dst), err)
+		}
+	}
+
+	var uploads []syncUpload
+	var replaced []string
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(srcLocal, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		rel, err := filepath.Rel(srcLocal, localPath)
+		if err != nil || rel == "." {
+			return err
+		}
+		path := fspath.Join(dst, filepath.ToSlash(rel))
+		if !d.IsDir() && !d.Type().IsRegular() {
+			logger.Debug("skipping special file", "op", "sync", "path", localPath)
+			return nil
+		}
+		seen[path] = true
+		item, exists := remote[path]
+		if exists && item.IsDir != d.IsDir() {
+			if !opts.Delete {
+				return fmt.Errorf("cannot sync %q to %s, one is a file and the other a directory", localPath, c.config.walrus_uri(path))
+			}
+			replaced = append(replaced, path)
+			exists = false
+		}
+		if d.IsDir() {
+			if !exists {
+				result.Mkdirs = append(result.Mkdirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if exists && item.Size == info.Size() {
+			same, err := same_content(localPath, item.ContentSha256)
+			if err != nil {
+				return err
+			}
+			if same {
+				result.Unchanged++
+				return nil
+			}
+		}
+		uploads = append(uploads, syncUpload{localPath: localPath, path: path, size: info.Size(), modTime: info.ModTime().UnixMilli()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deletes := replaced
+	if opts.Delete {
+		for path := range remote {
+			if !seen[path] {
+				deletes = append(deletes, path)
+			}
+		}
+	}
+	result.Deleted = top_paths(deletes)
+	for _, upload := range uploads {
+		result.Uploaded = append(result.Uploaded, upload.path)
+		result.BytesUploaded += upload.size
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// what is deleted may be in the way of the directories and files replacing it
+	if len(result.Deleted) > 0 {
+		logger.Info("deleting", "op", "sync", "paths", len(result.Deleted))
+		if _, err := c.DeleteMany(ctx, result.Deleted); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.Mkdirs) > 0 {
+		calls := make([]moveCall, len(result.Mkdirs))
+		for i, path := range result.Mkdirs {
+			if _, err := ValidatePath(path); err != nil {
+				return nil, err
+			}
+			calls[i] = moveCall{function: "add_dir", arguments: []interface{}{c.config.root, "0x6", path, make([]string, 0)}}
+		}
+		_, errs := execute_calls(ctx, c.config, "add_dirs", calls)
+		for _, path := range result.Mkdirs {
+			listings.invalidate(c.config.root, path)
+		}
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("cannot create directories: %w", err)
+		}
+	}
+	uploaded, err := c.syncUploads(ctx, uploads, result.BytesUploaded, opts.Progress)
+	result.Uploaded = uploaded
+	result.BytesUploaded = 0
+	for _, upload := range uploads {
+		if slices.Contains(uploaded, upload.path) {
+			result.BytesUploaded += upload.size
+		}
+	}
+	return result, err
+}
+
+// syncUploads publishes uploads at most walrusfs:copyconcurrency at a time, opening each file only while it is
+// published, and records them in batch transactions. It returns the paths recorded
+func (c WalrusClient) syncUploads(ctx context.Context, uploads []syncUpload, totalBytes int64, progress func(wshrpc.FileCopyProgress)) ([]string, error) {
+	tracker := newCopyProgressTracker(progress, len(uploads), totalBytes)
+	recs := make([]*fileRecord, len(uploads))
+	errs := make([]error, len(uploads))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(c.config.copyConcurrency, 1))
+	for i, upload := range uploads {
+		g.Go(func() error {
+			// a failed file is reported without stopping the others
+			recs[i], errs[i] = c.publishSyncUpload(gctx, upload)
+			if errs[i] == nil {
+				tracker.fileDone(upload.size)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	var published []*fileRecord
+	var indexes []int
+	for i, rec := range recs {
+		if rec != nil {
+			published = append(published, rec)
+			indexes = append(indexes, i)
+		}
+	}
+	_, recErrs := record_files(ctx, c.config, published)
+	for n, i := range indexes {
+		errs[i] = recErrs[n]
+	}
+
+	var recorded []string
+	var failed []error
+	for i, upload := range uploads {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("cannot upload %s: %w", upload.localPath, errs[i]))
+		} else {
+			recorded = append(recorded, upload.path)
+		}
+	}
+	return recorded, errors.Join(failed...)
+}
+
+// publishSyncUpload publishes the content of a local file, replacing the walrus file at its path
+func (c WalrusClient) publishSyncUpload(ctx context.Context, upload syncUpload) (*fileRecord, error) {
+	data, err := os.Open(upload.localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	var createTs int64
+	if preserve_times(ctx) {
+		createTs = upload.modTime
+	}
+	return publish_file(ctx, c.config, data, upload.size, upload.path, nil, createTs, true, 0)
+}
+
+// same_content reports whether the local file at localPath hashes to contentSha256. A file recorded without a
+// sha256 can't be compared and is taken as changed
+func same_content(localPath string, contentSha256 string) (bool, error) {
+	if contentSha256 == "" {
+		return false, nil
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, fmt.Errorf("cannot hash %q: %w", localPath, err)
+	}
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), contentSha256), nil
+}
+
+// top_paths returns paths sorted without the ones below another path in paths
+func top_paths(paths []string) []string {
+	slices.Sort(paths)
+	var rtn []string
+	for _, path := range paths {
+		if len(rtn) > 0 {
+			last := rtn[len(rtn)-1]
+			if path == last || strings.HasPrefix(path, last+fspath.Separator) {
+				continue
+			}
+		}
+		rtn = append(rtn, path)
+	}
+	return rtn
+}
@@ -0,0 +1,124 @@
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fardream/go-bcs/bcs"
+	"github.com/holiman/uint256"
+)
+
+func TestSync(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"same.txt":      "same",
+		"changed.txt":   "new!",
+		"new.txt":       "new",
+		"sub/n.txt":     "n",
+		"newdir/x.txt":  "x",
+		"gone/file.txt": "walrus has a file named gone",
+	} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sha := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	file := func(id uint64, size uint64, content string) FileObjectEx {
+		return FileObjectEx{Id: *uint256.NewInt(id), Obj: FileObject{Size: size, WalrusBlobId: "blob", ContentSha256: sha(content)}}
+	}
+	// /dst holds same.txt, changed.txt, extra.txt, a file named gone, sub/old.txt and the empty directory olddir
+	list, err := bcs.Marshal(RecursiveDirList{
+		Dirobj: *uint256.NewInt(1),
+		Files:  []FileObjectEx{file(10, 4, "same"), file(11, 4, "old!"), file(12, 5, "extra"), file(13, 4, "gone"), file(14, 3, "old")},
+		Dirs: []DirObjectEx{
+			{
+				Id:                     *uint256.NewInt(1),
+				ChildrenFileNames:      []string{"same.txt", "changed.txt", "extra.txt", "gone"},
+				ChildrenFileIds:        []uint256.Int{*uint256.NewInt(10), *uint256.NewInt(11), *uint256.NewInt(12), *uint256.NewInt(13)},
+				ChildrenDirectoryNames: []string{"sub", "olddir"},
+				ChildrenDirectoryIds:   []uint256.Int{*uint256.NewInt(2), *uint256.NewInt(3)},
+			},
+			{Id: *uint256.NewInt(2), ChildrenFileNames: []string{"old.txt"}, ChildrenFileIds: []uint256.Int{*uint256.NewInt(14)}},
+			{Id: *uint256.NewInt(3)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := func(name string) (WalrusClient, *fakeChain, *atomic.Int32) {
+		var requests atomic.Int32
+		var body atomic.Value
+		publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+		c, chain := newFakeChainClient("test-sync-" + name)
+		chain.inspectReturn = list
+		c.config.publisherUrls = []string{publisher.URL}
+		c.config.httpTimeout = time.Second
+		expires := time.Now().Add(time.Hour)
+		listings.putStat(c.config.root, "/dst", &ListDirFileItem{Name: "dst", IsDir: true}, expires)
+		listings.putStat(c.config.root, "/dst/extra.txt", &ListDirFileItem{Name: "extra.txt"}, expires)
+		listings.putStat(c.config.root, "/dst/gone", &ListDirFileItem{Name: "gone"}, expires)
+		listings.putStat(c.config.root, "/dst/olddir", &ListDirFileItem{Name: "olddir", IsDir: true}, expires)
+		listings.putStat(c.config.root, "/dst/sub/old.txt", &ListDirFileItem{Name: "old.txt"}, expires)
+		return c, chain, &requests
+	}
+	ctx := context.Background()
+	wantMkdirs := []string{"/dst/gone", "/dst/newdir"}
+	wantUploads := []string{"/dst/changed.txt", "/dst/gone/file.txt", "/dst/new.txt", "/dst/newdir/x.txt", "/dst/sub/n.txt"}
+	wantDeletes := []string{"/dst/extra.txt", "/dst/gone", "/dst/olddir", "/dst/sub/old.txt"}
+
+	// a walrus file in the way of a local directory needs deleting
+	c, chain, _ := setup("conflict")
+	if _, err := c.Sync(ctx, src, "/dst", SyncOpts{}); err == nil || !strings.Contains(err.Error(), "/dst/gone") {
+		t.Errorf("got error %v, want one about /dst/gone", err)
+	}
+	if len(chain.executed) != 0 {
+		t.Errorf("got transactions %v after the sync failed", chain.executed)
+	}
+
+	c, chain, requests := setup("dry-run")
+	result, err := c.Sync(ctx, src, "dst", SyncOpts{Delete: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Mkdirs, wantMkdirs) || !slices.Equal(result.Uploaded, wantUploads) || !slices.Equal(result.Deleted, wantDeletes) {
+		t.Errorf("got mkdirs %v, uploads %v and deletes %v", result.Mkdirs, result.Uploaded, result.Deleted)
+	}
+	if result.Unchanged != 1 || result.BytesUploaded != 4+28+3+1+1 {
+		t.Errorf("got %d unchanged files and %d bytes to upload", result.Unchanged, result.BytesUploaded)
+	}
+	if len(chain.executed) != 0 || requests.Load() != 0 {
+		t.Errorf("dry run made transactions %v and %d uploads", chain.executed, requests.Load())
+	}
+
+	c, chain, requests = setup("delete")
+	result, err = c.Sync(ctx, src, "/dst", SyncOpts{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Uploaded, wantUploads) || requests.Load() != int32(len(wantUploads)) {
+		t.Errorf("got uploads %v after %d publisher requests", result.Uploaded, requests.Load())
+	}
+	// the deletes, the directories and the files each go in a single transaction
+	if len(chain.executed) != 3 || len(chain.executed[0]) != len(wantDeletes) ||
+		!slices.Equal(chain.executed[1], []string{"add_dir", "add_dir"}) || len(chain.executed[2]) != len(wantUploads) {
+		t.Errorf("got transactions %v", chain.executed)
+	}
+}
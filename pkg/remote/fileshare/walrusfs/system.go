@@ -0,0 +1,53 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"fmt"
+)
+
+// SystemInfo describes the storage of a walrus deployment, read from its system object
+type SystemInfo struct {
+	// the walrus move package of the deployment
+	PackageId string
+	// storage capacity of the network in bytes
+	TotalCapacity uint64
+	UsedCapacity  uint64
+	// prices in FROST per MiB, storage is paid for each epoch and writes once
+	StoragePricePerUnit uint64
+	WritePricePerUnit   uint64
+}
+
+// GetSystemInfo returns the capacity and prices of the walrus deployment whose system object is set in
+// walrusfs:systemobject
+func (c WalrusClient) GetSystemInfo(ctx context.Context) (*SystemInfo, error) {
+	return get_system_info(ctx, c.config)
+}
+
+// get_system_info reads the walrus SystemStateInnerV1 struct from the inner object of the system object
+func get_system_info(ctx context.Context, config *WalrusFsConfig) (*SystemInfo, error) {
+	if config.systemObject == "" {
+		return nil, fmt.Errorf("walrusfs:systemobject is not set, it is needed to read the walrus system state")
+	}
+	fields, system, err := get_versioned_inner(ctx, config, config.systemObject, "system")
+	if err != nil {
+		return nil, err
+	}
+	info := &SystemInfo{}
+	if info.PackageId, err = get_map_string(system, "package_id"); err != nil {
+		return nil, fmt.Errorf("walrus system object %s: %w", config.systemObject, err)
+	}
+	for key, v := range map[string]*uint64{
+		"total_capacity_size":         &info.TotalCapacity,
+		"used_capacity_size":          &info.UsedCapacity,
+		"storage_price_per_unit_size": &info.StoragePricePerUnit,
+		"write_price_per_unit_size":   &info.WritePricePerUnit,
+	} {
+		if *v, err = get_map_uint64(fields, key); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
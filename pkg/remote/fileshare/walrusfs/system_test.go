@@ -0,0 +1,73 @@
+package walrusfs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetSystemInfo(t *testing.T) {
+	t.Parallel()
+
+	const systemId = "0x00000000000000000000000000000000000000000000000000000000000000cc"
+	const packageId = "0x00000000000000000000000000000000000000000000000000000000000000dd"
+	rpc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var result any
+		switch req.Method {
+		case "sui_getObject":
+			result = map[string]any{"data": map[string]any{"objectId": systemId, "version": "1", "digest": "d",
+				"content": map[string]any{"dataType": "moveObject", "fields": map[string]any{"version": "2", "package_id": packageId}}}}
+		case "suix_getDynamicFieldObject":
+			result = map[string]any{"data": map[string]any{"objectId": "0x1", "version": "1", "digest": "d",
+				"content": map[string]any{"dataType": "moveObject", "fields": map[string]any{
+					"name": "2",
+					"value": map[string]any{"fields": map[string]any{
+						"total_capacity_size":         "1000000",
+						"used_capacity_size":          "2500",
+						"storage_price_per_unit_size": "11000",
+						"write_price_per_unit_size":   "20000",
+					}},
+				}}}}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.Id, "result": result})
+	}))
+	defer rpc.Close()
+
+	c := WalrusClient{config: &WalrusFsConfig{rpcUrl: rpc.URL, systemObject: systemId}}
+	info, err := c.GetSystemInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SystemInfo{PackageId: packageId, TotalCapacity: 1000000, UsedCapacity: 2500, StoragePricePerUnit: 11000, WritePricePerUnit: 20000}
+	if *info != want {
+		t.Errorf("got %+v, want %+v", *info, want)
+	}
+
+	c = WalrusClient{config: &WalrusFsConfig{rpcUrl: rpc.URL}}
+	if _, err := c.GetSystemInfo(context.Background()); err == nil || !strings.Contains(err.Error(), "walrusfs:systemobject is not set") {
+		t.Errorf("got error %v without a system object, want one naming walrusfs:systemobject", err)
+	}
+}
+
+func TestRenewRequiresStakingObject(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-renew-staking")
+	if err := c.RenewFile(context.Background(), walrusConn("/a.txt"), 1); err == nil || !strings.Contains(err.Error(), "walrusfs:stakingobject is not set") {
+		t.Errorf("RenewFile: got error %v, want one naming walrusfs:stakingobject", err)
+	}
+	if err := c.RenewDir(context.Background(), walrusConn("/dir"), 1); err == nil || !strings.Contains(err.Error(), "walrusfs:stakingobject is not set") {
+		t.Errorf("RenewDir: got error %v, want one naming walrusfs:stakingobject", err)
+	}
+	if len(chain.executed) != 0 {
+		t.Errorf("executed transactions %v", chain.executed)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"github.com/wavetermdev/waveterm/pkg/telemetry/telemetrydata"
+)
+
+// the directions of the walrus copies and moves reported to telemetry
+const (
+	DirectionLocalToWalrus  = "local->walrus"
+	DirectionWalrusToLocal  = "walrus->local"
+	DirectionWalrusToWalrus = "walrus->walrus"
+)
+
+// the telemetry events of walrus file operations
+const (
+	TEventCopy   = "action:walruscopy"
+	TEventMove   = "action:walrusmove"
+	TEventDelete = "action:walrusdelete"
+)
+
+// MakeOpTEvent returns the telemetry event of a walrus file operation. It only carries the direction and the number
+// of files and bytes, never paths or contents. direction is empty for deletes
+func MakeOpTEvent(event string, direction string, files int, bytes int64) *telemetrydata.TEvent {
+	return telemetrydata.MakeTEvent(event, telemetrydata.TEventProps{
+		WalrusDirection: direction,
+		WalrusFiles:     files,
+		WalrusBytes:     bytes,
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/signer"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Signer signs walrusfs transactions. The default derives an ed25519 key from the configured mnemonic, a custom
+// signer set with SetSigner keeps the key out of the process, e.g. in a hardware wallet or a remote kms
+type Signer interface {
+	// Address is the sui address of the signing account, it sends and pays for every walrusfs transaction
+	Address() string
+	// SignTransaction signs bcs encoded transaction data. The ed25519 signature must be over TransactionDigest(txBytes),
+	// pubkey is the 32 byte ed25519 public key of Address
+	SignTransaction(txBytes []byte) (signature []byte, pubkey []byte, err error)
+}
+
+var customSignerLock sync.Mutex
+var customSigner Signer
+
+// SetSigner makes configs created afterwards sign with s instead of the mnemonic, nil restores the mnemonic signer
+func SetSigner(s Signer) {
+	customSignerLock.Lock()
+	defer customSignerLock.Unlock()
+	customSigner = s
+}
+
+func getCustomSigner() Signer {
+	customSignerLock.Lock()
+	defer customSignerLock.Unlock()
+	return customSigner
+}
+
+// TransactionDigest returns the digest a sui transaction signature covers, the blake2b-256 hash of the
+// transaction data intent message
+func TransactionDigest(txBytes []byte) [32]byte {
+	return blake2b.Sum256(append(append([]byte{}, models.IntentBytes...), txBytes...))
+}
+
+// mnemonicSigner signs with the key derived from the walrusfs mnemonic
+type mnemonicSigner struct {
+	account *signer.Signer
+}
+
+func (s mnemonicSigner) Address() string {
+	return s.account.Address
+}
+
+func (s mnemonicSigner) SignTransaction(txBytes []byte) ([]byte, []byte, error) {
+	digest := TransactionDigest(txBytes)
+	return ed25519.Sign(s.account.PriKey, digest[:]), s.account.PubKey, nil
+}
+
+// derived mnemonic signers by source and mnemonic setting, so the mnemonic is read and derived once per process
+// rather than for every client
+var mnemonicSignerLock sync.Mutex
+var mnemonicSigners = make(map[[32]byte]mnemonicSigner)
+
+// get_mnemonic_signer reads the mnemonic from its configured source and derives the signer account from it
+func get_mnemonic_signer(source string, configured secretString) (Signer, error) {
+	key := sha256.Sum256([]byte(source + "\x00" + string(configured)))
+	mnemonicSignerLock.Lock()
+	defer mnemonicSignerLock.Unlock()
+	if s, ok := mnemonicSigners[key]; ok {
+		return s, nil
+	}
+	mnemonic, err := load_mnemonic(source, configured)
+	if err != nil {
+		return nil, err
+	}
+	account, err := signer.NewSignertWithMnemonic(string(mnemonic))
+	if err != nil {
+		return nil, err
+	}
+	s := mnemonicSigner{account: account}
+	mnemonicSigners[key] = s
+	return s, nil
+}
+
+// normalize_address returns a sui address in its canonical form, lower case hex padded to 32 bytes
+func normalize_address(address string) string {
+	hexPart := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(address)), "0x")
+	if len(hexPart) < 64 {
+		hexPart = strings.Repeat("0", 64-len(hexPart)) + hexPart
+	}
+	return "0x" + hexPart
+}
+
+// is_object_id reports whether id is a full sui address or object id, 0x followed by 64 hex digits
+func is_object_id(id string) bool {
+	hexPart, ok := strings.CutPrefix(id, "0x")
+	if !ok || len(hexPart) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(hexPart)
+	return err == nil
+}
+
+var walletWarnings sync.Map
+
+// resolve_wallet defaults the wallet to the signer's address, and warns once when an explicitly set wallet is
+// a different address, dev inspect calls then run as an account that doesn't own the walrusfs objects
+func (config *WalrusFsConfig) resolve_wallet() {
+	signerAccount, err := config.getSigner()
+	if err != nil {
+		// surfaces when the signer is needed
+		return
+	}
+	address := signerAccount.Address()
+	if config.wallet == "" {
+		config.wallet = address
+		return
+	}
+	if normalize_address(config.wallet) == normalize_address(address) {
+		return
+	}
+	if _, warned := walletWarnings.LoadOrStore(config.wallet+"/"+address, true); !warned {
+		logger.Warn("walrusfs:wallet does not match the address of the walrusfs signer, leave walrusfs:wallet unset to use the signer's address", "wallet", config.wallet, "signer", address)
+	}
+}
+
+// sign_transaction signs base64 transaction bytes, returning the serialized signature sui_executeTransactionBlock expects
+func sign_transaction(s Signer, b64TxBytes string) (string, error) {
+	txBytes, err := base64.StdEncoding.DecodeString(b64TxBytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid transaction bytes: %w", err)
+	}
+	signature, pubkey, err := s.SignTransaction(txBytes)
+	if err != nil {
+		return "", fmt.Errorf("cannot sign transaction: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize || len(pubkey) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("signer returned a %d byte signature and %d byte public key, expected an ed25519 signature", len(signature), len(pubkey))
+	}
+	return models.ToSerializedSignature(signature, pubkey), nil
+}
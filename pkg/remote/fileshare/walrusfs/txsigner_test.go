@@ -0,0 +1,105 @@
+package walrusfs
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/signer"
+)
+
+type fakeSigner struct {
+	address   string
+	signature []byte
+	pubkey    []byte
+	err       error
+}
+
+func (s fakeSigner) Address() string {
+	return s.address
+}
+
+func (s fakeSigner) SignTransaction(txBytes []byte) ([]byte, []byte, error) {
+	return s.signature, s.pubkey, s.err
+}
+
+func TestMnemonicSignerMatchesSdk(t *testing.T) {
+	t.Parallel()
+
+	account, err := signer.NewSignertWithMnemonic(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := models.TxnMetaData{TxBytes: base64.StdEncoding.EncodeToString([]byte("transaction data"))}
+	want := txn.SignSerializedSigWith(account.PriKey).Signature
+
+	got, err := sign_transaction(mnemonicSigner{account: account}, txn.TxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got signature %s, want the sdk signature %s", got, want)
+	}
+}
+
+func TestCustomSigner(t *testing.T) {
+	t.Parallel()
+
+	custom := fakeSigner{address: "0x1", signature: make([]byte, 64), pubkey: make([]byte, 32)}
+	config := &WalrusFsConfig{txSigner: custom, mnemonic: "not a mnemonic"}
+	got, err := config.getSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Address() != "0x1" {
+		t.Errorf("got signer %s, want the custom signer", got.Address())
+	}
+
+	txBytes := base64.StdEncoding.EncodeToString([]byte("transaction data"))
+	if _, err := sign_transaction(custom, txBytes); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := sign_transaction(fakeSigner{signature: make([]byte, 64), pubkey: make([]byte, 33)}, txBytes); err == nil {
+		t.Errorf("expected an error for a non ed25519 public key")
+	}
+	signErr := errors.New("device locked")
+	if _, err := sign_transaction(fakeSigner{err: signErr}, txBytes); !errors.Is(err, signErr) {
+		t.Errorf("got error %v, want the signer error", err)
+	}
+}
+
+func TestResolveWallet(t *testing.T) {
+	t.Parallel()
+
+	account, err := signer.NewSignertWithMnemonic(testMnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &WalrusFsConfig{mnemonic: testMnemonic}
+	config.resolve_wallet()
+	if config.wallet != account.Address {
+		t.Errorf("got wallet %q, want the derived address %s", config.wallet, account.Address)
+	}
+
+	explicit := "0x" + strings.ToUpper(account.Address[2:])
+	config = &WalrusFsConfig{mnemonic: testMnemonic, wallet: explicit}
+	config.resolve_wallet()
+	if config.wallet != explicit {
+		t.Errorf("got wallet %q, an explicit wallet should be kept", config.wallet)
+	}
+	if normalize_address(explicit) != account.Address {
+		t.Errorf("normalized %s to %s, want %s", explicit, normalize_address(explicit), account.Address)
+	}
+	if got := normalize_address("0x2"); got != "0x"+strings.Repeat("0", 63)+"2" {
+		t.Errorf("got %s for a short address", got)
+	}
+
+	config = &WalrusFsConfig{mnemonicSource: "env:WALRUSFS_TEST_UNSET"}
+	config.resolve_wallet()
+	if config.wallet != "" {
+		t.Errorf("got wallet %q without a usable mnemonic", config.wallet)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
+)
+
+// UploadManifest records the files an upload stored on walrus as they were then, so Verify can check later that
+// walrus still serves the same content. It marshals to json to be kept next to the data
+type UploadManifest struct {
+	Files []UploadManifestEntry `json:"files"`
+}
+
+// UploadManifestEntry is a file of an UploadManifest, at the walrus path Path
+type UploadManifestEntry struct {
+	Path          string   `json:"path"`
+	Size          int64    `json:"size"`
+	BlobIds       []string `json:"blobids"`
+	ContentSha256 string   `json:"sha256"`
+	// how the blobs are coded, they hold the content as it is when both are unset
+	Compression string `json:"compression,omitempty"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+}
+
+// UploadManifest returns the manifest of the walrus files at paths, as the chain records them now. Directories
+// have no content of their own and are left out, a path that doesn't exist is an error
+func (c WalrusClient) UploadManifest(ctx context.Context, paths []string) (*UploadManifest, error) {
+	manifest := &UploadManifest{Files: []UploadManifestEntry{}}
+	for _, path := range paths {
+		finfo, err := c.Stat(ctx, &connparse.Connection{Scheme: connparse.ConnectionTypeWalrus, Host: "local", Path: path})
+		if err != nil {
+			return nil, fmt.Errorf("cannot stat %s: %w", c.config.walrus_uri(path), err)
+		}
+		if finfo.NotFound {
+			return nil, typed_error(ErrNotFound, "path not found: %s", c.config.walrus_uri(path))
+		}
+		if finfo.IsDir {
+			continue
+		}
+		manifest.Files = append(manifest.Files, UploadManifestEntry{
+			Path:          path,
+			Size:          finfo.Size,
+			BlobIds:       file_blob_ids(finfo.WalrusBlobId, finfo.WalrusBlobIds),
+			ContentSha256: finfo.ContentSha256,
+			Compression:   finfo.WalrusCompression,
+			Encrypted:     finfo.WalrusEncrypted,
+		})
+	}
+	return manifest, nil
+}
+
+// Verify downloads the blobs of every file in the manifest and checks they still have the recorded size and sha256.
+// The files that fail are returned with their error by path, a blob walrus no longer stores matches
+// ErrBlobExpired. The error is only set for a manifest that can't be checked at all
+func (c WalrusClient) Verify(ctx context.Context, manifest *UploadManifest) (map[string]error, error) {
+	if manifest == nil {
+		return nil, fmt.Errorf("no upload manifest to verify")
+	}
+	failed := make(map[string]error)
+	for _, entry := range manifest.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, context.Cause(ctx)
+		}
+		if len(entry.BlobIds) == 0 || entry.ContentSha256 == "" {
+			failed[entry.Path] = fmt.Errorf("manifest entry of %s has no blobs or sha256 to check", c.config.walrus_uri(entry.Path))
+			continue
+		}
+		coding := blobCoding{compression: entry.Compression, encrypted: entry.Encrypted}
+		// the reader checks the sha256 once it reaches the end
+		r := new_blob_reader(ctx, c.config, entry.ContentSha256, coding, entry.BlobIds)
+		n, err := io.Copy(io.Discard, r)
+		r.Close()
+		if err != nil {
+			failed[entry.Path] = fmt.Errorf("cannot verify %s: %w", c.config.walrus_uri(entry.Path), err)
+		} else if n != entry.Size {
+			failed[entry.Path] = fmt.Errorf("cannot verify %s: walrus serves %d bytes, the manifest recorded %d", c.config.walrus_uri(entry.Path), n, entry.Size)
+		}
+	}
+	return failed, nil
+}
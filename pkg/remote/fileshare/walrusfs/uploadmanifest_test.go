@@ -0,0 +1,83 @@
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUploadManifest(t *testing.T) {
+	t.Parallel()
+
+	content := "hello walrus"
+	sum := sha256.Sum256([]byte(content))
+	contentSha256 := hex.EncodeToString(sum[:])
+	// serves the content as blob1, any other blob has expired
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/blobs/blob1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer aggregator.Close()
+
+	config := &WalrusFsConfig{
+		root:          "test-upload-manifest",
+		cacheTTL:      time.Hour,
+		rpcUrl:        newTestRpc(t, false).URL,
+		aggregatorUrl: aggregator.URL,
+		httpTimeout:   time.Second,
+	}
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	listings.putStat(config.root, "/dir/a.txt", &ListDirFileItem{Name: "a.txt", Size: int64(len(content)), WalrusBlobId: "blob1", ContentSha256: contentSha256}, expires)
+	listings.putStat(config.root, "/missing", nil, expires)
+	c := WalrusClient{config: config}
+	ctx := context.Background()
+
+	manifest, err := c.UploadManifest(ctx, []string{"/dir", "/dir/a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 {
+		t.Fatalf("got %+v, want only the file", manifest.Files)
+	}
+	entry := manifest.Files[0]
+	if entry.Path != "/dir/a.txt" || entry.Size != int64(len(content)) || len(entry.BlobIds) != 1 || entry.BlobIds[0] != "blob1" || entry.ContentSha256 != contentSha256 {
+		t.Errorf("got entry %+v", entry)
+	}
+	if _, err := c.UploadManifest(ctx, []string{"/missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for a missing path, want ErrNotFound", err)
+	}
+
+	if failed, err := c.Verify(ctx, manifest); err != nil || len(failed) != 0 {
+		t.Errorf("got %v, %v for an intact upload", failed, err)
+	}
+	tests := []struct {
+		name   string
+		modify func(*UploadManifestEntry)
+	}{
+		{"other content", func(e *UploadManifestEntry) { e.ContentSha256 = hex.EncodeToString(make([]byte, sha256.Size)) }},
+		{"other size", func(e *UploadManifestEntry) { e.Size++ }},
+		{"expired blob", func(e *UploadManifestEntry) { e.BlobIds = []string{"blob2"} }},
+		{"no blobs", func(e *UploadManifestEntry) { e.BlobIds = nil }},
+	}
+	for _, tc := range tests {
+		changed := entry
+		changed.Path = "/dir/b.txt"
+		tc.modify(&changed)
+		failed, err := c.Verify(ctx, &UploadManifest{Files: []UploadManifestEntry{entry, changed}})
+		if err != nil || len(failed) != 1 || failed["/dir/b.txt"] == nil {
+			t.Errorf("%s: got %v, %v, want the changed file to fail", tc.name, failed, err)
+		}
+	}
+	if _, err := c.Verify(ctx, nil); err == nil {
+		t.Errorf("got no error without a manifest")
+	}
+}
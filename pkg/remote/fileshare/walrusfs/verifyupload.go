@@ -0,0 +1,91 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package walrusfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type verifyUploadKey struct{}
+
+// WithVerifyUpload returns a context whose walrus uploads are read back from the aggregators in
+// walrusfs:verifyaggregators, or the aggregator when it is unset, and checked against what was uploaded before the
+// file is recorded on chain, or not instead of following walrusfs:verifyupload. An upload that fails the check
+// fails without being recorded
+func WithVerifyUpload(ctx context.Context, verify bool) context.Context {
+	return context.WithValue(ctx, verifyUploadKey{}, verify)
+}
+
+// is_verify_upload returns whether uploads with ctx are verified
+func (config *WalrusFsConfig) is_verify_upload(ctx context.Context) bool {
+	if verify, ok := ctx.Value(verifyUploadKey{}).(bool); ok {
+		return verify
+	}
+	return config.verifyUpload
+}
+
+// verify_upload reads the blobs of a file from every verifying aggregator and checks their content has the sha256
+// uploaded. A blob the aggregator doesn't serve yet is asked for again with backoff, since it may take a moment to
+// reach an aggregator other than the publisher's
+func verify_upload(ctx context.Context, config *WalrusFsConfig, blobIds []string, contentSha256 string, coding blobCoding) error {
+	aggregatorUrls := config.verifyAggregatorUrls
+	if len(aggregatorUrls) == 0 {
+		aggregatorUrls = []string{config.aggregatorUrl}
+	}
+	for _, aggregatorUrl := range aggregatorUrls {
+		err := retry_unavailable(ctx, func() error {
+			return verify_blobs_at(ctx, config, aggregatorUrl, blobIds, contentSha256, coding)
+		})
+		if err != nil {
+			return fmt.Errorf("aggregator %s: %w", aggregatorUrl, err)
+		}
+	}
+	return nil
+}
+
+// retry_unavailable calls fn until it succeeds or fails with something other than a blob the aggregator doesn't
+// serve, waiting with backoff between the attempts. New blobs may take a moment to reach an aggregator
+func retry_unavailable(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < PublishMaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			case <-time.After(publishRetryBaseDelay << (attempt - 1)):
+			}
+		}
+		err = fn()
+		if err == nil || !(errors.Is(err, ErrBlobExpired) || errors.Is(err, ErrBlobUnavailable)) {
+			break
+		}
+	}
+	return err
+}
+
+// verify_blobs_at checks the blobs served by the aggregator at aggregatorUrl hash to contentSha256 once coding is
+// undone
+func verify_blobs_at(ctx context.Context, config *WalrusFsConfig, aggregatorUrl string, blobIds []string, contentSha256 string, coding blobCoding) error {
+	h := sha256.New()
+	for _, blobId := range blobIds {
+		body, err := open_blob_from(ctx, config, aggregatorUrl, blobId)
+		if err != nil {
+			return err
+		}
+		if body, err = open_coded(config, coding, blobId, body); err != nil {
+			return err
+		}
+		_, err = io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return blob_unavailable(err)
+		}
+	}
+	return verify_sum(h.Sum(nil), contentSha256)
+}
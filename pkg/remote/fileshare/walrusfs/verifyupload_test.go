@@ -0,0 +1,68 @@
+package walrusfs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVerifyUpload(t *testing.T) {
+	defer func(delay time.Duration) { publishRetryBaseDelay = delay }(publishRetryBaseDelay)
+	publishRetryBaseDelay = time.Millisecond
+
+	var requests atomic.Int32
+	var body atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &body)
+	newAggregator := func(content string, misses int32) (*httptest.Server, *atomic.Int32) {
+		var gets atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// a new blob may not have reached the aggregator yet
+			if gets.Add(1) <= misses {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(content))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &gets
+	}
+	good, goodGets := newAggregator("hello walrus", 0)
+	late, lateGets := newAggregator("hello walrus", 2)
+	corrupt, _ := newAggregator("hello w4lrus", 0)
+
+	config := &WalrusFsConfig{publisherUrls: []string{publisher.URL}, aggregatorUrl: good.URL, httpTimeout: time.Second}
+	publish := func(ctx context.Context) error {
+		_, err := publish_file(ctx, config, strings.NewReader("hello walrus"), 12, "/a.txt", nil, 0, false, 0)
+		return err
+	}
+
+	// off by default
+	if err := publish(context.Background()); err != nil || goodGets.Load() != 0 {
+		t.Fatalf("got %v with %d aggregator reads, want no verification", err, goodGets.Load())
+	}
+	// the aggregator verifies when no others are set
+	if err := publish(WithVerifyUpload(context.Background(), true)); err != nil || goodGets.Load() != 1 {
+		t.Errorf("got %v with %d aggregator reads, want one verification", err, goodGets.Load())
+	}
+
+	config.verifyUpload = true
+	config.verifyAggregatorUrls = []string{good.URL, late.URL}
+	if err := publish(context.Background()); err != nil {
+		t.Errorf("verification failed: %v", err)
+	}
+	if lateGets.Load() != 3 {
+		t.Errorf("got %d reads from the late aggregator, want it asked until it has the blob", lateGets.Load())
+	}
+
+	config.verifyAggregatorUrls = []string{good.URL, corrupt.URL}
+	if err := publish(context.Background()); err == nil || !strings.Contains(err.Error(), "checksum mismatch") || !strings.Contains(err.Error(), corrupt.URL) {
+		t.Errorf("got error %v, want a checksum mismatch from the corrupt aggregator", err)
+	}
+	if err := publish(WithVerifyUpload(context.Background(), false)); err != nil {
+		t.Errorf("got error %v with verification turned off", err)
+	}
+}
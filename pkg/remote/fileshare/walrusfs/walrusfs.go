@@ -10,19 +10,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/block-vision/sui-go-sdk/sui"
 	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
 	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
 	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fstype"
 	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fsutil"
-	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/pathtree"
 	"github.com/wavetermdev/waveterm/pkg/util/fileutil"
 	"github.com/wavetermdev/waveterm/pkg/util/iochan/iochantypes"
 	"github.com/wavetermdev/waveterm/pkg/util/tarcopy"
@@ -30,17 +32,116 @@ import (
 	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
 )
 
 type WalrusFsConfig struct {
-	pkg           string
-	root          string
-	publisherUrl  string
+	pkg  string
+	root string
+	// the root objects of walrus:roots by name, listed as top level directories and routed to by
+	// NewWalrusClientForConn
+	roots map[string]string
+	// the name of the named root this config was routed to, its uris are under walrus:///<rootName>. Empty for
+	// walrus:root
+	rootName string
+	// uploads go to the first publisher and fail over to the others in order
+	publisherUrls []string
 	aggregatorUrl string
-	mnemonic      string
-	wallet        string
+	// the mnemonic setting, only used when mnemonicSource is config
+	mnemonic       secretString
+	mnemonicSource string
+	wallet         string
+	rpcUrl         string
+	storageEpochs  int
+	// whether uploads store deletable blobs, unless their context comes from WithDeletable
+	deletable bool
+	// whether uploaded blobs are read back before they are recorded, unless their context comes from
+	// WithVerifyUpload. They are read from verifyAggregatorUrls, or the aggregator when there are none
+	verifyUpload         bool
+	verifyAggregatorUrls []string
+	// whether uploads look for the same content at the destination first, unless their context comes from
+	// WithDedupUpload
+	dedupUploads bool
+	// whether transactions are waited for until they are checkpointed, unless their context comes from
+	// WithWaitFinality
+	waitFinality bool
+	// a file is reported as expiring when fewer than this many epochs are left
+	expiryWarnEpochs int
+	// the walrus staking object, read for the network's epochs
+	stakingObject string
+	// the walrus system object, read for the network's capacity and prices
+	systemObject string
+	// a read only config never signs a transaction or publishes a blob, mutations fail with ErrReadOnly
+	readOnly bool
+
+	// the sui client, the signer derived from the mnemonic and the http client are created lazily and reused until
+	// Close, lazyLock guards them
+	lazyLock      sync.Mutex
+	suiClient     sui.ISuiAPI
+	signerDone    bool
+	signerAccount Signer
+	signerErr     error
+	httpClient    *http.Client
+	// signs instead of the mnemonic when set
+	txSigner Signer
+	// uploads are encrypted with a key derived from it when set, and encrypted files can only be read with it
+	encryptionKey secretString
+	// the algorithm uploads are compressed with unless WithCompression says otherwise, CompressionNone for none
+	compression string
+
+	// timeout for publisher and aggregator requests, including reading the body
+	httpTimeout time.Duration
+	// receives a record of each operation when set
+	metrics Metrics
+
+	// limit the bytes sent to publishers and read from the aggregator, nil is no limit
+	uploadLimiter   *rate.Limiter
+	downloadLimiter *rate.Limiter
+
+	// retries of transient failures when executing or inspecting transactions
+	retryPolicy RetryPolicy
+
+	// how long stat and directory listing results are served from the listing cache, zero disables it
+	cacheTTL time.Duration
+
+	// number of blobs downloaded at once by a recursive copy
+	copyConcurrency int
+
+	// number of blobs fetched ahead of the one being written when reading a directory as a tar
+	prefetchDepth int
+
+	// files larger than this are stored as several blobs
+	chunkSize int64
+
+	// largest file that is uploaded, zero leaves uploads unlimited
+	maxUploadSize int64
+
+	// gas budget in MIST for move calls that are not given one with WithGasBudget, zero estimates it with a dry run
+	gasBudget uint64
+
+	// gas price in MIST per unit of gas for transactions that are not given one with WithGasPrice, zero pays the
+	// reference gas price
+	gasPrice uint64
+
+	// the latest walrus epoch publishers reported to this config, the current epoch when there is no staking object
+	// to read it from
+	epochLock  sync.Mutex
+	knownEpoch int64
 }
 
+const DefaultExpiryWarnEpochs = 2
+const DefaultCopyConcurrency = 8
+const DefaultPrefetchDepth = 4
+
+// MaxPrefetchDepth bounds walrusfs:prefetchdepth, the files fetched ahead are held in memory
+const MaxPrefetchDepth = 16
+
+const DefaultHttpTimeout = 5 * time.Minute
+
+// WalrusClient is safe for concurrent use. Its config isn't changed once the client is made, apart from the
+// lazily created clients and the known epoch which are guarded by locks, and the listing cache shared by all
+// clients has a lock of its own
 type WalrusClient struct {
 	config *WalrusFsConfig
 }
@@ -50,21 +151,221 @@ var _ fstype.FileShareClient = WalrusClient{}
 func GetConfig() *WalrusFsConfig {
 	fullConfig := wconfig.GetWatcher().GetFullConfig()
 
+	set_log_level(fullConfig.Settings.WalrusFsLogLevel)
+
 	var config WalrusFsConfig
 	config.pkg = fullConfig.Settings.WalrusFsPackage
 	config.root = fullConfig.Settings.WalrusFsRoot
-	config.publisherUrl = fullConfig.Settings.WalrusFsPublisher
+	config.roots = fullConfig.Settings.WalrusFsRoots
+	for _, url := range append([]string{fullConfig.Settings.WalrusFsPublisher}, fullConfig.Settings.WalrusFsPublishers...) {
+		if url != "" && !slices.Contains(config.publisherUrls, url) {
+			config.publisherUrls = append(config.publisherUrls, url)
+		}
+	}
 	config.aggregatorUrl = fullConfig.Settings.WalrusFsAggregator
-	config.mnemonic = fullConfig.Settings.WalrusFsMnemonic
-	config.wallet = fullConfig.Settings.WalrusFsWaallet
+	config.mnemonic = secretString(fullConfig.Settings.WalrusFsMnemonic)
+	config.mnemonicSource = fullConfig.Settings.WalrusFsMnemonicSource
+	config.encryptionKey = secretString(fullConfig.Settings.WalrusFsEncryptionKey)
+	config.compression = fullConfig.Settings.WalrusFsCompression
+	config.txSigner = getCustomSigner()
+	config.metrics = getCustomMetrics()
+	config.wallet = fullConfig.Settings.WalrusFsWallet
+	config.rpcUrl = fullConfig.Settings.WalrusFsRpcUrl
+	config.stakingObject = fullConfig.Settings.WalrusFsStakingObject
+	config.systemObject = fullConfig.Settings.WalrusFsSystemObject
+	config.storageEpochs = fullConfig.Settings.WalrusFsStorageEpochs
+	config.deletable = fullConfig.Settings.WalrusFsDeletable
+	config.verifyUpload = fullConfig.Settings.WalrusFsVerifyUpload
+	config.verifyAggregatorUrls = fullConfig.Settings.WalrusFsVerifyAggregators
+	config.dedupUploads = fullConfig.Settings.WalrusFsDedupUploads
+	config.waitFinality = fullConfig.Settings.WalrusFsWaitFinality
+	config.readOnly = fullConfig.Settings.WalrusFsReadOnly
+	config.expiryWarnEpochs = fullConfig.Settings.WalrusFsExpiryWarnEpochs
+	if config.expiryWarnEpochs <= 0 {
+		config.expiryWarnEpochs = DefaultExpiryWarnEpochs
+	}
+	config.httpTimeout = time.Duration(fullConfig.Settings.WalrusFsHttpTimeoutMs) * time.Millisecond
+	if config.httpTimeout <= 0 {
+		config.httpTimeout = DefaultHttpTimeout
+	}
+	config.uploadLimiter = set_shared_limit(sharedUploadLimiter, fullConfig.Settings.WalrusFsUploadBytesPerSec)
+	config.downloadLimiter = set_shared_limit(sharedDownloadLimiter, fullConfig.Settings.WalrusFsDownloadBytesPerSec)
+	config.retryPolicy = DefaultRetryPolicy()
+	if fullConfig.Settings.WalrusFsTxRetryMaxAttempts > 0 {
+		config.retryPolicy.MaxAttempts = fullConfig.Settings.WalrusFsTxRetryMaxAttempts
+	}
+	if fullConfig.Settings.WalrusFsTxRetryBaseDelayMs > 0 {
+		config.retryPolicy.BaseDelay = time.Duration(fullConfig.Settings.WalrusFsTxRetryBaseDelayMs * float64(time.Millisecond))
+	}
+	if fullConfig.Settings.WalrusFsTxRetryJitter > 0 {
+		config.retryPolicy.Jitter = min(fullConfig.Settings.WalrusFsTxRetryJitter, 1)
+	}
+	config.cacheTTL = time.Duration(fullConfig.Settings.WalrusFsCacheTtlMs * float64(time.Millisecond))
+	config.copyConcurrency = fullConfig.Settings.WalrusFsCopyConcurrency
+	config.chunkSize = int64(fullConfig.Settings.WalrusFsChunkSizeMb) * 1024 * 1024
+	config.maxUploadSize = int64(fullConfig.Settings.WalrusFsMaxUploadSizeMb) * 1024 * 1024
+	if fullConfig.Settings.WalrusFsGasBudget > 0 {
+		config.gasBudget = uint64(fullConfig.Settings.WalrusFsGasBudget)
+	}
+	if fullConfig.Settings.WalrusFsGasPrice > 0 {
+		config.gasPrice = uint64(fullConfig.Settings.WalrusFsGasPrice)
+	}
+	if config.copyConcurrency <= 0 {
+		config.copyConcurrency = DefaultCopyConcurrency
+	}
+	config.prefetchDepth = fullConfig.Settings.WalrusFsPrefetchDepth
+	if config.prefetchDepth <= 0 {
+		config.prefetchDepth = DefaultPrefetchDepth
+	}
+	config.prefetchDepth = min(config.prefetchDepth, MaxPrefetchDepth)
 
 	return &config
 }
 
-func NewWalrusClient() *WalrusClient {
+// Validate checks the settings are usable before any request is made, every problem found is reported
+func (config *WalrusFsConfig) Validate() error {
+	var errs []error
+	if !is_object_id(config.pkg) {
+		errs = append(errs, fmt.Errorf("walrusfs:package %q is not a sui object id, expected 0x followed by 64 hex digits", config.pkg))
+	}
+	if !is_object_id(config.root) {
+		errs = append(errs, fmt.Errorf("walrusfs:root %q is not a sui object id, expected 0x followed by 64 hex digits", config.root))
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.roots)) {
+		if err := validate_root_name(name); err != nil {
+			errs = append(errs, fmt.Errorf("walrusfs:roots: %w", err))
+		}
+		if !is_object_id(config.roots[name]) {
+			errs = append(errs, fmt.Errorf("walrusfs:roots %q is %q, which is not a sui object id, expected 0x followed by 64 hex digits", name, config.roots[name]))
+		}
+	}
+	// a read only client never uploads
+	if len(config.publisherUrls) == 0 && !config.readOnly {
+		errs = append(errs, fmt.Errorf("walrusfs:publisher is not set"))
+	}
+	for _, publisherUrl := range config.publisherUrls {
+		if err := validate_url("walrusfs:publisher", publisherUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validate_url("walrusfs:aggregator", config.aggregatorUrl); err != nil {
+		errs = append(errs, err)
+	}
+	for _, aggregatorUrl := range config.verifyAggregatorUrls {
+		if err := validate_url("walrusfs:verifyaggregators", aggregatorUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validate_compression(config.compression); err != nil {
+		errs = append(errs, fmt.Errorf("walrusfs:compression: %w", err))
+	}
+	if config.encryptionKey != "" {
+		if _, err := encryption_key(config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// an unset rpc url uses the testnet endpoint
+	if config.rpcUrl != "" {
+		if err := validate_url("walrusfs:rpcurl", config.rpcUrl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if config.stakingObject != "" && !is_object_id(config.stakingObject) {
+		errs = append(errs, fmt.Errorf("walrusfs:stakingobject %q is not a sui object id, expected 0x followed by 64 hex digits", config.stakingObject))
+	}
+	if config.systemObject != "" && !is_object_id(config.systemObject) {
+		errs = append(errs, fmt.Errorf("walrusfs:systemobject %q is not a sui object id, expected 0x followed by 64 hex digits", config.systemObject))
+	}
+	if config.wallet != "" && !is_object_id(normalize_address(config.wallet)) {
+		errs = append(errs, fmt.Errorf("walrusfs:wallet %q is not a sui address", config.wallet))
+	}
+	if config.txSigner == nil {
+		kind, _, _ := strings.Cut(config.mnemonicSource, ":")
+		switch kind {
+		case "", MnemonicSourceConfig:
+			// dev inspect calls only need an address to run as, so a wallet without a mnemonic can still read.
+			// Transactions fail when they need the signer
+			if config.mnemonic == "" && config.wallet == "" {
+				errs = append(errs, fmt.Errorf("walrusfs:mnemonic is not set, set it or walrusfs:wallet to read without one"))
+			}
+		case MnemonicSourceEnv, MnemonicSourceFile, MnemonicSourceKeychain:
+			// read when the signer is first needed
+		default:
+			errs = append(errs, fmt.Errorf("unknown walrusfs:mnemonicsource %q, expected config, env, file or keychain", kind))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validate_url(key string, value string) error {
+	if value == "" {
+		return fmt.Errorf("%s is not set", key)
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%s %q is not a valid url: %w", key, value, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s %q must be an http or https url", key, value)
+	}
+	return nil
+}
+
+func NewWalrusClient() (*WalrusClient, error) {
+	return newWalrusClient(GetConfig())
+}
+
+// NewReadOnlyWalrusClient returns a client that can stat, list and read but not change anything, whatever
+// walrusfs:readonly is set to. It only needs a mnemonic when walrusfs:wallet isn't set
+func NewReadOnlyWalrusClient() (*WalrusClient, error) {
+	config := GetConfig()
+	config.readOnly = true
+	return newWalrusClient(config)
+}
+
+func newWalrusClient(config *WalrusFsConfig) (*WalrusClient, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid walrusfs config: %w", err)
+	}
+	if config.wallet == "" || !config.readOnly {
+		config.resolve_wallet()
+	}
 	return &WalrusClient{
-		config: GetConfig(),
+		config: config,
+	}, nil
+}
+
+// Close closes the idle publisher and aggregator connections of the client and drops its sui client and the signer
+// derived from the mnemonic, a client used after Close creates them again. Requests already running finish with the
+// clients they have. The listing cache of the client's root is cleared too, other roots keep theirs
+func (c WalrusClient) Close() error {
+	config := c.config
+	config.lazyLock.Lock()
+	defer config.lazyLock.Unlock()
+	if config.httpClient != nil {
+		config.httpClient.CloseIdleConnections()
+	}
+	config.httpClient = nil
+	config.suiClient = nil
+	config.signerDone = false
+	config.signerAccount = nil
+	config.signerErr = nil
+	// invalidating the root directory drops everything below it
+	listings.invalidate(config.root, "/")
+	return nil
+}
+
+// ReadOnly reports whether the client refuses mutations with ErrReadOnly
+func (c WalrusClient) ReadOnly() bool {
+	return c.config.readOnly
+}
+
+// check_writable returns ErrReadOnly for a read only client, mutations call it before touching the chain
+func (c WalrusClient) check_writable() error {
+	if c.config.readOnly {
+		return ErrReadOnly
 	}
+	return nil
 }
 
 func (c WalrusClient) Read(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) (*wshrpc.FileData, error) {
@@ -73,32 +374,23 @@ func (c WalrusClient) Read(ctx context.Context, conn *connparse.Connection, data
 }
 
 func (c WalrusClient) ReadStream(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) <-chan wshrpc.RespOrErrorUnion[wshrpc.FileData] {
+	return record_stream(c.config, OpRead, c.readStream(ctx, conn, data), func(d wshrpc.FileData) int64 { return base64_size(d.Data64) })
+}
+
+func (c WalrusClient) readStream(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) <-chan wshrpc.RespOrErrorUnion[wshrpc.FileData] {
 	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.FileData], 16)
 	go func() {
 		defer close(rtn)
-		finfo, err := c.Stat(ctx, conn)
+		finfo, err := c.statPath(ctx, conn)
 		if err != nil {
 			rtn <- wshutil.RespErr[wshrpc.FileData](err)
 			return
 		} else if finfo.NotFound {
-			rtn <- wshutil.RespErr[wshrpc.FileData](errors.New("no such file"))
+			// a missing path is an error whether it was meant as a file or a directory, there is nothing to show
+			rtn <- wshutil.RespErr[wshrpc.FileData](typed_error(ErrNotFound, "path not found: %s", conn.GetFullURI()))
 			return
 		}
 		rtn <- wshrpc.RespOrErrorUnion[wshrpc.FileData]{Response: wshrpc.FileData{Info: finfo}}
-		if finfo.NotFound {
-			rtn <- wshrpc.RespOrErrorUnion[wshrpc.FileData]{Response: wshrpc.FileData{Entries: []*wshrpc.FileInfo{
-				{
-					Path:     finfo.Dir,
-					Dir:      fspath.Dir(finfo.Dir),
-					Name:     "..",
-					IsDir:    true,
-					Size:     0,
-					ModTime:  time.Now().Unix(),
-					MimeType: "directory",
-				},
-			}}}
-			return
-		}
 		if finfo.IsDir {
 			listEntriesCh := c.ListEntriesStream(ctx, conn, nil)
 			defer func() {
@@ -116,29 +408,48 @@ func (c WalrusClient) ReadStream(ctx context.Context, conn *connparse.Connection
 			}
 		} else {
 			if data.At != nil {
-				log.Printf("reading %v with offset %d and size %d", conn.GetFullURI(), data.At.Offset, data.At.Size)
+				logger.Debug("partial reads are not supported", "op", "read", "path", conn.GetFullURI(), "offset", data.At.Offset, "size", data.At.Size)
 				rtn <- wshutil.RespErr[wshrpc.FileData](errors.New("can't read partial file"))
+				return
 			}
 
-			b, err := get_file(c.config, finfo.WalrusBlobId)
+			var b []byte
+			getFile := func() error {
+				b, err = get_file(ctx, c.config, finfo.ContentSha256, info_coding(finfo), file_blob_ids(finfo.WalrusBlobId, finfo.WalrusBlobIds)...)
+				return err
+			}
+			if finfo.WalrusCertified {
+				err = getFile()
+			} else {
+				// the blobs of a pending file may not have reached the aggregator yet
+				err = retry_unavailable(ctx, getFile)
+			}
+			if err != nil && !finfo.WalrusCertified && (errors.Is(err, ErrBlobExpired) || errors.Is(err, ErrBlobUnavailable)) {
+				err = fmt.Errorf("%s is pending certification on walrus and can't be read yet, try again later: %w", conn.GetFullURI(), err)
+			} else if errors.Is(err, ErrBlobExpired) {
+				err = fmt.Errorf("%s is no longer stored on walrus, its storage ran until epoch %d: %w", conn.GetFullURI(), finfo.WalrusEpochTill, err)
+			} else if errors.Is(err, ErrBlobUnavailable) {
+				err = fmt.Errorf("%s can't be read from the walrus aggregator right now: %w", conn.GetFullURI(), err)
+			}
 			if err != nil {
 				rtn <- wshutil.RespErr[wshrpc.FileData](err)
 				return
 			}
 
-			fullpath := conn.GetFullURI()
+			// the canonical uris of the stat, the connection path may lack its leading slash
 			finfo := &wshrpc.FileInfo{
-				Name:    finfo.Name,
-				IsDir:   false,
-				Size:    finfo.Size,
-				ModTime: finfo.ModTime,
-				Path:    fullpath,
-				Dir:     fsutil.GetParentPathString(fullpath),
+				Name:     finfo.Name,
+				IsDir:    false,
+				Size:     finfo.Size,
+				ModTime:  finfo.ModTime,
+				Path:     finfo.Path,
+				Dir:      finfo.Dir,
+				MimeType: finfo.MimeType,
 			}
 			fileutil.AddMimeTypeToFileInfo(finfo.Path, finfo)
 			rtn <- wshrpc.RespOrErrorUnion[wshrpc.FileData]{Response: wshrpc.FileData{Info: finfo}}
 			if finfo.Size == 0 {
-				log.Printf("no data to read")
+				logger.Debug("no data to read", "op", "read", "path", conn.GetFullURI())
 				return
 			}
 
@@ -148,59 +459,123 @@ func (c WalrusClient) ReadStream(ctx context.Context, conn *connparse.Connection
 	return rtn
 }
 
+// BlobAvailable reports whether the aggregator can serve a blob, a blob that expired or was never stored is not
+// available. The error is set when the aggregator can't be asked, it then matches ErrBlobUnavailable
+func (c WalrusClient) BlobAvailable(ctx context.Context, blobId string) (bool, error) {
+	return blob_available(ctx, c.config, blobId)
+}
+
+// ShareLink returns the aggregator url of the walrus file conn, which anyone can download the file from without a
+// sui client. Directories and files stored as several blobs have no single url, and neither do encrypted or
+// compressed files, whose blob isn't the content. With checkAvailable the aggregator is asked first, a blob it
+// doesn't have any more fails with ErrBlobExpired
+func (c WalrusClient) ShareLink(ctx context.Context, conn *connparse.Connection, checkAvailable bool) (string, error) {
+	finfo, err := c.statPath(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	if finfo.NotFound {
+		return "", typed_error(ErrNotFound, "file not found: %s", conn.GetFullURI())
+	}
+	if finfo.IsDir {
+		return "", fmt.Errorf("cannot share directory %q, only files have a link", conn.Path)
+	}
+	if blobIds := file_blob_ids(finfo.WalrusBlobId, finfo.WalrusBlobIds); len(blobIds) != 1 {
+		return "", fmt.Errorf("cannot share %q, it is stored as %d blobs", conn.Path, len(blobIds))
+	}
+	if finfo.WalrusEncrypted {
+		return "", fmt.Errorf("cannot share %q, it is stored encrypted and the link would only serve the ciphertext", conn.Path)
+	}
+	if finfo.WalrusCompression != CompressionNone {
+		return "", fmt.Errorf("cannot share %q, it is stored compressed with %s and the link would serve the compressed blob", conn.Path, finfo.WalrusCompression)
+	}
+	if checkAvailable {
+		available, err := blob_available(ctx, c.config, finfo.WalrusBlobId)
+		if err != nil {
+			return "", err
+		}
+		if !available {
+			return "", typed_error(ErrBlobExpired, "blob %s of %q is not available from the aggregator, it may have expired", finfo.WalrusBlobId, conn.Path)
+		}
+	}
+	return blob_url(c.config.aggregatorUrl, finfo.WalrusBlobId), nil
+}
+
+// ReadBlob returns the content of a walrus blob, read from the aggregator without looking up any path on chain.
+// The blob of an encrypted or compressed file is returned as it is stored, and a file stored as several blobs
+// needs each of them
+func (c WalrusClient) ReadBlob(ctx context.Context, blobId string) ([]byte, error) {
+	if err := check_blob_id(blobId); err != nil {
+		return nil, err
+	}
+	return get_file(ctx, c.config, "", blobCoding{compression: CompressionNone}, blobId)
+}
+
+// ReadBlobStream is ReadBlob for content too large to hold in memory, the caller reads and closes the returned body
+func (c WalrusClient) ReadBlobStream(ctx context.Context, blobId string) (io.ReadCloser, error) {
+	if err := check_blob_id(blobId); err != nil {
+		return nil, err
+	}
+	return open_blob(ctx, c.config, blobId)
+}
+
+// check_blob_id rejects what can't be a walrus blob id before it ends up in an aggregator url
+func check_blob_id(blobId string) error {
+	if blobId == "" || strings.ContainsAny(blobId, "/?#") {
+		return fmt.Errorf("invalid walrus blob id %q", blobId)
+	}
+	return nil
+}
+
 func (c WalrusClient) ReadTarStream(ctx context.Context, conn *connparse.Connection, opts *wshrpc.FileCopyOpts) <-chan wshrpc.RespOrErrorUnion[iochantypes.Packet] {
 	recursive := opts != nil && opts.Recursive
-	bucket := conn.Host
-	if bucket == "" || bucket == "/" {
-		return wshutil.SendErrCh[iochantypes.Packet](fmt.Errorf("bucket must be specified"))
-	}
 
-	// whether the operation is on the whole bucket
-	wholeBucket := conn.Path == "" || conn.Path == fspath.Separator
+	// whether the operation is on the whole walrus root
+	wholeRoot := conn.Path == "" || conn.Path == fspath.Separator
+	dirPath := strings.TrimSuffix(conn.Path, fspath.Separator)
 
-	// get the object if it's a single file operation
-	var singleFileResult *s3.GetObjectOutput
-	// this ensures we don't leak the object if we error out before copying it
-	closeSingleFileResult := true
-	defer func() {
-		// in case we error out before the object gets copied, make sure to close it
-		if singleFileResult != nil && closeSingleFileResult {
-			utilfn.GracefulClose(singleFileResult.Body, "s3fs", conn.Path)
+	// stat the path if it's not the root so we know whether it's a single file operation
+	var singleFileInfo *wshrpc.FileInfo
+	if !wholeRoot {
+		finfo, err := c.statPath(ctx, conn)
+		if err != nil {
+			return wshutil.SendErrCh[iochantypes.Packet](fmt.Errorf("error getting file info: %w", err))
+		}
+		if finfo.NotFound {
+			return wshutil.SendErrCh[iochantypes.Packet](typed_error(ErrNotFound, "file not found: %s", conn.GetFullURI()))
+		}
+		if !finfo.IsDir {
+			singleFileInfo = finfo
 		}
-	}()
-	if !wholeBucket {
 	}
 
 	// whether the operation is on a single file
-	singleFile := singleFileResult != nil
+	singleFile := singleFileInfo != nil
 
 	if !singleFile && !recursive {
 		return wshutil.SendErrCh[iochantypes.Packet](fmt.Errorf(fstype.RecursiveRequiredError))
 	}
 
 	// whether to include the directory itself in the tar
-	includeDir := (wholeBucket && conn.Path == "") || (singleFileResult == nil && conn.Path != "" && !strings.HasSuffix(conn.Path, fspath.Separator))
+	includeDir := !singleFile && !wholeRoot && !strings.HasSuffix(conn.Path, fspath.Separator)
 
 	timeout := fstype.DefaultTimeout
-	if opts.Timeout > 0 {
+	if opts != nil && opts.Timeout > 0 {
 		timeout = time.Duration(opts.Timeout) * time.Millisecond
 	}
-	readerCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	// the blob reads stop with ctx, a copy to another remote cancels it when a write fails
+	readerCtx, cancel := context.WithTimeout(ctx, timeout)
 
 	// the prefix that should be removed from the tar paths
-	tarPathPrefix := conn.Path
-
-	if wholeBucket {
-		// we treat the bucket name as the root directory. If we're not including the directory itself, we need to remove the bucket name from the tar paths
-		if includeDir {
-			tarPathPrefix = ""
-		} else {
-			tarPathPrefix = bucket
-		}
-	} else if singleFile || includeDir {
+	tarPathPrefix := dirPath
+	if singleFile || includeDir {
 		// if we're including the directory itself, we need to remove the last part of the path
 		tarPathPrefix = fsutil.GetParentPathString(tarPathPrefix)
 	}
+	if tarPathPrefix == "" {
+		// walrus paths are absolute, so the shortest prefix is the root itself
+		tarPathPrefix = fspath.Separator
+	}
 
 	rtn, writeHeader, fileWriter, tarClose := tarcopy.TarCopySrc(readerCtx, tarPathPrefix)
 	go func() {
@@ -208,106 +583,88 @@ func (c WalrusClient) ReadTarStream(ctx context.Context, conn *connparse.Connect
 			tarClose()
 			cancel()
 		}()
-
-		// below we get the objects concurrently so we need to store the results in a map
-		objMap := make(map[string]*s3.GetObjectOutput)
-		// close the objects when we're done
-		defer func() {
-			for key, obj := range objMap {
-				utilfn.GracefulClose(obj.Body, "s3fs", key)
-			}
-		}()
-
-		// tree to keep track of the paths we've added and insert fake directories for subpaths
-		tree := pathtree.NewTree(tarPathPrefix, "/")
-
-		if singleFile {
-			objMap[conn.Path] = singleFileResult
-			tree.Add(conn.Path)
-		} else {
-			// list the objects in the bucket and add them to a tree that we can then walk to write the tar entries
-			var input *s3.ListObjectsV2Input
-			if wholeBucket {
-				// get all the objects in the bucket
-				input = &s3.ListObjectsV2Input{
-					Bucket: aws.String(bucket),
-				}
-			} else {
-				objectPrefix := conn.Path
-				if !strings.HasSuffix(objectPrefix, fspath.Separator) {
-					objectPrefix = objectPrefix + fspath.Separator
-				}
-				input = &s3.ListObjectsV2Input{
-					Bucket: aws.String(bucket),
-					Prefix: aws.String(objectPrefix),
-				}
-			}
-
-			errs := make([]error, 0)
-			// wait group to await the finished fetches
-			wg := sync.WaitGroup{}
-			getObjectAndFileInfo := func(obj *ListDirFileItem) {
-				defer wg.Done()
-			}
-
-			if err := c.listFilesPrefix(ctx, *input.Prefix, func(obj *ListDirFileItem) (bool, error) {
-				wg.Add(1)
-				go getObjectAndFileInfo(obj)
-				return true, nil
-			}); err != nil {
+		// sendErr reports err unless readerCtx is done, rtn is closed by then and nobody reads it
+		sendErr := func(err error) {
+			if readerCtx.Err() == nil {
 				rtn <- wshutil.RespErr[iochantypes.Packet](err)
-				return
-			}
-			wg.Wait()
-			if len(errs) > 0 {
-				rtn <- wshutil.RespErr[iochantypes.Packet](errors.Join(errs...))
-				return
 			}
 		}
 
-		// Walk the tree and write the tar entries
-		if err := tree.Walk(func(path string, numChildren int) error {
-			mapEntry, isFile := objMap[path]
-
-			// default vals assume entry is dir, since mapEntry might not exist
-			modTime := int64(time.Now().Unix())
-			mode := fstype.DirMode
-			size := int64(numChildren)
-
-			if isFile {
-				mode = fstype.FileMode
-				size = *mapEntry.ContentLength
-				if mapEntry.LastModified != nil {
-					modTime = mapEntry.LastModified.UnixMilli()
-				}
-			}
-
+		// writeEntry writes the tar entry of path with the content read from r, item is nil for the directory itself
+		writeEntry := func(path string, item *ListDirFileItem, r io.Reader) error {
 			finfo := &wshrpc.FileInfo{
 				Name:    path,
-				IsDir:   !isFile,
-				Size:    size,
-				ModTime: modTime,
-				Mode:    mode,
+				IsDir:   true,
+				ModTime: time.Now().UnixMilli(),
+				Mode:    fstype.DirMode,
+			}
+			if item != nil && !item.IsDir {
+				finfo.IsDir = false
+				finfo.Size = item.Size
+				finfo.ModTime = item.CreateTs
+				finfo.Mode = fstype.FileMode
 			}
 			if err := writeHeader(fileutil.ToFsFileInfo(finfo), path, singleFile); err != nil {
 				return err
 			}
-			if isFile {
-				if n, err := io.Copy(fileWriter, mapEntry.Body); err != nil {
-					return err
-				} else if n != size {
-					return fmt.Errorf("error copying %v; expected to read %d bytes, but read %d", path, size, n)
-				}
+			if finfo.IsDir {
+				return nil
+			}
+			if n, err := io.Copy(fileWriter, r); err != nil {
+				return err
+			} else if n != finfo.Size {
+				return fmt.Errorf("error copying %v; expected to read %d bytes, but read %d", path, finfo.Size, n)
 			}
 			return nil
-		}); err != nil {
-			log.Printf("error walking tree: %v", err)
-			rtn <- wshutil.RespErr[iochantypes.Packet](err)
+		}
+
+		if singleFile {
+			// a single file is streamed, there is nothing to fetch ahead of it
+			r := new_blob_reader(readerCtx, c.config, singleFileInfo.ContentSha256, info_coding(singleFileInfo), file_blob_ids(singleFileInfo.WalrusBlobId, singleFileInfo.WalrusBlobIds))
+			defer r.Close()
+			item := &ListDirFileItem{
+				Name:     singleFileInfo.Name,
+				CreateTs: singleFileInfo.ModTime,
+				Size:     singleFileInfo.Size,
+			}
+			if err := writeEntry(dirPath, item, r); err != nil {
+				sendErr(err)
+			}
 			return
 		}
+
+		if includeDir {
+			if err := writeEntry(dirPath, nil, nil); err != nil {
+				sendErr(err)
+				return
+			}
+		}
+		// the entries come in walk order while the blobs of the next ones are fetched
+		fetches, walkErr := c.prefetchTree(readerCtx, dirPath)
+		for f := range fetches {
+			<-f.done
+			if f.err != nil {
+				sendErr(fmt.Errorf("error reading %s: %w", f.path, f.err))
+				return
+			}
+			var err error
+			if f.stream {
+				r := new_blob_reader(readerCtx, c.config, f.item.ContentSha256, item_coding(f.item), file_blob_ids(f.item.WalrusBlobId, f.item.WalrusBlobIds))
+				err = writeEntry(f.path, f.item, r)
+				r.Close()
+			} else {
+				err = writeEntry(f.path, f.item, bytes.NewReader(f.data))
+			}
+			if err != nil {
+				logger.Debug("cannot write tar entry", "op", "read_tar", "path", f.path, "err", err)
+				sendErr(err)
+				return
+			}
+		}
+		if err := walkErr(); err != nil {
+			sendErr(err)
+		}
 	}()
-	// we've handed singleFileResult off to the tar writer, so we don't want to close it
-	closeSingleFileResult = false
 	return rtn
 }
 
@@ -324,109 +681,189 @@ func (c WalrusClient) ListEntries(ctx context.Context, conn *connparse.Connectio
 	return entries, nil
 }
 
+// ListEntriesStream lists a walrus directory, one level or with opts.Recursive the whole subtree, ordered by path
+// unless the sort options of opts ask for another order. opts.Limit bounds the number of entries in the whole
+// response rather than in each chunk, it defaults to wshrpc.MaxDirSize and can't go above it. Entries are sent in
+// chunks of at most wshrpc.DirChunkSize, when the limit cuts the listing short the last chunk is marked truncated
+// and carries the cursor to pass as opts.Cursor for the next page
 func (c WalrusClient) ListEntriesStream(ctx context.Context, conn *connparse.Connection, opts *wshrpc.FileListOpts) <-chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteListEntriesRtnData] {
-	dirPrefix := conn.Path
-	if dirPrefix != "" && !strings.HasSuffix(dirPrefix, fspath.Separator) {
-		dirPrefix = dirPrefix + "/"
+	return record_stream(c.config, OpListEntries, c.listEntriesStream(ctx, conn, opts), nil)
+}
+
+func (c WalrusClient) listEntriesStream(ctx context.Context, conn *connparse.Connection, opts *wshrpc.FileListOpts) <-chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteListEntriesRtnData] {
+	dirPath := fspath.Join(fspath.Separator, conn.Path)
+	limit := wshrpc.MaxDirSize
+	cursor := ""
+	recursive := false
+	if opts != nil {
+		if opts.Limit > 0 {
+			limit = min(opts.Limit, wshrpc.MaxDirSize)
+		}
+		cursor = opts.Cursor
+		recursive = opts.Recursive
+	}
+	order, err := list_order(opts)
+	if err != nil {
+		return wshutil.SendErrCh[wshrpc.CommandRemoteListEntriesRtnData](err)
 	}
-	numToFetch := wshrpc.MaxDirSize
-	if opts != nil && opts.Limit > 0 {
-		numToFetch = min(opts.Limit, wshrpc.MaxDirSize)
+	var cursorPath string
+	var cursorItem *ListDirFileItem
+	if cursor != "" {
+		if cursorPath, cursorItem, err = order.parse_cursor(cursor); err != nil {
+			return wshutil.SendErrCh[wshrpc.CommandRemoteListEntriesRtnData](err)
+		}
 	}
-	numFetched := 0
 	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteListEntriesRtnData], 16)
-	// keep track of "directories" that have been used to avoid duplicates between pages
-	prevUsedDirKeys := make(map[string]any)
 	go func() {
 		defer close(rtn)
-		entryMap := make(map[string]*wshrpc.FileInfo)
-		if err := c.listFilesPrefix(ctx, dirPrefix, func(item *ListDirFileItem) (bool, error) {
-			if numFetched >= numToFetch {
-				return false, nil
-			}
-
-			lastModTime := item.CreateTs
-
-			// get the first level directory name or file name
-			name, isDir := item.Name, item.IsDir
-			// path := fspath.Join(conn.GetPathWithHost(), name)
-			path := "walrus://" + conn.Path
-			fullpath := ""
-			if strings.HasPrefix(name, fspath.Separator) {
-				fullpath = path + name
-			} else {
-				fullpath = path + fspath.Separator + name
-			}
-			if isDir {
-				if entryMap[fullpath] == nil {
-					if _, ok := prevUsedDirKeys[fullpath]; !ok {
-						entryMap[fullpath] = &wshrpc.FileInfo{
-							Path:    fullpath,
-							Name:    name,
-							IsDir:   true,
-							Dir:     fsutil.GetParentPathString(fullpath),
-							ModTime: lastModTime,
-							Size:    0,
-						}
-						fileutil.AddMimeTypeToFileInfo(fullpath, entryMap[fullpath])
-
-						prevUsedDirKeys[fullpath] = struct{}{}
-						numFetched++
-					}
-				} else if entryMap[fullpath].ModTime < lastModTime {
-					entryMap[fullpath].ModTime = lastModTime
-				}
-				return true, nil
+		currentEpoch, err := current_epoch(ctx, c.config)
+		if err != nil {
+			logger.Warn("cannot get current walrus epoch", "err", err)
+		}
+		// items by their path relative to dirPath, which is also the cursor
+		itemMap := make(map[string]*ListDirFileItem)
+		addItem := func(relPath string, item *ListDirFileItem) {
+			if relPath == "" {
+				return
 			}
-
-			size := item.Size
-			entryMap[fullpath] = &wshrpc.FileInfo{
-				Name:    name,
-				IsDir:   false,
-				Dir:     fsutil.GetParentPathString(fullpath),
-				Path:    fullpath,
-				ModTime: lastModTime,
-				Size:    size,
+			// a directory can be listed more than once, keep a single entry with the latest time
+			if prev := itemMap[relPath]; prev != nil && prev.IsDir && item.IsDir {
+				prev.CreateTs = max(prev.CreateTs, item.CreateTs)
+				return
 			}
-			fileutil.AddMimeTypeToFileInfo(fullpath, entryMap[fullpath])
-			numFetched++
-			return true, nil
-		}); err != nil {
+			itemMap[relPath] = item
+		}
+		if recursive {
+			err = c.collectEntries(ctx, dirPath, func(path string, item *ListDirFileItem) bool {
+				addItem(strings.Trim(strings.TrimPrefix(path, dirPath), fspath.Separator), item)
+				return true
+			})
+		} else {
+			err = c.listFilesPrefix(ctx, dirPath, func(item *ListDirFileItem) (bool, error) {
+				addItem(strings.Trim(item.Name, fspath.Separator), item)
+				return true, nil
+			})
+		}
+		if err != nil {
 			rtn <- wshutil.RespErr[wshrpc.CommandRemoteListEntriesRtnData](err)
 			return
 		}
-		entries := make([]*wshrpc.FileInfo, 0, wshrpc.DirChunkSize)
-		for _, entry := range entryMap {
-			entries = append(entries, entry)
-			if len(entries) == wshrpc.DirChunkSize {
-				rtn <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteListEntriesRtnData]{Response: wshrpc.CommandRemoteListEntriesRtnData{FileInfo: entries}}
-				entries = make([]*wshrpc.FileInfo, 0, wshrpc.DirChunkSize)
+		if dirPath == fspath.Separator && c.config.rootName == "" {
+			// the named roots are directories of the top level, over an entry of walrus:root with the same name.
+			// A recursive listing doesn't descend into them, their paths are routed to their own objects
+			for name := range c.config.roots {
+				itemMap[name] = &ListDirFileItem{Name: name, IsDir: true}
 			}
 		}
-		if len(entries) > 0 {
-			rtn <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteListEntriesRtnData]{Response: wshrpc.CommandRemoteListEntriesRtnData{FileInfo: entries}}
+
+		relPaths := slices.SortedFunc(maps.Keys(itemMap), func(a, b string) int {
+			return order.compare(a, itemMap[a], b, itemMap[b])
+		})
+		if cursorItem != nil {
+			// the entries up to the cursor were on the previous pages
+			start, _ := slices.BinarySearchFunc(relPaths, cursorPath, func(relPath string, cursorPath string) int {
+				if order.compare(relPath, itemMap[relPath], cursorPath, cursorItem) <= 0 {
+					return -1
+				}
+				return 1
+			})
+			relPaths = relPaths[start:]
+		}
+		nextCursor := ""
+		if len(relPaths) > limit {
+			relPaths = relPaths[:limit]
+			nextCursor = order.cursor(relPaths[limit-1], itemMap[relPaths[limit-1]])
+		}
+		entries := make([]*wshrpc.FileInfo, 0, len(relPaths))
+		for _, relPath := range relPaths {
+			entries = append(entries, c.entryInfo(fspath.Join(dirPath, relPath), itemMap[relPath], currentEpoch))
+		}
+		for _, chunk := range list_chunks(entries, nextCursor) {
+			rtn <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteListEntriesRtnData]{Response: chunk}
 		}
 	}()
 	return rtn
 }
 
+// entryInfo returns the FileInfo of a listed file or directory at the absolute walrus path itemPath
+func (c WalrusClient) entryInfo(itemPath string, item *ListDirFileItem, currentEpoch int64) *wshrpc.FileInfo {
+	fullpath := c.config.walrus_uri(itemPath)
+	finfo := &wshrpc.FileInfo{
+		Name:    fspath.Base(itemPath),
+		IsDir:   item.IsDir,
+		Dir:     fsutil.GetParentPathString(c.config.walrus_uri(itemPath)),
+		Path:    fullpath,
+		ModTime: item.CreateTs,
+		Tags:    item.Tags,
+	}
+	if !item.IsDir {
+		finfo.Size = item.Size
+		finfo.WalrusBlobId = item.WalrusBlobId
+		finfo.WalrusBlobIds = item.WalrusBlobIds
+		finfo.ContentSha256 = item.ContentSha256
+		finfo.WalrusEpochTill = item.WalrusEpochTill
+		finfo.WalrusDeletable = item.Deletable
+		finfo.WalrusCertified = item.Certified
+		finfo.WalrusEncrypted = item.Encrypted
+		finfo.WalrusCompression = item.Compression
+		finfo.MimeType = item.MimeType
+		c.setExpiry(finfo, currentEpoch)
+	}
+	fileutil.AddMimeTypeToFileInfo(fullpath, finfo)
+	return finfo
+}
+
+// list_chunks splits the entries into chunks of wshrpc.DirChunkSize. A non empty cursor means entries were left
+// out, the last chunk is then marked truncated and carries the cursor
+func list_chunks(entries []*wshrpc.FileInfo, cursor string) []wshrpc.CommandRemoteListEntriesRtnData {
+	var chunks []wshrpc.CommandRemoteListEntriesRtnData
+	for i := 0; i < len(entries); i += wshrpc.DirChunkSize {
+		chunks = append(chunks, wshrpc.CommandRemoteListEntriesRtnData{FileInfo: entries[i:min(i+wshrpc.DirChunkSize, len(entries))]})
+	}
+	if cursor != "" && len(chunks) > 0 {
+		last := &chunks[len(chunks)-1]
+		last.Truncated = true
+		last.Cursor = cursor
+	}
+	return chunks
+}
+
+// walrus_uri returns the canonical uri of a walrus path, walrus:// followed by the cleaned absolute path. The
+// path elements are joined, no elements is the root. The paths of a named root are under its name
+func (config *WalrusFsConfig) walrus_uri(elem ...string) string {
+	return "walrus://" + fspath.Join(append([]string{fspath.Separator, config.rootName}, elem...)...)
+}
+
+// Stat returns the info of a walrus path. A missing path gives a FileInfo with NotFound set, while a lookup that
+// fails, for instance because the chain can't be reached, is an error
 func (c WalrusClient) Stat(ctx context.Context, conn *connparse.Connection) (*wshrpc.FileInfo, error) {
+	start := time.Now()
+	finfo, err := c.statPath(ctx, conn)
+	c.config.record_op(OpStat, start, 0, err)
+	return finfo, err
+}
+
+func (c WalrusClient) statPath(ctx context.Context, conn *connparse.Connection) (*wshrpc.FileInfo, error) {
 	objectKey := conn.Path
 
 	if objectKey == "" || objectKey == fspath.Separator {
-		// root, refers to list all buckets
+		// the root, a named root is a directory of the top level
+		name := fspath.Separator
+		if c.config.rootName != "" {
+			name = c.config.rootName
+		}
 		return &wshrpc.FileInfo{
-			Name:     fspath.Separator,
+			Name:     name,
 			IsDir:    true,
 			Size:     0,
 			ModTime:  0,
-			Path:     "walrus://" + fspath.Separator,
-			Dir:      "walrus://" + fspath.Separator,
+			Path:     c.config.walrus_uri(),
+			Dir:      fsutil.GetParentPathString(c.config.walrus_uri()),
 			MimeType: "directory",
 		}, nil
 	}
 
-	item, err := stat(c.config, conn.Path)
+	item, err := stat(ctx, c.config, conn.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -437,137 +874,838 @@ func (c WalrusClient) Stat(ctx context.Context, conn *connparse.Connection) (*ws
 		}, nil
 	}
 
-	fullpath := "walrus://" + conn.Path
-	fullpath = strings.TrimSuffix(fullpath, "/")
+	itemPath := fspath.Join(fspath.Separator, conn.Path)
 
 	// calvin
 	rtn := &wshrpc.FileInfo{
-		Name:         item.Name,
-		Path:         fullpath,
-		Dir:          fsutil.GetParentPathString(fullpath),
-		IsDir:        item.IsDir,
-		Size:         item.Size,
-		ModTime:      item.CreateTs,
-		WalrusBlobId: item.WalrusBlobId,
+		Name:              item.Name,
+		Path:              c.config.walrus_uri(itemPath),
+		Dir:               fsutil.GetParentPathString(c.config.walrus_uri(itemPath)),
+		IsDir:             item.IsDir,
+		Size:              item.Size,
+		ModTime:           item.CreateTs,
+		WalrusBlobId:      item.WalrusBlobId,
+		WalrusBlobIds:     item.WalrusBlobIds,
+		ContentSha256:     item.ContentSha256,
+		WalrusEpochTill:   item.WalrusEpochTill,
+		WalrusDeletable:   item.Deletable,
+		WalrusCertified:   item.Certified,
+		WalrusEncrypted:   item.Encrypted,
+		WalrusCompression: item.Compression,
+		MimeType:          item.MimeType,
+		Tags:              item.Tags,
+	}
+	if !rtn.IsDir {
+		currentEpoch, err := current_epoch(ctx, c.config)
+		if err != nil {
+			logger.Warn("cannot get current walrus epoch", "err", err)
+		} else {
+			c.setExpiry(rtn, currentEpoch)
+		}
 	}
 	fileutil.AddMimeTypeToFileInfo(rtn.Path, rtn)
 	return rtn, nil
 }
 
-func (c WalrusClient) PutFile(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) error {
-	if data.At != nil {
-		return errors.Join(errors.ErrUnsupported, fmt.Errorf("file data offset and size not supported"))
-	}
+// ObjectMeta is what the walrusfs contract stores for a path, as it is on chain
+type ObjectMeta struct {
+	// ObjectId is the id of the entry in the walrusfs root, files and directories aren't sui objects of their own.
+	// It is empty when the lookup failed
+	ObjectId string `json:"object_id"`
+	ListDirFileItem
+}
 
-	contentMaxLength := base64.StdEncoding.DecodedLen(len(data.Data64))
-	var decodedBody []byte
-	var contentLength int
-	var err error
-	if contentMaxLength > 0 {
-		decodedBody = make([]byte, contentMaxLength)
-		contentLength, err = base64.StdEncoding.Decode(decodedBody, []byte(data.Data64))
+// GetObjectMeta returns the on-chain entry of conn for debugging, read from the chain rather than the listing cache.
+// The object id is found in a get_dir_all listing of the directory or of the parent of the file, which covers their
+// whole subtree, a failed lookup only leaves it empty
+func (c WalrusClient) GetObjectMeta(ctx context.Context, conn *connparse.Connection) (*ObjectMeta, error) {
+	itemPath := fspath.Join(fspath.Separator, conn.Path)
+	meta := &ObjectMeta{ListDirFileItem: ListDirFileItem{Name: fspath.Separator, IsDir: true}}
+	if itemPath != fspath.Separator {
+		item, err := inspect_stat(ctx, c.config, itemPath)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if item == nil {
+			return nil, typed_error(ErrNotFound, "path not found: %s", conn.GetFullURI())
 		}
+		meta.ListDirFileItem = *item
+	}
+
+	dirPath := itemPath
+	if !meta.IsDir {
+		dirPath = fspath.Dir(itemPath)
+	}
+	res, err := get_dir_all(ctx, c.config, dirPath)
+	if err != nil {
+		logger.Warn("cannot look up object id", "path", itemPath, "err", err)
+		return meta, nil
+	}
+	if meta.IsDir {
+		meta.ObjectId = res.Dirobj
 	} else {
-		decodedBody = []byte("\n")
-		contentLength = 1
+		meta.ObjectId = res.Dirs[res.Dirobj].ChildrenFiles[fspath.Base(itemPath)]
 	}
+	return meta, nil
+}
 
-	// Calvin TODO: overwrite anyway?
-	err = add_file_content(c.config, bytes.NewReader(decodedBody), int64(contentLength), conn.Path, true)
-	return err
+// Exists returns whether conn names a walrus file or directory. It returns false without an error only when the path
+// is known not to exist, a failed lookup is returned as an error rather than taken for a missing path
+func (c WalrusClient) Exists(ctx context.Context, conn *connparse.Connection) (bool, error) {
+	info, err := c.statPath(ctx, conn)
+	if err != nil {
+		return false, err
+	}
+	return !info.NotFound, nil
 }
 
-func (c WalrusClient) AppendFile(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) error {
-	return errors.Join(errors.ErrUnsupported, fmt.Errorf("append file not supported"))
+// setExpiry fills in the remaining storage epochs of a file, it does nothing while the current epoch is unknown
+func (c WalrusClient) setExpiry(finfo *wshrpc.FileInfo, currentEpoch int64) {
+	if finfo.IsDir || currentEpoch <= 0 || finfo.WalrusEpochTill <= 0 {
+		return
+	}
+	finfo.WalrusEpochsLeft = max(finfo.WalrusEpochTill-currentEpoch, 0)
+	finfo.WalrusExpiring = finfo.WalrusEpochsLeft < int64(c.config.expiryWarnEpochs)
 }
 
-func (c WalrusClient) Mkdir(ctx context.Context, conn *connparse.Connection) error {
-	err := create_directory(c.config, conn.Path)
+func (c WalrusClient) PutFile(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) error {
+	_, err := c.PutFileWithResult(ctx, conn, data)
 	return err
 }
 
-func (c WalrusClient) Mkfile(ctx context.Context, filepath string, dstpath string, overwrite bool) error {
-	err := add_file(c.config, filepath, dstpath, overwrite)
-	return err
+// PutFileWithResult is PutFile, also returning the transaction that recorded the file
+func (c WalrusClient) PutFileWithResult(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) (*TxResult, error) {
+	start := time.Now()
+	rtn, err := c.putFile(ctx, conn, data)
+	c.config.record_op(OpPutFile, start, base64_size(data.Data64), err)
+	return rtn, err
 }
 
-func (c WalrusClient) MoveInternal(ctx context.Context, srcConn, destConn *connparse.Connection, opts *wshrpc.FileCopyOpts) error {
-	// called when renaming file or dir
-	if srcConn.Scheme != connparse.ConnectionTypeWalrus || destConn.Scheme != connparse.ConnectionTypeWalrus {
-		return fmt.Errorf("source and destination must both be walrus")
+func (c WalrusClient) putFile(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) (*TxResult, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
 	}
-
-	fi, err := c.Stat(ctx, srcConn)
-	if err != nil {
-		return err
+	if data.At != nil {
+		return nil, errors.Join(errors.ErrUnsupported, fmt.Errorf("file data offset and size not supported"))
 	}
 
-	err = nil
-	if fi.IsDir {
-		err = rename(c.config, srcConn.Path, destConn.Path, true)
+	// decode while uploading rather than holding a second, decoded copy of the file in memory
+	var body io.Reader
+	var contentLength int64
+	if len(data.Data64) > 0 {
+		b64, err := newBase64Body(data.Data64)
+		if err != nil {
+			return nil, err
+		}
+		body = b64
+		contentLength = b64.size
 	} else {
-		err = rename(c.config, srcConn.Path, destConn.Path, false)
+		body = bytes.NewReader([]byte("\n"))
+		contentLength = 1
 	}
 
-	return err
-}
+	overwrite := data.Info != nil && data.Info.Opts != nil && data.Info.Opts.Overwrite
+	if !overwrite {
+		finfo, err := c.statPath(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if !finfo.NotFound {
+			return nil, typed_error(ErrOverwriteRequired, fstype.OverwriteRequiredError, conn.Path)
+		}
+	}
 
-func (c WalrusClient) CopyRemote(ctx context.Context, srcConn, destConn *connparse.Connection, srcClient fstype.FileShareClient, opts *wshrpc.FileCopyOpts) (bool, error) {
-	if srcConn.Scheme == connparse.ConnectionTypeS3 && destConn.Scheme == connparse.ConnectionTypeS3 {
-		return c.CopyInternal(ctx, srcConn, destConn, opts)
+	var tags []string
+	if data.Info != nil {
+		tags = data.Info.Tags
 	}
-	destBucket := destConn.Host
-	if destBucket == "" || destBucket == fspath.Separator {
-		return false, fmt.Errorf("destination bucket must be specified")
+	if err := validate_tags(tags); err != nil {
+		return nil, err
 	}
-	return fsutil.PrefixCopyRemote(ctx, srcConn, destConn, srcClient, c, func(bucket, path string, size int64, reader io.Reader) error {
-		return nil
-	}, opts)
+
+	return add_file_content(ctx, c.config, body, contentLength, conn.Path, tags, 0, overwrite, 0)
 }
 
-func (c WalrusClient) CopyRecursive(basePath string, newDir string, currentDirObj string, res *DirAllResult) (bool, error) {
-	// already exists?
-	_, err := os.Open(basePath + fspath.Separator + newDir)
-	if !os.IsNotExist(err) {
-		return false, fmt.Errorf("destination path already exists")
-	}
+// UploadSpec is one of the files uploaded by PutFiles
+type UploadSpec struct {
+	// Path is the walrus path the file is stored at
+	Path string
+	// Data is read for Size bytes, it isn't closed
+	Data io.Reader
+	Size int64
+	Tags []string
+	// CreateTs is the creation time to record in ms, 0 records the time of the upload
+	CreateTs  int64
+	Overwrite bool
+}
 
-	basePath = basePath + fspath.Separator + newDir
-	if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+// UploadResult is the outcome of uploading one UploadSpec, Tx is set when it succeeded and Err when it didn't
+type UploadResult struct {
+	Path string
+	Tx   *TxResult
+	Err  error
+}
+
+// PutFiles uploads several files, publishing their blobs at most walrusfs:copyconcurrency at a time and then adding
+// all of them in as few transactions as possible instead of signing one per file. The results are in the order of
+// specs, the error joins the failures of the files that didn't upload
+func (c WalrusClient) PutFiles(ctx context.Context, specs []UploadSpec) ([]UploadResult, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
+	}
+	results := make([]UploadResult, len(specs))
+	recs := make([]*fileRecord, len(specs))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(c.config.copyConcurrency, 1))
+	for i, spec := range specs {
+		results[i].Path = spec.Path
+		g.Go(func() error {
+			// a failed file is reported in its result without stopping the others
+			recs[i], results[i].Err = c.publishUpload(gctx, spec)
+			return nil
+		})
+	}
+	g.Wait()
+
+	var published []*fileRecord
+	var indexes []int
+	for i, rec := range recs {
+		if rec != nil {
+			published = append(published, rec)
+			indexes = append(indexes, i)
+		}
+	}
+	txs, errs := record_files(ctx, c.config, published)
+	for n, i := range indexes {
+		results[i].Tx, results[i].Err = txs[n], errs[n]
+	}
+
+	var failed []error
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, fmt.Errorf("cannot upload %s: %w", result.Path, result.Err))
+		}
+	}
+	return results, errors.Join(failed...)
+}
+
+// publishUpload checks spec like PutFile and publishes its content, returning the record still to be added
+func (c WalrusClient) publishUpload(ctx context.Context, spec UploadSpec) (*fileRecord, error) {
+	if err := validate_tags(spec.Tags); err != nil {
+		return nil, err
+	}
+	if !spec.Overwrite {
+		item, err := stat(ctx, c.config, spec.Path)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			return nil, typed_error(ErrOverwriteRequired, fstype.OverwriteRequiredError, spec.Path)
+		}
+	}
+	return publish_file(ctx, c.config, spec.Data, spec.Size, spec.Path, spec.Tags, spec.CreateTs, spec.Overwrite, 0)
+}
+
+// WriteFileStream uploads everything read from r to conn, for content of unknown length read from an io.Reader
+// rather than held in memory. The publisher needs the length up front and retries need to rewind, so the content is
+// spooled to a temporary file first. Like PutFile, an existing file is only replaced with opts.Overwrite. wsh file
+// write doesn't stream, it sends its input to PutFile
+func (c WalrusClient) WriteFileStream(ctx context.Context, conn *connparse.Connection, r io.Reader, opts *wshrpc.FileOpts) error {
+	_, err := c.WriteFileStreamWithResult(ctx, conn, r, opts)
+	return err
+}
+
+// WriteFileStreamWithResult is WriteFileStream, also returning the transaction that recorded the file
+func (c WalrusClient) WriteFileStreamWithResult(ctx context.Context, conn *connparse.Connection, r io.Reader, opts *wshrpc.FileOpts) (*TxResult, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
+	}
+	// checked before anything is read, a stream may be long
+	overwrite := opts != nil && opts.Overwrite
+	if !overwrite {
+		finfo, err := c.statPath(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if !finfo.NotFound {
+			return nil, typed_error(ErrOverwriteRequired, fstype.OverwriteRequiredError, conn.Path)
+		}
+	}
+	spool, err := os.CreateTemp("", "walrusfs-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload spool file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read upload content: %w", err)
+	}
+	if size == 0 {
+		// walrus doesn't store empty blobs, write empty files as PutFile does
+		if _, err := spool.WriteString("\n"); err != nil {
+			return nil, err
+		}
+		size = 1
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	logger.Debug("spooled upload", "op", "write", "path", conn.GetFullURI(), "size", size)
+	return add_file_content(ctx, c.config, spool, size, conn.Path, nil, 0, overwrite, 0)
+}
+
+// ctxReader stops reading once ctx is done, so spooling a stream that never ends can be cancelled
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if cr.ctx.Err() != nil {
+		return 0, context.Cause(cr.ctx)
+	}
+	return cr.r.Read(p)
+}
+
+// base64Body decodes standard base64 data as it is read. Seeking restarts decoding at the quantum holding the
+// new position, so rewinding for content type detection, chunking and publish retries stays cheap
+type base64Body struct {
+	data    string
+	size    int64
+	pos     int64
+	decoder io.Reader
+}
+
+func newBase64Body(data string) (*base64Body, error) {
+	// validate up front so corrupt input fails before anything is published
+	size, err := io.Copy(io.Discard, base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	return &base64Body{
+		data:    data,
+		size:    size,
+		decoder: base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)),
+	}, nil
+}
+
+func (b *base64Body) Read(p []byte) (int, error) {
+	n, err := b.decoder.Read(p)
+	b.pos += int64(n)
+	return n, err
+}
+
+func (b *base64Body) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 || offset > b.size {
+		return 0, fmt.Errorf("seek to %d outside of %d bytes", offset, b.size)
+	}
+	if offset == b.pos {
+		return b.pos, nil
+	}
+	// every 4 base64 characters decode to 3 bytes
+	quantum := offset / 3
+	b.decoder = base64.NewDecoder(base64.StdEncoding, strings.NewReader(b.data[quantum*4:]))
+	if _, err := io.CopyN(io.Discard, b.decoder, offset-quantum*3); err != nil {
+		return 0, err
+	}
+	b.pos = offset
+	return b.pos, nil
+}
+
+// AppendFile appends to a walrus file. Blobs are immutable, so the existing blob is read back, the new data
+// is concatenated and published as a new blob, and the file entry is overwritten to point at it
+func (c WalrusClient) AppendFile(ctx context.Context, conn *connparse.Connection, data wshrpc.FileData) error {
+	if err := c.check_writable(); err != nil {
+		return err
+	}
+	if data.At != nil {
+		return errors.Join(errors.ErrUnsupported, fmt.Errorf("file data offset and size not supported"))
+	}
+
+	appendData, err := base64.StdEncoding.DecodeString(data.Data64)
+	if err != nil {
+		return err
+	}
+
+	finfo, err := c.statPath(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if finfo.IsDir {
+		return fmt.Errorf("cannot append to directory %q", conn.Path)
+	}
+
+	var existing []byte
+	if !finfo.NotFound && finfo.Size > 0 {
+		existing, err = get_file(ctx, c.config, finfo.ContentSha256, info_coding(finfo), file_blob_ids(finfo.WalrusBlobId, finfo.WalrusBlobIds)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	combined := make([]byte, 0, len(existing)+len(appendData))
+	combined = append(combined, existing...)
+	combined = append(combined, appendData...)
+	// keep the tags of the file being appended to
+	_, err = add_file_content(ctx, c.config, bytes.NewReader(combined), int64(len(combined)), conn.Path, finfo.Tags, 0, true, 0)
+	return err
+}
+
+func (c WalrusClient) Mkdir(ctx context.Context, conn *connparse.Connection) error {
+	_, err := c.MkdirWithResult(ctx, conn, nil)
+	return err
+}
+
+// MkdirWithResult creates a directory with tags, returning the transaction that created it
+func (c WalrusClient) MkdirWithResult(ctx context.Context, conn *connparse.Connection, tags []string) (*TxResult, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
+	}
+	if err := validate_tags(tags); err != nil {
+		return nil, err
+	}
+	return create_directory(ctx, c.config, conn.Path, tags)
+}
+
+// MkdirAll creates the directory at conn.Path along with every ancestor that is missing, like os.MkdirAll. The
+// ancestors are looked up from the root down and the missing ones created in a single transaction, parents first.
+// A directory that already exists is not an error, a file in the way of one is
+func (c WalrusClient) MkdirAll(ctx context.Context, conn *connparse.Connection) error {
+	if err := c.check_writable(); err != nil {
+		return err
+	}
+	if strings.Trim(conn.Path, fspath.Separator) == "" {
+		return nil
+	}
+	dirPath, err := ValidatePath(conn.Path)
+	if err != nil {
+		return err
+	}
+	names := strings.Split(strings.TrimPrefix(dirPath, fspath.Separator), fspath.Separator)
+	var missing []string
+	for i := range names {
+		path := fspath.Separator + strings.Join(names[:i+1], fspath.Separator)
+		if len(missing) > 0 {
+			// everything below a missing directory is missing too
+			missing = append(missing, path)
+			continue
+		}
+		item, err := stat(ctx, c.config, path)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			missing = append(missing, path)
+		} else if !item.IsDir {
+			return fmt.Errorf("cannot create directory %s, %s is a file", c.config.walrus_uri(dirPath), c.config.walrus_uri(path))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	calls := make([]moveCall, len(missing))
+	for i, path := range missing {
+		calls[i] = moveCall{function: "add_dir", arguments: []interface{}{c.config.root, "0x6", path, make([]string, 0)}}
+	}
+	_, err = execute_batch_call(ctx, c.config, "add_dirs", calls)
+	for _, path := range missing {
+		listings.invalidate(c.config.root, path)
+	}
+	return err
+}
+
+// Mkfile uploads the local file at filepath to dstpath with tags. epochs overrides the configured storage epochs when non-zero
+func (c WalrusClient) Mkfile(ctx context.Context, filepath string, dstpath string, tags []string, overwrite bool, epochs int) error {
+	_, err := c.MkfileWithResult(ctx, filepath, dstpath, tags, overwrite, epochs)
+	return err
+}
+
+// MkfileWithResult is Mkfile, also returning the transaction that recorded the file
+func (c WalrusClient) MkfileWithResult(ctx context.Context, filepath string, dstpath string, tags []string, overwrite bool, epochs int) (*TxResult, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
+	}
+	if err := validate_tags(tags); err != nil {
+		return nil, err
+	}
+	return add_file(ctx, c.config, filepath, dstpath, tags, overwrite, epochs)
+}
+
+// RenewFile extends the storage of a walrus file by additionalEpochs. Its blob objects are extended on chain through
+// walrusfs:systemobject, paid with the signer's WAL, and the new end epoch is recorded in the same transaction
+func (c WalrusClient) RenewFile(ctx context.Context, conn *connparse.Connection, additionalEpochs int) error {
+	if err := c.check_writable(); err != nil {
+		return err
+	}
+	if additionalEpochs <= 0 {
+		return fmt.Errorf("additional epochs must be positive, got %d", additionalEpochs)
+	}
+	if err := c.config.require_staking_object("renew files"); err != nil {
+		return err
+	}
+	finfo, err := c.statPath(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if finfo.NotFound {
+		return typed_error(ErrNotFound, "file not found: %s", conn.GetFullURI())
+	}
+	if finfo.IsDir {
+		return fmt.Errorf("cannot renew directory %q, use RenewDir", conn.Path)
+	}
+	renewal, err := new_blob_renewal(ctx, c.config)
+	if err != nil {
+		return err
+	}
+	return renewal.renew(ctx, c.config, conn.Path, file_blob_ids(finfo.WalrusBlobId, finfo.WalrusBlobIds), finfo.WalrusEpochTill, additionalEpochs)
+}
+
+// RenewDir extends the storage of every file below the walrus directory by additionalEpochs, like RenewFile
+func (c WalrusClient) RenewDir(ctx context.Context, conn *connparse.Connection, additionalEpochs int) error {
+	if err := c.check_writable(); err != nil {
+		return err
+	}
+	if additionalEpochs <= 0 {
+		return fmt.Errorf("additional epochs must be positive, got %d", additionalEpochs)
+	}
+	if err := c.config.require_staking_object("renew files"); err != nil {
+		return err
+	}
+	renewal, err := new_blob_renewal(ctx, c.config)
+	if err != nil {
+		return err
+	}
+	return c.walkTree(ctx, conn.Path, func(path string, item *ListDirFileItem) error {
+		if item.IsDir {
+			return nil
+		}
+		if err := renewal.renew(ctx, c.config, path, file_blob_ids(item.WalrusBlobId, item.WalrusBlobIds), item.WalrusEpochTill, additionalEpochs); err != nil {
+			return fmt.Errorf("error renewing %q: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func (c WalrusClient) MoveInternal(ctx context.Context, srcConn, destConn *connparse.Connection, opts *wshrpc.FileCopyOpts) error {
+	// called when renaming file or dir
+	if err := c.check_writable(); err != nil {
+		return err
+	}
+	if srcConn.Scheme != connparse.ConnectionTypeWalrus || destConn.Scheme != connparse.ConnectionTypeWalrus {
+		return fmt.Errorf("source and destination must both be walrus")
+	}
+
+	fi, err := c.statPath(ctx, srcConn)
+	if err != nil {
+		return err
+	}
+	if fi.NotFound {
+		return typed_error(ErrNotFound, "source path not found: %s", srcConn.GetFullURI())
+	}
+
+	srcPath := strings.TrimSuffix(srcConn.Path, fspath.Separator)
+	destPath := strings.TrimSuffix(destConn.Path, fspath.Separator)
+	destInfo, err := c.statPath(ctx, destConn)
+	if err != nil {
+		return err
+	}
+	if destInfo.IsDir {
+		// move into the existing directory
+		destPath = fspath.Join(destPath, fspath.Base(srcPath))
+		destInfo, err = c.statPath(ctx, &connparse.Connection{Scheme: destConn.Scheme, Host: destConn.Host, Path: destPath})
+		if err != nil {
+			return err
+		}
+	}
+	// the copy of a directory into its own subtree would be deleted along with the source
+	srcClean, destClean := fspath.Join(fspath.Separator, srcPath), fspath.Join(fspath.Separator, destPath)
+	if destClean == srcClean || strings.HasPrefix(destClean, srcClean+fspath.Separator) {
+		return typed_error(ErrInvalidPath, "cannot move %s into itself: %s", srcConn.GetFullURI(), c.config.walrus_uri(destPath))
+	}
+	if destInfo.IsDir {
+		// copying would nest the source inside it rather than replace it
+		return typed_error(ErrAlreadyExists, "destination directory already exists: %s", c.config.walrus_uri(destPath))
+	}
+	if fspath.Dir(srcPath) != fspath.Dir(destPath) {
+		return c.moveAcrossDirs(ctx, srcConn, destPath, destInfo.NotFound, opts)
+	}
+
+	_, err = rename(ctx, c.config, srcConn.Path, destPath, fi.IsDir)
+	return err
+}
+
+// moveAcrossDirs moves to a different parent directory, which the contract can't rename into. The existing blob ids
+// are added at the destination before the source is removed, so nothing is re-uploaded and a failure in between leaves
+// the data in at least one place.
+func (c WalrusClient) moveAcrossDirs(ctx context.Context, srcConn *connparse.Connection, destPath string, destNew bool, opts *wshrpc.FileCopyOpts) error {
+	destConn := &connparse.Connection{Scheme: srcConn.Scheme, Host: srcConn.Host, Path: destPath}
+	if _, err := c.copyWalrusToWalrus(ctx, srcConn, destConn, opts); err != nil {
+		if destNew {
+			// drop whatever part of the destination was added, the source is untouched
+			if cleanupErr := c.deletePath(context.WithoutCancel(ctx), destConn, true); cleanupErr != nil {
+				logger.Warn("cannot remove partially moved destination", "op", "move", "path", destPath, "err", cleanupErr)
+			}
+		}
+		return fmt.Errorf("cannot move %s to %s, the source was left in place: %w", srcConn.GetFullURI(), c.config.walrus_uri(destPath), err)
+	}
+	if err := c.deletePath(ctx, srcConn, true); err != nil {
+		return fmt.Errorf("moved %s to %s but cannot remove the source, it now exists in both places: %w", srcConn.GetFullURI(), c.config.walrus_uri(destPath), err)
+	}
+	return nil
+}
+
+func (c WalrusClient) CopyRemote(ctx context.Context, srcConn, destConn *connparse.Connection, srcClient fstype.FileShareClient, opts *wshrpc.FileCopyOpts) (bool, error) {
+	if err := c.check_writable(); err != nil {
+		return false, err
+	}
+	if srcConn.Scheme == connparse.ConnectionTypeWalrus && destConn.Scheme == connparse.ConnectionTypeWalrus {
+		return c.CopyInternal(ctx, srcConn, destConn, opts)
+	}
+	// directories that are known to exist, so each parent is only checked once per copy
+	knownDirs := make(map[string]bool)
+	return fsutil.PrefixCopyRemote(ctx, srcConn, destConn, srcClient, c, func(host, path string, size int64, reader io.Reader) error {
+		if err := c.mkdirParents(ctx, path, knownDirs); err != nil {
+			return err
+		}
+		// conflicts at the destination are resolved by PrefixCopyRemote before any file is written
+		_, err := add_file_content(ctx, c.config, reader, size, path, nil, 0, true, 0)
+		return err
+	}, opts)
+}
+
+// mkdirParents creates the missing parent directories of path, walrus requires them to exist before a file is added
+func (c WalrusClient) mkdirParents(ctx context.Context, path string, knownDirs map[string]bool) error {
+	parent := strings.Trim(fspath.Dir(path), fspath.Separator)
+	if parent == "" || parent == "." {
+		return nil
+	}
+	dirPath := ""
+	for _, part := range strings.Split(parent, fspath.Separator) {
+		dirPath = dirPath + fspath.Separator + part
+		if knownDirs[dirPath] {
+			continue
+		}
+		item, err := stat(ctx, c.config, dirPath)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			if _, err := create_directory(ctx, c.config, dirPath, nil); err != nil {
+				return fmt.Errorf("cannot mkdir %q: %w", dirPath, err)
+			}
+		} else if !item.IsDir {
+			return fmt.Errorf("cannot create directory %q, a file with the same name exists", dirPath)
+		}
+		knownDirs[dirPath] = true
+	}
+	return nil
+}
+
+// CopyRecursive copies the directory currentDirObj from res to basePath/newDir. The directory tree is created
+// first, then the file blobs are downloaded at most walrusfs:copyconcurrency at a time, stopping at the first failure.
+// If progress is not nil it is called with the totals before the downloads start and again as each file is written.
+// Unless ctx says otherwise through WithPreserveTimes, each file gets its walrus creation time as modification time.
+// policy decides what happens to files that already exist, with ConflictFail an existing basePath/newDir fails the copy.
+// The files downloaded are recorded in a CopyManifestName file, so a copy that fails resumes when it is run again:
+// files recorded with the same blobs are skipped, and under ConflictFail the others are overwritten since the
+// directory is the one the failed copy created
+func (c WalrusClient) CopyRecursive(ctx context.Context, basePath string, newDir string, currentDirObj string, res *DirAllResult, policy ConflictPolicy, progress func(wshrpc.FileCopyProgress)) (bool, error) {
+	manifest, err := load_copy_manifest(basePath + fspath.Separator + newDir)
+	if err != nil {
 		return false, err
 	}
+	if manifest != nil && policy == ConflictFail {
+		// what the failed copy didn't record may be partly written
+		policy = ConflictOverwrite
+	}
+	var downloads []blobDownload
+	destDir, err := prepareCopyDir(basePath, newDir, currentDirObj, res, policy, manifest, &downloads)
+	if err != nil {
+		if manifest != nil {
+			manifest.close(false)
+		}
+		return false, err
+	}
+	if destDir == "" {
+		// skipped, a file is in the way of the directory
+		return true, nil
+	}
+	if manifest == nil {
+		if manifest, err = create_copy_manifest(destDir); err != nil {
+			return false, err
+		}
+	}
+
+	var totalBytes int64
+	for _, d := range downloads {
+		totalBytes += d.size
+	}
+	tracker := newCopyProgressTracker(progress, len(downloads), totalBytes)
+	preserveTimes := preserve_times(ctx)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(c.config.copyConcurrency, 1))
+	for _, d := range downloads {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+			b, err := get_file(gctx, c.config, d.contentSha256, d.coding, d.blobIds...)
+			if err != nil {
+				return fmt.Errorf("failed to get walrus blob %s: %w", d.blobIds[0], err)
+			}
+			if err := os.WriteFile(d.filename, b, 0644); err != nil {
+				return fmt.Errorf("failed to write walrus blob to %s: %w", d.filename, err)
+			}
+			if preserveTimes {
+				if err := set_mod_time(d.filename, d.createTs); err != nil {
+					return err
+				}
+			}
+			if err := manifest.record(d.filename, d.blobIds); err != nil {
+				logger.Warn("cannot record download in the copy manifest", "file", d.filename, "err", err)
+			}
+			tracker.fileDone(int64(len(b)))
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		manifest.close(false)
+		return false, fmt.Errorf("%w, run the copy again to resume it", err)
+	}
+	if err := manifest.close(true); err != nil {
+		logger.Warn("cannot remove the copy manifest", "dir", destDir, "err", err)
+	}
+
+	return true, nil
+}
+
+type blobDownload struct {
+	blobIds       []string
+	contentSha256 string
+	coding        blobCoding
+	filename      string
+	size          int64
+	createTs      int64
+}
+
+// set_mod_time sets the modification time of a downloaded file to the walrus creation time createTs, in ms
+func set_mod_time(filename string, createTs int64) error {
+	if createTs <= 0 {
+		return nil
+	}
+	modTime := time.UnixMilli(createTs)
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		return fmt.Errorf("failed to set the modification time of %s: %w", filename, err)
+	}
+	return nil
+}
+
+// copy_create_ts returns the creation time to record for a walrus copy of a file created at createTs,
+// 0 records the time of the copy
+func copy_create_ts(ctx context.Context, createTs int64) int64 {
+	if !preserve_times(ctx) {
+		return 0
+	}
+	return createTs
+}
+
+// copyProgressTracker accumulates the progress of a copy and reports it one update at a time
+type copyProgressTracker struct {
+	lock     sync.Mutex
+	state    wshrpc.FileCopyProgress
+	progress func(wshrpc.FileCopyProgress)
+}
+
+func newCopyProgressTracker(progress func(wshrpc.FileCopyProgress), totalFiles int, totalBytes int64) *copyProgressTracker {
+	tracker := &copyProgressTracker{
+		state:    wshrpc.FileCopyProgress{FilesTotal: totalFiles, BytesTotal: totalBytes},
+		progress: progress,
+	}
+	if progress != nil {
+		progress(tracker.state)
+	}
+	return tracker
+}
+
+func (t *copyProgressTracker) fileDone(bytes int64) {
+	if t.progress == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.state.FilesDone++
+	t.state.BytesDone += bytes
+	t.progress(t.state)
+}
+
+// prepareCopyDir creates basePath/newDir and its subdirectories for the directory dirobj in res, collecting the
+// files to download into downloads and returning the directory created. Existing files and directories are handled
+// by policy, files that manifest has as downloaded are left out
+func prepareCopyDir(basePath string, newDir string, dirobj string, res *DirAllResult, policy ConflictPolicy, manifest *copyManifest, downloads *[]blobDownload) (string, error) {
+	basePath, skip, err := local_conflict(policy, basePath+fspath.Separator+newDir, true)
+	if err != nil || skip {
+		return "", err
+	}
+	if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+		return "", err
+	}
 
 	// file
-	item := res.Dirs[currentDirObj]
+	item := res.Dirs[dirobj]
 	for fname, fid := range item.ChildrenFiles {
-		filename := basePath + fspath.Separator + fname
-		b, err := get_file(c.config, res.Files[fid].WalrusBlobId)
-		if err != nil {
-			return false, fmt.Errorf("failed to get walrus blob " + res.Files[fid].WalrusBlobId)
+		blobIds := file_blob_ids(res.Files[fid].WalrusBlobId, res.Files[fid].WalrusBlobIds)
+		if manifest.downloaded(basePath+fspath.Separator+fname, blobIds, res.Files[fid].Size) {
+			continue
 		}
-		err = os.WriteFile(filename, b, 0644)
+		filename, skip, err := local_conflict(policy, basePath+fspath.Separator+fname, false)
 		if err != nil {
-			return false, fmt.Errorf("failed to write walrus blob to " + filename)
+			return "", err
+		}
+		if skip {
+			continue
 		}
+		f := res.Files[fid]
+		*downloads = append(*downloads, blobDownload{
+			blobIds:       blobIds,
+			contentSha256: f.ContentSha256,
+			coding:        item_coding(&f),
+			filename:      filename,
+			size:          f.Size,
+			createTs:      f.CreateTs,
+		})
 	}
 
 	// sub-dir
 	for dname, did := range item.ChildrenDirectories {
-		b, err := c.CopyRecursive(basePath, dname, did, res)
-		if err != nil {
-			return b, err
+		if _, err := prepareCopyDir(basePath, dname, did, res, policy, manifest, downloads); err != nil {
+			return "", err
 		}
 	}
 
-	return true, nil
+	return basePath, nil
 }
 
 func (c WalrusClient) CopyInternal(ctx context.Context, srcConn, destConn *connparse.Connection, opts *wshrpc.FileCopyOpts) (bool, error) {
+	if opts != nil && opts.NoPreserveTimes {
+		ctx = WithPreserveTimes(ctx, false)
+	}
+	policy, err := CopyConflictPolicy(opts)
+	if err != nil {
+		return false, err
+	}
 	if destConn.Scheme == "wsh" && destConn.Host == "local" {
 		// walrus -> local
-		fi, err := c.Stat(ctx, srcConn)
+		fi, err := c.statPath(ctx, srcConn)
 		if err != nil {
 			return false, err
 		}
@@ -577,66 +1715,304 @@ func (c WalrusClient) CopyInternal(ctx context.Context, srcConn, destConn *connp
 			return false, err
 		}
 
+		var progress func(wshrpc.FileCopyProgress)
+		if opts != nil {
+			progress = opts.Progress
+		}
+
 		if fi.IsDir {
-			res, err := get_dir_all(c.config, srcConn.Path)
+			res, err := get_dir_all(ctx, c.config, srcConn.Path)
 			if err != nil {
 				return false, err
 			}
 
-			newDir := fsutil.GetEndingPart(srcConn.Path)
+			// walrus paths are absolute, so a top level entry has a name too, the root copies its children
+			newDir := ""
+			if strings.Trim(srcConn.Path, fspath.Separator) != "" {
+				newDir = fspath.Base(srcConn.Path)
+			}
 
-			return c.CopyRecursive(destPath, newDir, res.Dirobj, res)
+			return c.CopyRecursive(ctx, destPath, newDir, res.Dirobj, res, policy, progress)
 		} else {
-			filename := fsutil.GetEndingPart(srcConn.Path)
-			_, err := os.Open(destPath + fspath.Separator + filename)
-			if !os.IsNotExist(err) {
-				return false, fmt.Errorf("destination path already exists")
+			filename := fspath.Base(srcConn.Path)
+			destname, skip, err := local_conflict(policy, destPath+fspath.Separator+filename, false)
+			if err != nil || skip {
+				return false, err
 			}
 
-			destname := destPath + fspath.Separator + filename
-			b, err := get_file(c.config, fi.WalrusBlobId)
+			tracker := newCopyProgressTracker(progress, 1, fi.Size)
+			b, err := get_file(ctx, c.config, fi.ContentSha256, info_coding(fi), file_blob_ids(fi.WalrusBlobId, fi.WalrusBlobIds)...)
 			if err != nil {
-				return false, fmt.Errorf("failed to get walrus blob " + fi.WalrusBlobId)
+				return false, fmt.Errorf("failed to get walrus blob %s: %w", fi.WalrusBlobId, err)
 			}
 			err = os.WriteFile(destname, b, 0644)
 			if err != nil {
-				return false, fmt.Errorf("failed to write walrus blob to " + filename)
+				return false, fmt.Errorf("failed to write walrus blob to %s: %w", destname, err)
+			}
+			if preserve_times(ctx) {
+				if err := set_mod_time(destname, fi.ModTime); err != nil {
+					return false, err
+				}
 			}
+			tracker.fileDone(int64(len(b)))
 
 			return true, nil
 		}
 	}
 
+	if srcConn.Scheme == connparse.ConnectionTypeWalrus && destConn.Scheme == connparse.ConnectionTypeWalrus {
+		// walrus -> walrus
+		if err := c.check_writable(); err != nil {
+			return false, err
+		}
+		return c.copyWalrusToWalrus(ctx, srcConn, destConn, opts)
+	}
+
 	return false, fmt.Errorf("src/destination not supported")
 }
 
+// copyWalrusToWalrus copies within walrus by recording the existing blob ids at the destination, so no data is
+// re-uploaded. The conflict policy of opts applies to each file, a directory is merged into an existing one
+func (c WalrusClient) copyWalrusToWalrus(ctx context.Context, srcConn, destConn *connparse.Connection, opts *wshrpc.FileCopyOpts) (bool, error) {
+	policy, err := CopyConflictPolicy(opts)
+	if err != nil {
+		return false, err
+	}
+
+	srcInfo, err := stat(ctx, c.config, srcConn.Path)
+	if err != nil {
+		return false, err
+	}
+	if srcInfo == nil {
+		return false, typed_error(ErrNotFound, "source path not found: %s", srcConn.GetFullURI())
+	}
+
+	destPath := strings.TrimSuffix(destConn.Path, fspath.Separator)
+	destInfo, err := c.statPath(ctx, destConn)
+	if err != nil {
+		return false, err
+	}
+	if destInfo.IsDir {
+		// copy into the existing directory
+		destPath = fspath.Join(destPath, fspath.Base(srcConn.Path))
+	}
+	destPath, skip, err := c.walrusConflict(ctx, policy, destPath, srcInfo.IsDir)
+	if err != nil {
+		return false, err
+	}
+	if skip {
+		return srcInfo.IsDir, nil
+	}
+
+	if !srcInfo.IsDir {
+		_, err := add_file_blob(ctx, c.config, destPath, srcInfo.Size, file_blob_ids(srcInfo.WalrusBlobId, srcInfo.WalrusBlobIds), srcInfo.ContentSha256, srcInfo.WalrusEpochTill, srcInfo.Deletable, srcInfo.Certified, item_coding(srcInfo), srcInfo.MimeType, srcInfo.Tags, copy_create_ts(ctx, srcInfo.CreateTs), policy == ConflictOverwrite)
+		return false, err
+	}
+
+	res, err := get_dir_all(ctx, c.config, srcConn.Path)
+	if err != nil {
+		return false, err
+	}
+	destItem, err := stat(ctx, c.config, destPath)
+	if err != nil {
+		return false, err
+	}
+	if destItem == nil {
+		if _, err := create_directory(ctx, c.config, destPath, res.Dirs[res.Dirobj].Tags); err != nil {
+			return false, err
+		}
+	}
+	if err := c.copyWalrusDirRecursive(ctx, destPath, res.Dirobj, res, policy); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// walrusConflict returns where a copy to the walrus destPath goes under policy, skip set when nothing should be
+// copied there. isDir is whether a directory is copied; a directory merges with an existing one, while a file and
+// a directory never replace each other
+func (c WalrusClient) walrusConflict(ctx context.Context, policy ConflictPolicy, destPath string, isDir bool) (target string, skip bool, err error) {
+	destItem, err := stat(ctx, c.config, destPath)
+	if err != nil {
+		return "", false, err
+	}
+	if destItem == nil {
+		return destPath, false, nil
+	}
+	if destItem.IsDir != isDir && (policy == ConflictFail || policy == ConflictOverwrite) {
+		if isDir {
+			return "", false, fmt.Errorf("cannot overwrite file %q with a directory", destPath)
+		}
+		return "", false, fmt.Errorf("cannot overwrite directory %q with a file", destPath)
+	}
+	if policy == ConflictFail {
+		return "", false, typed_error(ErrOverwriteRequired, fstype.OverwriteRequiredError, destPath)
+	}
+	if isDir && destItem.IsDir {
+		return destPath, false, nil
+	}
+	return policy.ResolveConflict(destPath, func(candidate string) (bool, error) {
+		item, err := stat(ctx, c.config, candidate)
+		return item != nil, err
+	}, nil)
+}
+
+func (c WalrusClient) copyWalrusDirRecursive(ctx context.Context, destPath string, currentDirObj string, res *DirAllResult, policy ConflictPolicy) error {
+	item := res.Dirs[currentDirObj]
+	for fname, fid := range item.ChildrenFiles {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		filePath := fspath.Join(destPath, fname)
+		if policy == ConflictSkip || policy == ConflictRename {
+			// the other policies need no lookup, the contract fails or replaces an existing file
+			var skip bool
+			var err error
+			if filePath, skip, err = c.walrusConflict(ctx, policy, filePath, false); err != nil {
+				return fmt.Errorf("failed to copy %q: %w", fname, err)
+			} else if skip {
+				continue
+			}
+		}
+		f := res.Files[fid]
+		if _, err := add_file_blob(ctx, c.config, filePath, f.Size, file_blob_ids(f.WalrusBlobId, f.WalrusBlobIds), f.ContentSha256, f.WalrusEpochTill, f.Deletable, f.Certified, item_coding(&f), f.MimeType, f.Tags, copy_create_ts(ctx, f.CreateTs), policy == ConflictOverwrite); err != nil {
+			return fmt.Errorf("failed to copy %q: %w", fname, err)
+		}
+	}
+
+	for dname, did := range item.ChildrenDirectories {
+		subPath := fspath.Join(destPath, dname)
+		subInfo, err := stat(ctx, c.config, subPath)
+		if err != nil {
+			return err
+		}
+		if subInfo != nil && !subInfo.IsDir {
+			// a file is in the way of the directory
+			var skip bool
+			if subPath, skip, err = c.walrusConflict(ctx, policy, subPath, true); err != nil {
+				return err
+			} else if skip {
+				continue
+			}
+			subInfo = nil
+		}
+		if subInfo == nil {
+			if _, err := create_directory(ctx, c.config, subPath, res.Dirs[did].Tags); err != nil {
+				return err
+			}
+		}
+		if err := c.copyWalrusDirRecursive(ctx, subPath, did, res, policy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c WalrusClient) Delete(ctx context.Context, conn *connparse.Connection, recursive bool) error {
+	start := time.Now()
+	err := c.deletePath(ctx, conn, recursive)
+	c.config.record_op(OpDelete, start, 0, err)
+	return err
+}
+
+func (c WalrusClient) deletePath(ctx context.Context, conn *connparse.Connection, recursive bool) error {
 	var err error
 	path := conn.Path
 	path = strings.TrimSuffix(path, "/")
-	log.Printf("Deleting objects with prefix %v", path)
+	if err := c.check_writable(); err != nil {
+		return err
+	}
+	logger.Info("deleting", "op", "delete", "path", path, "recursive", recursive)
 
-	fi, err := c.Stat(ctx, conn)
+	fi, err := c.statPath(ctx, conn)
 	if err != nil {
 		return err
 	}
 
 	if fi.IsDir {
-		err = delete(c.config, path, true)
+		_, err = delete(ctx, c.config, path, true)
 	} else {
-		err = delete(c.config, path, false)
+		_, err = delete(ctx, c.config, path, false)
 	}
 
 	if err != nil {
-		fmt.Println(err.Error())
+		logger.Debug("delete failed", "op", "delete", "path", path, "err", err)
 		return err
 	}
 
 	return nil
 }
 
+// DeleteMany deletes the files and directories at paths, directories with everything below them, in as few
+// transactions as possible instead of one per path. A path below another one in paths is deleted along with it and
+// gets its result. The returned map has the error of every path, nil for the ones deleted, and the error joins the
+// failures
+func (c WalrusClient) DeleteMany(ctx context.Context, paths []string) (map[string]error, error) {
+	if err := c.check_writable(); err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		listed[fspath.Join(fspath.Separator, p)] = true
+	}
+	// the listed path a path is deleted with, itself unless an ancestor is listed too
+	deletedWith := func(p string) string {
+		rtn := p
+		for dir := fspath.Dir(p); dir != fspath.Separator; dir = fspath.Dir(dir) {
+			if listed[dir] {
+				rtn = dir
+			}
+		}
+		return rtn
+	}
+
+	pathErrs := make(map[string]error)
+	var targets []string
+	var isdir []bool
+	for _, p := range slices.Sorted(maps.Keys(listed)) {
+		if p == fspath.Separator {
+			pathErrs[p] = fmt.Errorf("cannot delete the walrus root")
+			continue
+		}
+		if deletedWith(p) != p {
+			continue
+		}
+		item, err := stat(ctx, c.config, p)
+		if err != nil {
+			pathErrs[p] = err
+			continue
+		}
+		if item == nil {
+			pathErrs[p] = typed_error(ErrNotFound, "path not found: %s", c.config.walrus_uri(p))
+			continue
+		}
+		targets = append(targets, p)
+		isdir = append(isdir, item.IsDir)
+	}
+	logger.Info("deleting", "op", "delete_many", "paths", len(paths), "targets", len(targets))
+	for i, err := range delete_many(ctx, c.config, targets, isdir) {
+		pathErrs[targets[i]] = err
+	}
+
+	results := make(map[string]error, len(paths))
+	var failed []error
+	for _, p := range paths {
+		clean := fspath.Join(fspath.Separator, p)
+		err := pathErrs[clean]
+		if clean != fspath.Separator {
+			err = pathErrs[deletedWith(clean)]
+		}
+		results[p] = err
+		if err != nil {
+			failed = append(failed, fmt.Errorf("cannot delete %s: %w", p, err))
+		}
+	}
+	return results, errors.Join(failed...)
+}
+
 func (c WalrusClient) listFilesPrefix(ctx context.Context, dirPath string, fileCallback func(*ListDirFileItem) (bool, error)) error {
-	items, err := list_directory(c.config, dirPath)
+	items, err := list_directory(ctx, c.config, dirPath)
 	if err != nil {
 		return err
 	}
@@ -652,6 +2028,304 @@ func (c WalrusClient) listFilesPrefix(ctx context.Context, dirPath string, fileC
 	return nil
 }
 
+// walkTree calls walkFn for every file and directory below dirPath, descending into subdirectories
+func (c WalrusClient) walkTree(ctx context.Context, dirPath string, walkFn func(path string, item *ListDirFileItem) error) error {
+	if dirPath == "" {
+		dirPath = fspath.Separator
+	}
+	return c.listFilesPrefix(ctx, dirPath, func(item *ListDirFileItem) (bool, error) {
+		if ctx.Err() != nil {
+			return false, context.Cause(ctx)
+		}
+		path := fspath.Join(dirPath, item.Name)
+		if err := walkFn(path, item); err != nil {
+			return false, err
+		}
+		if item.IsDir {
+			if err := c.walkTree(ctx, path, walkFn); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+}
+
+// Walk calls walkFn for every file and directory below the walrus directory conn, parents before their children.
+// The Path of each FileInfo is its walrus path
+func (c WalrusClient) Walk(ctx context.Context, conn *connparse.Connection, walkFn func(info *wshrpc.FileInfo) error) error {
+	return c.walkTree(ctx, conn.Path, func(path string, item *ListDirFileItem) error {
+		return walkFn(&wshrpc.FileInfo{
+			Name:    item.Name,
+			Path:    path,
+			Dir:     fspath.Dir(path),
+			IsDir:   item.IsDir,
+			Size:    item.Size,
+			ModTime: item.CreateTs,
+		})
+	})
+}
+
+// walkDirAll calls fileFn for every file below the directory object dirobj of res, basePath is the path of dirobj
+func walkDirAll(res *DirAllResult, dirobj string, basePath string, fileFn func(path string, item *ListDirFileItem)) {
+	walkDirAllEntries(res, dirobj, basePath, func(path string, item *ListDirFileItem) bool {
+		if !item.IsDir {
+			fileFn(path, item)
+		}
+		return true
+	})
+}
+
+// walkDirAllEntries calls entryFn for every file and directory below the directory object dirobj of res, a directory
+// before its contents. It stops when entryFn returns false and reports whether the walk finished
+func walkDirAllEntries(res *DirAllResult, dirobj string, basePath string, entryFn func(path string, item *ListDirFileItem) bool) bool {
+	dir := res.Dirs[dirobj]
+	for name, fid := range dir.ChildrenFiles {
+		item := res.Files[fid]
+		item.Name = name
+		if !entryFn(fspath.Join(basePath, name), &item) {
+			return false
+		}
+	}
+	for name, did := range dir.ChildrenDirectories {
+		sub := res.Dirs[did]
+		item := ListDirFileItem{Name: name, IsDir: true, CreateTs: sub.CreateTs, Tags: sub.Tags}
+		path := fspath.Join(basePath, name)
+		if !entryFn(path, &item) || !walkDirAllEntries(res, did, path, entryFn) {
+			return false
+		}
+	}
+	return true
+}
+
+// collectFiles calls fileFn for every file below dirPath
+func (c WalrusClient) collectFiles(ctx context.Context, dirPath string, fileFn func(path string, item *ListDirFileItem)) error {
+	return c.collectEntries(ctx, dirPath, func(path string, item *ListDirFileItem) bool {
+		if !item.IsDir {
+			fileFn(path, item)
+		}
+		return true
+	})
+}
+
+// collectEntries calls entryFn for every file and directory below dirPath until it returns false. Each directory
+// subtree is fetched with a single get_dir_all, the root is not a directory object so its entries are listed first.
+// A directory the root listing names more than once is passed to entryFn each time but only walked once
+func (c WalrusClient) collectEntries(ctx context.Context, dirPath string, entryFn func(path string, item *ListDirFileItem) bool) error {
+	dirPath = strings.TrimSuffix(dirPath, fspath.Separator)
+	if dirPath != "" {
+		res, err := get_dir_all(ctx, c.config, dirPath)
+		if err != nil {
+			return err
+		}
+		walkDirAllEntries(res, res.Dirobj, dirPath, entryFn)
+		return nil
+	}
+
+	walked := make(map[string]bool)
+	return c.listFilesPrefix(ctx, fspath.Separator, func(item *ListDirFileItem) (bool, error) {
+		if ctx.Err() != nil {
+			return false, context.Cause(ctx)
+		}
+		path := fspath.Join(fspath.Separator, item.Name)
+		if !entryFn(path, item) {
+			return false, nil
+		}
+		if !item.IsDir || walked[path] {
+			return true, nil
+		}
+		walked[path] = true
+		stopped := false
+		if err := c.collectEntries(ctx, path, func(path string, item *ListDirFileItem) bool {
+			stopped = !entryFn(path, item)
+			return !stopped
+		}); err != nil {
+			return false, err
+		}
+		return !stopped, nil
+	})
+}
+
+// TagQuery selects files by their tags
+type TagQuery struct {
+	Tags []string
+	// MatchAll requires every tag to be present, otherwise any one of them is enough
+	MatchAll bool
+}
+
+func (q TagQuery) matches(tags []string) bool {
+	if len(q.Tags) == 0 {
+		return false
+	}
+	for _, tag := range q.Tags {
+		found := slices.Contains(tags, tag)
+		if found && !q.MatchAll {
+			return true
+		}
+		if !found && q.MatchAll {
+			return false
+		}
+	}
+	return q.MatchAll
+}
+
+// FindByTag returns the files below conn that are tagged with tag
+func (c WalrusClient) FindByTag(ctx context.Context, conn *connparse.Connection, tag string) ([]*wshrpc.FileInfo, error) {
+	return c.FindByTags(ctx, conn, TagQuery{Tags: []string{tag}})
+}
+
+// FindByTags returns the files below conn whose tags match query, sorted by path
+func (c WalrusClient) FindByTags(ctx context.Context, conn *connparse.Connection, query TagQuery) ([]*wshrpc.FileInfo, error) {
+	if len(query.Tags) == 0 {
+		return nil, fmt.Errorf("no tags to search for")
+	}
+	currentEpoch, err := current_epoch(ctx, c.config)
+	if err != nil {
+		logger.Warn("cannot get current walrus epoch", "err", err)
+	}
+
+	rtn := make([]*wshrpc.FileInfo, 0)
+	err = c.collectFiles(ctx, conn.Path, func(path string, item *ListDirFileItem) {
+		if !query.matches(item.Tags) {
+			return
+		}
+		itemPath := fspath.Join(fspath.Separator, path)
+		finfo := &wshrpc.FileInfo{
+			Name:              item.Name,
+			IsDir:             false,
+			Dir:               fsutil.GetParentPathString(c.config.walrus_uri(itemPath)),
+			Path:              c.config.walrus_uri(itemPath),
+			ModTime:           item.CreateTs,
+			Size:              item.Size,
+			WalrusBlobId:      item.WalrusBlobId,
+			WalrusBlobIds:     item.WalrusBlobIds,
+			ContentSha256:     item.ContentSha256,
+			WalrusEpochTill:   item.WalrusEpochTill,
+			WalrusDeletable:   item.Deletable,
+			WalrusCertified:   item.Certified,
+			WalrusEncrypted:   item.Encrypted,
+			WalrusCompression: item.Compression,
+			MimeType:          item.MimeType,
+			Tags:              item.Tags,
+		}
+		c.setExpiry(finfo, currentEpoch)
+		fileutil.AddMimeTypeToFileInfo(finfo.Path, finfo)
+		rtn = append(rtn, finfo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(rtn, func(a, b *wshrpc.FileInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return rtn, nil
+}
+
+// Glob returns the files and directories below conn whose path relative to conn matches pattern, sorted by path.
+// Each element of pattern is matched with path.Match, and a ** element matches any number of directories, so
+// **/*.log finds the log files at any depth. The leading elements without wildcards pick the directory to search,
+// whose subtree is fetched with a single get_dir_all. A directory that doesn't exist matches nothing
+func (c WalrusClient) Glob(ctx context.Context, conn *connparse.Connection, pattern string) ([]*wshrpc.FileInfo, error) {
+	pattern = strings.Trim(pattern, fspath.Separator)
+	if pattern == "" {
+		return nil, fmt.Errorf("empty glob pattern")
+	}
+	elems := strings.Split(pattern, fspath.Separator)
+	for _, elem := range elems {
+		if elem == "." || elem == ".." {
+			return nil, fmt.Errorf("invalid glob pattern %q: %s is not allowed", pattern, elem)
+		}
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+
+	basePath := fspath.Join(fspath.Separator, conn.Path)
+	for len(elems) > 1 && !has_glob_meta(elems[0]) {
+		basePath = fspath.Join(basePath, elems[0])
+		elems = elems[1:]
+	}
+	rtn := make([]*wshrpc.FileInfo, 0)
+	if basePath != fspath.Separator {
+		item, err := stat(ctx, c.config, basePath)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil || !item.IsDir {
+			return rtn, nil
+		}
+	}
+
+	currentEpoch, err := current_epoch(ctx, c.config)
+	if err != nil {
+		logger.Warn("cannot get current walrus epoch", "err", err)
+	}
+	err = c.collectEntries(ctx, basePath, func(itemPath string, item *ListDirFileItem) bool {
+		rel := strings.TrimPrefix(strings.TrimPrefix(itemPath, basePath), fspath.Separator)
+		if glob_match(elems, strings.Split(rel, fspath.Separator)) {
+			rtn = append(rtn, c.entryInfo(itemPath, item, currentEpoch))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(rtn, func(a, b *wshrpc.FileInfo) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return rtn, nil
+}
+
+// has_glob_meta reports whether a pattern element has any of the special characters of path.Match
+func has_glob_meta(elem string) bool {
+	return strings.ContainsAny(elem, `*?[\`)
+}
+
+// glob_match reports whether the path elements name match the pattern elements, a ** element matches zero or more
+// path elements and every other one is matched with path.Match. The pattern has been checked to be well formed
+func glob_match(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if glob_match(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], name[0])
+	return matched && glob_match(pattern[1:], name[1:])
+}
+
+// DiskUsage returns the total size in bytes and the number of files below conn, or the size of conn if it is a file
+func (c WalrusClient) DiskUsage(ctx context.Context, conn *connparse.Connection) (int64, int, error) {
+	finfo, err := c.statPath(ctx, conn)
+	if err != nil {
+		return 0, 0, err
+	}
+	if finfo.NotFound {
+		return 0, 0, typed_error(ErrNotFound, "path not found: %s", conn.GetFullURI())
+	}
+	if !finfo.IsDir {
+		return finfo.Size, 1, nil
+	}
+
+	var total int64
+	count := 0
+	err = c.collectFiles(ctx, conn.Path, func(path string, item *ListDirFileItem) {
+		total += item.Size
+		count++
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return total, count, nil
+}
+
 func (c WalrusClient) Join(ctx context.Context, conn *connparse.Connection, parts ...string) (*wshrpc.FileInfo, error) {
 	var joinParts []string
 	if conn.Path == "" || conn.Path == fspath.Separator {
@@ -670,7 +2344,9 @@ func (c WalrusClient) GetConnectionType() string {
 
 func (c WalrusClient) GetCapability() wshrpc.FileShareCapability {
 	return wshrpc.FileShareCapability{
+		// an append publishes the whole file again and records it on chain, callers that append chunk by chunk
+		// would pay for the file once per chunk, so they write it in one go instead
 		CanAppend: false,
-		CanMkdir:  true,
+		CanMkdir:  !c.config.readOnly,
 	}
 }
@@ -0,0 +1,1933 @@
+package walrusfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/block-vision/sui-go-sdk/models"
+	"github.com/block-vision/sui-go-sdk/sui"
+	"github.com/block-vision/sui-go-sdk/utils"
+	"github.com/fardream/go-bcs/bcs"
+	"github.com/holiman/uint256"
+	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fspath"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fstype"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fsutil"
+	"github.com/wavetermdev/waveterm/pkg/util/fileutil"
+	"github.com/wavetermdev/waveterm/pkg/util/iochan/iochantypes"
+	"github.com/wavetermdev/waveterm/pkg/util/tarcopy"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+func TestSetExpiry(t *testing.T) {
+	t.Parallel()
+
+	c := WalrusClient{config: &WalrusFsConfig{expiryWarnEpochs: 2}}
+	tests := []struct {
+		name         string
+		epochTill    int64
+		currentEpoch int64
+		isDir        bool
+		wantLeft     int64
+		wantExpiring bool
+	}{
+		{"plenty left", 20, 10, false, 10, false},
+		{"at threshold", 12, 10, false, 2, false},
+		{"near expiry", 11, 10, false, 1, true},
+		{"expired", 8, 10, false, 0, true},
+		{"unknown current epoch", 20, 0, false, 0, false},
+		{"directory", 11, 10, true, 0, false},
+	}
+
+	for _, test := range tests {
+		finfo := &wshrpc.FileInfo{WalrusEpochTill: test.epochTill, IsDir: test.isDir}
+		c.setExpiry(finfo, test.currentEpoch)
+		if finfo.WalrusEpochsLeft != test.wantLeft || finfo.WalrusExpiring != test.wantExpiring {
+			t.Errorf("%s: got left=%d expiring=%v, want left=%d expiring=%v", test.name,
+				finfo.WalrusEpochsLeft, finfo.WalrusExpiring, test.wantLeft, test.wantExpiring)
+		}
+	}
+}
+
+func TestTagQueryMatches(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"project:foo", "env:prod"}
+	tests := []struct {
+		name  string
+		query TagQuery
+		want  bool
+	}{
+		{"single tag", TagQuery{Tags: []string{"env:prod"}}, true},
+		{"missing tag", TagQuery{Tags: []string{"env:dev"}}, false},
+		{"any of", TagQuery{Tags: []string{"env:dev", "project:foo"}}, true},
+		{"all of", TagQuery{Tags: []string{"env:prod", "project:foo"}, MatchAll: true}, true},
+		{"all of with one missing", TagQuery{Tags: []string{"env:dev", "project:foo"}, MatchAll: true}, false},
+		{"no tags", TagQuery{MatchAll: true}, false},
+	}
+
+	for _, test := range tests {
+		if got := test.query.matches(tags); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "dir/a.log", false},
+		{"2024-*/report.csv", "2024-01/report.csv", true},
+		{"2024-*/report.csv", "2023-01/report.csv", false},
+		{"2024-*/report.csv", "2024-01/sub/report.csv", false},
+		{"**/*.log", "a.log", true},
+		{"**/*.log", "dir/sub/a.log", true},
+		{"dir/**", "dir", true},
+		{"dir/**", "dir/sub/a.txt", true},
+		{"dir/**/a.txt", "dir/x/y/a.txt", true},
+		{"dir/**/a.txt", "other/a.txt", false},
+		{"**/sub/**/*.txt", "dir/sub/x/a.txt", true},
+		{"file?.txt", "file1.txt", true},
+		{"[ab].txt", "c.txt", false},
+	}
+
+	for _, test := range tests {
+		got := glob_match(strings.Split(test.pattern, "/"), strings.Split(test.name, "/"))
+		if got != test.want {
+			t.Errorf("%s against %s: got %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	t.Parallel()
+
+	c, _ := newFakeChainClient("test-glob")
+	expires := time.Now().Add(time.Hour)
+	listings.putList(c.config.root, "/", []ListDirFileItem{{Name: "b.log"}, {Name: "a.log"}, {Name: "c.txt"}}, expires)
+	listings.putStat(c.config.root, "/missing", nil, expires)
+	ctx := context.Background()
+
+	infos, err := c.Glob(ctx, walrusConn("/"), "*.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.Path)
+	}
+	if want := []string{"walrus:///a.log", "walrus:///b.log"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if infos, err := c.Glob(ctx, walrusConn("/"), "missing/*.log"); err != nil || len(infos) != 0 {
+		t.Errorf("got %d matches, %v in a missing directory", len(infos), err)
+	}
+	for _, pattern := range []string{"", "[a", "../*.log"} {
+		if _, err := c.Glob(ctx, walrusConn("/"), pattern); err == nil {
+			t.Errorf("no error for the glob pattern %q", pattern)
+		}
+	}
+}
+
+func TestWalkDirAll(t *testing.T) {
+	t.Parallel()
+
+	res := &DirAllResult{
+		Dirobj: "1",
+		Dirs: map[string]DirItem{
+			"1": {ChildrenFiles: map[string]string{"a.txt": "3"}, ChildrenDirectories: map[string]string{"sub": "2"}},
+			"2": {ChildrenFiles: map[string]string{"b.txt": "4"}},
+		},
+		Files: map[string]ListDirFileItem{
+			"3": {Size: 10},
+			"4": {Size: 20},
+		},
+	}
+
+	sizes := make(map[string]int64)
+	walkDirAll(res, res.Dirobj, "/docs", func(path string, item *ListDirFileItem) {
+		sizes[path] = item.Size
+		if item.Name != fspath.Base(path) {
+			t.Errorf("item name %q doesn't match path %q", item.Name, path)
+		}
+	})
+	if len(sizes) != 2 || sizes["/docs/a.txt"] != 10 || sizes["/docs/sub/b.txt"] != 20 {
+		t.Errorf("unexpected files: %v", sizes)
+	}
+}
+
+func TestWalkDirAllEntries(t *testing.T) {
+	t.Parallel()
+
+	res := &DirAllResult{
+		Dirobj: "1",
+		Dirs: map[string]DirItem{
+			"1": {ChildrenDirectories: map[string]string{"sub": "2"}},
+			"2": {CreateTs: 5, Tags: []string{"t"}, ChildrenFiles: map[string]string{"b.txt": "4"}, ChildrenDirectories: map[string]string{"deep": "3"}},
+			"3": {ChildrenFiles: map[string]string{"c.txt": "5"}},
+		},
+		Files: map[string]ListDirFileItem{
+			"4": {Size: 20},
+			"5": {Size: 30},
+		},
+	}
+
+	var paths []string
+	walkDirAllEntries(res, res.Dirobj, "/docs", func(path string, item *ListDirFileItem) bool {
+		if path == "/docs/sub" && (!item.IsDir || item.CreateTs != 5 || len(item.Tags) != 1) {
+			t.Errorf("unexpected directory entry %+v", item)
+		}
+		if strings.HasPrefix(path, "/docs/sub/") && !slices.Contains(paths, "/docs/sub") {
+			t.Errorf("%s was walked before its directory", path)
+		}
+		paths = append(paths, path)
+		return true
+	})
+	slices.Sort(paths)
+	want := []string{"/docs/sub", "/docs/sub/b.txt", "/docs/sub/deep", "/docs/sub/deep/c.txt"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got entries %v, want %v", paths, want)
+	}
+
+	count := 0
+	finished := walkDirAllEntries(res, res.Dirobj, "/docs", func(path string, item *ListDirFileItem) bool {
+		count++
+		return count < 2
+	})
+	if finished || count != 2 {
+		t.Errorf("walk didn't stop, finished %v after %d entries", finished, count)
+	}
+}
+
+func TestCopyRecursiveConcurrency(t *testing.T) {
+	const limit = 3
+	var inFlight, maxInFlight atomic.Int32
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("content of " + strings.TrimPrefix(r.URL.Path, "/v1/blobs/")))
+	}))
+	defer aggregator.Close()
+
+	res := &DirAllResult{
+		Dirobj: "d0",
+		Files:  map[string]ListDirFileItem{},
+		Dirs: map[string]DirItem{
+			"d0": {ChildrenFiles: map[string]string{}, ChildrenDirectories: map[string]string{"sub": "d1"}},
+			"d1": {ChildrenFiles: map[string]string{}, ChildrenDirectories: map[string]string{}},
+		},
+	}
+	want := map[string]string{}
+	var totalSize int64
+	for i := 0; i < 12; i++ {
+		dirobj, dir := "d0", "top"
+		if i%2 == 1 {
+			dirobj, dir = "d1", filepath.Join("top", "sub")
+		}
+		fid, name := fmt.Sprintf("f%d", i), fmt.Sprintf("file%d.txt", i)
+		content := fmt.Sprintf("content of blob%d", i)
+		res.Files[fid] = ListDirFileItem{Name: name, Size: int64(len(content)), WalrusBlobId: fmt.Sprintf("blob%d", i)}
+		res.Dirs[dirobj].ChildrenFiles[name] = fid
+		want[filepath.Join(dir, name)] = content
+		totalSize += int64(len(content))
+	}
+
+	c := WalrusClient{config: &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: time.Second, copyConcurrency: limit}}
+	dest := t.TempDir()
+	var updates []wshrpc.FileCopyProgress
+	progress := func(p wshrpc.FileCopyProgress) { updates = append(updates, p) }
+	if ok, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictFail, progress); !ok || err != nil {
+		t.Fatalf("CopyRecursive = %v, %v", ok, err)
+	}
+	if maxInFlight.Load() > limit {
+		t.Errorf("expected at most %d concurrent downloads, got %d", limit, maxInFlight.Load())
+	}
+	for name, content := range want {
+		b, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil {
+			t.Errorf("%s was not written: %v", name, err)
+		} else if string(b) != content {
+			t.Errorf("%s has content %q, want %q", name, b, content)
+		}
+	}
+
+	if len(updates) != len(want)+1 {
+		t.Fatalf("expected %d progress updates, got %d", len(want)+1, len(updates))
+	}
+	for i, p := range updates {
+		if p.FilesDone != i || p.FilesTotal != len(want) || p.BytesTotal != totalSize {
+			t.Errorf("unexpected progress update %d: %+v", i, p)
+		}
+	}
+	if last := updates[len(updates)-1]; last.BytesDone != totalSize {
+		t.Errorf("expected %d bytes done, got %d", totalSize, last.BytesDone)
+	}
+
+	if ok, err := c.CopyRecursive(context.Background(), dest, "top", res.Dirobj, res, ConflictFail, nil); ok || err == nil {
+		t.Errorf("expected copying onto an existing destination to fail")
+	}
+}
+
+func TestCopyRecursiveModTimes(t *testing.T) {
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer aggregator.Close()
+
+	createTs := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC).UnixMilli()
+	res := &DirAllResult{
+		Dirobj: "d0",
+		Files: map[string]ListDirFileItem{
+			"f0": {Name: "old.txt", Size: 7, WalrusBlobId: "blob0", CreateTs: createTs},
+			"f1": {Name: "nots.txt", Size: 7, WalrusBlobId: "blob1"},
+		},
+		Dirs: map[string]DirItem{
+			"d0": {ChildrenFiles: map[string]string{"old.txt": "f0", "nots.txt": "f1"}, ChildrenDirectories: map[string]string{}},
+		},
+	}
+	c := WalrusClient{config: &WalrusFsConfig{aggregatorUrl: aggregator.URL, httpTimeout: time.Second}}
+	dest := t.TempDir()
+	start := time.Now().Add(-time.Second)
+
+	if _, err := c.CopyRecursive(context.Background(), dest, "kept", res.Dirobj, res, ConflictFail, nil); err != nil {
+		t.Fatalf("CopyRecursive: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "kept", "old.txt")); err != nil || fi.ModTime().UnixMilli() != createTs {
+		t.Errorf("expected old.txt to keep its walrus creation time, got %v, %v", fi, err)
+	}
+	// without a creation time the file keeps the time it was written
+	if fi, err := os.Stat(filepath.Join(dest, "kept", "nots.txt")); err != nil || fi.ModTime().Before(start) {
+		t.Errorf("expected nots.txt to have the time of the copy, got %v, %v", fi, err)
+	}
+
+	if _, err := c.CopyRecursive(WithPreserveTimes(context.Background(), false), dest, "now", res.Dirobj, res, ConflictFail, nil); err != nil {
+		t.Fatalf("CopyRecursive: %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dest, "now", "old.txt")); err != nil || fi.ModTime().Before(start) {
+		t.Errorf("expected old.txt to have the time of the copy, got %v, %v", fi, err)
+	}
+
+	if got := copy_create_ts(context.Background(), createTs); got != createTs {
+		t.Errorf("copy_create_ts = %d, want %d", got, createTs)
+	}
+	if got := copy_create_ts(WithPreserveTimes(context.Background(), false), createTs); got != 0 {
+		t.Errorf("copy_create_ts without preserving times = %d, want 0", got)
+	}
+}
+
+func TestModTimeUnits(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content"))
+	}))
+	defer aggregator.Close()
+
+	// the chain clock records ms, every FileInfo.ModTime has to be the same
+	want := time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+	item := &ListDirFileItem{Name: "old.txt", CreateTs: want.UnixMilli(), Size: 7, WalrusBlobId: "blob0"}
+	config := &WalrusFsConfig{root: "test-mod-time-units", cacheTTL: time.Hour, aggregatorUrl: aggregator.URL, httpTimeout: time.Second, rpcUrl: newTestRpc(t, true).URL}
+	listings.putStat(config.root, "/old.txt", item, time.Now().Add(time.Hour))
+	c := WalrusClient{config: config}
+	conn := &connparse.Connection{Scheme: "walrus", Path: "/old.txt"}
+
+	if got := time.UnixMilli(c.entryInfo("/old.txt", item, 0).ModTime).UTC(); !got.Equal(want) {
+		t.Errorf("listed modification time is %v, want %v", got, want)
+	}
+	finfo, err := c.Stat(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if got := time.UnixMilli(finfo.ModTime).UTC(); !got.Equal(want) {
+		t.Errorf("stat modification time is %v, want %v", got, want)
+	}
+	if got := fileutil.ToFsFileInfo(finfo).ModTime().UTC(); !got.Equal(want) {
+		t.Errorf("fs.FileInfo modification time is %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	var headers int
+	err = tarcopy.TarCopyDest(ctx, cancel, c.ReadTarStream(ctx, conn, nil), func(next *tar.Header, reader *tar.Reader, singleFile bool) error {
+		headers++
+		if !next.ModTime.Equal(want) {
+			t.Errorf("tar header of %s has modification time %v, want %v", next.Name, next.ModTime.UTC(), want)
+		}
+		return nil
+	})
+	if err != nil || headers != 1 {
+		t.Errorf("expected one tar entry, got %d: %v", headers, err)
+	}
+}
+
+// stubCopyDest is a copy destination like s3 for PrefixCopyRemote, only Stat is called on it. Paths in dirs exist as
+// directories, everything else is missing
+type stubCopyDest struct {
+	fstype.FileShareClient
+	dirs []string
+}
+
+func (d stubCopyDest) Stat(ctx context.Context, conn *connparse.Connection) (*wshrpc.FileInfo, error) {
+	if slices.Contains(d.dirs, conn.Path) {
+		return &wshrpc.FileInfo{Path: conn.Path, IsDir: true}, nil
+	}
+	return &wshrpc.FileInfo{Path: conn.Path, NotFound: true}, nil
+}
+
+func TestCopyToRemote(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + fspath.Base(r.URL.Path)))
+	}))
+	defer aggregator.Close()
+
+	config := &WalrusFsConfig{root: "test-copy-to-remote", cacheTTL: time.Hour, aggregatorUrl: aggregator.URL, httpTimeout: time.Second, rpcUrl: newTestRpc(t, true).URL}
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	listings.putList(config.root, "/dir", []ListDirFileItem{{Name: "a.txt", Size: 16, WalrusBlobId: "blobA"}, {Name: "sub", IsDir: true}}, expires)
+	listings.putList(config.root, "/dir/sub", []ListDirFileItem{{Name: "b.txt", Size: 16, WalrusBlobId: "blobB"}}, expires)
+	c := WalrusClient{config: config}
+	dest := stubCopyDest{dirs: []string{"prefix"}}
+
+	srcConn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: "/dir"}
+	var lock sync.Mutex
+	written := make(map[string]string)
+	isDir, err := fsutil.PrefixCopyRemote(context.Background(), srcConn, &connparse.Connection{Scheme: "s3", Host: "bucket", Path: "prefix"}, c, dest, func(host, path string, size int64, reader io.Reader) error {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		written[host+":"+path] = string(data)
+		return nil
+	}, &wshrpc.FileCopyOpts{Recursive: true})
+	if err != nil || !isDir {
+		t.Fatalf("expected a completed directory copy, got %v: %v", isDir, err)
+	}
+	want := map[string]string{"bucket:prefix/dir/a.txt": "content of blobA", "bucket:prefix/dir/sub/b.txt": "content of blobB"}
+	if len(written) != len(want) {
+		t.Errorf("unexpected files written: %v", written)
+	}
+	for k, v := range want {
+		if written[k] != v {
+			t.Errorf("%s: got %q, want %q", k, written[k], v)
+		}
+	}
+
+	// a failed write fails the copy
+	_, err = fsutil.PrefixCopyRemote(context.Background(), srcConn, &connparse.Connection{Scheme: "s3", Host: "bucket", Path: "prefix"}, c, dest, func(host, path string, size int64, reader io.Reader) error {
+		return errors.New("put failed")
+	}, &wshrpc.FileCopyOpts{Recursive: true})
+	if err == nil || !strings.Contains(err.Error(), "put failed") {
+		t.Errorf("expected the put error, got %v", err)
+	}
+}
+
+// stubCopySource is a copy source like s3 for CopyRemote, a directory /src holding files by their path relative to it
+type stubCopySource struct {
+	fstype.FileShareClient
+	files map[string]string
+}
+
+func (s stubCopySource) Stat(ctx context.Context, conn *connparse.Connection) (*wshrpc.FileInfo, error) {
+	return &wshrpc.FileInfo{Path: conn.Path, Name: fspath.Base(conn.Path), IsDir: true}, nil
+}
+
+func (s stubCopySource) ReadTarStream(ctx context.Context, conn *connparse.Connection, opts *wshrpc.FileCopyOpts) <-chan wshrpc.RespOrErrorUnion[iochantypes.Packet] {
+	rtn, writeHeader, fileWriter, tarClose := tarcopy.TarCopySrc(ctx, fspath.Separator)
+	go func() {
+		defer tarClose()
+		for _, name := range slices.Sorted(maps.Keys(s.files)) {
+			content := s.files[name]
+			finfo := &wshrpc.FileInfo{Name: fspath.Base(name), Size: int64(len(content)), Mode: fstype.FileMode}
+			if err := writeHeader(fileutil.ToFsFileInfo(finfo), "/src/"+name, false); err != nil {
+				rtn <- wshutil.RespErr[iochantypes.Packet](err)
+				return
+			}
+			if _, err := io.WriteString(fileWriter, content); err != nil {
+				rtn <- wshutil.RespErr[iochantypes.Packet](err)
+				return
+			}
+		}
+	}()
+	return rtn
+}
+
+func TestCopyRemote(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var lastBody atomic.Value
+	c, chain := newFakeChainClient("test-copy-remote")
+	// the directories created on the way drop the cached stats below them
+	chain.inspectMissing = true
+	c.config.publisherUrls = []string{newTestPublisher(t, http.StatusOK, &requests, &lastBody).URL}
+	c.config.httpTimeout = time.Second
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/dest", &ListDirFileItem{Name: "dest", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/dest/src", nil, expires)
+	listings.putStat(c.config.root, "/dest/src/sub", nil, expires)
+	src := stubCopySource{files: map[string]string{"a.txt": "aaa", "empty.txt": "", "sub/b.txt": "bbbbbbb"}}
+
+	srcConn := &connparse.Connection{Scheme: "s3", Host: "bucket", Path: "/src"}
+	isDir, err := c.CopyRemote(context.Background(), srcConn, walrusConn("/dest"), src, &wshrpc.FileCopyOpts{Recursive: true})
+	if err != nil || !isDir {
+		t.Fatalf("expected a completed directory copy, got %v: %v", isDir, err)
+	}
+	sizes := make(map[string]string)
+	for _, call := range chain.calls {
+		if call.Function == "add_file" {
+			sizes[call.Arguments[2].(string)] = call.Arguments[4].(string)
+		}
+	}
+	want := map[string]string{"/dest/src/a.txt": "3", "/dest/src/empty.txt": "0", "/dest/src/sub/b.txt": "7"}
+	if !maps.Equal(sizes, want) {
+		t.Errorf("got files added with sizes %v, want %v", sizes, want)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d blobs published, want one per file", got)
+	}
+}
+
+func TestBase64BodyStreaming(t *testing.T) {
+	defer func(delay time.Duration) { publishRetryBaseDelay = delay }(publishRetryBaseDelay)
+	publishRetryBaseDelay = time.Millisecond
+
+	const size = 24 << 20
+	content := bytes.Repeat([]byte("walrus streaming upload\n"), size/24)
+	want := sha256.Sum256(content)
+	data64 := base64.StdEncoding.EncodeToString(content)
+	content = nil
+
+	var requests atomic.Int32
+	var got atomic.Value
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// fail the first attempt after reading the body, so the retry needs a rewind
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.ContentLength != size {
+			t.Errorf("expected content length %d, got %d", size, r.ContentLength)
+		}
+		h := sha256.New()
+		io.Copy(h, r.Body)
+		got.Store(h.Sum(nil))
+		w.Write([]byte(`{"newlyCreated": {"blobObject": {"blobId": "blob1", "registeredEpoch": 3, "storage": {"endEpoch": 8}}}}`))
+	}))
+	defer publisher.Close()
+	config := &WalrusFsConfig{publisherUrls: []string{publisher.URL}, httpTimeout: 10 * time.Second}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	body, err := newBase64Body(data64)
+	if err != nil {
+		t.Fatalf("newBase64Body: %v", err)
+	}
+	if body.size != size {
+		t.Fatalf("expected decoded size %d, got %d", size, body.size)
+	}
+	mimeType, rest, err := detect_content_type("upload", body)
+	if err != nil || mimeType != "text/plain; charset=utf-8" {
+		t.Fatalf("detect_content_type = %q, %v", mimeType, err)
+	}
+	if _, err := publish_blob(context.Background(), config, rest, body.size, 1); err != nil {
+		t.Fatalf("publish_blob: %v", err)
+	}
+
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("expected the upload to stream, but %d bytes were allocated for a %d byte file", allocated, size)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 publish attempts, got %d", requests.Load())
+	}
+	if sum, _ := got.Load().([]byte); !bytes.Equal(sum, want[:]) {
+		t.Errorf("publisher received different content")
+	}
+
+	if _, err := newBase64Body("not base64!"); err == nil {
+		t.Errorf("expected an error for corrupt base64 data")
+	}
+}
+
+func TestBase64BodySeek(t *testing.T) {
+	t.Parallel()
+
+	content := "walrus chunked upload"
+	body, err := newBase64Body(base64.StdEncoding.EncodeToString([]byte(content)))
+	if err != nil {
+		t.Fatalf("newBase64Body: %v", err)
+	}
+	for _, offset := range []int64{0, 1, 2, 3, 7, 20, 21} {
+		if pos, err := body.Seek(offset, io.SeekStart); err != nil || pos != offset {
+			t.Fatalf("Seek(%d) = %d, %v", offset, pos, err)
+		}
+		rest, err := io.ReadAll(body)
+		if err != nil || string(rest) != content[offset:] {
+			t.Errorf("after Seek(%d) read %q, %v", offset, rest, err)
+		}
+	}
+	if _, err := body.Seek(22, io.SeekStart); err == nil {
+		t.Errorf("expected an error seeking past the end")
+	}
+}
+
+func TestListFilesPrefixCachedItems(t *testing.T) {
+	t.Parallel()
+
+	// serve the listing from the cache so no chain access is needed
+	config := &WalrusFsConfig{root: "test-list-files-prefix", cacheTTL: time.Hour}
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	var items []ListDirFileItem
+	for _, name := range names {
+		items = append(items, ListDirFileItem{Name: name})
+	}
+	listings.putList(config.root, "/dir", items, time.Now().Add(time.Hour))
+
+	c := WalrusClient{config: config}
+	list := func(modify bool) []string {
+		var seen []string
+		err := c.listFilesPrefix(context.Background(), "/dir", func(item *ListDirFileItem) (bool, error) {
+			seen = append(seen, item.Name)
+			if modify {
+				item.Name = "changed"
+			}
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("listFilesPrefix: %v", err)
+		}
+		return seen
+	}
+	// a callback changing its item leaves the cached listing as it was
+	list(true)
+	if got := list(false); !slices.Equal(got, names) {
+		t.Errorf("got %v, want %v", got, names)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Parallel()
+
+	valid := func() *WalrusFsConfig {
+		return &WalrusFsConfig{
+			pkg:           testRootId,
+			root:          testRootId,
+			publisherUrls: []string{"https://publisher.example.com"},
+			aggregatorUrl: "https://aggregator.example.com",
+			mnemonic:      testMnemonic,
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("unexpected error for a valid config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*WalrusFsConfig)
+		want   string
+	}{
+		{"empty package", func(c *WalrusFsConfig) { c.pkg = "" }, "walrusfs:package"},
+		{"short root", func(c *WalrusFsConfig) { c.root = "0xabc" }, "walrusfs:root"},
+		{"non hex root", func(c *WalrusFsConfig) { c.root = "0x" + strings.Repeat("z", 64) }, "walrusfs:root"},
+		{"no publisher", func(c *WalrusFsConfig) { c.publisherUrls = nil }, "walrusfs:publisher is not set"},
+		{"publisher without scheme", func(c *WalrusFsConfig) { c.publisherUrls = []string{"publisher.example.com"} }, "walrusfs:publisher"},
+		{"no aggregator", func(c *WalrusFsConfig) { c.aggregatorUrl = "" }, "walrusfs:aggregator is not set"},
+		{"bad rpc url", func(c *WalrusFsConfig) { c.rpcUrl = "ftp://rpc" }, "walrusfs:rpcurl"},
+		{"bad wallet", func(c *WalrusFsConfig) { c.wallet = "wallet" }, "walrusfs:wallet"},
+		{"no mnemonic", func(c *WalrusFsConfig) { c.mnemonic = "" }, "walrusfs:mnemonic is not set"},
+		{"unknown mnemonic source", func(c *WalrusFsConfig) { c.mnemonicSource = "vault" }, "walrusfs:mnemonicsource"},
+		{"unknown compression", func(c *WalrusFsConfig) { c.compression = "lz4" }, "walrusfs:compression"},
+		{"passphrase encryption key", func(c *WalrusFsConfig) { c.encryptionKey = "correct horse battery staple" }, "walrusfs:encryptionkey"},
+		{"short encryption key", func(c *WalrusFsConfig) { c.encryptionKey = secretString(strings.Repeat("ab", 16)) }, "walrusfs:encryptionkey"},
+		{"nested root name", func(c *WalrusFsConfig) { c.roots = map[string]string{"a/b": testRootId} }, "walrusfs:roots"},
+		{"dot root name", func(c *WalrusFsConfig) { c.roots = map[string]string{"..": testRootId} }, "walrusfs:roots"},
+		{"bad root object", func(c *WalrusFsConfig) { c.roots = map[string]string{"work": "0xabc"} }, "walrusfs:roots"},
+	}
+	for _, tc := range tests {
+		config := valid()
+		tc.modify(config)
+		err := config.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tc.name, err, tc.want)
+		}
+	}
+
+	config := valid()
+	config.encryptionKey = secretString(testEncryptionKey)
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error with an encryption key: %v", err)
+	}
+	config = valid()
+	config.mnemonic = ""
+	config.mnemonicSource = "env"
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error with an env mnemonic source: %v", err)
+	}
+	config.mnemonicSource = ""
+	config.txSigner = fakeSigner{address: testRootId}
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error with a custom signer: %v", err)
+	}
+	config.txSigner = nil
+	config.wallet = testRootId
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error with a wallet and no mnemonic: %v", err)
+	}
+
+	// a read only client needs neither a publisher nor a mnemonic, only an address to inspect as
+	config = valid()
+	config.readOnly = true
+	config.publisherUrls = nil
+	config.mnemonic = ""
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "walrusfs:wallet") {
+		t.Errorf("got error %v for a read only config without a wallet, want one about walrusfs:wallet", err)
+	}
+	config.wallet = testRootId
+	if err := config.Validate(); err != nil {
+		t.Errorf("unexpected error for a read only config with a wallet: %v", err)
+	}
+}
+
+func TestListEntriesPaths(t *testing.T) {
+	t.Parallel()
+
+	// serve the listings from the cache, the epoch lookup fails against the test rpc and is only logged
+	config := &WalrusFsConfig{root: "test-list-entries-paths", cacheTTL: time.Hour, rpcUrl: newTestRpc(t, true).URL}
+	expires := time.Now().Add(time.Hour)
+	listings.putList(config.root, "/", []ListDirFileItem{{Name: "dir", IsDir: true}, {Name: "a.txt"}}, expires)
+	listings.putList(config.root, "/dir", []ListDirFileItem{{Name: "sub/", IsDir: true}, {Name: "b.txt"}}, expires)
+	listings.putList(config.root, "/dir/sub", []ListDirFileItem{{Name: "/c.txt"}}, expires)
+
+	tests := []struct {
+		path    string
+		wantDir string
+		want    []string
+	}{
+		{"", "walrus:///", []string{"walrus:///a.txt", "walrus:///dir"}},
+		{"/", "walrus:///", []string{"walrus:///a.txt", "walrus:///dir"}},
+		{"/dir", "walrus:///dir/", []string{"walrus:///dir/b.txt", "walrus:///dir/sub"}},
+		{"/dir/", "walrus:///dir/", []string{"walrus:///dir/b.txt", "walrus:///dir/sub"}},
+		{"dir/sub/", "walrus:///dir/sub/", []string{"walrus:///dir/sub/c.txt"}},
+		{"//dir//sub", "walrus:///dir/sub/", []string{"walrus:///dir/sub/c.txt"}},
+	}
+	c := WalrusClient{config: config}
+	for _, tc := range tests {
+		var got []string
+		for resp := range c.ListEntriesStream(context.Background(), &connparse.Connection{Scheme: "walrus", Path: tc.path}, nil) {
+			if resp.Error != nil {
+				t.Fatalf("%q: %v", tc.path, resp.Error)
+			}
+			for _, info := range resp.Response.FileInfo {
+				if info.Dir != tc.wantDir {
+					t.Errorf("%q: entry %s has dir %q, want %q", tc.path, info.Path, info.Dir, tc.wantDir)
+				}
+				if !strings.HasSuffix(info.Path, "/"+info.Name) {
+					t.Errorf("%q: entry %s has name %q", tc.path, info.Path, info.Name)
+				}
+				got = append(got, info.Path)
+			}
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%q: got entries %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestListEntriesLimit(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{root: "test-list-entries-limit", cacheTTL: time.Hour, rpcUrl: newTestRpc(t, true).URL}
+	var items []ListDirFileItem
+	for i := 0; i < wshrpc.DirChunkSize+10; i++ {
+		items = append(items, ListDirFileItem{Name: fmt.Sprintf("f%03d", i)})
+	}
+	// a directory listed twice counts once
+	items = append(items, ListDirFileItem{Name: "sub", IsDir: true}, ListDirFileItem{Name: "sub/", IsDir: true})
+	listings.putList(config.root, "/dir", items, time.Now().Add(time.Hour))
+	c := WalrusClient{config: config}
+
+	var seen []string
+	opts := &wshrpc.FileListOpts{Limit: wshrpc.DirChunkSize + 5}
+	for page := 0; ; page++ {
+		if page > 2 {
+			t.Fatalf("listing didn't finish after %d pages", page)
+		}
+		var last wshrpc.CommandRemoteListEntriesRtnData
+		count := 0
+		for resp := range c.ListEntriesStream(context.Background(), &connparse.Connection{Scheme: "walrus", Path: "/dir"}, opts) {
+			if resp.Error != nil {
+				t.Fatal(resp.Error)
+			}
+			if last.Truncated {
+				t.Errorf("page %d: a chunk followed the truncated one", page)
+			}
+			if len(resp.Response.FileInfo) > wshrpc.DirChunkSize {
+				t.Errorf("page %d: chunk of %d entries", page, len(resp.Response.FileInfo))
+			}
+			for _, info := range resp.Response.FileInfo {
+				seen = append(seen, info.Name)
+			}
+			count += len(resp.Response.FileInfo)
+			last = resp.Response
+		}
+		if count > opts.Limit {
+			t.Errorf("page %d: got %d entries, over the limit of %d", page, count, opts.Limit)
+		}
+		if !last.Truncated {
+			break
+		}
+		if count != opts.Limit || last.Cursor != seen[len(seen)-1] {
+			t.Errorf("page %d: truncated after %d entries with cursor %q", page, count, last.Cursor)
+		}
+		opts.Cursor = last.Cursor
+	}
+	if len(seen) != wshrpc.DirChunkSize+11 || !slices.IsSorted(seen) || len(slices.Compact(slices.Clone(seen))) != len(seen) {
+		t.Errorf("pages returned %d entries, want %d distinct entries in name order", len(seen), wshrpc.DirChunkSize+11)
+	}
+}
+
+func TestListEntriesSharedSubdir(t *testing.T) {
+	t.Parallel()
+
+	// every file of /sub names the directory again, as a listing by prefix does
+	var items []ListDirFileItem
+	for i := 0; i < 50; i++ {
+		name := "sub"
+		if i%2 == 1 {
+			name = "sub/"
+		}
+		items = append(items, ListDirFileItem{Name: name, IsDir: true, CreateTs: int64(i)})
+	}
+	items = append(items, ListDirFileItem{Name: "a.txt", CreateTs: 7})
+	file := func(id uint64) FileObjectEx {
+		return FileObjectEx{Id: *uint256.NewInt(id), Obj: FileObject{Size: 1, WalrusBlobId: "blob"}}
+	}
+	list, err := bcs.Marshal(RecursiveDirList{
+		Dirobj: *uint256.NewInt(1),
+		Files:  []FileObjectEx{file(10), file(11), file(12)},
+		Dirs: []DirObjectEx{{
+			Id:                *uint256.NewInt(1),
+			ChildrenFileNames: []string{"f0", "f1", "f2"},
+			ChildrenFileIds:   []uint256.Int{*uint256.NewInt(10), *uint256.NewInt(11), *uint256.NewInt(12)},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, recursive := range []bool{false, true} {
+		c, chain := newFakeChainClient(fmt.Sprintf("test-list-entries-shared-%v", recursive))
+		chain.inspectReturn = list
+		listings.putList(c.config.root, "/", items, time.Now().Add(time.Hour))
+		want := []string{"a.txt", "sub"}
+		if recursive {
+			want = append(want, "sub/f0", "sub/f1", "sub/f2")
+		}
+
+		// a limit of exactly the distinct entries leaves nothing out
+		opts := &wshrpc.FileListOpts{Recursive: recursive, Limit: len(want)}
+		var got []string
+		var subTime int64
+		truncated := false
+		for resp := range c.ListEntriesStream(context.Background(), walrusConn("/"), opts) {
+			if resp.Error != nil {
+				t.Fatal(resp.Error)
+			}
+			for _, info := range resp.Response.FileInfo {
+				got = append(got, strings.TrimPrefix(info.Path, "walrus:///"))
+				if info.Name == "sub" {
+					subTime = info.ModTime
+				}
+			}
+			truncated = truncated || resp.Response.Truncated
+		}
+		if !slices.Equal(got, want) || truncated {
+			t.Errorf("recursive %v: got %v truncated %v, want %v", recursive, got, truncated, want)
+		}
+		if subTime != 49 {
+			t.Errorf("recursive %v: got sub modified at %d, want the latest time 49", recursive, subTime)
+		}
+		// the subdirectory is fetched once however many times it is listed
+		chain.lock.Lock()
+		inspects := len(chain.senders)
+		chain.lock.Unlock()
+		if wantInspects := map[bool]int{false: 0, true: 1}[recursive]; inspects != wantInspects {
+			t.Errorf("recursive %v: got %d dev inspect calls, want %d", recursive, inspects, wantInspects)
+		}
+	}
+}
+
+func TestListEntriesSort(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{root: "test-list-entries-sort", cacheTTL: time.Hour, rpcUrl: newTestRpc(t, true).URL}
+	listings.putList(config.root, "/dir", []ListDirFileItem{
+		{Name: "c.txt", Size: 20, CreateTs: 2},
+		{Name: "z", IsDir: true},
+		{Name: "a.txt", Size: 30, CreateTs: 1},
+		{Name: "d.txt", Size: 10, CreateTs: 4},
+		{Name: "b.txt", Size: 10, CreateTs: 3},
+	}, time.Now().Add(time.Hour))
+	c := WalrusClient{config: config}
+	list := func(opts *wshrpc.FileListOpts) ([]string, string, error) {
+		var names []string
+		var cursor string
+		for resp := range c.ListEntriesStream(context.Background(), &connparse.Connection{Scheme: "walrus", Path: "/dir"}, opts) {
+			if resp.Error != nil {
+				return nil, "", resp.Error
+			}
+			for _, info := range resp.Response.FileInfo {
+				names = append(names, info.Name)
+			}
+			cursor = resp.Response.Cursor
+		}
+		return names, cursor, nil
+	}
+
+	tests := []struct {
+		name string
+		opts *wshrpc.FileListOpts
+		want []string
+	}{
+		{"default", nil, []string{"a.txt", "b.txt", "c.txt", "d.txt", "z"}},
+		{"name descending", &wshrpc.FileListOpts{SortBy: wshrpc.FileSortName, SortDesc: true}, []string{"z", "d.txt", "c.txt", "b.txt", "a.txt"}},
+		{"size", &wshrpc.FileListOpts{SortBy: wshrpc.FileSortSize}, []string{"z", "b.txt", "d.txt", "c.txt", "a.txt"}},
+		{"size descending dirs first", &wshrpc.FileListOpts{SortBy: wshrpc.FileSortSize, SortDesc: true, DirsFirst: true}, []string{"z", "a.txt", "c.txt", "d.txt", "b.txt"}},
+		{"modtime descending", &wshrpc.FileListOpts{SortBy: wshrpc.FileSortModTime, SortDesc: true}, []string{"d.txt", "b.txt", "c.txt", "a.txt", "z"}},
+	}
+	for _, tc := range tests {
+		got, _, err := list(tc.opts)
+		if err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("%s: got %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+
+		// paging keeps the order
+		var paged []string
+		opts := &wshrpc.FileListOpts{Limit: 2}
+		if tc.opts != nil {
+			*opts = *tc.opts
+			opts.Limit = 2
+		}
+		for page := 0; page < 3; page++ {
+			names, cursor, err := list(opts)
+			if err != nil {
+				t.Fatalf("%s: page %d: %v", tc.name, page, err)
+			}
+			paged = append(paged, names...)
+			opts.Cursor = cursor
+		}
+		if !slices.Equal(paged, tc.want) {
+			t.Errorf("%s: pages returned %v, want %v", tc.name, paged, tc.want)
+		}
+	}
+
+	if _, _, err := list(&wshrpc.FileListOpts{SortBy: "color"}); err == nil {
+		t.Errorf("got no error for an unknown sort order")
+	}
+}
+
+func TestExists(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{root: "test-exists", cacheTTL: time.Hour, rpcUrl: newTestRpc(t, false).URL}
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(config.root, "/a.txt", &ListDirFileItem{Name: "a.txt"}, expires)
+	listings.putStat(config.root, "/missing.txt", nil, expires)
+	c := WalrusClient{config: config}
+
+	tests := []struct {
+		path    string
+		want    bool
+		wantErr bool
+	}{
+		{"/", true, false},
+		{"/a.txt", true, false},
+		{"/missing.txt", false, false},
+		// not cached, the lookup fails since the root object doesn't exist
+		{"/unknown.txt", false, true},
+	}
+	for _, tc := range tests {
+		got, err := c.Exists(context.Background(), &connparse.Connection{Scheme: "walrus", Path: tc.path})
+		if got != tc.want || (err != nil) != tc.wantErr {
+			t.Errorf("Exists(%q) = %v, %v, want %v with error %v", tc.path, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestStatParentDir(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{root: "test-stat-parent", cacheTTL: time.Hour, rpcUrl: newTestRpc(t, false).URL}
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(config.root, "/foo.txt", &ListDirFileItem{Name: "foo.txt"}, expires)
+	listings.putStat(config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	listings.putStat(config.root, "/dir/bar.txt", &ListDirFileItem{Name: "bar.txt"}, expires)
+	c := WalrusClient{config: config}
+
+	tests := []struct {
+		path    string
+		wantUri string
+		wantDir string
+	}{
+		{"/", "walrus:///", ""},
+		{"/foo.txt", "walrus:///foo.txt", "walrus:///"},
+		{"/dir", "walrus:///dir", "walrus:///"},
+		{"/dir/bar.txt", "walrus:///dir/bar.txt", "walrus:///dir/"},
+	}
+	for _, tc := range tests {
+		finfo, err := c.Stat(context.Background(), walrusConn(tc.path))
+		if err != nil || finfo.Path != tc.wantUri || finfo.Dir != tc.wantDir {
+			t.Errorf("Stat(%q) = %+v, %v, want path %q in %q", tc.path, finfo, err, tc.wantUri, tc.wantDir)
+		}
+	}
+}
+
+func TestReadStreamNotFound(t *testing.T) {
+	t.Parallel()
+
+	config := &WalrusFsConfig{root: "test-read-not-found", cacheTTL: time.Hour, rpcUrl: newTestRpc(t, false).URL}
+	listings.putStat(config.root, "/missing", nil, time.Now().Add(time.Hour))
+	c := WalrusClient{config: config}
+
+	var got []wshrpc.FileData
+	var err error
+	for resp := range c.ReadStream(context.Background(), walrusConn("/missing"), wshrpc.FileData{}) {
+		if resp.Error != nil {
+			err = resp.Error
+			continue
+		}
+		got = append(got, resp.Response)
+	}
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, fs.ErrNotExist) || len(got) != 0 {
+		t.Errorf("got %d responses and %v, want only a not found error", len(got), err)
+	}
+}
+
+func TestWriteFileStream(t *testing.T) {
+	defer func(delay time.Duration) { publishRetryBaseDelay = delay }(publishRetryBaseDelay)
+	publishRetryBaseDelay = time.Millisecond
+
+	content := strings.Repeat("piped walrus content\n", 1000)
+	var requests atomic.Int32
+	var got atomic.Value
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if requests.Add(1) == 1 {
+			// the retry has to send the spooled content again
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.ContentLength != int64(len(content)) {
+			t.Errorf("expected content length %d, got %d", len(content), r.ContentLength)
+		}
+		got.Store(string(body))
+		w.Write([]byte(`{"newlyCreated": {"blobObject": {"blobId": "blob1", "registeredEpoch": 3, "storage": {"endEpoch": 8}}}}`))
+	}))
+	defer publisher.Close()
+	// recording the file needs the chain, which the test rpc can't serve
+	config := &WalrusFsConfig{root: testRootId, publisherUrls: []string{publisher.URL}, httpTimeout: 5 * time.Second, rpcUrl: newTestRpc(t, true).URL}
+	c := WalrusClient{config: config}
+	conn := &connparse.Connection{Scheme: "walrus", Path: "/piped.txt"}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(content); i += 100 {
+			pw.Write([]byte(content[i:min(i+100, len(content))]))
+		}
+		pw.Close()
+	}()
+	c.WriteFileStream(context.Background(), conn, pr, &wshrpc.FileOpts{Overwrite: true})
+	if requests.Load() != 2 || got.Load() != content {
+		t.Errorf("publisher got %d requests, last with %d bytes, want the %d bytes of content", requests.Load(), len(fmt.Sprint(got.Load())), len(content))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	requests.Store(0)
+	if err := c.WriteFileStream(ctx, conn, strings.NewReader(content), &wshrpc.FileOpts{Overwrite: true}); !errors.Is(err, context.Canceled) || requests.Load() != 0 {
+		t.Errorf("cancelled write returned %v after %d publisher requests", err, requests.Load())
+	}
+
+	// like PutFile, an existing file is only replaced when asked to, before anything is read or uploaded
+	config.cacheTTL = time.Hour
+	existing := &connparse.Connection{Scheme: "walrus", Path: "/stream-existing.txt"}
+	listings.putStat(config.root, existing.Path, &ListDirFileItem{Name: "stream-existing.txt", Size: 3, WalrusBlobId: "blobE"}, time.Now().Add(time.Hour))
+	input := strings.NewReader(content)
+	for _, opts := range []*wshrpc.FileOpts{nil, {}} {
+		if err := c.WriteFileStream(context.Background(), existing, input, opts); !errors.Is(err, ErrOverwriteRequired) || requests.Load() != 0 || input.Len() != len(content) {
+			t.Errorf("write over an existing file with opts %+v returned %v after %d publisher requests", opts, err, requests.Load())
+		}
+	}
+}
+
+// fakeChain executes move calls without a sui node, recording the calls made. Transactions with a call that fail
+// reports get a failed transaction status, anything not overridden panics through the nil interface.
+type fakeChain struct {
+	sui.ISuiAPI
+	lock     sync.Mutex
+	calls    []models.MoveCallRequest
+	executed [][]string
+	fail     func(call models.MoveCallRequest) bool
+	// inspectReturn is the bcs bytes dev inspect calls return, without it there are no objects to inspect
+	inspectReturn []byte
+	// inspectReturns are returned by the next dev inspect calls in order, before falling back to inspectReturn
+	inspectReturns [][]byte
+	// inspectMissing makes dev inspect calls abort as if the path looked up doesn't exist
+	inspectMissing bool
+	senders        []string
+	// currentEpoch is the epoch recorded in the root object, 0 leaves the root without content
+	currentEpoch int64
+	// checkpointAfter is how many lookups of a transaction find it before it is checkpointed, finalStatus the
+	// status it is then recorded with
+	checkpointAfter int
+	finalStatus     models.ExecutionStatus
+	txLookups       int
+	// submitErrors fail the next submissions in order before they execute, lostResponses is how many of the
+	// submissions after them execute but fail with a timeout as if the connection dropped
+	submitErrors  []error
+	lostResponses int
+	submissions   int
+	// landed are the executed transactions by digest, looked up by their tx-n digest as well
+	landed map[string]models.SuiTransactionBlockResponse
+}
+
+// build returns transaction bytes the fake can execute, the calls encoded as json
+func (f *fakeChain) build(calls []models.MoveCallRequest) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = append(f.calls, calls...)
+	b, err := json.Marshal(calls)
+	return base64.StdEncoding.EncodeToString(b), err
+}
+
+func (f *fakeChain) MoveCall(ctx context.Context, req models.MoveCallRequest) (models.TxnMetaData, error) {
+	txBytes, err := f.build([]models.MoveCallRequest{req})
+	return models.TxnMetaData{TxBytes: txBytes}, err
+}
+
+func (f *fakeChain) BatchTransaction(ctx context.Context, req models.BatchTransactionRequest) (models.BatchTransactionResponse, error) {
+	var calls []models.MoveCallRequest
+	for _, params := range req.RPCTransactionRequestParams {
+		calls = append(calls, *params.MoveCallRequestParams)
+	}
+	txBytes, err := f.build(calls)
+	return models.BatchTransactionResponse{TxBytes: txBytes}, err
+}
+
+func (f *fakeChain) SuiExecuteTransactionBlock(ctx context.Context, req models.SuiExecuteTransactionBlockRequest) (models.SuiTransactionBlockResponse, error) {
+	var rsp models.SuiTransactionBlockResponse
+	f.lock.Lock()
+	f.submissions++
+	if len(f.submitErrors) > 0 {
+		err := f.submitErrors[0]
+		f.submitErrors = f.submitErrors[1:]
+		f.lock.Unlock()
+		return rsp, err
+	}
+	f.lock.Unlock()
+	b, err := base64.StdEncoding.DecodeString(req.TxBytes)
+	if err != nil {
+		return rsp, err
+	}
+	var calls []models.MoveCallRequest
+	if err := json.Unmarshal(b, &calls); err != nil {
+		return rsp, err
+	}
+	var functions []string
+	for _, call := range calls {
+		functions = append(functions, call.Function)
+		if f.fail != nil && f.fail(call) {
+			rsp.Effects.Status = models.ExecutionStatus{Status: "failure", Error: "MoveAbort"}
+			return rsp, nil
+		}
+	}
+	digest, err := utils.GetTxDigest(req.TxBytes)
+	if err != nil {
+		return rsp, err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if landed, ok := f.landed[digest]; ok {
+		return landed, nil
+	}
+	f.executed = append(f.executed, functions)
+	rsp.Digest = fmt.Sprintf("tx-%d", len(f.executed))
+	rsp.Effects.Status.Status = "success"
+	if f.landed == nil {
+		f.landed = make(map[string]models.SuiTransactionBlockResponse)
+	}
+	f.landed[digest] = rsp
+	f.landed[rsp.Digest] = rsp
+	if f.lostResponses > 0 {
+		f.lostResponses--
+		return models.SuiTransactionBlockResponse{}, errors.New("Post \"http://fullnode\": context deadline exceeded (Client.Timeout exceeded while awaiting headers)")
+	}
+	return rsp, nil
+}
+
+func (f *fakeChain) SuiGetObject(ctx context.Context, req models.SuiGetObjectRequest) (models.SuiObjectResponse, error) {
+	f.lock.Lock()
+	empty := f.inspectReturn == nil && len(f.inspectReturns) == 0 && !f.inspectMissing
+	currentEpoch := f.currentEpoch
+	f.lock.Unlock()
+	if currentEpoch > 0 {
+		content := &models.SuiParsedData{DataType: "moveObject"}
+		content.Fields = map[string]interface{}{"current_epoch": strconv.FormatInt(currentEpoch, 10)}
+		return models.SuiObjectResponse{Data: &models.SuiObjectData{ObjectId: req.ObjectId, Version: "1", Digest: strings.Repeat("1", 32), Content: content}}, nil
+	}
+	if empty {
+		return models.SuiObjectResponse{}, errors.New("no objects on the fake chain")
+	}
+	// 32 zero bytes in base58
+	return models.SuiObjectResponse{Data: &models.SuiObjectData{ObjectId: req.ObjectId, Version: "1", Digest: strings.Repeat("1", 32)}}, nil
+}
+
+func (f *fakeChain) SuiDevInspectTransactionBlock(ctx context.Context, req models.SuiDevInspectTransactionBlockRequest) (models.SuiTransactionBlockResponse, error) {
+	f.lock.Lock()
+	f.senders = append(f.senders, req.Sender)
+	inspectReturn := f.inspectReturn
+	if len(f.inspectReturns) > 0 {
+		inspectReturn, f.inspectReturns = f.inspectReturns[0], f.inspectReturns[1:]
+	}
+	missing := f.inspectMissing
+	f.lock.Unlock()
+	var rsp models.SuiTransactionBlockResponse
+	if missing {
+		rsp.Effects.Status = models.ExecutionStatus{Status: "failure", Error: fmt.Sprintf("MoveAbort(MoveLocation { module: walrusfs }, %d) in command 0", abortPathError)}
+		return rsp, nil
+	}
+	value := make([]int, len(inspectReturn))
+	for i, b := range inspectReturn {
+		value[i] = int(b)
+	}
+	results, err := json.Marshal([]map[string]any{{"ReturnValues": []any{[]any{value, "type"}}}})
+	rsp.Results = results
+	rsp.Effects.Status.Status = "success"
+	return rsp, err
+}
+
+func (f *fakeChain) SuiGetTransactionBlock(ctx context.Context, req models.SuiGetTransactionBlockRequest) (models.SuiTransactionBlockResponse, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	rsp, ok := f.landed[req.Digest]
+	if !ok {
+		return rsp, fmt.Errorf("Could not find the referenced transaction [TransactionDigest(%s)]", req.Digest)
+	}
+	f.txLookups++
+	if f.finalStatus.Status != "" {
+		rsp.Effects.Status = f.finalStatus
+	}
+	if f.txLookups > f.checkpointAfter {
+		rsp.Checkpoint = "42"
+	}
+	return rsp, nil
+}
+
+func (f *fakeChain) functions() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var rtn []string
+	for _, call := range f.calls {
+		rtn = append(rtn, call.Function)
+	}
+	return rtn
+}
+
+// newFakeChainClient returns a client whose transactions go to a fakeChain, stats have to be served from the cache.
+// Its root is an object id derived from name, so every test has a cache of its own. Calls of the functions in fail
+// abort
+func newFakeChainClient(name string, fail ...string) (WalrusClient, *fakeChain) {
+	chain := &fakeChain{fail: func(call models.MoveCallRequest) bool { return slices.Contains(fail, call.Function) }}
+	root := sha256.Sum256([]byte(name))
+	config := &WalrusFsConfig{
+		root:            "0x" + hex.EncodeToString(root[:]),
+		cacheTTL:        time.Hour,
+		gasBudget:       DefaultGasBudget,
+		copyConcurrency: DefaultCopyConcurrency,
+		txSigner:        fakeSigner{address: "0x1", signature: make([]byte, 64), pubkey: make([]byte, 32)},
+	}
+	config.suiClient = chain
+	return WalrusClient{config: config}, chain
+}
+
+func walrusConn(path string) *connparse.Connection {
+	return &connparse.Connection{Scheme: connparse.ConnectionTypeWalrus, Host: "local", Path: path}
+}
+
+func TestMoveInternalRename(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-move-rename")
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/dir/a.txt", &ListDirFileItem{Name: "a.txt", Size: 5, WalrusBlobId: "blobA"}, expires)
+	listings.putStat(c.config.root, "/dir/b.txt", nil, expires)
+
+	if err := c.MoveInternal(context.Background(), walrusConn("/dir/a.txt"), walrusConn("/dir/b.txt"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.functions(); !slices.Equal(got, []string{"rename_file"}) {
+		t.Errorf("got calls %v, want a single rename_file", got)
+	}
+}
+
+func TestMoveInternalAcrossDirs(t *testing.T) {
+	t.Parallel()
+
+	setup := func(name string, fail ...string) (WalrusClient, *fakeChain) {
+		c, chain := newFakeChainClient("test-move-across-"+name, fail...)
+		expires := time.Now().Add(time.Hour)
+		listings.putStat(c.config.root, "/src/a.txt", &ListDirFileItem{Name: "a.txt", Size: 5, WalrusBlobId: "blobA", ContentSha256: "sha"}, expires)
+		listings.putStat(c.config.root, "/dst", &ListDirFileItem{Name: "dst", IsDir: true}, expires)
+		listings.putStat(c.config.root, "/dst/a.txt", nil, expires)
+		return c, chain
+	}
+
+	c, chain := setup("ok")
+	if err := c.MoveInternal(context.Background(), walrusConn("/src/a.txt"), walrusConn("/dst"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := chain.functions(); !slices.Equal(got, []string{"add_file", "delete_file"}) {
+		t.Fatalf("got calls %v, want add_file then delete_file", got)
+	}
+	// the existing blob is referenced at the destination, nothing is uploaded again
+	add := chain.calls[0]
+	if add.Arguments[2] != "/dst/a.txt" || add.Arguments[5] != "blobA" {
+		t.Errorf("add_file got path %v and blob %v, want /dst/a.txt and blobA", add.Arguments[2], add.Arguments[5])
+	}
+	if chain.calls[1].Arguments[1] != "/src/a.txt" {
+		t.Errorf("delete_file got path %v, want /src/a.txt", chain.calls[1].Arguments[1])
+	}
+
+	// a failed add leaves the source alone
+	c, chain = setup("add-fails", "add_file")
+	err := c.MoveInternal(context.Background(), walrusConn("/src/a.txt"), walrusConn("/dst"), nil)
+	if err == nil || !strings.Contains(err.Error(), "left in place") {
+		t.Errorf("got error %v, want one saying the source was left in place", err)
+	}
+	if slices.Contains(chain.functions(), "delete_file") {
+		t.Errorf("source was deleted after the add failed, calls %v", chain.functions())
+	}
+
+	// a failed delete leaves the file in both places rather than neither
+	c, _ = setup("delete-fails", "delete_file")
+	err = c.MoveInternal(context.Background(), walrusConn("/src/a.txt"), walrusConn("/dst"), nil)
+	if err == nil || !strings.Contains(err.Error(), "both places") {
+		t.Errorf("got error %v, want one saying the file exists in both places", err)
+	}
+}
+
+func TestMoveInternalOntoDirectory(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-move-onto-dir")
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/src/sub", &ListDirFileItem{Name: "sub", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/dst", &ListDirFileItem{Name: "dst", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/dst/sub", &ListDirFileItem{Name: "sub", IsDir: true}, expires)
+
+	err := c.MoveInternal(context.Background(), walrusConn("/src/sub"), walrusConn("/dst"), nil)
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("got error %v, want ErrAlreadyExists", err)
+	}
+	if got := chain.functions(); len(got) != 0 {
+		t.Errorf("got calls %v, want none", got)
+	}
+}
+
+func TestMoveInternalIntoItself(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-move-into-itself")
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a", &ListDirFileItem{Name: "a", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/a/a", nil, expires)
+	listings.putStat(c.config.root, "/a/b", &ListDirFileItem{Name: "b", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/a/b/a", nil, expires)
+	listings.putStat(c.config.root, "/a/c", nil, expires)
+	listings.putStat(c.config.root, "/x.txt", &ListDirFileItem{Name: "x.txt"}, expires)
+
+	tests := []struct {
+		src  string
+		dest string
+	}{
+		{"/a", "/a/b"},
+		{"/a/", "/a/b/"},
+		{"/a", "/a"},
+		{"/a", "/a/c"},
+		{"/x.txt", "/x.txt"},
+	}
+	for _, tc := range tests {
+		err := c.MoveInternal(context.Background(), walrusConn(tc.src), walrusConn(tc.dest), nil)
+		if !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%s to %s: got error %v, want ErrInvalidPath", tc.src, tc.dest, err)
+		}
+	}
+	if got := chain.functions(); len(got) != 0 {
+		t.Errorf("got calls %v, want none", got)
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-mkdir-all")
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a", &ListDirFileItem{Name: "a", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/a/b", nil, expires)
+	listings.putStat(c.config.root, "/f", &ListDirFileItem{Name: "f"}, expires)
+	ctx := context.Background()
+
+	// nothing to create
+	for _, path := range []string{"/a", "/", ""} {
+		if err := c.MkdirAll(ctx, walrusConn(path)); err != nil {
+			t.Errorf("%q: %v", path, err)
+		}
+	}
+	if err := c.MkdirAll(ctx, walrusConn("/f/x")); err == nil || !strings.Contains(err.Error(), "is a file") {
+		t.Errorf("got %v with a file in the way", err)
+	}
+	if len(chain.executed) != 0 {
+		t.Errorf("got %d transactions without any directory to create", len(chain.executed))
+	}
+
+	if err := c.MkdirAll(ctx, walrusConn("/a/b/c/")); err != nil {
+		t.Fatal(err)
+	}
+	var paths []any
+	for _, call := range chain.calls {
+		paths = append(paths, call.Arguments[2])
+	}
+	if !slices.Equal(chain.functions(), []string{"add_dir", "add_dir"}) || len(chain.executed) != 1 || !slices.Equal(paths, []any{"/a/b", "/a/b/c"}) {
+		t.Errorf("got calls %v on %v in %d transactions, want /a/b and /a/b/c created together", chain.functions(), paths, len(chain.executed))
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	var published atomic.Value
+	publisher := newTestPublisher(t, http.StatusOK, &requests, &published)
+	existing := "hello "
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(existing))
+	}))
+	defer aggregator.Close()
+
+	c, chain := newFakeChainClient("test-append-file")
+	c.config.publisherUrls = []string{publisher.URL}
+	c.config.aggregatorUrl = aggregator.URL
+	c.config.httpTimeout = time.Second
+	sum := sha256.Sum256([]byte(existing))
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt", Size: int64(len(existing)), WalrusBlobId: "blobA", ContentSha256: hex.EncodeToString(sum[:]), Tags: []string{"keep"}}, expires)
+	listings.putStat(c.config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	ctx := context.Background()
+	data := func(s string) wshrpc.FileData {
+		return wshrpc.FileData{Data64: base64.StdEncoding.EncodeToString([]byte(s))}
+	}
+
+	// the whole file is published again with the data after it, keeping its tags
+	if err := c.AppendFile(ctx, walrusConn("/a.txt"), data("walrus")); err != nil {
+		t.Fatal(err)
+	}
+	if got := published.Load(); got != "hello walrus" {
+		t.Errorf("published %q, want the file with the data appended", got)
+	}
+	recorded := slices.ContainsFunc(chain.calls, func(call models.MoveCallRequest) bool {
+		return slices.Contains(call.Arguments, interface{}("/a.txt"))
+	})
+	if !recorded {
+		t.Errorf("got calls %v, none recording /a.txt", chain.functions())
+	}
+
+	if err := c.AppendFile(ctx, walrusConn("/dir"), data("x")); err == nil || !strings.Contains(err.Error(), "directory") {
+		t.Errorf("got %v appending to a directory", err)
+	}
+	withAt := data("x")
+	withAt.At = &wshrpc.FileDataAt{Offset: 1}
+	if err := c.AppendFile(ctx, walrusConn("/a.txt"), withAt); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("got %v appending at an offset, want errors.ErrUnsupported", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("published %d times, want once", requests.Load())
+	}
+}
+
+// appending rewrites the whole file, so walrus doesn't offer it to callers that would append chunk by chunk
+func TestCapability(t *testing.T) {
+	t.Parallel()
+
+	c := WalrusClient{config: &WalrusFsConfig{}}
+	if capability := c.GetCapability(); !capability.CanMkdir || capability.CanAppend {
+		t.Errorf("got capability %+v, want mkdir without append", capability)
+	}
+}
+
+func TestPutFiles(t *testing.T) {
+	t.Parallel()
+
+	var blobs atomic.Int32
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprintf(w, `{"alreadyCertified": {"blobId": "blob%d", "endEpoch": 10}}`, blobs.Add(1))
+	}))
+	defer publisher.Close()
+
+	setup := func(name string) (WalrusClient, *fakeChain, []UploadSpec) {
+		c, chain := newFakeChainClient("test-put-files-" + name)
+		c.config.publisherUrls = []string{publisher.URL}
+		c.config.httpTimeout = time.Second
+		expires := time.Now().Add(time.Hour)
+		listings.putStat(c.config.root, "/a.txt", nil, expires)
+		listings.putStat(c.config.root, "/b.txt", nil, expires)
+		listings.putStat(c.config.root, "/exists.txt", &ListDirFileItem{Name: "exists.txt"}, expires)
+		specs := []UploadSpec{
+			{Path: "/a.txt", Data: strings.NewReader("aaa"), Size: 3},
+			{Path: "/exists.txt", Data: strings.NewReader("eee"), Size: 3},
+			{Path: "/b.txt", Data: strings.NewReader("bbb"), Size: 3},
+		}
+		return c, chain, specs
+	}
+
+	c, chain, specs := setup("batch")
+	results, err := c.PutFiles(context.Background(), specs)
+	if err == nil || !strings.Contains(err.Error(), "/exists.txt") {
+		t.Errorf("got error %v, want one for /exists.txt", err)
+	}
+	if len(chain.executed) != 1 || !slices.Equal(chain.executed[0], []string{"add_file", "add_file"}) {
+		t.Fatalf("got transactions %v, want a single one adding both new files", chain.executed)
+	}
+	for i, want := range []bool{true, false, true} {
+		if results[i].Path != specs[i].Path || (results[i].Err == nil) != want || (results[i].Tx != nil) != want {
+			t.Errorf("result %d is %+v, want success %v", i, results[i], want)
+		}
+	}
+	if !errors.Is(results[1].Err, ErrOverwriteRequired) {
+		t.Errorf("got error %v for an existing file, want ErrOverwriteRequired", results[1].Err)
+	}
+	if results[0].Tx.Digest != results[2].Tx.Digest || results[0].Tx.BlobId == results[2].Tx.BlobId {
+		t.Errorf("files added by the same transaction got %+v and %+v", results[0].Tx, results[2].Tx)
+	}
+
+	// a file that aborts the batch only fails itself
+	c, chain, specs = setup("fallback")
+	chain.fail = func(call models.MoveCallRequest) bool { return call.Arguments[2] == "/b.txt" }
+	results, err = c.PutFiles(context.Background(), specs)
+	if err == nil || !strings.Contains(err.Error(), "/b.txt") {
+		t.Errorf("got error %v, want one for /b.txt", err)
+	}
+	if results[0].Err != nil || results[0].Tx == nil {
+		t.Errorf("got %+v for /a.txt, want it added on its own", results[0])
+	}
+	if results[2].Err == nil {
+		t.Errorf("got no error for /b.txt")
+	}
+	if len(chain.executed) != 1 || !slices.Equal(chain.executed[0], []string{"add_file"}) {
+		t.Errorf("got transactions %v, want only /a.txt added", chain.executed)
+	}
+}
+
+func TestDeleteMany(t *testing.T) {
+	t.Parallel()
+
+	setup := func(name string, fail ...string) (WalrusClient, *fakeChain) {
+		c, chain := newFakeChainClient("test-delete-many-"+name, fail...)
+		expires := time.Now().Add(time.Hour)
+		listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt"}, expires)
+		listings.putStat(c.config.root, "/b.txt", &ListDirFileItem{Name: "b.txt"}, expires)
+		listings.putStat(c.config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+		listings.putStat(c.config.root, "/missing.txt", nil, expires)
+		return c, chain
+	}
+	paths := []string{"/dir", "/dir/sub/x.txt", "/a.txt", "/missing.txt", "b.txt/"}
+
+	c, chain := setup("batch")
+	results, err := c.DeleteMany(context.Background(), paths)
+	if err == nil || !strings.Contains(err.Error(), "/missing.txt") {
+		t.Errorf("got error %v, want one for /missing.txt", err)
+	}
+	// the file below /dir goes with it
+	if len(chain.executed) != 1 || !slices.Equal(chain.executed[0], []string{"delete_file", "delete_file", "delete_dir"}) {
+		t.Fatalf("got transactions %v, want a single one deleting /a.txt, /b.txt and /dir", chain.executed)
+	}
+	for _, p := range paths {
+		if want := p == "/missing.txt"; (results[p] != nil) != want {
+			t.Errorf("got %v for %s, want an error %v", results[p], p, want)
+		}
+	}
+	if !errors.Is(results["/missing.txt"], ErrNotFound) {
+		t.Errorf("got %v for a missing path, want ErrNotFound", results["/missing.txt"])
+	}
+
+	// a path that aborts the batch only fails itself and what is below it
+	c, chain = setup("fallback", "delete_dir")
+	results, _ = c.DeleteMany(context.Background(), paths)
+	for _, p := range []string{"/dir", "/dir/sub/x.txt"} {
+		if results[p] == nil {
+			t.Errorf("got no error for %s", p)
+		}
+	}
+	for _, p := range []string{"/a.txt", "b.txt/"} {
+		if results[p] != nil {
+			t.Errorf("got %v for %s, want it deleted on its own", results[p], p)
+		}
+	}
+	if len(chain.executed) != 2 {
+		t.Errorf("got transactions %v, want /a.txt and /b.txt deleted one at a time", chain.executed)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	c, chain := newFakeChainClient("test-read-only")
+	c.config.readOnly = true
+	c.config.txSigner = nil
+	c.config.wallet = "0x1"
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt", Size: 3, WalrusBlobId: "blobA"}, expires)
+	listings.putList(c.config.root, "/", []ListDirFileItem{{Name: "a.txt", Size: 3, WalrusBlobId: "blobA"}}, expires)
+
+	file, dir := walrusConn("/a.txt"), walrusConn("/dir")
+	data := wshrpc.FileData{Data64: base64.StdEncoding.EncodeToString([]byte("new"))}
+	mutations := map[string]func() error{
+		"PutFile":      func() error { return c.PutFile(ctx, file, data) },
+		"AppendFile":   func() error { return c.AppendFile(ctx, file, data) },
+		"Mkdir":        func() error { return c.Mkdir(ctx, dir) },
+		"Mkfile":       func() error { return c.Mkfile(ctx, "/tmp/none", "/b.txt", nil, false, 0) },
+		"MoveInternal": func() error { return c.MoveInternal(ctx, file, walrusConn("/b.txt"), nil) },
+		"CopyInternal": func() error { _, err := c.CopyInternal(ctx, file, walrusConn("/b.txt"), nil); return err },
+		"Delete":       func() error { return c.Delete(ctx, file, false) },
+		"DeleteMany":   func() error { _, err := c.DeleteMany(ctx, []string{"/a.txt"}); return err },
+		"PutFiles": func() error {
+			_, err := c.PutFiles(ctx, []UploadSpec{{Path: "/b.txt", Data: strings.NewReader("b"), Size: 1}})
+			return err
+		},
+		"RenewFile":       func() error { return c.RenewFile(ctx, file, 1) },
+		"CallMove":        func() error { _, err := c.CallMove(ctx, "update_epoch", nil, nil); return err },
+		"WriteFileStream": func() error { return c.WriteFileStream(ctx, file, strings.NewReader("new"), nil) },
+	}
+	for name, mutate := range mutations {
+		if err := mutate(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: got error %v, want ErrReadOnly", name, err)
+		}
+	}
+	if len(chain.calls) != 0 {
+		t.Errorf("read only client made move calls %v", chain.functions())
+	}
+	// the low level calls refuse too
+	if _, err := execute_move_call(ctx, c.config, "delete_file", nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("execute_move_call: got error %v, want ErrReadOnly", err)
+	}
+
+	if info, err := c.Stat(ctx, file); err != nil || info.NotFound {
+		t.Errorf("Stat: got %+v, %v", info, err)
+	}
+	if entries, err := c.ListEntries(ctx, walrusConn("/"), nil); err != nil || len(entries) != 1 {
+		t.Errorf("ListEntries: got %d entries, %v", len(entries), err)
+	}
+	if capability := c.GetCapability(); capability.CanMkdir || capability.CanAppend {
+		t.Errorf("got capability %+v for a read only client", capability)
+	}
+}
+
+func TestWalletWithoutMnemonic(t *testing.T) {
+	t.Parallel()
+
+	item, err := bcs.Marshal(ListDirFileItem{Name: "a.txt", Size: 3, WalrusBlobId: "blobA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, chain := newFakeChainClient(testRootId)
+	chain.inspectReturn = item
+	c.config.pkg = testRootId
+	c.config.cacheTTL = 0
+	c.config.txSigner = nil
+	c.config.wallet = "0x2"
+	ctx := context.Background()
+
+	// reads dev inspect as the wallet without deriving a signer
+	info, err := c.Stat(ctx, walrusConn("/a.txt"))
+	if err != nil || info.NotFound || info.Size != 3 {
+		t.Fatalf("Stat: got %+v, %v", info, err)
+	}
+	if !slices.Equal(chain.senders, []string{"0x2"}) {
+		t.Errorf("got dev inspect senders %v, want the wallet", chain.senders)
+	}
+	if c.config.signerErr != nil {
+		t.Errorf("reading derived the signer: %v", c.config.signerErr)
+	}
+
+	// writes still need the mnemonic
+	if err := c.Delete(ctx, walrusConn("/a.txt"), false); err == nil || !strings.Contains(err.Error(), "walrusfs:mnemonic is not set") {
+		t.Errorf("Delete: got error %v, want one about walrusfs:mnemonic", err)
+	}
+	if len(chain.executed) != 0 {
+		t.Errorf("executed transactions %v without a signer", chain.executed)
+	}
+}
+
+func TestGetObjectMeta(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"keep"}
+	item, err := bcs.Marshal(ListDirFileItem{Name: "a.txt", Size: 3, Tags: tags, WalrusBlobId: "blobA", WalrusEpochTill: 7, MimeType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := bcs.Marshal(RecursiveDirList{
+		Dirobj: *uint256.NewInt(1),
+		Dirs: []DirObjectEx{{
+			Id:                *uint256.NewInt(1),
+			ChildrenFileNames: []string{"a.txt"},
+			ChildrenFileIds:   []uint256.Int{*uint256.NewInt(42)},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, chain := newFakeChainClient(testRootId)
+	chain.inspectReturns = [][]byte{item, list}
+	c.config.pkg = testRootId
+
+	meta, err := c.GetObjectMeta(context.Background(), walrusConn("/dir/a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.ObjectId != "42" || meta.WalrusBlobId != "blobA" || meta.WalrusEpochTill != 7 || !slices.Equal(meta.Tags, tags) || meta.MimeType != "text/plain" {
+		t.Errorf("got %+v, want object 42 with the tags and mime type as stored", meta)
+	}
+}
+
+func TestClose(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + fspath.Base(r.URL.Path)))
+	}))
+	defer aggregator.Close()
+
+	c, _ := newFakeChainClient("test-close")
+	c.config.aggregatorUrl = aggregator.URL
+	c.config.httpTimeout = time.Second
+	ctx := context.Background()
+	if _, err := get_file(ctx, c.config, "", blobCoding{}, "blobA"); err != nil {
+		t.Fatal(err)
+	}
+	httpClient := c.config.getHttpClient()
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt"}, expires)
+	listings.putList(c.config.root, "/dir", []ListDirFileItem{{Name: "b.txt"}}, expires)
+	listings.putStat("test-close-other", "/a.txt", &ListDirFileItem{Name: "a.txt"}, expires)
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.config.httpClient != nil || c.config.suiClient != nil {
+		t.Errorf("Close kept the http client %v and the sui client %v", c.config.httpClient, c.config.suiClient)
+	}
+	now := time.Now()
+	if _, ok := listings.getStat(c.config.root, "/a.txt", now); ok {
+		t.Errorf("Close kept the cached stat of the root")
+	}
+	if _, ok := listings.getList(c.config.root, "/dir", now); ok {
+		t.Errorf("Close kept the cached listing of the root")
+	}
+	if _, ok := listings.getStat("test-close-other", "/a.txt", now); !ok {
+		t.Errorf("Close dropped the cache of another root")
+	}
+	// a closed client starts over
+	if b, err := get_file(ctx, c.config, "", blobCoding{}, "blobA"); err != nil || string(b) != "content of blobA" {
+		t.Errorf("get_file after Close: got %q, %v", b, err)
+	}
+	if c.config.getHttpClient() == httpClient {
+		t.Errorf("the http client was not created again after Close")
+	}
+}
+
+// TestConcurrentUse is meant for go test -race, it calls one client from many goroutines while its sui and http
+// clients are still to be created
+func TestConcurrentUse(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("content of " + fspath.Base(r.URL.Path)))
+	}))
+	defer aggregator.Close()
+
+	item, err := bcs.Marshal(ListDirFileItem{Name: "new.txt", Size: 16, WalrusBlobId: "blobN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, chain := newFakeChainClient("test-concurrent-use")
+	chain.inspectReturn = item
+	c.config.pkg = testRootId
+	c.config.aggregatorUrl = aggregator.URL
+	c.config.httpTimeout = time.Second
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/dir/a.txt", &ListDirFileItem{Name: "a.txt", Size: 16, WalrusBlobId: "blobA"}, expires)
+	listings.putList(c.config.root, "/dir", []ListDirFileItem{{Name: "a.txt", Size: 16, WalrusBlobId: "blobA"}}, expires)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*16)
+	for i := 0; i < 16; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			// not cached, so it goes to the chain and fills the cache
+			if info, err := c.Stat(ctx, walrusConn("/dir/new.txt")); err != nil || info.NotFound {
+				errs <- fmt.Errorf("Stat: %+v, %v", info, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if entries, err := c.ListEntries(ctx, walrusConn("/dir"), nil); err != nil || len(entries) != 1 {
+				errs <- fmt.Errorf("ListEntries: %v, %v", entries, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			data, err := c.Read(ctx, walrusConn("/dir/a.txt"), wshrpc.FileData{})
+			if err != nil {
+				errs <- fmt.Errorf("Read: %v", err)
+				return
+			}
+			if b, _ := base64.StdEncoding.DecodeString(data.Data64); string(b) != "content of blobA" {
+				errs <- fmt.Errorf("Read: got %q", b)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestShareLink(t *testing.T) {
+	t.Parallel()
+
+	status := http.StatusOK
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer aggregator.Close()
+
+	c, _ := newFakeChainClient("test-share-link")
+	c.config.aggregatorUrl = aggregator.URL
+	c.config.httpTimeout = time.Second
+	expires := time.Now().Add(time.Hour)
+	listings.putStat(c.config.root, "/a.txt", &ListDirFileItem{Name: "a.txt", Size: 3, WalrusBlobId: "blobA"}, expires)
+	listings.putStat(c.config.root, "/big.bin", &ListDirFileItem{Name: "big.bin", Size: 3, WalrusBlobId: "blob1", WalrusBlobIds: []string{"blob1", "blob2"}}, expires)
+	listings.putStat(c.config.root, "/dir", &ListDirFileItem{Name: "dir", IsDir: true}, expires)
+	listings.putStat(c.config.root, "/secret.txt", &ListDirFileItem{Name: "secret.txt", Size: 3, WalrusBlobId: "blobS", Encrypted: true}, expires)
+	listings.putStat(c.config.root, "/log.txt", &ListDirFileItem{Name: "log.txt", Size: 3, WalrusBlobId: "blobL", Compression: CompressionZstd}, expires)
+	listings.putStat(c.config.root, "/missing.txt", nil, expires)
+	ctx := context.Background()
+
+	if link, err := c.ShareLink(ctx, walrusConn("/a.txt"), true); err != nil || link != aggregator.URL+"/v1/blobs/blobA" {
+		t.Errorf("got link %q, %v", link, err)
+	}
+	status = http.StatusNotFound
+	if _, err := c.ShareLink(ctx, walrusConn("/a.txt"), true); !errors.Is(err, ErrBlobExpired) {
+		t.Errorf("got error %v for an expired blob, want ErrBlobExpired", err)
+	}
+	if link, err := c.ShareLink(ctx, walrusConn("/a.txt"), false); err != nil || link == "" {
+		t.Errorf("got link %q, %v without checking the blob", link, err)
+	}
+	for _, path := range []string{"/big.bin", "/dir", "/secret.txt", "/log.txt"} {
+		if _, err := c.ShareLink(ctx, walrusConn(path), false); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+	if _, err := c.ShareLink(ctx, walrusConn("/missing.txt"), false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing file, want ErrNotFound", err)
+	}
+}
+
+func TestReadBlob(t *testing.T) {
+	t.Parallel()
+
+	aggregator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/blobs/blobA" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello walrus"))
+	}))
+	defer aggregator.Close()
+
+	// the client has no chain to look anything up on
+	c := WalrusClient{config: &WalrusFsConfig{root: "test-read-blob", aggregatorUrl: aggregator.URL, httpTimeout: time.Second}}
+	ctx := context.Background()
+	if b, err := c.ReadBlob(ctx, "blobA"); err != nil || string(b) != "hello walrus" {
+		t.Errorf("ReadBlob: got %q, %v", b, err)
+	}
+	body, err := c.ReadBlobStream(ctx, "blobA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(b) != "hello walrus" {
+		t.Errorf("ReadBlobStream: got %q, %v", b, err)
+	}
+	if _, err := c.ReadBlob(ctx, "gone"); !errors.Is(err, ErrBlobExpired) {
+		t.Errorf("got error %v for a missing blob, want ErrBlobExpired", err)
+	}
+	for _, blobId := range []string{"", "../blobA", "blobA?x"} {
+		if _, err := c.ReadBlobStream(ctx, blobId); err == nil {
+			t.Errorf("blob id %q was accepted", blobId)
+		}
+	}
+}
@@ -14,20 +14,23 @@ import (
 )
 
 var ValidEventNames = map[string]bool{
-	"app:startup":        true,
-	"app:shutdown":       true,
-	"app:activity":       true,
-	"app:display":        true,
-	"app:counts":         true,
-	"action:magnify":     true,
-	"action:settabtheme": true,
-	"action:runaicmd":    true,
-	"action:createtab":   true,
-	"action:createblock": true,
-	"wsh:run":            true,
-	"debug:panic":        true,
-	"conn:connect":       true,
-	"conn:connecterror":  true,
+	"app:startup":         true,
+	"app:shutdown":        true,
+	"app:activity":        true,
+	"app:display":         true,
+	"app:counts":          true,
+	"action:magnify":      true,
+	"action:settabtheme":  true,
+	"action:runaicmd":     true,
+	"action:createtab":    true,
+	"action:createblock":  true,
+	"action:walruscopy":   true,
+	"action:walrusmove":   true,
+	"action:walrusdelete": true,
+	"wsh:run":             true,
+	"debug:panic":         true,
+	"conn:connect":        true,
+	"conn:connecterror":   true,
 }
 
 type TEvent struct {
@@ -72,6 +75,10 @@ type TEventProps struct {
 	WshHadError     bool   `json:"wsh:haderror,omitempty"`
 	ConnType        string `json:"conn:conntype,omitempty"`
 
+	WalrusDirection string `json:"walrus:direction,omitempty" tstype:"\"local->walrus\" | \"walrus->local\" | \"walrus->walrus\""`
+	WalrusFiles     int    `json:"walrus:files,omitempty"`
+	WalrusBytes     int64  `json:"walrus:bytes,omitempty"`
+
 	DisplayHeight int         `json:"display:height,omitempty"`
 	DisplayWidth  int         `json:"display:width,omitempty"`
 	DisplayDPR    float64     `json:"display:dpr,omitempty"`
@@ -205,7 +205,7 @@ type FsFileInfo struct {
 	NameInternal    string
 	ModeInternal    os.FileMode
 	SizeInternal    int64
-	ModTimeInternal int64
+	ModTimeInternal int64 // unix time in milliseconds, as wshrpc.FileInfo.ModTime
 	IsDirInternal   bool
 }
 
@@ -222,7 +222,7 @@ func (f FsFileInfo) Mode() os.FileMode {
 }
 
 func (f FsFileInfo) ModTime() time.Time {
-	return time.Unix(0, f.ModTimeInternal)
+	return time.UnixMilli(f.ModTimeInternal)
 }
 
 func (f FsFileInfo) IsDir() bool {
@@ -34,12 +34,21 @@ type anthropicRequest struct {
 	MaxTokens   int                `json:"max_tokens,omitempty"`
 	Stream      bool               `json:"stream"`
 	Temperature float32            `json:"temperature,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
 }
 
 // Claude API response types for SSE events
 type anthropicContentBlock struct {
-	Type string `json:"type"` // "text" or other content types
+	Type string `json:"type"` // "text", "tool_use" or other content types
 	Text string `json:"text,omitempty"`
+	ID   string `json:"id,omitempty"`   // tool_use only
+	Name string `json:"name,omitempty"` // tool_use only
 }
 
 type anthropicUsage struct {
@@ -64,7 +73,9 @@ type anthropicStreamEventError struct {
 }
 
 type anthropicStreamEventDelta struct {
-	Text string `json:"text"`
+	Type        string `json:"type"` // "text_delta" or "input_json_delta"
+	Text        string `json:"text"`
+	PartialJSON string `json:"partial_json"`
 }
 
 type anthropicStreamEvent struct {
@@ -162,6 +173,13 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Wav
 			Stream:    true,
 			MaxTokens: request.Opts.MaxTokens,
 		}
+		if walrusToolEnabled(ctx) {
+			anthropicReq.Tools = []anthropicTool{{
+				Name:        WalrusFileOperationTool,
+				Description: walrusFileOperationToolDesc,
+				InputSchema: walrusToolSchema(),
+			}}
+		}
 
 		reqBody, err := json.Marshal(anthropicReq)
 		if err != nil {
@@ -195,6 +213,9 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Wav
 		}
 
 		reader := bufio.NewReader(resp.Body)
+		// the tool_use block being streamed, its input arrives as partial json
+		var toolBlock *anthropicContentBlock
+		var toolInput strings.Builder
 		for {
 			// Check for context cancellation
 			select {
@@ -237,23 +258,31 @@ func (AnthropicBackend) StreamCompletion(ctx context.Context, request wshrpc.Wav
 				}
 
 			case "content_block_start":
-				if event.ContentBlock != nil && event.ContentBlock.Text != "" {
+				if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+					toolBlock = event.ContentBlock
+					toolInput.Reset()
+				} else if event.ContentBlock != nil && event.ContentBlock.Text != "" {
 					pk := MakeWaveAIPacket()
 					pk.Text = event.ContentBlock.Text
 					rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *pk}
 				}
 
 			case "content_block_delta":
-				if event.Delta != nil && event.Delta.Text != "" {
+				if event.Delta != nil && event.Delta.Type == "input_json_delta" {
+					toolInput.WriteString(event.Delta.PartialJSON)
+				} else if event.Delta != nil && event.Delta.Text != "" {
 					pk := MakeWaveAIPacket()
 					pk.Text = event.Delta.Text
 					rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *pk}
 				}
 
 			case "content_block_stop":
-				// Note: According to the docs, this just signals the end of a content block
-				// We might want to use this for tracking block boundaries, but for now
-				// we don't need to send anything special to match OpenAI's format
+				// Note: According to the docs, this just signals the end of a content block,
+				// only a finished tool_use block needs anything done
+				if toolBlock != nil {
+					rtn <- runWalrusToolCall(ctx, toolBlock.Name, toolInput.String())
+					toolBlock = nil
+				}
 
 			case "message_delta":
 				// Update message metadata, usage stats
@@ -122,7 +122,7 @@ func (WaveAICloudBackend) StreamCompletion(ctx context.Context, request wshrpc.W
 				// got eof packet from socket
 				fullmsg = strings.TrimPrefix(fullmsg, " ")
 				if strings.HasPrefix(fullmsg, "```") {
-					s, err := fileop.FileOperation(fullmsg)
+					s, err := fileop.FileOperation(ctx, fullmsg)
 					if err == nil {
 						streamResp.Text = s
 						rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *streamResp}
@@ -29,9 +29,32 @@ func (GoogleBackend) StreamCompletion(ctx context.Context, request wshrpc.WaveAI
 		return nil
 	}
 
+	if walrusToolEnabled(ctx) {
+		model.Tools = []*genai.Tool{googleWalrusTool()}
+	}
+
+	// system messages, like the walrus prompt, go in the system instruction rather than the chat
+	var prompt []wshrpc.WaveAIPromptMessageType
+	var system []genai.Part
+	for _, p := range request.Prompt {
+		if p.Role == "system" {
+			system = append(system, genai.Text(p.Content))
+			continue
+		}
+		prompt = append(prompt, p)
+	}
+	if len(prompt) == 0 {
+		log.Println("no prompt to send")
+		client.Close()
+		return nil
+	}
+	if len(system) > 0 {
+		model.SystemInstruction = &genai.Content{Parts: system}
+	}
+
 	cs := model.StartChat()
-	cs.History = extractHistory(request.Prompt)
-	iter := cs.SendMessageStream(ctx, extractPrompt(request.Prompt))
+	cs.History = extractHistory(prompt)
+	iter := cs.SendMessageStream(ctx, extractPrompt(prompt))
 
 	rtn := make(chan wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType])
 
@@ -57,6 +80,9 @@ func (GoogleBackend) StreamCompletion(ctx context.Context, request wshrpc.WaveAI
 			}
 
 			rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: wshrpc.WaveAIPacketType{Text: convertCandidatesToText(resp.Candidates)}}
+			for _, fc := range extractFunctionCalls(resp.Candidates) {
+				rtn <- runGoogleWalrusToolCall(ctx, fc)
+			}
 		}
 	}()
 	return rtn
@@ -83,9 +109,30 @@ func extractPrompt(prompt []wshrpc.WaveAIPromptMessageType) genai.Part {
 func convertCandidatesToText(candidates []*genai.Candidate) string {
 	var rtn string
 	for _, c := range candidates {
+		if c.Content == nil {
+			continue
+		}
 		for _, p := range c.Content.Parts {
+			if _, ok := p.(genai.FunctionCall); ok {
+				continue
+			}
 			rtn += fmt.Sprintf("%v", p)
 		}
 	}
 	return rtn
 }
+
+func extractFunctionCalls(candidates []*genai.Candidate) []genai.FunctionCall {
+	var rtn []genai.FunctionCall
+	for _, c := range candidates {
+		if c.Content == nil {
+			continue
+		}
+		for _, p := range c.Content.Parts {
+			if fc, ok := p.(genai.FunctionCall); ok {
+				rtn = append(rtn, fc)
+			}
+		}
+	}
+	return rtn
+}
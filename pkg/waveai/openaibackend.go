@@ -8,7 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	openaiapi "github.com/sashabaranov/go-openai"
@@ -29,7 +31,7 @@ func defaultAzureMapperFn(model string) string {
 
 func setApiType(opts *wshrpc.WaveAIOptsType, clientConfig *openaiapi.ClientConfig) error {
 	ourApiType := strings.ToLower(opts.APIType)
-	if ourApiType == "" || ourApiType == APIType_OpenAI || ourApiType == strings.ToLower(string(openaiapi.APITypeOpenAI)) {
+	if ourApiType == "" || ourApiType == APIType_OpenAI || ourApiType == ApiType_Ollama || ourApiType == strings.ToLower(string(openaiapi.APITypeOpenAI)) {
 		clientConfig.APIType = openaiapi.APITypeOpenAI
 		return nil
 	} else if ourApiType == strings.ToLower(string(openaiapi.APITypeAzure)) {
@@ -105,6 +107,16 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.WaveAI
 			Model:    request.Opts.Model,
 			Messages: convertPrompt(request.Prompt),
 		}
+		if walrusToolEnabled(ctx) {
+			req.Tools = []openaiapi.Tool{{
+				Type: openaiapi.ToolTypeFunction,
+				Function: &openaiapi.FunctionDefinition{
+					Name:        WalrusFileOperationTool,
+					Description: walrusFileOperationToolDesc,
+					Parameters:  walrusToolSchema(),
+				},
+			}}
+		}
 
 		// Handle o1 models differently - use non-streaming API
 		if strings.HasPrefix(request.Opts.Model, "o1-") {
@@ -131,6 +143,9 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.WaveAI
 				pk.Text = choice.Message.Content
 				pk.FinishReason = string(choice.FinishReason)
 				rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *pk}
+				for _, call := range choice.Message.ToolCalls {
+					rtn <- runOpenAIToolCall(ctx, i, call)
+				}
 			}
 			return
 		}
@@ -143,14 +158,26 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.WaveAI
 		}
 
 		apiResp, err := client.CreateChatCompletionStream(ctx, req)
+		// without the tool the model is asked for fenced json, whose text is kept to run it at the end
+		var fencedText map[int]string
+		if err != nil && req.Tools != nil && toolsRejected(request.Opts, err) {
+			req.Tools = nil
+			req.Messages = convertPrompt(withoutWalrusToolPrompt(request.Prompt))
+			fencedText = make(map[int]string)
+			apiResp, err = client.CreateChatCompletionStream(ctx, req)
+		}
 		if err != nil {
 			rtn <- makeAIError(fmt.Errorf("error calling openai API: %v", err))
 			return
 		}
 		sentHeader := false
+		// tool calls stream in pieces, keyed by choice index and then by their own index
+		toolCalls := make(map[int][]openaiapi.ToolCall)
 		for {
 			streamResp, err := apiResp.Recv()
 			if err == io.EOF {
+				runOpenAIToolCalls(ctx, rtn, toolCalls)
+				runFencedFileOperations(ctx, rtn, fencedText)
 				break
 			}
 			if err != nil {
@@ -170,8 +197,74 @@ func (OpenAIBackend) StreamCompletion(ctx context.Context, request wshrpc.WaveAI
 				pk.Text = choice.Delta.Content
 				pk.FinishReason = string(choice.FinishReason)
 				rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *pk}
+				for _, delta := range choice.Delta.ToolCalls {
+					toolCalls[choice.Index] = mergeToolCallDelta(toolCalls[choice.Index], delta)
+				}
+				if fencedText != nil {
+					fencedText[choice.Index] += choice.Delta.Content
+				}
 			}
 		}
 	}()
 	return rtn
 }
+
+// toolsRejected reports whether an ollama model answered a request offering the walrus tool with a 400, which many
+// models without tool support do
+func toolsRejected(opts *wshrpc.WaveAIOptsType, err error) bool {
+	if opts.APIType != ApiType_Ollama {
+		return false
+	}
+	var apiErr *openaiapi.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusBadRequest
+	}
+	var reqErr *openaiapi.RequestError
+	return errors.As(err, &reqErr) && reqErr.HTTPStatusCode == http.StatusBadRequest
+}
+
+// mergeToolCallDelta adds a streamed tool call chunk to the calls of a choice, the first chunk of a call carries its
+// name and the rest append to its arguments
+func mergeToolCallDelta(calls []openaiapi.ToolCall, delta openaiapi.ToolCall) []openaiapi.ToolCall {
+	idx := len(calls) - 1
+	if delta.Index != nil {
+		idx = *delta.Index
+	} else if delta.ID != "" || idx < 0 {
+		// without an index a chunk with an id starts the next call
+		idx = len(calls)
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	for len(calls) <= idx {
+		calls = append(calls, openaiapi.ToolCall{})
+	}
+	if delta.ID != "" {
+		calls[idx].ID = delta.ID
+	}
+	if delta.Function.Name != "" {
+		calls[idx].Function.Name = delta.Function.Name
+	}
+	calls[idx].Function.Arguments += delta.Function.Arguments
+	return calls
+}
+
+// runOpenAIToolCalls runs the tool calls of a finished stream in choice order
+func runOpenAIToolCalls(ctx context.Context, rtn chan wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType], toolCalls map[int][]openaiapi.ToolCall) {
+	choices := make([]int, 0, len(toolCalls))
+	for choiceIdx := range toolCalls {
+		choices = append(choices, choiceIdx)
+	}
+	sort.Ints(choices)
+	for _, choiceIdx := range choices {
+		for _, call := range toolCalls[choiceIdx] {
+			rtn <- runOpenAIToolCall(ctx, choiceIdx, call)
+		}
+	}
+}
+
+func runOpenAIToolCall(ctx context.Context, choiceIdx int, call openaiapi.ToolCall) wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType] {
+	resp := runWalrusToolCall(ctx, call.Function.Name, call.Function.Arguments)
+	resp.Response.Index = choiceIdx
+	return resp
+}
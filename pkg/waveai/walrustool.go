@@ -0,0 +1,191 @@
+// Copyright 2025, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package waveai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fileop"
+	"github.com/wavetermdev/waveterm/pkg/userinput"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// WalrusFileOperationTool is the tool backends with function calling get instead of asking the model for fenced json
+const WalrusFileOperationTool = "walrus_file_operation"
+
+const walrusFileOperationToolDesc = "Copy, move, rename or delete files and directories between walrus and the local filesystem. " +
+	"Walrus paths start with walrus://, at least one of src and dst has to be a walrus path. " +
+	"Deletes and moves between walrus and the local filesystem are confirmed by the user before they run."
+
+// walrusToolPrompt is added after the walrus prompt for backends that get the tool, it takes precedence over the
+// fenced json the prompt asks for
+const walrusToolPrompt = "Call the " + WalrusFileOperationTool + " tool for file operations on walrus instead of responding with json."
+
+type walrusToolCtxKey struct{}
+
+// withWalrusTool marks a request as one where the backend should offer the walrus_file_operation tool
+func withWalrusTool(ctx context.Context) context.Context {
+	return context.WithValue(ctx, walrusToolCtxKey{}, true)
+}
+
+func walrusToolEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(walrusToolCtxKey{}).(bool)
+	return enabled
+}
+
+// walrusToolSchema is the json schema of the tool arguments, it's what fileop.FileOperationJSON accepts
+func walrusToolSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"operation": map[string]any{
+				"type":        "string",
+				"enum":        []string{"copy", "move", "rename", "delete"},
+				"description": "the file operation to run",
+			},
+			"src": map[string]any{
+				"type":        "string",
+				"description": "source path of a copy, move or rename",
+			},
+			"dst": map[string]any{
+				"type":        "string",
+				"description": "destination path of a copy, move or rename, a rename can give just the new name",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "walrus path to delete",
+			},
+			"dryrun": map[string]any{
+				"type":        "boolean",
+				"description": "only describe what a copy would do without doing it",
+			},
+			"contents": map[string]any{
+				"type":        "boolean",
+				"description": "copy what is inside a local source directory rather than the directory itself",
+			},
+			"conflict": map[string]any{
+				"type":        "string",
+				"enum":        []string{"fail", "skip", "overwrite", "rename"},
+				"description": "what a copy does with destination files that already exist, fail when not given",
+			},
+			"manifest": map[string]any{
+				"type":        "string",
+				"description": "local file a copy to walrus writes the size, blob ids and sha256 of each uploaded file to, to verify them later",
+			},
+		},
+		"required": []string{"operation"},
+	}
+}
+
+// googleWalrusTool is walrusToolSchema in the shape genai wants
+func googleWalrusTool() *genai.Tool {
+	str := func(desc string) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeString, Description: desc}
+	}
+	return &genai.Tool{
+		FunctionDeclarations: []*genai.FunctionDeclaration{{
+			Name:        WalrusFileOperationTool,
+			Description: walrusFileOperationToolDesc,
+			Parameters: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"operation": {Type: genai.TypeString, Format: "enum", Enum: []string{"copy", "move", "rename", "delete"}, Description: "the file operation to run"},
+					"src":       str("source path of a copy, move or rename"),
+					"dst":       str("destination path of a copy, move or rename, a rename can give just the new name"),
+					"path":      str("walrus path to delete"),
+					"dryrun":    {Type: genai.TypeBoolean, Description: "only describe what a copy would do without doing it"},
+					"contents":  {Type: genai.TypeBoolean, Description: "copy what is inside a local source directory rather than the directory itself"},
+					"conflict":  {Type: genai.TypeString, Format: "enum", Enum: []string{"fail", "skip", "overwrite", "rename"}, Description: "what a copy does with destination files that already exist, fail when not given"},
+					"manifest":  str("local file a copy to walrus writes the size, blob ids and sha256 of each uploaded file to, to verify them later"),
+				},
+				Required: []string{"operation"},
+			},
+		}},
+	}
+}
+
+// confirmFileOperation asks the user in the ui whether a file operation the model asked for may delete files
+func confirmFileOperation(ctx context.Context, title string, text string) (bool, error) {
+	ctx, cancelFn := context.WithTimeout(ctx, 60*time.Second)
+	defer cancelFn()
+	resp, err := userinput.GetUserInput(ctx, &userinput.UserInputRequest{
+		ResponseType: "confirm",
+		QueryText:    text,
+		Title:        title,
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Confirm, nil
+}
+
+// runWalrusToolCall runs a tool call made by the model and returns the packet reporting its result
+func runWalrusToolCall(ctx context.Context, name string, args string) wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType] {
+	if name != WalrusFileOperationTool {
+		return makeAIError(fmt.Errorf("model called unknown tool %q", name))
+	}
+	if args == "" {
+		args = "{}"
+	}
+	s, err := fileop.FileOperationJSON(ctx, args)
+	if err != nil {
+		return makeAIError(err)
+	}
+	pk := MakeWaveAIPacket()
+	pk.Text = s
+	return wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *pk}
+}
+
+// runGoogleWalrusToolCall runs a genai function call, its arguments come already decoded
+func runGoogleWalrusToolCall(ctx context.Context, fc genai.FunctionCall) wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType] {
+	args, err := json.Marshal(fc.Args)
+	if err != nil {
+		return makeAIError(fmt.Errorf("cannot encode %s arguments: %w", fc.Name, err))
+	}
+	return runWalrusToolCall(ctx, fc.Name, string(args))
+}
+
+// withoutWalrusToolPrompt returns prompt with the tool instruction taken out of its system messages, for a request
+// without the tool that falls back to the fenced json the walrus prompt asks for
+func withoutWalrusToolPrompt(prompt []wshrpc.WaveAIPromptMessageType) []wshrpc.WaveAIPromptMessageType {
+	rtn := make([]wshrpc.WaveAIPromptMessageType, len(prompt))
+	for i, msg := range prompt {
+		if msg.Role == "system" {
+			msg.Content = strings.Replace(msg.Content, "\n"+walrusToolPrompt, "", 1)
+		}
+		rtn[i] = msg
+	}
+	return rtn
+}
+
+// runFencedFileOperations runs the fenced json file operations that choices without the tool responded with, in
+// choice order. Choices that aren't fenced json are left alone
+func runFencedFileOperations(ctx context.Context, rtn chan wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType], texts map[int]string) {
+	choices := make([]int, 0, len(texts))
+	for choiceIdx := range texts {
+		choices = append(choices, choiceIdx)
+	}
+	sort.Ints(choices)
+	for _, choiceIdx := range choices {
+		text := strings.TrimSpace(texts[choiceIdx])
+		if !strings.HasPrefix(text, "```") {
+			continue
+		}
+		s, err := fileop.FileOperation(ctx, text)
+		if err != nil {
+			rtn <- makeAIError(err)
+			continue
+		}
+		pk := MakeWaveAIPacket()
+		pk.Index = choiceIdx
+		pk.Text = s
+		rtn <- wshrpc.RespOrErrorUnion[wshrpc.WaveAIPacketType]{Response: *pk}
+	}
+}
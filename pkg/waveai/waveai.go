@@ -5,11 +5,21 @@ package waveai
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"path"
+	"slices"
+	"strings"
 
+	"github.com/wavetermdev/waveterm/pkg/remote/connparse"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/fileop"
+	"github.com/wavetermdev/waveterm/pkg/remote/fileshare/walrusfs"
 	"github.com/wavetermdev/waveterm/pkg/telemetry"
 	"github.com/wavetermdev/waveterm/pkg/telemetry/telemetrydata"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wconfig"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wstore"
 )
 
 const WaveAIPacketstr = "waveai"
@@ -17,6 +27,24 @@ const ApiType_Anthropic = "anthropic"
 const ApiType_Perplexity = "perplexity"
 const APIType_Google = "google"
 const APIType_OpenAI = "openai"
+const ApiType_Ollama = "ollama"
+
+// DefaultOllamaBaseURL is the OpenAI compatible endpoint of a local ollama, used when ai:baseurl isn't set
+const DefaultOllamaBaseURL = "http://localhost:11434/v1"
+
+// DefaultWalrusPrompt is the system message sent with ai:walrusprompt, it explains walrus and how to ask for the
+// file operations that fileop.FileOperation carries out. ai:walrusprompttext replaces it
+const DefaultWalrusPrompt = `Aside from being a mammal, Walrus also refers to a novel approach to decentralized blob storage, built to operate on top of the Sui blockchain. It’s designed to provide robust, efficient, and scalable storage for decentralized applications (dApps) that require high levels of integrity, availability, and authenticity for their data. Unlike traditional decentralized storage systems that rely on full replication, Walrus optimizes data storage with a new encoding protocol that minimizes replication costs while ensuring data reliability even under byzantine fault conditions. Please tell the difference based on conversation context." \
+			If user asks for file operations between walrus and/or local filesystem, please respond with json including following items: operation type (copy, move, rename or delete), source path, destination path. A delete only needs the path to delete, the user is asked to confirm it before it runs. Add "dryrun": true to a copy when the user only wants to see what it would do. A local directory is copied into the destination as a directory of the same name, add "contents": true to a copy when the user wants what is inside it copied instead. A move between walrus and the local filesystem only moves a single file and deletes it once it is copied, the user is asked to confirm it before it runs so just respond with the json. The json should start and end with markdown token. Some examples: 
+			1. User input: "please copy local folder ~/Downloads/test to /temp on walrus", your response: '\u0060\u0060\u0060{"operation": "copy", "src": "~/Downloads/test", "dst": "walrus://temp"}\u0060\u0060\u0060'
+			2. User input: "I'd like to copy walrus://temp/file.png to ~/Downloads", your response: '\u0060\u0060\u0060{"operation": "copy", "src": "walrus://temp/file.png", "dst": "~/Downloads"}\u0060\u0060\u0060'
+			3. User input: "copy walrus://docs/report.pdf to walrus://backup", your response: '\u0060\u0060\u0060{"operation": "copy", "src": "walrus://docs/report.pdf", "dst": "walrus://backup"}\u0060\u0060\u0060'
+			4. User input: "move walrus://a/x to walrus://b/x", your response: '\u0060\u0060\u0060{"operation": "move", "src": "walrus://a/x", "dst": "walrus://b/x"}\u0060\u0060\u0060'
+			5. User input: "move ~/Downloads/report.pdf to walrus://docs", your response: '\u0060\u0060\u0060{"operation": "move", "src": "~/Downloads/report.pdf", "dst": "walrus://docs"}\u0060\u0060\u0060'
+			6. User input: "rename walrus://docs/draft.txt to final.txt", your response: '\u0060\u0060\u0060{"operation": "rename", "src": "walrus://docs/draft.txt", "dst": "walrus://docs/final.txt"}\u0060\u0060\u0060'
+			7. User input: "delete walrus://temp/old.log", your response, which the user is asked to confirm: '\u0060\u0060\u0060{"operation": "delete", "path": "walrus://temp/old.log"}\u0060\u0060\u0060'
+			8. User input: "what would copying ~/photos to walrus://photos upload?", your response: '\u0060\u0060\u0060{"operation": "copy", "src": "~/photos", "dst": "walrus://photos", "dryrun": true}\u0060\u0060\u0060'
+			`
 
 type WaveAICmdInfoPacketOutputType struct {
 	Model        string `json:"model,omitempty"`
@@ -74,6 +102,14 @@ func RunAICommand(ctx context.Context, request wshrpc.WaveAIStreamRequest) chan
 	} else if request.Opts.APIType == APIType_Google {
 		backend = GoogleBackend{}
 		backendType = APIType_Google
+	} else if request.Opts.APIType == ApiType_Ollama {
+		// ollama speaks the openai api and needs no token, it must not fall through to the cloud
+		if request.Opts.BaseURL == "" {
+			request.Opts.BaseURL = DefaultOllamaBaseURL
+			endpoint = DefaultOllamaBaseURL
+		}
+		backend = OpenAIBackend{}
+		backendType = ApiType_Ollama
 	} else if IsCloudAIRequest(request.Opts) {
 		endpoint = "waveterm cloud"
 		request.Opts.APIType = APIType_OpenAI
@@ -95,17 +131,107 @@ func RunAICommand(ctx context.Context, request wshrpc.WaveAIStreamRequest) chan
 		},
 	})
 
-	// add walrus prompt in context
-	request.Prompt = append(request.Prompt, wshrpc.WaveAIPromptMessageType{
-		Role: "system",
-		Content: `Aside from being a mammal, Walrus also refers to a novel approach to decentralized blob storage, built to operate on top of the Sui blockchain. It’s designed to provide robust, efficient, and scalable storage for decentralized applications (dApps) that require high levels of integrity, availability, and authenticity for their data. Unlike traditional decentralized storage systems that rely on full replication, Walrus optimizes data storage with a new encoding protocol that minimizes replication costs while ensuring data reliability even under byzantine fault conditions. Please tell the difference based on conversation context." \
-			If user asks for file operations between walrus and/or local filesystem, please respond with json including following items: operation type, source path, destination path. The json should start and end with markdown token. Some examples: 
-			1. User input: "please copy local folder ~/Downloads/test to /temp on walrus", your response: '\u0060\u0060\u0060{"operation": "copy", "src": "~/Downloads/test", dst: "walrus://temp"}\u0060\u0060\u0060'
-			2. User input: "I'd like to copy walrus://temp/file.png to ~/Downloads", your response: '\u0060\u0060\u0060{"operation": "copy", "src": "walrus://temp/file.png", dst: "~/Downloads"}\u0060\u0060\u0060'
-			`,
-		Name: "",
-	})
+	if prompt := walrusPrompt(); prompt != "" {
+		ctx = fileop.WithConfirm(ctx, confirmFileOperation)
+		if backendSupportsTools(backendType) {
+			// structured tool calls replace the fenced json the prompt asks for
+			prompt += "\n" + walrusToolPrompt
+			ctx = withWalrusTool(ctx)
+		}
+		if cwdPrompt := walrusCwdPrompt(ctx, request.BlockId); cwdPrompt != "" {
+			prompt += "\n" + cwdPrompt
+		}
+		request.Prompt = append(request.Prompt, wshrpc.WaveAIPromptMessageType{
+			Role:    "system",
+			Content: prompt,
+		})
+	}
 
 	log.Printf("sending ai chat message to %s endpoint %q using model %s\n", request.Opts.APIType, endpoint, request.Opts.Model)
 	return backend.StreamCompletion(ctx, request)
 }
+
+// backendSupportsTools reports whether the backend can offer the walrus_file_operation tool, the others fall back to
+// fileop.FileOperation on fenced json. Ollama models without tool support are asked again without it, see
+// toolsRejected
+func backendSupportsTools(backendType string) bool {
+	return backendType == APIType_OpenAI || backendType == ApiType_Ollama || backendType == ApiType_Anthropic || backendType == APIType_Google
+}
+
+// walrusPrompt returns the walrus system message to add to AI requests, "" unless ai:walrusprompt is set and walrusfs
+// is configured
+func walrusPrompt() string {
+	settings := wconfig.GetWatcher().GetFullConfig().Settings
+	if !settings.AiWalrusPrompt {
+		return ""
+	}
+	if err := walrusfs.GetConfig().Validate(); err != nil {
+		return ""
+	}
+	if settings.AiWalrusPromptText != "" {
+		return settings.AiWalrusPromptText
+	}
+	return DefaultWalrusPrompt
+}
+
+// walrusCwdPrompt tells the AI which walrus directory is open next to the chat so a destination like "here" can be
+// resolved, it's "" when the tab of the AI block shows no walrus directory
+func walrusCwdPrompt(ctx context.Context, blockId string) string {
+	dirs := walrusCwds(ctx, blockId)
+	switch len(dirs) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("The current walrus directory is %s, resolve \"here\" and relative walrus paths against it.", dirs[0])
+	default:
+		return fmt.Sprintf("The walrus directories open next to this chat are %s, resolve \"here\" against the one the user means.", strings.Join(dirs, ", "))
+	}
+}
+
+// walrusCwds returns the walrus directories of the preview blocks in the same tab as blockId, a previewed file
+// counts as its parent directory
+func walrusCwds(ctx context.Context, blockId string) []string {
+	if blockId == "" {
+		return nil
+	}
+	tabId, err := wstore.DBFindTabForBlockId(ctx, blockId)
+	if err != nil {
+		log.Printf("cannot find tab for ai block %s: %v\n", blockId, err)
+		return nil
+	}
+	tab, err := wstore.DBGet[*waveobj.Tab](ctx, tabId)
+	if err != nil || tab == nil {
+		return nil
+	}
+	var client *walrusfs.WalrusClient
+	var dirs []string
+	for _, id := range tab.BlockIds {
+		block, err := wstore.DBGet[*waveobj.Block](ctx, id)
+		if err != nil || block == nil {
+			continue
+		}
+		file := block.Meta.GetString(waveobj.MetaKey_File, "")
+		if block.Meta.GetString(waveobj.MetaKey_View, "") != "preview" || !strings.HasPrefix(file, "walrus://") {
+			continue
+		}
+		if client == nil {
+			if client, err = walrusfs.NewWalrusClient(); err != nil {
+				return nil
+			}
+			defer client.Close()
+		}
+		walrusPath := "/" + strings.TrimPrefix(strings.TrimPrefix(file, "walrus://"), "/")
+		fi, err := client.Stat(ctx, &connparse.Connection{Scheme: "walrus", Host: "local", Path: walrusPath})
+		if err != nil || fi.NotFound {
+			continue
+		}
+		if !fi.IsDir {
+			walrusPath = path.Dir(walrusPath)
+		}
+		dir := "walrus://" + strings.TrimPrefix(walrusPath, "/")
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
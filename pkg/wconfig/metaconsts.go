@@ -24,6 +24,8 @@ const (
 	ConfigKey_AiTimeoutMs                    = "ai:timeoutms"
 	ConfigKey_AiFontSize                     = "ai:fontsize"
 	ConfigKey_AiFixedFontSize                = "ai:fixedfontsize"
+	ConfigKey_AiWalrusPrompt                 = "ai:walrusprompt"
+	ConfigKey_AiWalrusPromptText             = "ai:walrusprompttext"
 
 	ConfigKey_TermClear                      = "term:*"
 	ConfigKey_TermFontSize                   = "term:fontsize"
@@ -98,7 +100,37 @@ const (
 	ConfigKey_WalrusFsRoot                   = "walrusfs:root"
 	ConfigKey_WalrusFsPublisher              = "walrusfs:publisher"
 	ConfigKey_WalrusFsAggregator             = "walrusfs:aggregator"
-	ConfigKey_WalrusFsWaallet                = "walrusfs:wallet"
+	ConfigKey_WalrusFsWallet                 = "walrusfs:wallet"
 	ConfigKey_WalrusFsMnemonic               = "walrusfs:mnemonic"
+	ConfigKey_WalrusFsRpcUrl                 = "walrusfs:rpcurl"
+	ConfigKey_WalrusFsStorageEpochs          = "walrusfs:storageepochs"
+	ConfigKey_WalrusFsExpiryWarnEpochs       = "walrusfs:expirywarnepochs"
+	ConfigKey_WalrusFsHttpTimeoutMs          = "walrusfs:httptimeoutms"
+	ConfigKey_WalrusFsPublishers             = "walrusfs:publishers"
+	ConfigKey_WalrusFsTxRetryMaxAttempts     = "walrusfs:txretrymaxattempts"
+	ConfigKey_WalrusFsTxRetryBaseDelayMs     = "walrusfs:txretrybasedelayms"
+	ConfigKey_WalrusFsTxRetryJitter          = "walrusfs:txretryjitter"
+	ConfigKey_WalrusFsCacheTtlMs             = "walrusfs:cachettlms"
+	ConfigKey_WalrusFsCopyConcurrency        = "walrusfs:copyconcurrency"
+	ConfigKey_WalrusFsPrefetchDepth          = "walrusfs:prefetchdepth"
+	ConfigKey_WalrusFsUploadBytesPerSec      = "walrusfs:uploadbytespersec"
+	ConfigKey_WalrusFsDownloadBytesPerSec    = "walrusfs:downloadbytespersec"
+	ConfigKey_WalrusFsChunkSizeMb            = "walrusfs:chunksizemb"
+	ConfigKey_WalrusFsGasBudget              = "walrusfs:gasbudget"
+	ConfigKey_WalrusFsMnemonicSource         = "walrusfs:mnemonicsource"
+	ConfigKey_WalrusFsLogLevel               = "walrusfs:loglevel"
+	ConfigKey_WalrusFsStakingObject          = "walrusfs:stakingobject"
+	ConfigKey_WalrusFsSystemObject           = "walrusfs:systemobject"
+	ConfigKey_WalrusFsDeletable              = "walrusfs:deletable"
+	ConfigKey_WalrusFsVerifyUpload           = "walrusfs:verifyupload"
+	ConfigKey_WalrusFsVerifyAggregators      = "walrusfs:verifyaggregators"
+	ConfigKey_WalrusFsDedupUploads           = "walrusfs:dedupuploads"
+	ConfigKey_WalrusFsReadOnly               = "walrusfs:readonly"
+	ConfigKey_WalrusFsEncryptionKey          = "walrusfs:encryptionkey"
+	ConfigKey_WalrusFsCompression            = "walrusfs:compression"
+	ConfigKey_WalrusFsGasPrice               = "walrusfs:gasprice"
+	ConfigKey_WalrusFsMaxUploadSizeMb        = "walrusfs:maxuploadsizemb"
+	ConfigKey_WalrusFsWaitFinality           = "walrusfs:waitfinality"
+	ConfigKey_WalrusFsRoots                  = "walrusfs:roots"
 )
 
@@ -56,19 +56,21 @@ type SettingsType struct {
 	AppDismissArchitectureWarning bool   `json:"app:dismissarchitecturewarning,omitempty"`
 	AppDefaultNewBlock            string `json:"app:defaultnewblock,omitempty"`
 
-	AiClear         bool    `json:"ai:*,omitempty"`
-	AiPreset        string  `json:"ai:preset,omitempty"`
-	AiApiType       string  `json:"ai:apitype,omitempty"`
-	AiBaseURL       string  `json:"ai:baseurl,omitempty"`
-	AiApiToken      string  `json:"ai:apitoken,omitempty"`
-	AiName          string  `json:"ai:name,omitempty"`
-	AiModel         string  `json:"ai:model,omitempty"`
-	AiOrgID         string  `json:"ai:orgid,omitempty"`
-	AIApiVersion    string  `json:"ai:apiversion,omitempty"`
-	AiMaxTokens     float64 `json:"ai:maxtokens,omitempty"`
-	AiTimeoutMs     float64 `json:"ai:timeoutms,omitempty"`
-	AiFontSize      float64 `json:"ai:fontsize,omitempty"`
-	AiFixedFontSize float64 `json:"ai:fixedfontsize,omitempty"`
+	AiClear            bool    `json:"ai:*,omitempty"`
+	AiPreset           string  `json:"ai:preset,omitempty"`
+	AiApiType          string  `json:"ai:apitype,omitempty"`
+	AiBaseURL          string  `json:"ai:baseurl,omitempty"`
+	AiApiToken         string  `json:"ai:apitoken,omitempty"`
+	AiName             string  `json:"ai:name,omitempty"`
+	AiModel            string  `json:"ai:model,omitempty"`
+	AiOrgID            string  `json:"ai:orgid,omitempty"`
+	AIApiVersion       string  `json:"ai:apiversion,omitempty"`
+	AiMaxTokens        float64 `json:"ai:maxtokens,omitempty"`
+	AiTimeoutMs        float64 `json:"ai:timeoutms,omitempty"`
+	AiFontSize         float64 `json:"ai:fontsize,omitempty"`
+	AiFixedFontSize    float64 `json:"ai:fixedfontsize,omitempty"`
+	AiWalrusPrompt     bool    `json:"ai:walrusprompt,omitempty"`
+	AiWalrusPromptText string  `json:"ai:walrusprompttext,omitempty"`
 
 	TermClear               bool     `json:"term:*,omitempty"`
 	TermFontSize            float64  `json:"term:fontsize,omitempty"`
@@ -138,13 +140,43 @@ type SettingsType struct {
 	ConnAskBeforeWshInstall *bool `json:"conn:askbeforewshinstall,omitempty"`
 	ConnWshEnabled          bool  `json:"conn:wshenabled,omitempty"`
 
-	WalrusFsClear      bool   `json:"walrusfs:*,omitempty"`
-	WalrusFsPackage    string `json:"walrusfs:package,omitempty"`
-	WalrusFsRoot       string `json:"walrusfs:root,omitempty"`
-	WalrusFsPublisher  string `json:"walrusfs:publisher,omitempty"`
-	WalrusFsAggregator string `json:"walrusfs:aggregator,omitempty"`
-	WalrusFsWaallet    string `json:"walrusfs:wallet,omitempty"`
-	WalrusFsMnemonic   string `json:"walrusfs:mnemonic,omitempty"`
+	WalrusFsClear               bool              `json:"walrusfs:*,omitempty"`
+	WalrusFsPackage             string            `json:"walrusfs:package,omitempty"`
+	WalrusFsRoot                string            `json:"walrusfs:root,omitempty"`
+	WalrusFsPublisher           string            `json:"walrusfs:publisher,omitempty"`
+	WalrusFsAggregator          string            `json:"walrusfs:aggregator,omitempty"`
+	WalrusFsWallet              string            `json:"walrusfs:wallet,omitempty"`
+	WalrusFsMnemonic            string            `json:"walrusfs:mnemonic,omitempty"`
+	WalrusFsRpcUrl              string            `json:"walrusfs:rpcurl,omitempty"`
+	WalrusFsStorageEpochs       int               `json:"walrusfs:storageepochs,omitempty"`
+	WalrusFsExpiryWarnEpochs    int               `json:"walrusfs:expirywarnepochs,omitempty"`
+	WalrusFsHttpTimeoutMs       float64           `json:"walrusfs:httptimeoutms,omitempty"`
+	WalrusFsPublishers          []string          `json:"walrusfs:publishers,omitempty"`
+	WalrusFsTxRetryMaxAttempts  int               `json:"walrusfs:txretrymaxattempts,omitempty"`
+	WalrusFsTxRetryBaseDelayMs  float64           `json:"walrusfs:txretrybasedelayms,omitempty"`
+	WalrusFsTxRetryJitter       float64           `json:"walrusfs:txretryjitter,omitempty"`
+	WalrusFsCacheTtlMs          float64           `json:"walrusfs:cachettlms,omitempty"`
+	WalrusFsCopyConcurrency     int               `json:"walrusfs:copyconcurrency,omitempty"`
+	WalrusFsPrefetchDepth       int               `json:"walrusfs:prefetchdepth,omitempty"`
+	WalrusFsUploadBytesPerSec   int64             `json:"walrusfs:uploadbytespersec,omitempty"`
+	WalrusFsDownloadBytesPerSec int64             `json:"walrusfs:downloadbytespersec,omitempty"`
+	WalrusFsChunkSizeMb         int               `json:"walrusfs:chunksizemb,omitempty"`
+	WalrusFsGasBudget           int64             `json:"walrusfs:gasbudget,omitempty"`
+	WalrusFsMnemonicSource      string            `json:"walrusfs:mnemonicsource,omitempty"`
+	WalrusFsLogLevel            string            `json:"walrusfs:loglevel,omitempty"`
+	WalrusFsStakingObject       string            `json:"walrusfs:stakingobject,omitempty"`
+	WalrusFsSystemObject        string            `json:"walrusfs:systemobject,omitempty"`
+	WalrusFsDeletable           bool              `json:"walrusfs:deletable,omitempty"`
+	WalrusFsVerifyUpload        bool              `json:"walrusfs:verifyupload,omitempty"`
+	WalrusFsVerifyAggregators   []string          `json:"walrusfs:verifyaggregators,omitempty"`
+	WalrusFsDedupUploads        bool              `json:"walrusfs:dedupuploads,omitempty"`
+	WalrusFsReadOnly            bool              `json:"walrusfs:readonly,omitempty"`
+	WalrusFsEncryptionKey       string            `json:"walrusfs:encryptionkey,omitempty"`
+	WalrusFsCompression         string            `json:"walrusfs:compression,omitempty"`
+	WalrusFsGasPrice            int64             `json:"walrusfs:gasprice,omitempty"`
+	WalrusFsMaxUploadSizeMb     int               `json:"walrusfs:maxuploadsizemb,omitempty"`
+	WalrusFsWaitFinality        bool              `json:"walrusfs:waitfinality,omitempty"`
+	WalrusFsRoots               map[string]string `json:"walrusfs:roots,omitempty"`
 }
 
 type ConfigError struct {
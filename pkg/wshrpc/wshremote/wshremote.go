@@ -313,6 +313,11 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 	if overwrite && merge {
 		return false, fmt.Errorf("cannot specify both overwrite and merge")
 	}
+	// only copies to walrus go file by file, the other copies don't look at the policy
+	policy, err := walrusfs.CopyConflictPolicy(opts)
+	if err != nil {
+		return false, err
+	}
 
 	destConn, err := connparse.ParseURIAndReplaceCurrentHost(ctx, destUri)
 	if err != nil {
@@ -411,13 +416,13 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 
 	copyDirToWalrus := func(walrus *walrusfs.WalrusClient, destpath string, finfo fs.FileInfo, srcFile string) (int64, error) {
 		conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath}
-		nextinfo, err := walrus.Stat(context.Background(), conn)
+		exists, err := walrus.Exists(context.Background(), conn)
 		if err != nil {
 			return 0, fmt.Errorf("cannot stat file %q: %w", destpath, err)
 		}
-		if nextinfo.NotFound {
-			// try creating the dir
-			err = walrus.Mkdir(context.Background(), conn)
+		if !exists {
+			// create the dir along with any parent the walk has not created yet
+			err = walrus.MkdirAll(context.Background(), conn)
 			if err != nil {
 				return 0, fmt.Errorf("cannot mkdir %q: %w", destpath, err)
 			}
@@ -428,41 +433,34 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 
 	copyFileToWalrus := func(walrus *walrusfs.WalrusClient, destpath string, finfo fs.FileInfo, srcFile string) (int64, error) {
 		conn := &connparse.Connection{Scheme: "walrus", Host: "local", Path: destpath}
-		nextinfo, err := walrus.Stat(context.Background(), conn)
+		destinfo, err := walrus.Stat(context.Background(), conn)
 		if err != nil {
 			return 0, fmt.Errorf("cannot stat file %q: %w", destpath, err)
 		}
-		/*
-			else if nextinfo.NotFound && !finfo.IsDir() {
-				// file copy to existing dir - parent folder not existing
-				return 0, fmt.Errorf("path error")
+		exists := !destinfo.NotFound
+		if destinfo.IsDir {
+			// copy into the existing directory
+			destpath = filepath.Join(destpath, filepath.Base(finfo.Name()))
+			conn.Path = destpath
+			exists, err = walrus.Exists(context.Background(), conn)
+			if err != nil {
+				return 0, fmt.Errorf("cannot stat file %q: %w", destpath, err)
 			}
-		*/
-
-		if nextinfo != nil {
-			if nextinfo.IsDir {
-				// file copy to existing dir
-				// try to create file in directory
-				destpath = filepath.Join(destpath, filepath.Base(finfo.Name()))
-				conn.Path = destpath
-				newdestinfo, err := walrus.Stat(context.Background(), conn)
-				if err != nil {
-					return 0, fmt.Errorf("cannot stat file %q: %w", destpath, err)
-				}
-				if !newdestinfo.NotFound && !overwrite {
-					return 0, fmt.Errorf(fstype.OverwriteRequiredError, destpath)
-				}
-			} else {
-				// file copy
-				if !nextinfo.NotFound {
-					if !overwrite {
-						return 0, fmt.Errorf(fstype.OverwriteRequiredError, destpath)
-					}
-				}
+		}
+		if exists && policy == walrusfs.ConflictFail {
+			return 0, fmt.Errorf(fstype.OverwriteRequiredError, destpath)
+		}
+		if exists {
+			target, skip, err := policy.ResolveConflict(destpath, func(candidate string) (bool, error) {
+				return walrus.Exists(context.Background(), &connparse.Connection{Scheme: "walrus", Host: "local", Path: candidate})
+			}, nil)
+			if err != nil || skip {
+				return 0, err
 			}
+			conn.Path = target
 		}
 
-		err = walrus.Mkfile(context.Background(), srcFile, conn.Path, overwrite)
+		err = walrus.Mkfile(walrusfs.WithPreserveTimes(context.Background(), !opts.NoPreserveTimes), srcFile, conn.Path, nil, policy == walrusfs.ConflictOverwrite, 0)
 		if err != nil {
 			return 0, fmt.Errorf("cannot create walrus file %q: %w", destpath, err)
 		}
@@ -526,7 +524,14 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 		}
 	} else if srcConn.Host == destConn.Host && srcConn.Scheme != connparse.ConnectionTypeWalrus && destConn.Scheme == connparse.ConnectionTypeWalrus {
 		// local -> walrus
-		walrus := walrusfs.NewWalrusClient()
+		walrus, rootConn, err := walrusfs.NewWalrusClientForConn(destConn)
+		if err != nil {
+			return false, err
+		}
+		defer walrus.Close()
+		// a destination under a named root is relative to its object
+		destConn = rootConn
+		destPathCleaned = filepath.Clean(destConn.Path)
 
 		srcPathCleaned := filepath.Clean(wavebase.ExpandHomeDirSafe(srcConn.Path))
 
@@ -541,6 +546,8 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 		}
 		destIsDir = fi.IsDir
 
+		numFiles := 0
+		totalBytes := int64(0)
 		if srcFileStat.IsDir() {
 			srcIsDir = true
 			var srcPathPrefix string
@@ -567,7 +574,10 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 				if info.IsDir() {
 					_, err = copyDirToWalrus(walrus, destFilePath, info, srcFilePath)
 				} else {
-					_, err = copyFileToWalrus(walrus, destFilePath, info, srcFilePath)
+					var n int64
+					n, err = copyFileToWalrus(walrus, destFilePath, info, srcFilePath)
+					numFiles++
+					totalBytes += n
 				}
 				return err
 			})
@@ -591,10 +601,16 @@ func (impl *ServerImpl) RemoteFileCopyCommand(ctx context.Context, data wshrpc.C
 				}
 			*/
 			destFilePath := destPathCleaned
-			_, err = copyFileToWalrus(walrus, destFilePath, srcFileStat, srcPathCleaned)
+			totalBytes, err = copyFileToWalrus(walrus, destFilePath, srcFileStat, srcPathCleaned)
 			if err != nil {
 				return false, fmt.Errorf("cannot copy %q to %q: %w", srcUri, destUri, err)
 			}
+			numFiles = 1
+		}
+		// this may run in a remote wsh, so the event goes to wavesrv to be recorded
+		tevent := walrusfs.MakeOpTEvent(walrusfs.TEventCopy, walrusfs.DirectionLocalToWalrus, numFiles, totalBytes)
+		if err := wshclient.RecordTEventCommand(wshfs.RpcClient, *tevent, &wshrpc.RpcOpts{NoResponse: true}); err != nil {
+			log.Printf("RemoteFileCopyCommand: cannot record telemetry: %v\n", err)
 		}
 	} else if srcConn.Host == destConn.Host && srcConn.Scheme == connparse.ConnectionTypeWalrus && destConn.Scheme != connparse.ConnectionTypeWalrus {
 		// walrus -> local
@@ -410,21 +410,31 @@ type FileData struct {
 }
 
 type FileInfo struct {
-	Path          string      `json:"path"`          // cleaned path (may have "~")
-	Dir           string      `json:"dir,omitempty"` // returns the directory part of the path (if this is a a directory, it will be equal to Path).  "~" will be expanded, and separators will be normalized to "/"
-	Name          string      `json:"name,omitempty"`
-	NotFound      bool        `json:"notfound,omitempty"`
-	Opts          *FileOpts   `json:"opts,omitempty"`
-	Size          int64       `json:"size,omitempty"`
-	Meta          *FileMeta   `json:"meta,omitempty"`
-	Mode          os.FileMode `json:"mode,omitempty"`
-	ModeStr       string      `json:"modestr,omitempty"`
-	ModTime       int64       `json:"modtime,omitempty"`
-	IsDir         bool        `json:"isdir,omitempty"`
-	SupportsMkdir bool        `json:"supportsmkdir,omitempty"`
-	MimeType      string      `json:"mimetype,omitempty"`
-	ReadOnly      bool        `json:"readonly,omitempty"` // this is not set for fileinfo's returned from directory listings
-	WalrusBlobId  string      `json:"walrus_blob_id,omitempty"`
+	Path              string      `json:"path"`          // cleaned path (may have "~")
+	Dir               string      `json:"dir,omitempty"` // returns the directory part of the path (if this is a a directory, it will be equal to Path).  "~" will be expanded, and separators will be normalized to "/"
+	Name              string      `json:"name,omitempty"`
+	NotFound          bool        `json:"notfound,omitempty"`
+	Opts              *FileOpts   `json:"opts,omitempty"`
+	Size              int64       `json:"size,omitempty"`
+	Meta              *FileMeta   `json:"meta,omitempty"`
+	Mode              os.FileMode `json:"mode,omitempty"`
+	ModeStr           string      `json:"modestr,omitempty"`
+	ModTime           int64       `json:"modtime,omitempty"` // unix time in milliseconds, for every file share
+	IsDir             bool        `json:"isdir,omitempty"`
+	SupportsMkdir     bool        `json:"supportsmkdir,omitempty"`
+	MimeType          string      `json:"mimetype,omitempty"`
+	ReadOnly          bool        `json:"readonly,omitempty"` // this is not set for fileinfo's returned from directory listings
+	WalrusBlobId      string      `json:"walrus_blob_id,omitempty"`
+	WalrusBlobIds     []string    `json:"walrus_blob_ids,omitempty"` // set for files stored in chunks, in order
+	ContentSha256     string      `json:"content_sha256,omitempty"`
+	WalrusEpochTill   int64       `json:"walrus_epoch_till,omitempty"`
+	WalrusEpochsLeft  int64       `json:"walrus_epochs_left,omitempty"`
+	WalrusExpiring    bool        `json:"walrus_expiring,omitempty"`    // set when fewer than walrusfs:expirywarnepochs epochs are left
+	WalrusDeletable   bool        `json:"walrus_deletable,omitempty"`   // set when the blobs can be deleted to free their storage
+	WalrusCertified   bool        `json:"walrus_certified,omitempty"`   // unset while the blobs are pending certification and may not be readable yet
+	WalrusEncrypted   bool        `json:"walrus_encrypted,omitempty"`   // set when the blobs hold the content encrypted with walrusfs:encryptionkey
+	WalrusCompression string      `json:"walrus_compression,omitempty"` // the algorithm the blobs were compressed with, Size is still the size of the content
+	Tags              []string    `json:"tags,omitempty"`
 }
 
 type FileOpts struct {
@@ -434,6 +444,7 @@ type FileOpts struct {
 	IJsonBudget int   `json:"ijsonbudget,omitempty"`
 	Truncate    bool  `json:"truncate,omitempty"`
 	Append      bool  `json:"append,omitempty"`
+	Overwrite   bool  `json:"overwrite,omitempty"` // for PutFile, replace the file if it already exists
 }
 
 type FileMeta = map[string]any
@@ -449,7 +460,24 @@ type FileListOpts struct {
 	All    bool `json:"all,omitempty"`
 	Offset int  `json:"offset,omitempty"`
 	Limit  int  `json:"limit,omitempty"`
-}
+	// Cursor continues a truncated listing, it is the cursor returned with the previous page
+	Cursor string `json:"cursor,omitempty"`
+	// Recursive lists the whole subtree instead of a single directory level
+	Recursive bool `json:"recursive,omitempty"`
+	// SortBy orders the entries by one of the FileSort values, by name when it is unset. Ties are ordered by name
+	SortBy string `json:"sortby,omitempty"`
+	// SortDesc reverses the order
+	SortDesc bool `json:"sortdesc,omitempty"`
+	// DirsFirst lists the directories before the files, in either direction
+	DirsFirst bool `json:"dirsfirst,omitempty"`
+}
+
+// the orders of FileListOpts.SortBy
+const (
+	FileSortName    = "name"
+	FileSortSize    = "size"
+	FileSortModTime = "modtime"
+)
 
 type FileCreateData struct {
 	Path string         `json:"path"`
@@ -480,6 +508,7 @@ type CommandEventReadHistoryData struct {
 
 type WaveAIStreamRequest struct {
 	ClientId string                    `json:"clientid,omitempty"`
+	BlockId  string                    `json:"blockid,omitempty"` // the ai block, its tab gives the walrus context
 	Opts     *WaveAIOptsType           `json:"opts"`
 	Prompt   []WaveAIPromptMessageType `json:"prompt"`
 }
@@ -550,6 +579,19 @@ type FileCopyOpts struct {
 	Recursive bool  `json:"recursive,omitempty"` // only used for move, always true for copy
 	Merge     bool  `json:"merge,omitempty"`
 	Timeout   int64 `json:"timeout,omitempty"`
+	// record the time of the copy instead of keeping the modification times of the source files
+	NoPreserveTimes bool `json:"nopreservetimes,omitempty"`
+	// what to do with destination files that exist: fail, skip, overwrite or rename, empty fails unless Overwrite is set
+	ConflictPolicy string `json:"conflictpolicy,omitempty"`
+
+	Progress func(FileCopyProgress) `json:"-"` // optional, called as files of a recursive copy complete
+}
+
+type FileCopyProgress struct {
+	FilesDone  int   `json:"filesdone"`
+	FilesTotal int   `json:"filestotal"`
+	BytesDone  int64 `json:"bytesdone"`
+	BytesTotal int64 `json:"bytestotal"`
 }
 
 type CommandRemoteStreamFileData struct {
@@ -564,6 +606,9 @@ type CommandRemoteListEntriesData struct {
 
 type CommandRemoteListEntriesRtnData struct {
 	FileInfo []*FileInfo `json:"fileinfo,omitempty"`
+	// Truncated is set on the last chunk when the listing stopped at the limit, Cursor then requests the next page
+	Truncated bool   `json:"truncated,omitempty"`
+	Cursor    string `json:"cursor,omitempty"`
 }
 
 type ConnRequest struct {